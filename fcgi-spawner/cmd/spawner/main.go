@@ -1,656 +1,191 @@
+// Command spawner serves FastCGI applications, starting them on demand, and
+// static files. See the spawner package for embedding it in other programs.
 package main
 
 import (
-	"bufio"
+	"context"
 	"flag"
 	"fmt"
-	"io"
-	"log"
-	"net"
+	"log/slog"
 	"net/http"
+	"net/http/pprof"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"strings"
-	"sync"
+	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/fsnotify/fsnotify"
-	fcgiclient "github.com/tomasen/fcgi_client"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/h2c"
+	"github.com/sylee/fcgi-spawner/pkg/spawner"
 )
 
-// Config holds the spawner's configuration.
-type Config struct {
-	WebRoot            string
-	StaticRoot         string
-	SocketDir          string
-	ListenAddr         string
-	DefaultIdleTimeout time.Duration
-}
-
-// loadConfig parses command-line flags and returns a Config struct.
-func loadConfig() *Config {
-	cfg := &Config{}
-	flag.StringVar(&cfg.WebRoot, "webRoot", "/web", "Root directory for web files")
-	flag.StringVar(&cfg.StaticRoot, "staticRoot", "", "Optional root directory for static files. If specified, files in this directory will be served.")
-	flag.StringVar(&cfg.SocketDir, "socketDir", "", "Directory for FastCGI application sockets. If empty, stdio mode is used.")
-	flag.StringVar(&cfg.ListenAddr, "listenAddr", ":8080", "Address for the spawner to listen on (e.g., :8080)")
-	flag.DurationVar(&cfg.DefaultIdleTimeout, "idleTimeout", 5*time.Minute, "Idle timeout for child processes (e.g., 1m, 5m, 1h)")
-	flag.Parse()
-	return cfg
-}
-
-// Spawner manages FastCGI applications and serves static files.
-type Spawner struct {
-	Config           *Config
-	staticFileServer http.Handler
-	childProcessesMu sync.Mutex
-	childProcesses   map[string]*childProcess
-}
-
-// NewSpawner creates and initializes a new Spawner instance.
-func NewSpawner(cfg *Config) *Spawner {
-	s := &Spawner{
-		Config:         cfg,
-		childProcesses: make(map[string]*childProcess),
-	}
-
-	if cfg.StaticRoot != "" {
-		info, err := os.Stat(cfg.StaticRoot)
-		if err != nil {
-			log.Fatalf("Error accessing staticRoot %s: %v", cfg.StaticRoot, err)
-		}
-		if !info.IsDir() {
-			log.Fatalf("staticRoot %s is not a directory", cfg.StaticRoot)
-		}
-		log.Printf("Enabling static file serving from %s", cfg.StaticRoot)
-		s.staticFileServer = http.FileServer(noHiddenFS{http.Dir(cfg.StaticRoot)})
-	}
-	return s
-}
-
-type processInterface interface {
-	Signal(os.Signal) error
-	Wait() (*os.ProcessState, error)
-	Kill() error
-	Pid() int // Add Pid() for logging
-}
-
-type cmdInterface interface {
-	Start() error
-	Process() processInterface
-	ProcessState() *os.ProcessState
-	Path() string // Add Path() for SCRIPT_FILENAME
-}
-
-type childProcess struct {
-	cmd           cmdInterface
-	socketPath    string
-	lastUsed      time.Time
-	binaryPath    string
-	idleTimeout   time.Duration
-	binaryModTime time.Time
-	listener      net.Listener // Add listener for stdio apps
-}
-
-// execCmdWrapper implements cmdInterface for *exec.Cmd
-type execCmdWrapper struct {
-	cmd *exec.Cmd
-}
-
-func (w *execCmdWrapper) Start() error {
-	return w.cmd.Start()
-}
-
-func (w *execCmdWrapper) Process() processInterface {
-	if w.cmd.Process == nil {
-		return nil
-	}
-	return &osProcessWrapper{w.cmd.Process}
-}
-
-func (w *execCmdWrapper) ProcessState() *os.ProcessState {
-	return w.cmd.ProcessState
-}
-
-func (w *execCmdWrapper) Path() string {
-	return w.cmd.Path
-}
-
-// osProcessWrapper implements processInterface for *os.Process
-type osProcessWrapper struct {
-	process *os.Process
-}
-
-func (w *osProcessWrapper) Signal(sig os.Signal) error {
-	return w.process.Signal(sig)
-}
-
-func (w *osProcessWrapper) Wait() (*os.ProcessState, error) {
-	return w.process.Wait()
-}
-
-func (w *osProcessWrapper) Kill() error {
-	return w.process.Kill()
-}
-
-func (w *osProcessWrapper) Pid() int {
-	return w.process.Pid
-}
-
-func (s *Spawner) cleanupChildProcesses() {
-	for {
-		s.childProcessesMu.Lock()
-		for appPath, child := range s.childProcesses {
-			// Check if process is still alive. On Unix, signal 0 can be used to check for existence.
-			// If the process is not alive, an error will be returned.
-			if child.cmd.Process() != nil && child.cmd.Process().Signal(syscall.Signal(0)) != nil {
-				log.Printf("Child process for %s (PID: %d) is no longer running, removing from map.", appPath, child.cmd.Process().Pid())
-				// Wait for the process to ensure it's reaped and doesn't become a zombie
-				if _, err := child.cmd.Process().Wait(); err != nil {
-					log.Printf("Error waiting for child process %d: %v", child.cmd.Process().Pid(), err)
-				}
-				if child.listener != nil {
-					child.listener.Close()
-				} else {
-					if err := os.Remove(child.socketPath); err != nil && !os.IsNotExist(err) {
-						log.Printf("Error removing socket file %s: %v", child.socketPath, err)
-					}
-				}
-				delete(s.childProcesses, appPath)
-				continue // Move to the next child process
-			}
-
-			// Check for idle timeout
-			if s.Config.DefaultIdleTimeout > 0 && time.Since(child.lastUsed) > s.Config.DefaultIdleTimeout {
-				log.Printf("Child process for %s (PID: %d) has been idle for %s, terminating.", appPath, child.cmd.Process().Pid(), time.Since(child.lastUsed).Round(time.Second))
-				_ = child.cmd.Process().Kill() // Terminate the process
-				// Wait for the process to ensure it's reaped and doesn't become a zombie
-				if _, err := child.cmd.Process().Wait(); err != nil {
-					log.Printf("Error waiting for child process %d: %v", child.cmd.Process().Pid(), err)
-				}
-				if child.listener != nil {
-					child.listener.Close()
-				} else {
-					if err := os.Remove(child.socketPath); err != nil && !os.IsNotExist(err) {
-						log.Printf("Error removing socket file %s: %v", child.socketPath, err)
-					}
-				}
-				delete(s.childProcesses, appPath)
-			}
-		}
-		s.childProcessesMu.Unlock()
-		time.Sleep(5 * time.Second) // Check every 5 seconds
-	}
-}
-
-// logStream reads from a stream (stdout/stderr) and logs each line with a prefix.
-func logStream(stream io.ReadCloser, appPath string, pid int, streamName string) {
-	scanner := bufio.NewScanner(stream)
-	for scanner.Scan() {
-		log.Printf("[%s/%d %s] %s", filepath.Base(appPath), pid, streamName, scanner.Text())
-	}
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error reading from %s stream for %s (PID: %d): %v", streamName, appPath, pid, err)
-	}
-}
-
 func main() {
-	cfg := loadConfig() // Load configuration
-	spawner := NewSpawner(cfg)
-
-	// The spawner is a regular HTTP server that will be started by supervisor.
-	// Nginx will proxy requests to this server.
-
-	// Start the cleanup goroutine
-	go spawner.cleanupChildProcesses()
-
-	// Start the file watcher goroutine
-	go spawner.watchFcgiBinaries()
-
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", spawner.spawnerHandler)
-
-	h2s := &http2.Server{}
-	h2cHandler := h2c.NewHandler(mux, h2s)
-
-	server := &http.Server{
-		Addr:    spawner.Config.ListenAddr,
-		Handler: h2cHandler,
+	// Route the log package, used by libraries, through the main logger.
+	slog.SetDefault(spawner.Logger())
+	cfg, mode := loadConfig() // Load configuration
+	if err := spawner.SetLogLevels(cfg.LogLevel); err != nil {
+		fatal("Invalid -logLevel", "error", err)
 	}
-
-	log.Printf("Spawner listening on %s", spawner.Config.ListenAddr)
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatal(err)
+	if mode.check {
+		os.Exit(checkConfig(cfg))
 	}
-}
-
-func (s *Spawner) watchFcgiBinaries() {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatal("Failed to create file watcher:", err)
+	if err := cfg.Validate(); err != nil {
+		fatal("Invalid configuration", "error", err)
 	}
-	defer watcher.Close()
-
-	err = watcher.Add(s.Config.WebRoot)
-	if err != nil {
-		log.Fatal("Failed to add webRoot to watcher:", err)
-	}
-
-	log.Printf("Watching directory %s for changes to FCGI binaries", s.Config.WebRoot)
-
-	for {
-		select {
-		case event, ok := <-watcher.Events:
-			if !ok {
-				return
-			}
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				if strings.HasSuffix(event.Name, ".fcgi") {
-					appPath := event.Name
-					log.Printf("FCGI binary changed: %s. Terminating existing child process if any.", appPath)
-
-					s.childProcessesMu.Lock()
-					if child, exists := s.childProcesses[appPath]; exists {
-						log.Printf("Terminating old child process for %s (PID: %d)", appPath, child.cmd.Process().Pid())
-						_ = child.cmd.Process().Kill()
-						_ = os.Remove(child.socketPath) // Clean up socket file
-						delete(s.childProcesses, appPath)
-					}
-					s.childProcessesMu.Unlock()
-				}
-			}
-		case err, ok := <-watcher.Errors:
-			if !ok {
-				return
-			}
-			log.Println("Watcher error:", err)
+	s := spawner.NewSpawner(cfg)
+	if mode.dryRun {
+		// The arguments are URLs to resolve.
+		if err := s.DryRun(os.Stdout, flag.Args()...); err != nil {
+			fatal("Dry run failed", "error", err)
 		}
-	}
-}
-
-// noHiddenFS is a file system that hides dot files.
-type noHiddenFS struct {
-	fs http.FileSystem
-}
-
-// Open implements the http.FileSystem interface.
-func (nhfs noHiddenFS) Open(name string) (http.File, error) {
-	// Disallow browsing of hidden files/directories
-	if strings.Contains(name, "/.") {
-		return nil, os.ErrNotExist
-	}
-
-	file, err := nhfs.fs.Open(name)
-	if err != nil {
-		return nil, err
-	}
-	return noHiddenFile{file}, nil
-}
-
-// noHiddenFile is a file that filters out hidden files from directory listings.
-type noHiddenFile struct {
-	http.File
-}
-
-// Readdir implements the http.File interface and filters out hidden files.
-func (nhf noHiddenFile) Readdir(count int) ([]os.FileInfo, error) {
-	files, err := nhf.File.Readdir(count)
-	if err != nil {
-		return nil, err
-	}
-
-	var visibleFiles []os.FileInfo
-	for _, f := range files {
-		if !strings.HasPrefix(f.Name(), ".") {
-			visibleFiles = append(visibleFiles, f)
-		}
-	}
-	return visibleFiles, nil
-}
-
-func (s *Spawner) spawnerHandler(w http.ResponseWriter, r *http.Request) {
-	scriptPath := r.URL.Path
-	if scriptPath == "" {
-		http.Error(w, "Internal Server Error: script path is empty", http.StatusInternalServerError)
-		log.Println("script path is empty in request")
 		return
 	}
-
-	// Find the correct FCGI application path from the URL
-	var targetPath string
-	pathSegments := strings.Split(strings.Trim(scriptPath, "/"), "/")
-	currentPath := ""
-	for _, segment := range pathSegments {
-		currentPath = filepath.Join(currentPath, segment)
-		if strings.HasSuffix(currentPath, ".fcgi") {
-			potentialPath := filepath.Join(s.Config.WebRoot, currentPath)
-			if _, err := os.Stat(potentialPath); err == nil {
-				targetPath = potentialPath
-				break
-			}
-		}
-	}
-
-	// If no FCGI app was found in the path, fall back to original logic for static files.
-	if targetPath == "" {
-		targetPath = filepath.Join(s.Config.WebRoot, filepath.Base(scriptPath))
+	if cfg.Pprof {
+		s.HandleAdmin("GET /debug/pprof/", http.HandlerFunc(pprof.Index))
+		s.HandleAdmin("GET /debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+		s.HandleAdmin("GET /debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+		s.HandleAdmin("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+		s.HandleAdmin("GET /debug/pprof/trace", http.HandlerFunc(pprof.Trace))
 	}
 
-	if !strings.HasPrefix(targetPath, s.Config.WebRoot) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		log.Printf("Forbidden: Attempted directory traversal: %s", scriptPath)
-		return
-	}
+	// The spawner is a regular HTTP server that will be started by supervisor.
+	// Nginx will proxy requests to this server.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	// A second signal during shutdown stops the spawner right away.
+	context.AfterFunc(ctx, stop)
+	if err := s.ListenAndServe(ctx); err != nil {
+		fatal("Spawner failed", "error", err)
+	}
+}
+
+// checkConfig prints the problems spawner.Config.Check finds in cfg, for
+// -check, and returns the exit status: 1 if there are any.
+func checkConfig(cfg *spawner.Config) int {
+	errs := cfg.Check()
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, "error:", err)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(errs))
+		return 1
+	}
+	fmt.Println("Configuration OK")
+	return 0
+}
+
+// runMode is what the command does instead of serving, if anything.
+type runMode struct {
+	check  bool // -check
+	dryRun bool // -dryRun
+}
+
+// loadConfig parses command-line flags and returns a Config struct, and
+// whether -check or -dryRun ask for something else than serving.
+// If -config names a configuration file, its values are used for every
+// setting that wasn't given explicitly on the command line.
+func loadConfig() (*spawner.Config, runMode) {
+	cfg := &spawner.Config{}
+	var configPath string
+	var mode runMode
+	flag.StringVar(&configPath, "config", "", "Optional YAML (.yaml, .yml) or TOML (.toml) configuration file. Command-line flags override its values.")
+	flag.BoolVar(&mode.check, "check", false, "Check the configuration, the directories and the applications it names, print the problems found and exit non-zero if there are any")
+	flag.BoolVar(&mode.dryRun, "dryRun", false, "Print the effective configuration, the applications found with their command and environment, and the routes, then exit. Arguments are URLs to show the application of.")
+	flag.StringVar(&cfg.WebRoot, "webRoot", "/web", "Root directory for web files")
+	flag.StringVar(&cfg.StaticRoot, "staticRoot", "", "Optional root directory for static files. If specified, files in this directory will be served.")
+	flag.BoolVar(&cfg.SPAFallback, "spaFallback", false, "Serve index.html of staticRoot for unknown paths without a file extension, for single-page apps using client-side routing")
+	flag.StringVar(&cfg.IndexFiles, "indexFiles", spawner.DefaultIndexFiles, "Comma-separated files served for directories of the static roots, the first one found wins")
+	flag.StringVar(&cfg.DirListing, "dirListing", spawner.DirListingPlain, "Directory listing of static directories without an index file: off (404), plain or themed")
+	flag.StringVar(&cfg.DirListingTemplate, "dirListingTemplate", "", "Optional html/template file rendering the themed directory listing")
+	flag.StringVar(&cfg.SocketDir, "socketDir", "", "Directory for FastCGI application sockets. If empty, stdio mode is used.")
+	flag.StringVar(&cfg.ListenAddr, "listenAddr", ":8080", "Address for the spawner to listen on (e.g., :8080), or a unix socket (e.g., unix:/run/fcgi-spawner.sock)")
+	flag.StringVar(&cfg.SocketMode, "socketMode", "", "Optional permissions set on the sockets of applications in socketDir, e.g. 0660")
+	flag.StringVar(&cfg.SocketOwner, "socketOwner", "", "Optional owner set on the sockets of applications in socketDir: user, user:group or :group")
+	flag.StringVar(&cfg.SocketDirMode, "socketDirMode", "", "Optional permissions of socketDir and its subdirectories, e.g. 0750")
+	flag.StringVar(&cfg.SocketDirOwner, "socketDirOwner", "", "Optional owner of socketDir and its subdirectories: user, user:group or :group")
+	flag.BoolVar(&cfg.AdoptOrphans, "adoptOrphans", false, "Take over the application processes a previous spawner left running in socketDir instead of stopping them")
+	flag.StringVar(&cfg.ListenSocketMode, "listenSocketMode", "0660", "Permissions of the unix socket the spawner listens on")
+	flag.StringVar(&cfg.ListenSocketOwner, "listenSocketOwner", "", "Optional owner of the unix socket the spawner listens on: user, user:group or :group")
+	flag.DurationVar(&cfg.DefaultIdleTimeout, "idleTimeout", 5*time.Minute, "Idle timeout for child processes (e.g., 1m, 5m, 1h)")
+	flag.DurationVar(&cfg.ReadinessTimeout, "readinessTimeout", 5*time.Second, "How long a newly started child process may take to accept connections")
+	flag.StringVar(&cfg.LogLevel, "logLevel", "info", "Log level (debug, info, warn, error), optionally per subsystem (main, spawn, proxy, watcher, cleanup, admin, app), e.g. info,proxy=debug")
+	flag.StringVar(&cfg.AccessLog, "accessLog", "", "Optional access log file (- for stdout)")
+	flag.StringVar(&cfg.AccessLogFormat, "accessLogFormat", spawner.AccessLogCombined, "Access log format: combined or json")
+	flag.StringVar(&cfg.AuditLog, "auditLog", "", "Optional file every admin API action and application reload is appended to as a JSON line")
+	flag.DurationVar(&cfg.SlowRequestThreshold, "slowRequestThreshold", 0, "Log a warning for requests to applications taking longer than this, with the time spent starting the application and proxying (0 disables it)")
+	flag.BoolVar(&cfg.H2C, "h2c", true, "Accept HTTP/2 without TLS (h2c), e.g. from a reverse proxy. Use -h2c=false to only speak HTTP/1.1 on plain HTTP.")
+	flag.StringVar(&cfg.TLSCert, "tlsCert", "", "TLS certificate file. Together with -tlsKey the spawner is served over HTTPS.")
+	flag.StringVar(&cfg.TLSKey, "tlsKey", "", "TLS private key file")
+	flag.StringVar(&cfg.TLSClientCA, "tlsClientCA", "", "Optional file of CA certificates to verify TLS client certificates with, whose details are passed to applications in SSL_CLIENT_* variables")
+	flag.StringVar(&cfg.TLSClientAuth, "tlsClientAuth", "optional", "Whether clients must present a certificate with -tlsClientCA: optional or require")
+	flag.StringVar(&cfg.TLSClientCertHeader, "tlsClientCertHeader", "", "Optional header trusted proxies pass the verified client certificate in, e.g. X-SSL-Client-Cert for nginx's $ssl_client_escaped_cert")
+	flag.StringVar(&cfg.AutocertDomains, "autocertDomains", "", "Comma-separated domains to obtain certificates for from Let's Encrypt. Enables HTTPS with automatic certificates.")
+	flag.StringVar(&cfg.AutocertCacheDir, "autocertCacheDir", "autocert-cache", "Directory storing certificates obtained with -autocertDomains")
+	flag.StringVar(&cfg.RedirectAddr, "redirectAddr", "", "Optional plain HTTP listen address (e.g. :80) redirecting to HTTPS. In autocert mode it also answers ACME HTTP-01 challenges.")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdownTimeout", 30*time.Second, "How long to wait for in-flight requests on SIGTERM before stopping child processes")
+	flag.DurationVar(&cfg.PreStopDelay, "preStopDelay", 0, "How long to fail readiness checks while still serving before shutting down on SIGTERM, so that load balancers stop sending requests first. Also enables the preStop hook GET /prestop.")
+	flag.DurationVar(&cfg.TerminationGracePeriod, "terminationGracePeriod", 0, "Time the spawner has to stop once told to, e.g. the terminationGracePeriodSeconds of its pod; -shutdownTimeout is shortened to fit (0 for no limit)")
+	flag.DurationVar(&cfg.UpstreamTimeout, "upstreamTimeout", 60*time.Second, "How long an application may take to send the response headers before 504 Gateway Timeout is returned (0 disables it)")
+	flag.Int64Var(&cfg.SpoolThreshold, "spoolThreshold", 1<<20, "Size in bytes up to which request bodies without Content-Length are buffered in memory for SCGI applications and CGI scripts; larger ones are spooled to a temporary file in -spoolDir")
+	flag.StringVar(&cfg.SpoolDir, "spoolDir", "", "Directory request bodies are spooled to (default the system's temporary directory)")
+	flag.DurationVar(&cfg.DrainTimeout, "drainTimeout", 30*time.Second, "How long old child processes may finish their requests after their application was upgraded")
+	flag.BoolVar(&cfg.Manifest, "manifest", false, "Only run the applications declared in the apps section of the configuration file, instead of any executable found in webRoot")
+	flag.BoolVar(&cfg.PrewarmAll, "prewarmAll", false, "Start every application in webRoot when the spawner starts instead of on its first request")
+	flag.IntVar(&cfg.SpawnQueueSize, "spawnQueueSize", 100, "Requests that may wait for an application while it starts (0 for no limit). Others get 503 Service Unavailable.")
+	flag.DurationVar(&cfg.SpawnQueueTimeout, "spawnQueueTimeout", 30*time.Second, "How long a request may wait for an application while it starts before 503 Service Unavailable is returned (0 for no limit)")
+	flag.IntVar(&cfg.MaxConcurrent, "maxConcurrent", 0, "Requests each application process may serve at once (0 for no limit). Further requests wait for one to finish.")
+	flag.IntVar(&cfg.RequestQueueSize, "requestQueueSize", 100, "Requests per application that may wait for a process below -maxConcurrent (0 for no limit). Others get 503 Service Unavailable.")
+	flag.DurationVar(&cfg.RequestQueueTimeout, "requestQueueTimeout", 30*time.Second, "How long a request may wait for a process below -maxConcurrent before 503 Service Unavailable is returned (0 for no limit)")
+	flag.DurationVar(&cfg.WatchdogInterval, "watchdogInterval", 10*time.Second, "How often child processes are checked against their maxMemory and maxCPU limits (0 disables it)")
+	flag.IntVar(&cfg.MaxChildren, "maxChildren", 0, "Most child processes running at once (0 for no limit). At the limit, the least recently used idle one is stopped to start another; if all are busy, 503 is returned.")
+	flag.IntVar(&cfg.ConnPoolSize, "connPoolSize", 8, "Idle FastCGI connections kept open per child process for reuse (0 disables keep-alive)")
+	flag.StringVar(&cfg.User, "user", "", "Optional user (name or uid) child processes run as. Requires the spawner to run as root.")
+	flag.StringVar(&cfg.Group, "group", "", "Optional group (name or gid) child processes run as. Defaults to the primary group of -user.")
+	flag.StringVar(&cfg.TrustedProxies, "trustedProxies", "", "Comma-separated addresses or networks (e.g. 127.0.0.1,10.0.0.0/8) of proxies whose X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Port headers are trusted; unix trusts clients on a unix listen socket")
+	flag.StringVar(&cfg.GeoIPDatabases, "geoipDatabases", "", "Comma-separated MaxMind databases (e.g. GeoLite2-City.mmdb) the client address is looked up in for the GEOIP_* variables of requests")
+	flag.BoolVar(&cfg.Compress, "compress", false, "Compress responses with gzip or brotli for clients accepting it")
+	flag.IntVar(&cfg.CompressMinSize, "compressMinSize", 1024, "Smallest response in bytes compressed with -compress")
+	flag.StringVar(&cfg.CompressTypes, "compressTypes", spawner.DefaultCompressTypes, "Comma-separated content types compressed with -compress, e.g. text/*,application/json")
+	flag.StringVar(&cfg.CoordinationDir, "coordinationDir", "", "Optional directory shared by spawners running side by side on this host, keeping their sockets apart and running singleton applications once")
+	flag.StringVar(&cfg.ContainerRuntime, "containerRuntime", "docker", "Command running applications configured with a container image (docker or podman)")
+	flag.StringVar(&cfg.AdminAddr, "adminAddr", "", "Optional address for the admin API (e.g., 127.0.0.1:8081). Requires an admin token.")
+	flag.StringVar(&cfg.EventWebhook, "eventWebhook", "", "Optional URL the lifecycle events of child processes (spawned, ready, idle-killed, crashed, restarted) are posted to as JSON")
+	flag.StringVar(&cfg.ChatWebhook, "chatWebhook", "", "Optional Mattermost or Slack incoming webhook URL notified when an application crash-loops or fails its readiness probe")
+	flag.IntVar(&cfg.ChatLogLines, "chatLogLines", 10, "Latest stderr lines of the application included in -chatWebhook messages (at most 50)")
+	flag.StringVar(&cfg.Registry, "registry", "", "Optional service registry the running applications are registered in: consul or etcd")
+	flag.StringVar(&cfg.RegistryAddr, "registryAddr", "", "URL of the Consul agent or etcd endpoint for -registry (default the local one, http://127.0.0.1:8500 or http://127.0.0.1:2379)")
+	flag.BoolVar(&cfg.Pprof, "pprof", false, "Serve CPU, heap, goroutine and other profiles of the spawner below /debug/pprof/ on the admin API")
+	flag.Parse()
 
-	// Check if the requested path is an executable FCGI application
-	fileInfo, err := os.Stat(targetPath)
-	if err == nil && fileInfo.Mode().IsRegular() && (fileInfo.Mode().Perm()&0111 != 0) && strings.HasSuffix(targetPath, ".fcgi") {
-		child, err := s.getOrCreateChild(targetPath)
-		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			log.Printf("Error getting or creating child process for %s: %v", targetPath, err)
-			return
-		}
-		s.proxyRequest(w, r, child)
-		return
+	if configPath != "" {
+		loadConfigFileWithFlags(configPath, cfg)
 	}
-
-	// If not an FCGI app, try serving as a static file
-	if s.staticFileServer != nil {
-		s.staticFileServer.ServeHTTP(w, r)
-		return
+	if token := os.Getenv("SPAWNER_ADMIN_TOKEN"); token != "" {
+		cfg.AdminToken = token
 	}
-
-	// If we reach here, it's a 404
-	http.Error(w, "404 Not Found", http.StatusNotFound)
-	log.Printf("Requested path %s is not a valid FCGI application and static file serving is disabled.", r.URL.Path)
+	return cfg, mode
 }
 
-func (s *Spawner) getOrCreateChild(appPath string) (*childProcess, error) {
-	s.childProcessesMu.Lock()
-	defer s.childProcessesMu.Unlock()
-
-	fileInfo, err := os.Stat(appPath)
-	if os.IsNotExist(err) {
-		return nil, fmt.Errorf("application not found: %s", appPath)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get file info for %s: %v", appPath, err)
-	}
-	currentModTime := fileInfo.ModTime()
-
-	if child, exists := s.childProcesses[appPath]; exists {
-		// Check if process is still alive and binary hasn't changed
-		if (child.cmd.ProcessState() == nil || !child.cmd.ProcessState().Exited()) && !currentModTime.After(child.binaryModTime) {
-			child.lastUsed = time.Now()
-			return child, nil
-		}
-		// Process has exited or binary has changed, so we'll terminate the old one and create a new one.
-		log.Printf("Child process for %s (PID: %d) has exited or binary changed. Terminating old process and restarting...", appPath, child.cmd.Process().Pid())
-		// Attempt graceful shutdown first
-		if child.cmd.Process() != nil {
-			if err := child.cmd.Process().Signal(syscall.SIGTERM); err != nil {
-				log.Printf("Error sending SIGTERM to child process %d: %v", child.cmd.Process().Pid(), err)
-			}
-			// Give it a moment to shut down gracefully
-			time.Sleep(1 * time.Second)
-
-			// If it's still alive, forcefully kill it
-			if child.cmd.Process() != nil && child.cmd.Process().Signal(syscall.Signal(0)) == nil { // Check if process is still alive
-				if err := child.cmd.Process().Kill(); err != nil {
-					log.Printf("Error sending SIGKILL to child process %d: %v", child.cmd.Process().Pid(), err)
-				}
-			}
-		}
-		// Wait for the process to ensure it's reaped and doesn't become a zombie
-		if _, err := child.cmd.Process().Wait(); err != nil {
-			log.Printf("Error waiting for child process %d: %v", child.cmd.Process().Pid(), err)
-		}
-		if child.listener != nil {
-			child.listener.Close()
-		} else {
-			if err := os.Remove(child.socketPath); err != nil && !os.IsNotExist(err) {
-				log.Printf("Error removing socket file %s: %v", child.socketPath, err)
-			}
-		}
-		delete(s.childProcesses, appPath)
-	}
-
-	// Load environment variables from .env file if it exists
-	var childEnv []string // Initialize as empty slice
-
-	// Hardcode PATH as a base. It can be overridden by .env file.
-	childEnv = append(childEnv, "PATH=/usr/local/bin:/usr/bin:/bin")
-
-	envFilePath := strings.TrimSuffix(appPath, ".fcgi") + ".env"
-	if _, err := os.Stat(envFilePath); err == nil {
-		log.Printf("Loading environment file: %s", envFilePath)
-		envFile, err := os.Open(envFilePath)
-		if err != nil {
-			return nil, fmt.Errorf("could not open env file %s: %v", envFilePath, err)
-		}
-		defer envFile.Close()
-
-		scanner := bufio.NewScanner(envFile)
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line != "" && !strings.HasPrefix(line, "#") {
-				parts := strings.SplitN(line, "=", 2)
-				if len(parts) == 2 {
-					// Check if this variable already exists (e.g., PATH) and overwrite it.
-					// Otherwise, append it.
-					found := false
-					for i, existingVar := range childEnv {
-						if strings.HasPrefix(existingVar, parts[0]+"=") {
-							childEnv[i] = line // Overwrite
-							found = true
-							break
-						}
-					}
-					if !found {
-						childEnv = append(childEnv, line) // Append new variable
-					}
-				}
-			}
-		}
-	}
-
-	useSocketMode := s.Config.SocketDir != ""
-	var socketPath string
-	if useSocketMode {
-		socketPath = filepath.Join(s.Config.SocketDir, filepath.Base(appPath)+".sock")
-		if err := os.MkdirAll(s.Config.SocketDir, 0755); err != nil {
-			return nil, fmt.Errorf("failed to create socket directory: %v", err)
-		}
-		// Clean up old socket file if it exists
-		_ = os.Remove(socketPath)
-	} else {
-		// Use an abstract socket for stdio mode
-		socketPath = filepath.Join("/tmp/fcgi-spawner-sockets", filepath.Base(appPath)+".sock")
-		socketPath = "\x00" + socketPath
-	}
-
-	var cmd *exec.Cmd
-	var ln net.Listener
-
-	if useSocketMode {
-		cmd = exec.Command(appPath, socketPath)
-	} else {
-		cmd = exec.Command(appPath)
-		var err error
-		ln, err = net.Listen("unix", socketPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create listener for stdio app: %v", err)
-		}
-
-		unixListener, ok := ln.(*net.UnixListener)
-		if !ok {
-			ln.Close()
-			return nil, fmt.Errorf("listener was not a UnixListener")
-		}
-
-		listenerFile, err := unixListener.File()
-		if err != nil {
-			ln.Close()
-			return nil, fmt.Errorf("failed to get listener file for child: %v", err)
-		}
-		defer listenerFile.Close() // We can close the file descriptor copy after start
-		cmd.Stdin = listenerFile
-	}
-
-	// Always set cmd.Env to the explicitly defined childEnv (which might be empty)
-	cmd.Env = childEnv
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		if ln != nil {
-			ln.Close()
-		}
-		return nil, fmt.Errorf("failed to create stderr pipe for %s: %v", appPath, err)
-	}
-
-	var stdoutToLog io.ReadCloser
-	if useSocketMode { // Only capture stdout for socket mode
-		var err error
-		stdoutToLog, err = cmd.StdoutPipe()
-		if err != nil {
-			if ln != nil {
-				ln.Close()
-			}
-			return nil, fmt.Errorf("failed to create stdout pipe for %s: %v", appPath, err)
-		}
-	}
-
-	if err := cmd.Start(); err != nil {
-		if ln != nil {
-			ln.Close()
-		}
-		return nil, fmt.Errorf("failed to start application %s: %v", appPath, err)
-	}
-
-	go logStream(stderr, appPath, cmd.Process.Pid, "stderr")
-	if stdoutToLog != nil {
-		go logStream(stdoutToLog, appPath, cmd.Process.Pid, "stdout")
+// loadConfigFileWithFlags loads the configuration file at path into cfg,
+// keeping the values of flags given on the command line.
+func loadConfigFileWithFlags(configPath string, cfg *spawner.Config) {
+	// Remember the flags given on the command line, as loading the file
+	// overwrites the values they were bound to.
+	explicit := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+	if err := spawner.LoadConfigFile(configPath, cfg); err != nil {
+		fatal("Error loading config file", "error", err)
 	}
-
-	// Wait for the child to be ready by dialing the socket.
-	var conn net.Conn
-	var dialErr error
-	for i := 0; i < 100; i++ {
-		conn, dialErr = net.DialTimeout("unix", socketPath, 50*time.Millisecond)
-		if dialErr == nil {
-			conn.Close()
-			break
+	for name, value := range explicit {
+		if err := flag.Set(name, value); err != nil {
+			fatal("Error applying flag", "flag", name, "error", err)
 		}
-		time.Sleep(20 * time.Millisecond)
 	}
-	if dialErr != nil {
-		log.Printf("Failed to connect to child socket %s after timeout: %v", socketPath, dialErr)
-		// Attempt to kill the process we just started, as it's not responding
-		if cmd.Process != nil {
-			cmd.Process.Kill()
-		}
-		if ln != nil {
-			ln.Close()
-		}
-		return nil, fmt.Errorf("failed to connect to child socket: %v", dialErr)
-	}
-
-	child := &childProcess{
-		cmd:           &execCmdWrapper{cmd: cmd},
-		socketPath:    socketPath,
-		lastUsed:      time.Now(),
-		binaryPath:    appPath,
-		idleTimeout:   s.Config.DefaultIdleTimeout,
-		binaryModTime: currentModTime,
-		listener:      ln, // Store the listener
-	}
-	s.childProcesses[appPath] = child
-
-	if useSocketMode {
-		log.Printf("Started new socket child process for %s (PID: %d) on socket %s", appPath, child.cmd.Process().Pid(), child.socketPath)
-	} else {
-		log.Printf("Started new stdio child process for %s (PID: %d)", appPath, child.cmd.Process().Pid())
-	}
-
-	return child, nil
+	slog.Info("Loaded configuration", "path", configPath)
 }
 
-func (s *Spawner) proxyRequest(w http.ResponseWriter, r *http.Request, child *childProcess) {
-	s.childProcessesMu.Lock()
-	child.lastUsed = time.Now()
-	s.childProcessesMu.Unlock()
-
-	fcgi, err := fcgiclient.Dial("unix", child.socketPath)
-	if err != nil {
-		http.Error(w, "Bad Gateway", http.StatusBadGateway)
-		log.Printf("Failed to connect to child application %s: %v", child.socketPath, err)
-		return
-	}
-	defer fcgi.Close()
-
-	env := make(map[string]string)
-	env["REQUEST_METHOD"] = r.Method
-	env["SERVER_PROTOCOL"] = r.Proto
-	env["QUERY_STRING"] = r.URL.RawQuery
-	env["CONTENT_TYPE"] = r.Header.Get("Content-Type")
-	env["CONTENT_LENGTH"] = fmt.Sprintf("%d", r.ContentLength)
-	env["SCRIPT_FILENAME"] = child.cmd.Path()
-	env["SCRIPT_NAME"] = r.URL.Path
-	env["REQUEST_URI"] = r.URL.RequestURI()
-	env["DOCUMENT_URI"] = r.URL.Path
-	env["DOCUMENT_ROOT"] = s.Config.WebRoot
-	env["SERVER_SOFTWARE"] = "go-fcgi-spawner"
-	env["REMOTE_ADDR"] = r.RemoteAddr
-	env["HTTP_HOST"] = r.Host
-
-	for name, headers := range r.Header {
-		for _, h := range headers {
-			env["HTTP_"+strings.ToUpper(strings.Replace(name, "-", "_", -1))] = h
-		}
-	}
-
-	resp, err := fcgi.Request(env, r.Body)
-	if err != nil {
-		http.Error(w, "Bad Gateway", http.StatusBadGateway)
-		log.Printf("FastCGI request failed: %v", err)
-		return
-	}
-
-	for k, vv := range resp.Header {
-		for _, v := range vv {
-			w.Header().Add(k, v)
-		}
-	}
-	w.WriteHeader(resp.StatusCode)
-	// Explicitly flush headers
-	if flusher, ok := w.(http.Flusher); ok {
-		flusher.Flush()
-	}
-
-	// Read from FCGI response body and write to client, flushing incrementally
-	buf := make([]byte, 4096) // 4KB buffer
-	for {
-		n, err := resp.Body.Read(buf)
-		if n > 0 {
-			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
-				log.Printf("Failed to write response chunk to client: %v", writeErr)
-				return // Client likely disconnected
-			}
-			if flusher, ok := w.(http.Flusher); ok {
-				flusher.Flush()
-			}
-		}
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			log.Printf("Failed to read from FCGI response body: %v", err)
-			return
-		}
-	}
+// fatal logs msg as an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
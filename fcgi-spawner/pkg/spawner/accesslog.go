@@ -0,0 +1,174 @@
+package spawner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Access log formats.
+const (
+	AccessLogCombined = "combined"
+	AccessLogJSON     = "json"
+)
+
+// accessLog writes a line per request, separately from the operational log.
+type accessLog struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+}
+
+// newAccessLog opens the access log at path for appending. "-" writes to
+// standard output.
+func newAccessLog(path, format string) (*accessLog, error) {
+	switch format {
+	case AccessLogCombined, AccessLogJSON:
+	default:
+		return nil, fmt.Errorf("unknown access log format %q, expected %s or %s", format, AccessLogCombined, AccessLogJSON)
+	}
+	if path == "-" {
+		return &accessLog{w: os.Stdout, format: format}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &accessLog{w: f, format: format}, nil
+}
+
+// accessEntry is what is logged about a request. App and Spawned are filled
+// in by the spawner handler when the request goes to an application.
+type accessEntry struct {
+	Time       time.Time `json:"time"`
+	Remote     string    `json:"remote"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	App        string    `json:"app,omitempty"`
+	Spawned    bool      `json:"spawned"`
+	DurationMs float64   `json:"durationMs"`
+}
+
+type accessEntryKey struct{}
+
+// accessEntryFrom returns the access log entry of the request with context
+// ctx, or nil if access logging is disabled.
+func accessEntryFrom(ctx context.Context) *accessEntry {
+	entry, _ := ctx.Value(accessEntryKey{}).(*accessEntry)
+	return entry
+}
+
+// statusRecorder records the status and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush keeps streaming responses working through the recorder.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// middleware logs every request handled by next.
+func (l *accessLog) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessEntry{
+			Time:      start,
+			Method:    r.Method,
+			Path:      r.URL.RequestURI(),
+			Proto:     r.Proto,
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		}
+		entry.Remote, _, _ = net.SplitHostPort(r.RemoteAddr)
+		if entry.Remote == "" {
+			entry.Remote = r.RemoteAddr
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessEntryKey{}, entry)))
+
+		entry.Status = rec.status
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		entry.Bytes = rec.bytes
+		entry.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+		l.write(entry)
+	})
+}
+
+func (l *accessLog) write(e *accessEntry) {
+	var line []byte
+	if l.format == AccessLogJSON {
+		line, _ = json.Marshal(e)
+		line = append(line, '\n')
+	} else {
+		line = []byte(formatCombined(e))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(line)
+}
+
+// formatCombined formats e in the Apache combined log format, followed by
+// the application, whether a process was spawned for the request and the
+// duration in milliseconds.
+func formatCombined(e *accessEntry) string {
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+	app, spawn := "-", "-"
+	if e.App != "" {
+		app, spawn = e.App, "reuse"
+		if e.Spawned {
+			spawn = "spawn"
+		}
+	}
+	return fmt.Sprintf("%s - - [%s] %q %d %s %q %q %q %s %.3f\n",
+		e.Remote, e.Time.Format("02/Jan/2006:15:04:05 -0700"), e.Method+" "+e.Path+" "+e.Proto,
+		e.Status, size, orDash(e.Referer), orDash(e.UserAgent), app, spawn, e.DurationMs)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
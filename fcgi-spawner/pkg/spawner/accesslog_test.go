@@ -0,0 +1,63 @@
+package spawner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/app.fcgi" {
+			entry := accessEntryFrom(r.Context())
+			entry.App, entry.Spawned = "app.fcgi", true
+			w.(http.Flusher).Flush()
+		}
+		http.Error(w, "teapot", http.StatusTeapot)
+	})
+
+	tests := []struct {
+		format string
+		check  func(t *testing.T, line []byte)
+	}{
+		{
+			format: AccessLogCombined,
+			check: func(t *testing.T, line []byte) {
+				want := regexp.MustCompile(`^192\.0\.2\.1 - - \[[^]]+\] "GET /app\.fcgi\?a=1 HTTP/1\.1" 418 7 "https://example\.com/" "tester" "app\.fcgi" spawn [0-9.]+\n$`)
+				if !want.Match(line) {
+					t.Errorf("combined line = %q", line)
+				}
+			},
+		},
+		{
+			format: AccessLogJSON,
+			check: func(t *testing.T, line []byte) {
+				var e accessEntry
+				if err := json.Unmarshal(line, &e); err != nil {
+					t.Fatalf("Failed to decode JSON line %q: %v", line, err)
+				}
+				if e.Remote != "192.0.2.1" || e.Method != "GET" || e.Path != "/app.fcgi?a=1" || e.Status != http.StatusTeapot || e.Bytes != 7 || e.App != "app.fcgi" || !e.Spawned {
+					t.Errorf("JSON entry = %+v", e)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := &accessLog{w: &buf, format: tt.format}
+			req := httptest.NewRequest(http.MethodGet, "/app.fcgi?a=1", nil)
+			req.Header.Set("Referer", "https://example.com/")
+			req.Header.Set("User-Agent", "tester")
+			l.middleware(handler).ServeHTTP(httptest.NewRecorder(), req)
+			tt.check(t, buf.Bytes())
+		})
+	}
+
+	if _, err := newAccessLog("-", "xml"); err == nil {
+		t.Errorf("newAccessLog() accepted an unknown format")
+	}
+}
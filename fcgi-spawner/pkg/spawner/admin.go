@@ -0,0 +1,227 @@
+package spawner
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// AdminHandler returns the handler of the admin API. Every request must carry
+// the admin token or one of Config.AdminTokens as a bearer token. Actions are
+// recorded in Config.AuditLog.
+//
+//	GET  /status             summarizes the spawner as text or JSON
+//	GET  /children           lists the running child processes
+//	GET  /apps               lists the starts and restarts of the apps
+//	GET  /metrics            lists the request metrics of the apps
+//	GET  /logs               returns the latest output of the apps
+//	GET  /events             streams lifecycle events as server-sent events
+//	POST /apps/{app}/start   starts the app's minimum number of instances
+//	POST /apps/{app}/stop    stops all instances of the app
+//	POST /apps/{app}/restart stops the app and starts it again
+//	POST /apps/{app}/deploy  replaces the app's binary by the one at the path
+//	                         in the JSON body {"binary": ...}, blue-green
+//
+// {app} is the path of the application relative to WebRoot, e.g. hello.fcgi.
+// The dashboard at /dashboard/, which uses the API, is served without a token.
+// Further endpoints can be added with HandleAdmin.
+func (s *Spawner) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.handleAdminStatus)
+	mux.HandleFunc("GET /children", s.handleAdminChildren)
+	mux.HandleFunc("GET /apps", s.handleAdminApps)
+	mux.HandleFunc("GET /metrics", s.handleAdminMetrics)
+	mux.HandleFunc("GET /logs", s.handleAdminLogs)
+	mux.HandleFunc("GET /events", s.handleAdminEvents)
+	mux.HandleFunc("POST /apps/{app...}", s.handleAdminApp)
+	for pattern, handler := range s.adminRoutes {
+		mux.Handle(pattern, handler)
+	}
+
+	// The dashboard itself holds no data, it asks for the token to use the
+	// API from the browser.
+	root := http.NewServeMux()
+	root.Handle("GET /dashboard/", dashboardHandler())
+	root.Handle("GET /{$}", http.RedirectHandler("/dashboard/", http.StatusFound))
+	root.Handle("/", s.requireAdminToken(mux))
+	return root
+}
+
+// HandleAdmin adds handler for pattern, as in http.ServeMux, to the admin
+// API, e.g. the net/http/pprof profiles for Config.Pprof. It requires the
+// admin token like the built-in endpoints. HandleAdmin must be called before
+// AdminHandler.
+func (s *Spawner) HandleAdmin(pattern string, handler http.Handler) {
+	if s.adminRoutes == nil {
+		s.adminRoutes = make(map[string]http.Handler)
+	}
+	s.adminRoutes[pattern] = handler
+}
+
+// requireAdminToken rejects requests without the admin token or one of the
+// operators' tokens. The operator is passed on with the request, see
+// adminOperator, and rejected requests are audited.
+func (s *Spawner) requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		operator := ""
+		if ok {
+			operator = s.adminTokenOperator(token)
+		}
+		if operator == "" {
+			s.auditAdmin(r, "unauthorized", "", r.Method+" "+r.URL.Path, nil)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="spawner"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, withAdminOperator(r, operator))
+	})
+}
+
+// adminTokenOperator returns the operator whose token is token, or "" if
+// it's none. Every token is compared, in constant time.
+func (s *Spawner) adminTokenOperator(token string) string {
+	operator := ""
+	if s.Config.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.Config.AdminToken)) == 1 {
+		operator = adminOperatorDefault
+	}
+	for name, t := range s.Config.AdminTokens {
+		if t != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			operator = name
+		}
+	}
+	return operator
+}
+
+func (s *Spawner) handleAdminChildren(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.children())
+}
+
+func (s *Spawner) handleAdminApps(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.appRestartStats())
+}
+
+func (s *Spawner) handleAdminMetrics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.metrics.snapshot())
+}
+
+func (s *Spawner) handleAdminLogs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, appLogTail.snapshot())
+}
+
+// handleAdminApp runs an action on an application. The action is the last
+// segment of the path, as the wildcard matching the app has to come last.
+func (s *Spawner) handleAdminApp(w http.ResponseWriter, r *http.Request) {
+	path := r.PathValue("app")
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	rel, action := path[:i], path[i+1:]
+	appPath, err := s.resolveApp(rel)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var detail string
+	switch action {
+	case "start":
+		err = s.startApp(appPath)
+	case "stop":
+		s.stopApp(appPath)
+	case "restart":
+		s.stopApp(appPath)
+		err = s.startApp(appPath)
+	case "deploy":
+		var body struct {
+			Binary string `json:"binary"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Binary == "" {
+			http.Error(w, `Expected a JSON body {"binary": "/path/to/new/binary"}`, http.StatusBadRequest)
+			return
+		}
+		detail = body.Binary
+		err = s.deployApp(appPath, body.Binary)
+	default:
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	s.auditAdmin(r, action, appPath, detail, err)
+	if err != nil {
+		adminLog.Error("Admin action failed", "operator", adminOperator(r), "action", action, "app", appPath, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to %s %s: %v", action, rel, err), http.StatusInternalServerError)
+		return
+	}
+	adminLog.Info("Admin action", "operator", adminOperator(r), "action", action, "app", appPath)
+
+	var running []childStatus
+	for _, child := range s.children() {
+		if child.App == appPath {
+			running = append(running, child)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"app": rel, "children": running})
+}
+
+// resolveApp returns the path of the application rel, relative to WebRoot,
+// checking that it is an application inside WebRoot.
+func (s *Spawner) resolveApp(rel string) (string, error) {
+	appPath := filepath.Join(s.Config.WebRoot, filepath.FromSlash(rel))
+	if !strings.HasPrefix(appPath, filepath.Clean(s.Config.WebRoot)+string(filepath.Separator)) || (!s.isAppName(appPath) && !s.hasCommand(appPath)) {
+		return "", fmt.Errorf("not an application: %s", rel)
+	}
+	if !s.isApp(appPath) {
+		return "", fmt.Errorf("application not found: %s", rel)
+	}
+	return appPath, nil
+}
+
+// adminName returns the path of the application at appPath relative to
+// WebRoot, which names it in the admin API, or "" if it is outside WebRoot.
+func (s *Spawner) adminName(appPath string) string {
+	rel, err := filepath.Rel(s.Config.WebRoot, appPath)
+	if err != nil || !filepath.IsLocal(rel) {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// startApp starts the minimum number of instances of the application at
+// appPath, if they aren't running yet, even if its restart policy kept it
+// from being started again.
+func (s *Spawner) startApp(appPath string) error {
+	appLock := s.appLock(appPath)
+	appLock.Lock()
+	defer appLock.Unlock()
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	s.resetRestarts(appPath)
+	_, _, err := s.ensurePool(appPath)
+	return err
+}
+
+// stopApp terminates all instances of the application at appPath.
+func (s *Spawner) stopApp(appPath string) {
+	appLock := s.appLock(appPath)
+	appLock.Lock()
+	defer appLock.Unlock()
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	for _, child := range s.pool(appPath) {
+		spawnLog.Info("Stopping child process", "app", appPath, "pid", child.cmd.Process().Pid())
+		s.terminateChild(child)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		adminLog.Error("Failed to encode JSON response", "error", err)
+	}
+}
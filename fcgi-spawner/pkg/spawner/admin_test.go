@@ -0,0 +1,107 @@
+package spawner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdminAPI(t *testing.T) {
+	webRoot := t.TempDir()
+	// In stdio mode the spawner owns the socket, so any long-running
+	// executable is good enough to test process management.
+	script := "#!/bin/sh\nexec sleep 30\n"
+	if err := os.WriteFile(filepath.Join(webRoot, "app.fcgi"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(webRoot, "data.txt"), []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	s := NewSpawner(&Config{WebRoot: webRoot, AdminToken: "secret"})
+	handler := s.AdminHandler()
+	t.Cleanup(func() { s.stopApp(filepath.Join(webRoot, "app.fcgi")) })
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+		wantCount  int // Running children after the request
+	}{
+		{"no token", http.MethodGet, "/children", "", http.StatusUnauthorized, 0},
+		{"wrong token", http.MethodGet, "/children", "guess", http.StatusUnauthorized, 0},
+		{"list", http.MethodGet, "/children", "secret", http.StatusOK, 0},
+		{"start", http.MethodPost, "/apps/app.fcgi/start", "secret", http.StatusOK, 1},
+		{"start again", http.MethodPost, "/apps/app.fcgi/start", "secret", http.StatusOK, 1},
+		{"restart", http.MethodPost, "/apps/app.fcgi/restart", "secret", http.StatusOK, 1},
+		{"unknown action", http.MethodPost, "/apps/app.fcgi/reload", "secret", http.StatusNotFound, 1},
+		{"not an app", http.MethodPost, "/apps/data.txt/start", "secret", http.StatusNotFound, 1},
+		{"outside webRoot", http.MethodPost, "/apps/..%2Fapp.fcgi/start", "secret", http.StatusNotFound, 1},
+		{"stop", http.MethodPost, "/apps/app.fcgi/stop", "secret", http.StatusOK, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.method, tt.path, tt.token)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.path, rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := len(s.children()); got != tt.wantCount {
+				t.Errorf("%d children running, want %d", got, tt.wantCount)
+			}
+		})
+	}
+
+	s.startApp(filepath.Join(webRoot, "app.fcgi"))
+	var children []childStatus
+	if err := json.NewDecoder(do(http.MethodGet, "/children", "secret").Body).Decode(&children); err != nil {
+		t.Fatalf("Failed to decode children: %v", err)
+	}
+	if len(children) != 1 || children[0].PID == 0 {
+		t.Errorf("GET /children = %+v, want the running app", children)
+	}
+}
+
+func TestHandleAdmin(t *testing.T) {
+	s := NewSpawner(&Config{WebRoot: t.TempDir(), AdminToken: "secret"})
+	s.HandleAdmin("GET /debug/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("debug"))
+	}))
+	handler := s.AdminHandler()
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"token", "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("GET /debug/vars = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
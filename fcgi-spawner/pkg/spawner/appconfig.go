@@ -0,0 +1,495 @@
+package spawner
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AppConfig holds settings of a single application that override the
+// spawner-wide defaults. Unset fields fall back to the defaults.
+type AppConfig struct {
+	// IdleTimeout overrides Config.DefaultIdleTimeout; 0 disables it for the app.
+	IdleTimeout *time.Duration `yaml:"idleTimeout"`
+	// Command is run for the application instead of the file at its path,
+	// which then needn't exist, e.g. /opt/app/bin/server. It is only read
+	// from Config.Apps, not from sidecar files.
+	Command string `yaml:"command"`
+	// Args are passed to the application. In socket mode they follow the socket path.
+	// An arguments file next to the binary replaces them, see readArgsFile.
+	Args []string `yaml:"args"`
+	// Env is added to the environment of the application, taking precedence
+	// over its .env files.
+	Env map[string]string `yaml:"env"`
+	// Params are added to the FastCGI params of every request, taking
+	// precedence over the standard ones. Values are templates, see
+	// paramData. PassEnv are variables of the spawner's environment passed
+	// as params.
+	Params  map[string]string `yaml:"params"`
+	PassEnv []string          `yaml:"passEnv"`
+	// ReadinessTimeout overrides Config.ReadinessTimeout.
+	ReadinessTimeout time.Duration `yaml:"readinessTimeout"`
+	// ReadinessInterval is the time between readiness probes (default 20ms).
+	ReadinessInterval time.Duration `yaml:"readinessInterval"`
+	// ReadinessPath is requested to check that a new process is ready, see
+	// probe; empty only waits for its socket to accept connections.
+	ReadinessPath string `yaml:"readinessPath"`
+	// HealthCheckPath is requested from every running process of the
+	// application every HealthCheckInterval (default 10s), and must be
+	// answered within HealthCheckTimeout (default 2s). A process failing
+	// HealthCheckFailures (default 3) checks in a row is replaced, see
+	// checkHealth. Empty disables health checks.
+	HealthCheckPath     string        `yaml:"healthCheckPath"`
+	HealthCheckInterval time.Duration `yaml:"healthCheckInterval"`
+	HealthCheckTimeout  time.Duration `yaml:"healthCheckTimeout"`
+	HealthCheckFailures int           `yaml:"healthCheckFailures"`
+	// UpstreamTimeout overrides Config.UpstreamTimeout; 0 disables it for the app.
+	UpstreamTimeout *time.Duration `yaml:"upstreamTimeout"`
+	// StopTimeout is the grace period a process gets to exit after SIGTERM
+	// before it is killed (default 1s).
+	StopTimeout time.Duration `yaml:"stopTimeout"`
+	// MinInstances processes are started when the app is first used (default 1).
+	MinInstances int `yaml:"minInstances"`
+	// MaxInstances caps the processes started when all instances are busy.
+	MaxInstances int `yaml:"maxInstances"`
+	// ScaleThreshold is the number of concurrent requests of an instance
+	// at which another one is started (default 1). ScaleDownDelay is how
+	// long instances beyond MinInstances may be idle before they are
+	// stopped, overriding the idle timeout for them.
+	ScaleThreshold int           `yaml:"scaleThreshold"`
+	ScaleDownDelay time.Duration `yaml:"scaleDownDelay"`
+	// MaxConcurrent and RequestQueueSize override Config.MaxConcurrent and
+	// Config.RequestQueueSize.
+	MaxConcurrent    int `yaml:"maxConcurrent"`
+	RequestQueueSize int `yaml:"requestQueueSize"`
+	// Balance selects how requests are spread over the instances:
+	// "least-connections" (default), "round-robin", or, keeping clients on
+	// one instance, "cookie" or "ip-hash".
+	Balance string `yaml:"balance"`
+	// User and Group override Config.User and Config.Group.
+	User  string `yaml:"user"`
+	Group string `yaml:"group"`
+	// SocketMode and SocketOwner override Config.SocketMode and
+	// Config.SocketOwner.
+	SocketMode  string `yaml:"socketMode"`
+	SocketOwner string `yaml:"socketOwner"`
+	// Protocol is the protocol the application speaks on its socket:
+	// "fastcgi" (default), "scgi" or "http", see proxyHTTP.
+	Protocol string `yaml:"protocol"`
+	// Multiplex decides whether concurrent requests to a FastCGI application
+	// share connections, each with its own request ID, see fcgiMux, instead
+	// of one connection per request in flight. By default they do if the
+	// application reports supporting it (FCGI_MPXS_CONNS), see negotiate;
+	// true also assumes it does if it doesn't answer, and false never
+	// multiplexes.
+	Multiplex *bool `yaml:"multiplex"`
+	// Restart is the restart policy: "always" (default), "on-failure" or
+	// "never", deciding whether an application whose process exited is
+	// started again, see recordExit.
+	Restart string `yaml:"restart"`
+	// MaxRestarts is how often the application is started again after its
+	// process exited within RestartWindow (0 for the whole lifetime of the
+	// spawner); 0 doesn't limit restarts.
+	MaxRestarts   int           `yaml:"maxRestarts"`
+	RestartWindow time.Duration `yaml:"restartWindow"`
+	// BackoffMultiplier is the factor the backoff of a failing application
+	// grows by with every failure (default 2).
+	BackoffMultiplier float64 `yaml:"backoffMultiplier"`
+	// Container runs the application in a container, see containerCommand.
+	Container *ContainerConfig `yaml:"container"`
+	// MaxMemory is the resident memory a process may use, e.g. "512M", and
+	// MaxCPU the share of a CPU core in percent it may use on average
+	// between two checks of the watchdog. OnLimit is what happens to a
+	// process exceeding them: "restart" (default) or "alert", see
+	// checkResources.
+	MaxMemory string  `yaml:"maxMemory"`
+	MaxCPU    float64 `yaml:"maxCPU"`
+	OnLimit   string  `yaml:"onLimit"`
+	// Singleton keeps spawners sharing Config.CoordinationDir from running
+	// the application at the same time, see lockSingleton.
+	Singleton bool `yaml:"singleton"`
+	// WorkDir is the working directory of the application, relative to the
+	// directory it is in. Without it, applications inherit the spawner's
+	// and CGI scripts run in their directory.
+	WorkDir string `yaml:"workDir"`
+	// Umask is the file mode creation mask of the application in octal,
+	// e.g. "027", see withUmask. Without it, the spawner's is inherited.
+	Umask string `yaml:"umask"`
+	// PrivateTmp gives every process of the application a TMPDIR of its
+	// own, removed when it exits, see makePrivateTmp.
+	PrivateTmp bool `yaml:"privateTmp"`
+	// Seccomp lists the system calls the application may not make, which
+	// fail with EPERM, see confine; "default" stands for
+	// defaultSeccompDeny. AppArmorProfile is the loaded AppArmor profile it
+	// runs confined by. NoNewPrivileges keeps it from gaining privileges
+	// through setuid binaries or file capabilities; seccomp implies it.
+	// Sidecar files can only tighten these: they add to Seccomp and can't
+	// replace the AppArmorProfile of Config.Apps.
+	Seccomp         []string `yaml:"seccomp"`
+	AppArmorProfile string   `yaml:"appArmorProfile"`
+	NoNewPrivileges bool     `yaml:"noNewPrivileges"`
+	// Isolate runs the application in a mount namespace of its own, in
+	// which only the web root of its site, read-only, BindReadOnlyPaths,
+	// BindPaths and its socket and temporary directories are visible, see
+	// isolate. The paths are only read from Config.Apps.
+	Isolate           bool     `yaml:"isolate"`
+	BindPaths         []string `yaml:"bindPaths"`
+	BindReadOnlyPaths []string `yaml:"bindReadOnlyPaths"`
+	// WarmUp lists the windows during which the application is kept
+	// running, see runWarmUps.
+	WarmUp []WarmUpWindow `yaml:"warmUp"`
+}
+
+// sidecarExtensions are the extensions of per-app config files, which are
+// named after the application, e.g. hello.fcgi.yaml.
+var sidecarExtensions = []string{".yaml", ".yml", ".toml"}
+
+// argsFileExtension is the extension of per-app files holding the arguments
+// of the application, one per line, e.g. hello.fcgi.args.
+const argsFileExtension = ".args"
+
+// isSidecarFile reports whether path is a per-app config or marker file.
+func (s *Spawner) isSidecarFile(path string) bool {
+	for _, ext := range slices.Concat(sidecarExtensions, httpMarkerExtensions, []string{argsFileExtension}) {
+		if filepath.Ext(path) == ext && s.isAppName(path[:len(path)-len(ext)]) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlay returns c with every field set in o replaced by the value from o,
+// except Command, BindPaths, BindReadOnlyPaths and the AppArmorProfile set
+// in c. Environment variables and denied system calls are merged.
+func (c AppConfig) overlay(o AppConfig) AppConfig {
+	if o.IdleTimeout != nil {
+		c.IdleTimeout = o.IdleTimeout
+	}
+	if o.Args != nil {
+		c.Args = o.Args
+	}
+	if o.Env != nil {
+		env := maps.Clone(c.Env)
+		if env == nil {
+			env = make(map[string]string)
+		}
+		maps.Copy(env, o.Env)
+		c.Env = env
+	}
+	if o.Params != nil {
+		params := maps.Clone(c.Params)
+		if params == nil {
+			params = make(map[string]string)
+		}
+		maps.Copy(params, o.Params)
+		c.Params = params
+	}
+	if o.PassEnv != nil {
+		c.PassEnv = o.PassEnv
+	}
+	if o.ReadinessTimeout != 0 {
+		c.ReadinessTimeout = o.ReadinessTimeout
+	}
+	if o.ReadinessInterval != 0 {
+		c.ReadinessInterval = o.ReadinessInterval
+	}
+	if o.ReadinessPath != "" {
+		c.ReadinessPath = o.ReadinessPath
+	}
+	if o.HealthCheckPath != "" {
+		c.HealthCheckPath = o.HealthCheckPath
+	}
+	if o.HealthCheckInterval != 0 {
+		c.HealthCheckInterval = o.HealthCheckInterval
+	}
+	if o.HealthCheckTimeout != 0 {
+		c.HealthCheckTimeout = o.HealthCheckTimeout
+	}
+	if o.HealthCheckFailures != 0 {
+		c.HealthCheckFailures = o.HealthCheckFailures
+	}
+	if o.UpstreamTimeout != nil {
+		c.UpstreamTimeout = o.UpstreamTimeout
+	}
+	if o.StopTimeout != 0 {
+		c.StopTimeout = o.StopTimeout
+	}
+	if o.MinInstances != 0 {
+		c.MinInstances = o.MinInstances
+	}
+	if o.MaxInstances != 0 {
+		c.MaxInstances = o.MaxInstances
+	}
+	if o.ScaleThreshold != 0 {
+		c.ScaleThreshold = o.ScaleThreshold
+	}
+	if o.ScaleDownDelay != 0 {
+		c.ScaleDownDelay = o.ScaleDownDelay
+	}
+	if o.MaxConcurrent != 0 {
+		c.MaxConcurrent = o.MaxConcurrent
+	}
+	if o.RequestQueueSize != 0 {
+		c.RequestQueueSize = o.RequestQueueSize
+	}
+	if o.Balance != "" {
+		c.Balance = o.Balance
+	}
+	if o.User != "" {
+		c.User = o.User
+	}
+	if o.Group != "" {
+		c.Group = o.Group
+	}
+	if o.SocketMode != "" {
+		c.SocketMode = o.SocketMode
+	}
+	if o.SocketOwner != "" {
+		c.SocketOwner = o.SocketOwner
+	}
+	if o.Protocol != "" {
+		c.Protocol = o.Protocol
+	}
+	if o.Multiplex != nil {
+		c.Multiplex = o.Multiplex
+	}
+	if o.Restart != "" {
+		c.Restart = o.Restart
+	}
+	if o.MaxRestarts != 0 {
+		c.MaxRestarts = o.MaxRestarts
+	}
+	if o.RestartWindow != 0 {
+		c.RestartWindow = o.RestartWindow
+	}
+	if o.BackoffMultiplier != 0 {
+		c.BackoffMultiplier = o.BackoffMultiplier
+	}
+	if o.Container != nil {
+		c.Container = o.Container
+	}
+	if o.MaxMemory != "" {
+		c.MaxMemory = o.MaxMemory
+	}
+	if o.MaxCPU != 0 {
+		c.MaxCPU = o.MaxCPU
+	}
+	if o.OnLimit != "" {
+		c.OnLimit = o.OnLimit
+	}
+	if o.Singleton {
+		c.Singleton = o.Singleton
+	}
+	if o.WorkDir != "" {
+		c.WorkDir = o.WorkDir
+	}
+	if o.Umask != "" {
+		c.Umask = o.Umask
+	}
+	if o.PrivateTmp {
+		c.PrivateTmp = o.PrivateTmp
+	}
+	if o.Seccomp != nil {
+		c.Seccomp = slices.Concat(c.Seccomp, o.Seccomp)
+	}
+	if o.AppArmorProfile != "" && c.AppArmorProfile == "" {
+		c.AppArmorProfile = o.AppArmorProfile
+	}
+	if o.NoNewPrivileges {
+		c.NoNewPrivileges = o.NoNewPrivileges
+	}
+	if o.Isolate {
+		c.Isolate = o.Isolate
+	}
+	if o.WarmUp != nil {
+		c.WarmUp = o.WarmUp
+	}
+	return c
+}
+
+// appConfig returns the settings of the application at appPath: the entry
+// in Config.Apps, keyed by its path relative to the web root of its site,
+// overridden by a marker file selecting the HTTP protocol, by the sidecar
+// file next to the binary and by its arguments file. Sidecar and arguments
+// files are ignored in manifest mode.
+func (s *Spawner) appConfig(appPath string) (AppConfig, error) {
+	var app AppConfig
+	if rel, err := filepath.Rel(s.siteOf(appPath).webRoot, appPath); err == nil {
+		app = s.Config.Apps[filepath.ToSlash(rel)]
+	}
+	if hasHTTPMarker(appPath) {
+		app.Protocol = protocolHTTP
+	}
+	extensions := sidecarExtensions
+	if s.Config.Manifest {
+		// Only the configuration declares applications.
+		extensions = nil
+	}
+	for _, ext := range extensions {
+		path := appPath + ext
+		var sidecar AppConfig
+		err := decodeFile(path, &sidecar)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return AppConfig{}, fmt.Errorf("invalid app config: %v", err)
+		}
+		app = app.overlay(sidecar)
+		break
+	}
+	if extensions != nil {
+		args, err := readArgsFile(appPath + argsFileExtension)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return AppConfig{}, fmt.Errorf("invalid app config: %v", err)
+		}
+		if err == nil {
+			app.Args = args
+		}
+	}
+	if err := app.validate(); err != nil {
+		return AppConfig{}, fmt.Errorf("invalid app config for %s: %v", appPath, err)
+	}
+	return app, nil
+}
+
+// readArgsFile returns the arguments in the file at path, one per line and
+// taken as is, without quoting. Blank lines and lines starting with # are
+// skipped.
+func readArgsFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{}
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			args = append(args, line)
+		}
+	}
+	return args, nil
+}
+
+// validate checks the values that can't be rejected while decoding.
+func (c AppConfig) validate() error {
+	if c.MinInstances < 0 || c.MaxInstances < 0 {
+		return errors.New("instance counts must not be negative")
+	}
+	if c.ScaleThreshold < 0 || c.ScaleDownDelay < 0 {
+		return errors.New("scaleThreshold and scaleDownDelay must not be negative")
+	}
+	if c.MaxConcurrent < 0 || c.RequestQueueSize < 0 {
+		return errors.New("maxConcurrent and requestQueueSize must not be negative")
+	}
+	if err := c.validateParams(); err != nil {
+		return err
+	}
+	switch c.Protocol {
+	case "", protocolFastCGI, protocolSCGI, protocolHTTP:
+	default:
+		return fmt.Errorf("unknown protocol %q", c.Protocol)
+	}
+	if c.Multiplex != nil && *c.Multiplex && c.Protocol != "" && c.Protocol != protocolFastCGI {
+		return fmt.Errorf("multiplex needs the fastcgi protocol, not %s", c.Protocol)
+	}
+	switch c.Restart {
+	case "", restartAlways, restartOnFailure, restartNever:
+	default:
+		return fmt.Errorf("unknown restart policy %q", c.Restart)
+	}
+	if c.MaxRestarts < 0 || c.RestartWindow < 0 {
+		return errors.New("maxRestarts and restartWindow must not be negative")
+	}
+	if c.BackoffMultiplier != 0 && c.BackoffMultiplier < 1 {
+		return fmt.Errorf("backoff multiplier %g must be at least 1", c.BackoffMultiplier)
+	}
+	if c.ReadinessPath != "" && !strings.HasPrefix(c.ReadinessPath, "/") {
+		return fmt.Errorf("readiness path %q must start with /", c.ReadinessPath)
+	}
+	if c.HealthCheckPath != "" && !strings.HasPrefix(c.HealthCheckPath, "/") {
+		return fmt.Errorf("health check path %q must start with /", c.HealthCheckPath)
+	}
+	if c.HealthCheckInterval < 0 || c.HealthCheckTimeout < 0 || c.HealthCheckFailures < 0 {
+		return errors.New("healthCheckInterval, healthCheckTimeout and healthCheckFailures must not be negative")
+	}
+	if c.Container != nil && c.Container.Image == "" {
+		return errors.New("container image is missing")
+	}
+	if c.SocketMode != "" {
+		if _, err := parseFileMode(c.SocketMode); err != nil {
+			return fmt.Errorf("invalid socket mode: %v", err)
+		}
+	}
+	if c.Container != nil && c.Command != "" {
+		return errors.New("command and container can't be combined")
+	}
+	if c.Umask != "" {
+		if _, err := parseFileMode(c.Umask); err != nil {
+			return fmt.Errorf("invalid umask: %v", err)
+		}
+	}
+	if c.Container != nil && (c.WorkDir != "" || c.Umask != "" || c.PrivateTmp) {
+		return errors.New("workDir, umask and privateTmp can't be combined with container")
+	}
+	if err := c.validateSandbox(); err != nil {
+		return err
+	}
+	if err := c.validateLimits(); err != nil {
+		return err
+	}
+	if err := c.validateWarmUp(); err != nil {
+		return err
+	}
+	switch c.Balance {
+	case "", balanceLeastConnections, balanceRoundRobin, balanceCookie, balanceIPHash:
+		return nil
+	default:
+		return fmt.Errorf("unknown balance %q", c.Balance)
+	}
+}
+
+// idleTimeoutFor returns the idle timeout applying to child.
+func (s *Spawner) idleTimeoutFor(child *childProcess) time.Duration {
+	if child.app.ScaleDownDelay > 0 && child.instance >= child.app.minInstances() {
+		return child.app.ScaleDownDelay
+	}
+	if child.app.IdleTimeout != nil {
+		return *child.app.IdleTimeout
+	}
+	return s.Config.DefaultIdleTimeout
+}
+
+// readinessTimeoutFor returns how long the application may take to start.
+func (s *Spawner) readinessTimeoutFor(app AppConfig) time.Duration {
+	if app.ReadinessTimeout > 0 {
+		return app.ReadinessTimeout
+	}
+	if s.Config.ReadinessTimeout > 0 {
+		return s.Config.ReadinessTimeout
+	}
+	return 5 * time.Second
+}
+
+// upstreamTimeoutFor returns how long the application may take to send the
+// response headers.
+func (s *Spawner) upstreamTimeoutFor(app AppConfig) time.Duration {
+	if app.UpstreamTimeout != nil {
+		return *app.UpstreamTimeout
+	}
+	return s.Config.UpstreamTimeout
+}
+
+// stopTimeoutFor returns how long the application gets to exit after SIGTERM.
+func (s *Spawner) stopTimeoutFor(app AppConfig) time.Duration {
+	if app.StopTimeout > 0 {
+		return app.StopTimeout
+	}
+	return time.Second
+}
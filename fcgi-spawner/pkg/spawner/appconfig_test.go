@@ -0,0 +1,121 @@
+package spawner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAppConfig(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "hello.fcgi")
+	sidecar := `idleTimeout: 0s
+args: ["-verbose"]
+env:
+  GREETING: hi
+`
+	if err := os.WriteFile(appPath+".yaml", []byte(sidecar), 0644); err != nil {
+		t.Fatalf("Failed to write sidecar: %v", err)
+	}
+
+	global := time.Minute
+	s := NewSpawner(&Config{
+		WebRoot:            webRoot,
+		DefaultIdleTimeout: 5 * time.Minute,
+		Apps: map[string]AppConfig{
+			"hello.fcgi": {
+				IdleTimeout:      &global,
+				Env:              map[string]string{"GREETING": "hello", "LANG": "C"},
+				ReadinessTimeout: 10 * time.Second,
+			},
+		},
+	})
+
+	app, err := s.appConfig(appPath)
+	if err != nil {
+		t.Fatalf("appConfig() error = %v", err)
+	}
+	if app.IdleTimeout == nil || *app.IdleTimeout != 0 {
+		t.Errorf("appConfig() IdleTimeout = %v, want 0 from the sidecar", app.IdleTimeout)
+	}
+	if !reflect.DeepEqual(app.Args, []string{"-verbose"}) {
+		t.Errorf("appConfig() Args = %v, want [-verbose]", app.Args)
+	}
+	if want := map[string]string{"GREETING": "hi", "LANG": "C"}; !reflect.DeepEqual(app.Env, want) {
+		t.Errorf("appConfig() Env = %v, want %v", app.Env, want)
+	}
+	if app.ReadinessTimeout != 10*time.Second {
+		t.Errorf("appConfig() ReadinessTimeout = %v, want value from the global config", app.ReadinessTimeout)
+	}
+
+	// The sidecar disables the idle timeout for this app only.
+	if got := s.idleTimeoutFor(&childProcess{app: app}); got != 0 {
+		t.Errorf("idleTimeoutFor() = %v, want 0", got)
+	}
+	if got := s.idleTimeoutFor(&childProcess{}); got != 5*time.Minute {
+		t.Errorf("idleTimeoutFor() = %v, want the default", got)
+	}
+
+	// Other apps are not affected.
+	other, err := s.appConfig(filepath.Join(webRoot, "other.fcgi"))
+	if err != nil {
+		t.Fatalf("appConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(other, AppConfig{}) {
+		t.Errorf("appConfig() for other app = %+v, want defaults", other)
+	}
+}
+
+func TestAppConfigArgsFile(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "hello.fcgi")
+	args := "# Listen address\n-addr\n\n  :9000  \n--title=Hello world\n"
+	if err := os.WriteFile(appPath+".args", []byte(args), 0644); err != nil {
+		t.Fatalf("Failed to write arguments file: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot, Apps: map[string]AppConfig{"hello.fcgi": {Args: []string{"-verbose"}}}})
+
+	app, err := s.appConfig(appPath)
+	if err != nil {
+		t.Fatalf("appConfig() error = %v", err)
+	}
+	if want := []string{"-addr", ":9000", "--title=Hello world"}; !reflect.DeepEqual(app.Args, want) {
+		t.Errorf("appConfig() Args = %q, want %q", app.Args, want)
+	}
+
+	// An empty file passes no arguments at all.
+	if err := os.WriteFile(appPath+".args", nil, 0644); err != nil {
+		t.Fatalf("Failed to write arguments file: %v", err)
+	}
+	if app, _ := s.appConfig(appPath); app.Args == nil || len(app.Args) != 0 {
+		t.Errorf("appConfig() Args = %q with an empty arguments file, want none", app.Args)
+	}
+
+	// Like sidecar files, it is ignored in manifest mode.
+	s.Config.Manifest = true
+	if app, _ := s.appConfig(appPath); !reflect.DeepEqual(app.Args, []string{"-verbose"}) {
+		t.Errorf("appConfig() Args = %q in manifest mode, want those from the config", app.Args)
+	}
+}
+
+func TestIsSidecarFile(t *testing.T) {
+	s := NewSpawner(&Config{Interpreters: map[string]string{".php": "php-cgi"}})
+	tests := map[string]bool{
+		"/web/hello.fcgi.yaml": true,
+		"/web/hello.fcgi.toml": true,
+		"/web/index.php.yaml":  true,
+		"/web/hello.fcgi":      false,
+		"/web/spawner.yaml":    false,
+		"/web/hello.env":       false,
+		"/web/hello.fcgi.args": true,
+		"/web/hello.args":      false,
+		"/web/script.py.yaml":  false,
+	}
+	for path, want := range tests {
+		if got := s.isSidecarFile(path); got != want {
+			t.Errorf("isSidecarFile(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
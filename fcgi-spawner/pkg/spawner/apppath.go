@@ -0,0 +1,82 @@
+package spawner
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// errForbiddenPath is returned for URL paths trying to leave WebRoot.
+var errForbiddenPath = errors.New("path leaves webRoot")
+
+// findApp returns the application serving urlPath: the shortest prefix of the
+// path, segment by segment, naming an application or a CGI script below
+// webRoot, or an application declared with a command. For
+// /api/v1/users.fcgi/42 that is webRoot/api/v1/users.fcgi. It returns an
+// empty path if there is none. Hidden directories are never searched.
+func (s *Spawner) findApp(webRoot, urlPath string) (string, error) {
+	current := webRoot
+	for _, segment := range strings.Split(urlPath, "/") {
+		switch {
+		case segment == "" || segment == ".":
+			continue
+		case segment == "..":
+			return "", errForbiddenPath
+		case strings.HasPrefix(segment, "."):
+			return "", nil
+		}
+		current = filepath.Join(current, segment)
+		if s.isApp(current) || s.isCGIScript(current) {
+			return current, nil
+		}
+	}
+	return "", nil
+}
+
+// isExecutable reports whether path is an executable regular file.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
+
+// relApp returns the path of the application at appPath relative to the web
+// root of its site, e.g. api/v1/users.fcgi.
+func (s *Spawner) relApp(appPath string) string {
+	rel, err := filepath.Rel(s.siteOf(appPath).webRoot, appPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.Base(appPath)
+	}
+	return rel
+}
+
+// splitScriptPath splits urlPath into the SCRIPT_NAME of the application at
+// appPath and the PATH_INFO following it, the way nginx and Apache do:
+// /api/users.fcgi/42 becomes /api/users.fcgi and /42.
+func (s *Spawner) splitScriptPath(urlPath, appPath string) (scriptName, pathInfo string) {
+	scriptName = "/" + filepath.ToSlash(s.relApp(appPath))
+	rest, ok := strings.CutPrefix(urlPath, scriptName)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return urlPath, ""
+	}
+	return scriptName, rest
+}
+
+// watchTree adds dir and its subdirectories, except hidden ones, to watcher.
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
@@ -0,0 +1,83 @@
+package spawner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindApp(t *testing.T) {
+	root := t.TempDir()
+	webRoot := filepath.Join(root, "web")
+	files := map[string]os.FileMode{
+		"web/hello.fcgi":             0755,
+		"web/api/v1/users.fcgi":      0755,
+		"web/docs/readme.fcgi":       0644, // not executable
+		"web/.hidden/secret.fcgi":    0755,
+		"web2/evil.fcgi":             0755,
+		"web/api/v1/users.fcgi.yaml": 0644,
+	}
+	for name, mode := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, nil, mode); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot})
+
+	tests := []struct {
+		urlPath string
+		want    string
+		wantErr error
+	}{
+		{urlPath: "/hello.fcgi", want: "hello.fcgi"},
+		{urlPath: "/hello.fcgi/users/42", want: "hello.fcgi"},
+		{urlPath: "/api/v1/users.fcgi", want: "api/v1/users.fcgi"},
+		{urlPath: "//api/./v1/users.fcgi/42", want: "api/v1/users.fcgi"},
+		{urlPath: "/other/hello.fcgi"},
+		{urlPath: "/docs/readme.fcgi"},
+		{urlPath: "/.hidden/secret.fcgi"},
+		{urlPath: "/index.html"},
+		{urlPath: "/../web2/evil.fcgi", wantErr: errForbiddenPath},
+		{urlPath: "/api/../../web2/evil.fcgi", wantErr: errForbiddenPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.urlPath, func(t *testing.T) {
+			got, err := s.findApp(webRoot, tt.urlPath)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("findApp() error = %v, want %v", err, tt.wantErr)
+			}
+			want := ""
+			if tt.want != "" {
+				want = filepath.Join(webRoot, tt.want)
+			}
+			if got != want {
+				t.Errorf("findApp() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestSplitScriptPath(t *testing.T) {
+	s := NewSpawner(&Config{WebRoot: "/web"})
+	tests := []struct {
+		urlPath, appPath     string
+		scriptName, pathInfo string
+	}{
+		{"/app.fcgi", "/web/app.fcgi", "/app.fcgi", ""},
+		{"/app.fcgi/", "/web/app.fcgi", "/app.fcgi", "/"},
+		{"/app.fcgi/users/42", "/web/app.fcgi", "/app.fcgi", "/users/42"},
+		{"/api/v1/users.fcgi/42", "/web/api/v1/users.fcgi", "/api/v1/users.fcgi", "/42"},
+		{"/app.fcgix", "/web/app.fcgi", "/app.fcgix", ""},
+	}
+	for _, tt := range tests {
+		scriptName, pathInfo := s.splitScriptPath(tt.urlPath, tt.appPath)
+		if scriptName != tt.scriptName || pathInfo != tt.pathInfo {
+			t.Errorf("splitScriptPath(%q, %q) = %q, %q, want %q, %q", tt.urlPath, tt.appPath, scriptName, pathInfo, tt.scriptName, tt.pathInfo)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package spawner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// adminOperatorDefault is the operator using Config.AdminToken.
+	adminOperatorDefault = "admin"
+	// auditActorWatcher is the actor of reloads after changes to binaries
+	// and per-app files.
+	auditActorWatcher = "watcher"
+)
+
+// auditEntry is a line of the audit log.
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`            // Operator of the admin API, or auditActorWatcher
+	Remote string    `json:"remote,omitempty"` // Address the admin API was used from
+	Action string    `json:"action"`
+	App    string    `json:"app,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+	Error  string    `json:"error,omitempty"` // Why the action failed
+}
+
+// auditLog appends a JSON line for every administrative action to a file,
+// so that operators sharing a spawner can tell who did what and when.
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openAuditLog opens the audit log at path for appending, creating it if
+// needed. Only the spawner's user can read it.
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{file: f}, nil
+}
+
+// record appends entry to the log. A nil log records nothing.
+func (l *auditLog) record(entry auditEntry) {
+	if l == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		adminLog.Error("Failed to write to the audit log", "error", err, "entry", string(line))
+	}
+}
+
+// close closes the log; later entries are dropped.
+func (l *auditLog) close() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+// adminOperatorKey is the context key of the operator of an admin request,
+// see requireAdminToken.
+type adminOperatorKey struct{}
+
+// adminOperator returns the operator whose token authorized r.
+func adminOperator(r *http.Request) string {
+	operator, _ := r.Context().Value(adminOperatorKey{}).(string)
+	return operator
+}
+
+// withAdminOperator returns r with operator as the one who sent it.
+func withAdminOperator(r *http.Request, operator string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), adminOperatorKey{}, operator))
+}
+
+// auditAdmin records the admin action of r on the application at appPath,
+// "" for none, which failed with err if not nil.
+func (s *Spawner) auditAdmin(r *http.Request, action, appPath, detail string, err error) {
+	entry := auditEntry{
+		Actor:  adminOperator(r),
+		Remote: r.RemoteAddr,
+		Action: action,
+		Detail: detail,
+	}
+	if appPath != "" {
+		entry.App = s.relApp(appPath)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	s.audit.record(entry)
+}
@@ -0,0 +1,95 @@
+package spawner
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "audited.fcgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "audit.log")
+	s := NewSpawner(&Config{WebRoot: webRoot, AdminToken: "secret", AdminTokens: map[string]string{"alice": "alice-token"}, AuditLog: path})
+	audit, err := openAuditLog(path)
+	if err != nil {
+		t.Fatalf("openAuditLog() error = %v", err)
+	}
+	s.audit = audit
+	t.Cleanup(func() { s.stopApp(appPath) })
+
+	handler := s.AdminHandler()
+	for _, req := range []struct{ path, token string }{
+		{"/apps/audited.fcgi/start", "alice-token"},
+		{"/apps/audited.fcgi/restart", "secret"},
+		{"/apps/audited.fcgi/stop", "guess"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, req.path, nil)
+		r.Header.Set("Authorization", "Bearer "+req.token)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	s.upgradeApp(appPath)
+	s.audit.close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer f.Close()
+	var got []auditEntry
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Invalid audit log line %q: %v", scanner.Text(), err)
+		}
+		if entry.Time.IsZero() {
+			t.Errorf("Entry %q has no time", scanner.Text())
+		}
+		got = append(got, entry)
+	}
+
+	want := []struct{ actor, action, app string }{
+		{"alice", "start", "audited.fcgi"},
+		{"admin", "restart", "audited.fcgi"},
+		{"", "unauthorized", ""},
+		{auditActorWatcher, "reload", "audited.fcgi"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Audit log has %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].Actor != w.actor || got[i].Action != w.action || got[i].App != w.app {
+			t.Errorf("Entry %d = %+v, want actor %q, action %q, app %q", i, got[i], w.actor, w.action, w.app)
+		}
+	}
+	if got[0].Remote == "" {
+		t.Errorf("Entry of the admin API has no remote address: %+v", got[0])
+	}
+	if got[2].Detail != "POST /apps/audited.fcgi/stop" {
+		t.Errorf("Detail of the rejected request = %q, want POST /apps/audited.fcgi/stop", got[2].Detail)
+	}
+}
+
+func TestValidateAdminTokens(t *testing.T) {
+	tests := []struct {
+		tokens  map[string]string
+		wantErr bool
+	}{
+		{map[string]string{"alice": "a", "bob": "b"}, false},
+		{map[string]string{"alice": ""}, true},
+		{map[string]string{"alice": "secret"}, true},
+	}
+	for _, tt := range tests {
+		cfg := &Config{WebRoot: t.TempDir(), AdminToken: "secret", AdminTokens: tt.tokens}
+		if err := cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate() with adminTokens %v error = %v, wantErr %v", tt.tokens, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package spawner
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AuthRule protects the URL paths it matches before requests reach an
+// application or the static files, either with HTTP basic auth against an
+// htpasswd file, or by asking an external service whether to let the request
+// through, like nginx's auth_request.
+type AuthRule struct {
+	// Path matches like Route.Path: the URL path exactly, or, ending in /*,
+	// the path and everything below it, e.g. /admin/*.
+	Path string `yaml:"path"`
+	// Htpasswd is a file of user:hash lines with bcrypt (htpasswd -B) or
+	// SHA-1 (htpasswd -s) hashes. Realm is shown by browsers asking for the
+	// password.
+	Htpasswd string `yaml:"htpasswd"`
+	Realm    string `yaml:"realm"`
+	// ForwardAuth is the URL asked about every request, see forwardAuth.
+	// AuthResponseHeaders are copied from its answer to the request passed
+	// on, e.g. X-Auth-User.
+	ForwardAuth         string   `yaml:"forwardAuth"`
+	AuthResponseHeaders []string `yaml:"authResponseHeaders"`
+
+	users *htpasswdFile
+}
+
+// forwardAuthTimeout is how long the forward-auth service may take to answer.
+const forwardAuthTimeout = 10 * time.Second
+
+// forwardAuthClient asks forward-auth services about requests. Redirects are
+// passed on to the client, e.g. to a login page.
+var forwardAuthClient = &http.Client{
+	Timeout: forwardAuthTimeout,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// validateAuth checks the auth rules and loads their htpasswd files.
+func (c *Config) validateAuth() error {
+	for i := range c.Auth {
+		rule := &c.Auth[i]
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("auth rule %d: path %q must start with /", i+1, rule.Path)
+		}
+		if (rule.Htpasswd == "") == (rule.ForwardAuth == "") {
+			return fmt.Errorf("auth rule %d: exactly one of htpasswd and forwardAuth must be set", i+1)
+		}
+		if rule.ForwardAuth != "" {
+			if u, err := url.Parse(rule.ForwardAuth); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("auth rule %d: forwardAuth %q must be an http or https URL", i+1, rule.ForwardAuth)
+			}
+			continue
+		}
+		rule.users = &htpasswdFile{path: rule.Htpasswd}
+		if err := rule.users.load(); err != nil {
+			return fmt.Errorf("auth rule %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// authRuleFor returns the first auth rule matching urlPath, or nil.
+func (s *Spawner) authRuleFor(urlPath string) *AuthRule {
+	for i := range s.Config.Auth {
+		rule := &s.Config.Auth[i]
+		if _, _, ok := (&Route{Path: rule.Path}).match(urlPath); ok {
+			return rule
+		}
+	}
+	return nil
+}
+
+type authUserKey struct{}
+
+// authUserFrom returns the user the request with context ctx was
+// authenticated as with basic auth, or "".
+func authUserFrom(ctx context.Context) string {
+	user, _ := ctx.Value(authUserKey{}).(string)
+	return user
+}
+
+// authorize checks r against the auth rule protecting its path, if any. It
+// returns the request to pass on, or nil if it answered the request itself.
+func (s *Spawner) authorize(w http.ResponseWriter, r *http.Request) *http.Request {
+	rule := s.authRuleFor(r.URL.Path)
+	switch {
+	case rule == nil:
+		return r
+	case rule.users != nil:
+		return s.basicAuth(w, r, rule)
+	default:
+		return s.forwardAuth(w, r, rule)
+	}
+}
+
+// basicAuth lets r through if it carries the password of a user in the
+// htpasswd file of rule, and asks for one otherwise.
+func (s *Spawner) basicAuth(w http.ResponseWriter, r *http.Request, rule *AuthRule) *http.Request {
+	user, password, ok := r.BasicAuth()
+	if ok {
+		if err := rule.users.load(); err != nil {
+			// Keep the users loaded before, the file may be being rewritten.
+			proxyLog.Error("Error reloading htpasswd file", "path", rule.Htpasswd, "error", err)
+		}
+		if rule.users.check(user, password) {
+			return r.WithContext(context.WithValue(r.Context(), authUserKey{}, user))
+		}
+		proxyLog.Info("Basic auth failed", "path", r.URL.Path, "user", user)
+	}
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", cmp.Or(rule.Realm, "Restricted")))
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return nil
+}
+
+// forwardAuth asks the forward-auth service of rule about r, sending it the
+// headers of r without its body, along with the original method and URI in
+// X-Forwarded-Method and X-Forwarded-Uri (and X-Original-URI, as nginx
+// does). A 2xx answer lets r through, with the AuthResponseHeaders of the
+// answer. Any other answer, such as 401 or a redirect to a login page, is
+// sent to the client instead.
+func (s *Spawner) forwardAuth(w http.ResponseWriter, r *http.Request, rule *AuthRule) *http.Request {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, rule.ForwardAuth, nil)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		proxyLog.Error("Error creating forward-auth request", "url", rule.ForwardAuth, "error", err)
+		return nil
+	}
+	for name, values := range r.Header {
+		switch http.CanonicalHeaderKey(name) {
+		case "Connection", "Keep-Alive", "Te", "Trailer", "Transfer-Encoding", "Upgrade", "Content-Length":
+			continue
+		}
+		req.Header[name] = values
+	}
+	s.setForwardedHeaders(req.Header, r)
+	req.Header.Set("X-Forwarded-Method", r.Method)
+	req.Header.Set("X-Forwarded-Uri", r.URL.RequestURI())
+	req.Header.Set("X-Original-URI", r.URL.RequestURI())
+
+	resp, err := forwardAuthClient.Do(req)
+	if err != nil {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		proxyLog.Error("Forward-auth request failed", "url", rule.ForwardAuth, "error", err)
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		r = r.Clone(r.Context())
+		for _, name := range rule.AuthResponseHeaders {
+			// Values sent by the client must not pass for ones of the service.
+			r.Header.Del(name)
+			for _, value := range resp.Header.Values(name) {
+				r.Header.Add(name, value)
+			}
+		}
+		return r
+	}
+	for name, values := range resp.Header {
+		switch http.CanonicalHeaderKey(name) {
+		case "Connection", "Keep-Alive", "Transfer-Encoding", "Content-Length":
+			continue
+		}
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+	proxyLog.Debug("Forward-auth denied request", "path", r.URL.Path, "status", resp.StatusCode)
+	return nil
+}
+
+// htpasswdFile holds the users of an htpasswd file, reloaded when the file
+// changes.
+type htpasswdFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	users   map[string]string // Password hashes by user
+}
+
+// load reads the file if it changed since it was last read.
+func (f *htpasswdFile) load() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.users != nil && info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return fmt.Errorf("%s:%d: expected user:hash", f.path, n)
+		}
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "{SHA}") {
+			return fmt.Errorf("%s:%d: unsupported password hash of %s, use bcrypt (htpasswd -B)", f.path, n, user)
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	f.users, f.modTime = users, info.ModTime()
+	return nil
+}
+
+// check reports whether password is the password of user.
+func (f *htpasswdFile) check(user, password string) bool {
+	f.mu.Lock()
+	hash, ok := f.users[user]
+	f.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if sha, ok := strings.CutPrefix(hash, "{SHA}"); ok {
+		sum := sha1.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(base64.StdEncoding.EncodeToString(sum[:])), []byte(sha)) == 1
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil && !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		proxyLog.Warn("Invalid password hash in htpasswd file", "path", f.path, "user", user, "error", err)
+	}
+	return err == nil
+}
@@ -0,0 +1,158 @@
+package spawner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestValidateAuth(t *testing.T) {
+	htpasswd := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(htpasswd, []byte("alice:{SHA}qUqP5cyxm6YcTAhz05Hph5gvu9M=\n"), 0600); err != nil {
+		t.Fatalf("Failed to write htpasswd: %v", err)
+	}
+	md5 := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(md5, []byte("bob:$apr1$salt$hash\n"), 0600); err != nil {
+		t.Fatalf("Failed to write htpasswd: %v", err)
+	}
+	tests := []struct {
+		rule    AuthRule
+		wantErr bool
+	}{
+		{rule: AuthRule{Path: "/admin/*", Htpasswd: htpasswd}},
+		{rule: AuthRule{Path: "/app/*", ForwardAuth: "http://127.0.0.1:9091/verify"}},
+		{rule: AuthRule{Path: "admin", Htpasswd: htpasswd}, wantErr: true},
+		{rule: AuthRule{Path: "/admin/*"}, wantErr: true},
+		{rule: AuthRule{Path: "/admin/*", Htpasswd: htpasswd, ForwardAuth: "http://127.0.0.1/"}, wantErr: true},
+		{rule: AuthRule{Path: "/admin/*", ForwardAuth: "127.0.0.1:9091"}, wantErr: true},
+		{rule: AuthRule{Path: "/admin/*", Htpasswd: filepath.Join(t.TempDir(), "missing")}, wantErr: true},
+		{rule: AuthRule{Path: "/admin/*", Htpasswd: md5}, wantErr: true},
+	}
+	for _, tt := range tests {
+		cfg := Config{Auth: []AuthRule{tt.rule}}
+		if err := cfg.validateAuth(); (err != nil) != tt.wantErr {
+			t.Errorf("validateAuth(%+v) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	webRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(webRoot, "whoami.cgi"), []byte("#!/bin/sh\nprintf 'Content-Type: text/plain\\r\\n\\r\\n%s %s' \"$AUTH_TYPE\" \"$REMOTE_USER\"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword() error = %v", err)
+	}
+	htpasswd := filepath.Join(t.TempDir(), "htpasswd")
+	// bob's password is "password".
+	content := "# users\nalice:" + string(hash) + "\nbob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"
+	if err := os.WriteFile(htpasswd, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write htpasswd: %v", err)
+	}
+	cfg := &Config{WebRoot: webRoot, Auth: []AuthRule{{Path: "/whoami.cgi", Htpasswd: htpasswd, Realm: "Staff"}}}
+	if err := cfg.validateAuth(); err != nil {
+		t.Fatalf("validateAuth() error = %v", err)
+	}
+	s := NewSpawner(cfg)
+
+	tests := []struct {
+		user, password string
+		wantStatus     int
+		wantBody       string
+	}{
+		{wantStatus: http.StatusUnauthorized},
+		{user: "alice", password: "wrong", wantStatus: http.StatusUnauthorized},
+		{user: "carol", password: "secret", wantStatus: http.StatusUnauthorized},
+		{user: "alice", password: "secret", wantStatus: http.StatusOK, wantBody: "Basic alice"},
+		{user: "bob", password: "password", wantStatus: http.StatusOK, wantBody: "Basic bob"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/whoami.cgi", nil)
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, tt.password)
+		}
+		w := httptest.NewRecorder()
+		s.spawnerHandler(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s:%s: status = %d, want %d", tt.user, tt.password, w.Code, tt.wantStatus)
+		}
+		if tt.wantStatus == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != `Basic realm="Staff", charset="UTF-8"` {
+			t.Errorf("%s:%s: WWW-Authenticate = %q", tt.user, tt.password, w.Header().Get("WWW-Authenticate"))
+		}
+		if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+			t.Errorf("%s:%s: body = %q, want %q", tt.user, tt.password, w.Body.String(), tt.wantBody)
+		}
+	}
+}
+
+func TestForwardAuth(t *testing.T) {
+	webRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(webRoot, "user.cgi"), []byte("#!/bin/sh\nprintf 'Content-Type: text/plain\\r\\n\\r\\n%s' \"$HTTP_X_AUTH_USER\"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	authService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Forwarded-Method") != http.MethodPost || r.Header.Get("X-Forwarded-Uri") != "/user.cgi?q=1" {
+			http.Error(w, "missing original request", http.StatusBadRequest)
+			return
+		}
+		switch r.Header.Get("Cookie") {
+		case "session=alice":
+			w.Header().Set("X-Auth-User", "alice")
+		case "":
+			http.Redirect(w, r, "https://login.example.com/", http.StatusFound)
+		default:
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		}
+	}))
+	defer authService.Close()
+
+	cfg := &Config{WebRoot: webRoot, Auth: []AuthRule{{Path: "/user.cgi", ForwardAuth: authService.URL, AuthResponseHeaders: []string{"X-Auth-User"}}}}
+	if err := cfg.validateAuth(); err != nil {
+		t.Fatalf("validateAuth() error = %v", err)
+	}
+	s := NewSpawner(cfg)
+
+	tests := []struct {
+		cookie     string
+		wantStatus int
+		wantBody   string
+	}{
+		{cookie: "session=alice", wantStatus: http.StatusOK, wantBody: "alice"},
+		{cookie: "", wantStatus: http.StatusFound},
+		{cookie: "session=mallory", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/user.cgi?q=1", strings.NewReader("body"))
+		if tt.cookie != "" {
+			r.Header.Set("Cookie", tt.cookie)
+		}
+		// The client can't make up the headers of the auth service.
+		r.Header.Set("X-Auth-User", "root")
+		w := httptest.NewRecorder()
+		s.spawnerHandler(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("cookie %q: status = %d, want %d", tt.cookie, w.Code, tt.wantStatus)
+		}
+		if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+			t.Errorf("cookie %q: body = %q, want %q", tt.cookie, w.Body.String(), tt.wantBody)
+		}
+		if tt.wantStatus == http.StatusFound && w.Header().Get("Location") != "https://login.example.com/" {
+			t.Errorf("cookie %q: Location = %q", tt.cookie, w.Header().Get("Location"))
+		}
+	}
+
+	// Unprotected paths don't ask the auth service.
+	authService.Close()
+	w := httptest.NewRecorder()
+	s.spawnerHandler(w, httptest.NewRequest(http.MethodGet, "/other", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /other: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,118 @@
+package spawner
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// defaultSpoolThreshold is the Config.SpoolThreshold unless it is set.
+const defaultSpoolThreshold = 1 << 20
+
+// requestBodyError is returned when the body of a request can't be read from
+// the client, who went away, sent a malformed body or exceeded a limit.
+type requestBodyError struct {
+	err error
+}
+
+func (e *requestBodyError) Error() string {
+	return fmt.Sprintf("reading request body: %v", e.err)
+}
+
+func (e *requestBodyError) Unwrap() error {
+	return e.err
+}
+
+// failRequestBody answers a request to the application at appPath whose body
+// couldn't be read because of err.
+func failRequestBody(w http.ResponseWriter, appPath string, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+	} else {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+	}
+	proxyLog.Debug("Failed to read request body", "app", appPath, "error", err)
+}
+
+// sizedBody returns the body of r and its length, for applications that need
+// the length up front. A body of unknown length is read to find out, into
+// memory up to Config.SpoolThreshold and into a temporary file in
+// Config.SpoolDir beyond, so that large uploads don't take up the memory of
+// the spawner. The returned function releases the file.
+func (s *Spawner) sizedBody(r *http.Request) (io.Reader, int64, func(), error) {
+	if r.Body == nil || r.ContentLength == 0 {
+		return http.NoBody, 0, func() {}, nil
+	}
+	if r.ContentLength > 0 {
+		return r.Body, r.ContentLength, func() {}, nil
+	}
+	threshold := cmp.Or(s.Config.SpoolThreshold, defaultSpoolThreshold)
+	body := clientBody{r.Body}
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, body, threshold+1)
+	if err == io.EOF {
+		return bytes.NewReader(buf.Bytes()), n, func() {}, nil
+	}
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	f, err := os.CreateTemp(s.Config.SpoolDir, "spawner-body-*")
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("spooling request body: %w", err)
+	}
+	// The file goes away once it is closed, even if the spawner doesn't get
+	// to close it.
+	os.Remove(f.Name())
+	if n, err = io.Copy(f, io.MultiReader(&buf, body)); err != nil {
+		f.Close()
+		var bodyErr *requestBodyError
+		if errors.As(err, &bodyErr) {
+			return nil, 0, nil, err
+		}
+		return nil, 0, nil, fmt.Errorf("spooling request body: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, 0, nil, fmt.Errorf("spooling request body: %w", err)
+	}
+	proxyLog.Debug("Spooled request body to disk", "path", r.URL.Path, "size", n)
+	return f, n, func() { f.Close() }, nil
+}
+
+// clientBody reads a request body from the client, reporting errors as
+// requestBodyError.
+type clientBody struct {
+	r io.Reader
+}
+
+func (b clientBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &requestBodyError{err}
+	}
+	return n, err
+}
+
+// progressWriter writes a request to an application, which must take each
+// write within timeout unless it is 0. Large bodies are sent for as long as
+// the application keeps taking them, and a stuck application doesn't hold up
+// the upload forever.
+type progressWriter struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (w progressWriter) Write(p []byte) (int, error) {
+	if w.timeout > 0 {
+		w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	}
+	return w.conn.Write(p)
+}
@@ -0,0 +1,67 @@
+package spawner
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSizedBody(t *testing.T) {
+	spoolDir := t.TempDir()
+	s := NewSpawner(&Config{SpoolThreshold: 4, SpoolDir: spoolDir})
+
+	tests := []struct {
+		name    string
+		body    string
+		spooled bool
+	}{
+		{name: "small", body: "abcd"},
+		{name: "large", body: "abcdefghij", spooled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/app.cgi", strings.NewReader(tt.body))
+			r.ContentLength = -1
+			body, size, release, err := s.sizedBody(r)
+			if err != nil {
+				t.Fatalf("sizedBody() error = %v", err)
+			}
+			defer release()
+			if size != int64(len(tt.body)) {
+				t.Errorf("sizedBody() size = %d, want %d", size, len(tt.body))
+			}
+			if _, ok := body.(*os.File); ok != tt.spooled {
+				t.Errorf("sizedBody() spooled = %t, want %t", ok, tt.spooled)
+			}
+			if data, _ := io.ReadAll(body); string(data) != tt.body {
+				t.Errorf("sizedBody() body = %q, want %q", data, tt.body)
+			}
+		})
+	}
+	// Spooled bodies don't leave files behind.
+	if entries, _ := os.ReadDir(spoolDir); len(entries) > 0 {
+		t.Errorf("spoolDir has %d entries, want none", len(entries))
+	}
+}
+
+func TestSizedBodyClientError(t *testing.T) {
+	s := NewSpawner(&Config{SpoolThreshold: 4, SpoolDir: t.TempDir()})
+	r := httptest.NewRequest(http.MethodPost, "/app.cgi", nil)
+	r.ContentLength = -1
+	w := httptest.NewRecorder()
+	r.Body = http.MaxBytesReader(w, io.NopCloser(strings.NewReader("abcdefghij")), 8)
+
+	_, _, _, err := s.sizedBody(r)
+	var bodyErr *requestBodyError
+	if !errors.As(err, &bodyErr) {
+		t.Fatalf("sizedBody() error = %v, want a requestBodyError", err)
+	}
+	failRequestBody(w, "app.cgi", err)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
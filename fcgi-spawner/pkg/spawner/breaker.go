@@ -0,0 +1,187 @@
+package spawner
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// crashWindow is how long a child must run for its exit not to count as
+	// a failure to start.
+	crashWindow = 10 * time.Second
+	// minBackoff and maxBackoff bound the time an application isn't
+	// respawned after failing; it doubles with every consecutive failure.
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// breaker tracks the consecutive failures of an application. While open, no
+// new process is started for it; afterwards the next request probes it.
+type breaker struct {
+	failures  int
+	openUntil time.Time
+	lastErr   error
+}
+
+// circuitOpenError is returned instead of starting an application that is
+// known to be failing.
+type circuitOpenError struct {
+	app        string
+	retryAfter time.Duration
+	lastErr    error
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("%s is failing, not respawning it for %s: %v", e.app, e.retryAfter.Round(time.Second), e.lastErr)
+}
+
+// backoff returns how long an application isn't respawned after the given
+// number of consecutive failures, growing by multiplier with every failure.
+func backoff(failures int, multiplier float64) time.Duration {
+	d := minBackoff
+	for i := 1; i < failures && d < maxBackoff; i++ {
+		d = time.Duration(float64(d) * multiplier)
+	}
+	return min(d, maxBackoff)
+}
+
+// checkBreaker returns a *circuitOpenError if the application at appPath must
+// not be started yet. The caller must hold childProcessesMu.
+func (s *Spawner) checkBreaker(appPath string) error {
+	b := s.breakers[appPath]
+	if b == nil || !time.Now().Before(b.openUntil) {
+		return nil
+	}
+	return &circuitOpenError{app: appPath, retryAfter: time.Until(b.openUntil), lastErr: b.lastErr}
+}
+
+// recordFailure opens the breaker of the application at appPath after it
+// failed to start or crashed right away, using the backoff multiplier of app.
+// The caller must hold childProcessesMu.
+func (s *Spawner) recordFailure(appPath string, app AppConfig, err error) {
+	if s.breakers == nil {
+		s.breakers = make(map[string]*breaker)
+	}
+	b := s.breakers[appPath]
+	if b == nil {
+		b = &breaker{}
+		s.breakers[appPath] = b
+	}
+	b.failures++
+	b.lastErr = err
+	wait := backoff(b.failures, app.backoffMultiplier())
+	b.openUntil = time.Now().Add(wait)
+	spawnLog.Warn("Application is failing, backing off", "app", appPath, "failures", b.failures, "backoff", wait, "error", err)
+	var notReady *notReadyError
+	if errors.As(err, &notReady) {
+		s.notifyChat(chatNotReady, appPath, fmt.Sprintf("failed its readiness probe: %v", notReady.reason))
+	}
+}
+
+// recordSuccess closes the breaker of the application at appPath once it has
+// served a request.
+func (s *Spawner) recordSuccess(appPath string) {
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	if _, ok := s.breakers[appPath]; ok {
+		delete(s.breakers, appPath)
+		spawnLog.Info("Application recovered", "app", appPath)
+	}
+}
+
+// spawnChild starts an instance of the application at appPath unless it is
+// backing off after failures or its restart policy keeps it from being
+// started, and records starts and failures to start. The caller must
+// hold the app's lock and childProcessesMu, which is released while the
+// instance starts.
+func (s *Spawner) spawnChild(appPath string, instance int, app AppConfig) (*childProcess, error) {
+	if err := s.checkRestartPolicy(appPath); err != nil {
+		return nil, err
+	}
+	if err := s.checkBreaker(appPath); err != nil {
+		return nil, err
+	}
+	if err := s.lockSingleton(appPath, app); err != nil {
+		return nil, err
+	}
+	child, err := s.launchChild(appPath, instance, app)
+	if err != nil {
+		s.releaseSingleton(appPath)
+	}
+	var denied *spawnDeniedError
+	var tooMany *tooManyChildrenError
+	if errors.As(err, &denied) || errors.As(err, &tooMany) || errors.Is(err, errShuttingDown) {
+		// Not a failure of the application.
+		return nil, err
+	}
+	if err != nil {
+		s.recordFailure(appPath, app, err)
+		return nil, err
+	}
+	s.childProcesses[instanceKey(appPath, instance)] = child
+	s.watchChild(child)
+	s.recordStart(child)
+	s.saveState()
+	return child, nil
+}
+
+// errShuttingDown is returned for instances started while the spawner shut
+// down.
+var errShuttingDown = errors.New("spawner is shutting down")
+
+// launchChild starts an instance of the application at appPath without adding
+// it to the running processes, making room for it if MaxChildren is reached.
+// The caller must hold the app's lock and childProcessesMu, which is released
+// while the instance starts.
+func (s *Spawner) launchChild(appPath string, instance int, app AppConfig) (*childProcess, error) {
+	if err := s.makeRoom(appPath); err != nil {
+		return nil, err
+	}
+	s.starting++
+	lock := s.appLocks[appPath]
+	lock.starting = true
+	s.childProcessesMu.Unlock()
+	err := s.preSpawn(appPath, app)
+	var child *childProcess
+	if err == nil {
+		child, err = s.startChild(appPath, instance, app)
+	}
+	s.childProcessesMu.Lock()
+	s.starting--
+	lock.starting = false
+	if err != nil {
+		return nil, err
+	}
+	if s.stopped {
+		// The spawner shut down while the instance was starting.
+		s.childProcessesMu.Unlock()
+		s.stopChild(child)
+		s.childProcessesMu.Lock()
+		return nil, errShuttingDown
+	}
+	return child, nil
+}
+
+// failingApp describes an application that is backing off.
+type failingApp struct {
+	App       string    `json:"app"`
+	Failures  int       `json:"failures"`
+	RetryAt   time.Time `json:"retryAt"`
+	LastError string    `json:"lastError"`
+}
+
+// failingApps returns the applications whose last attempts to start failed,
+// ordered by path.
+func (s *Spawner) failingApps() []failingApp {
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+
+	var apps []failingApp
+	for appPath, b := range s.breakers {
+		apps = append(apps, failingApp{App: appPath, Failures: b.failures, RetryAt: b.openUntil, LastError: b.lastErr.Error()})
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].App < apps[j].App })
+	return apps
+}
@@ -0,0 +1,75 @@
+package spawner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		4:  8 * time.Second,
+		7:  maxBackoff,
+		50: maxBackoff,
+	}
+	for failures, want := range tests {
+		if got := backoff(failures, 2); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func TestCrashingAppBacksOff(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "crash.fcgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot, SocketDir: t.TempDir(), ReadinessTimeout: 5 * time.Second})
+
+	// The first attempt notices that the app exits without waiting for the
+	// readiness timeout.
+	start := time.Now()
+	_, _, err := s.getOrCreateChild(context.Background(), appPath, nil)
+	if err == nil {
+		t.Fatalf("getOrCreateChild() succeeded for a crashing app")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("getOrCreateChild() took %s to notice the crash", elapsed)
+	}
+
+	// Further requests fail fast while the app backs off.
+	rec := httptest.NewRecorder()
+	s.spawnerHandler(rec, httptest.NewRequest(http.MethodGet, "/crash.fcgi", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("spawnerHandler() = %d with Retry-After %q, want 503 with Retry-After 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if apps := s.failingApps(); len(apps) != 1 || apps[0].Failures != 1 {
+		t.Errorf("failingApps() = %+v, want one failure", apps)
+	}
+
+	// Once the backoff has expired, the next request probes the app again.
+	s.childProcessesMu.Lock()
+	s.breakers[appPath].openUntil = time.Now()
+	s.childProcessesMu.Unlock()
+	_, _, err = s.getOrCreateChild(context.Background(), appPath, nil)
+	var circuitOpen *circuitOpenError
+	if err == nil || errors.As(err, &circuitOpen) {
+		t.Errorf("getOrCreateChild() error = %v, want a new failed attempt", err)
+	}
+	if apps := s.failingApps(); len(apps) != 1 || apps[0].Failures != 2 {
+		t.Errorf("failingApps() = %+v, want two failures", apps)
+	}
+
+	s.recordSuccess(appPath)
+	if apps := s.failingApps(); len(apps) != 0 {
+		t.Errorf("failingApps() = %+v after success, want none", apps)
+	}
+}
@@ -0,0 +1,92 @@
+package spawner
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// CacheRule sets the caching headers of the static files it matches, e.g. a
+// year for assets with a content hash in their name and a minute for HTML.
+type CacheRule struct {
+	// Path matches like Route.Path: the URL path exactly, or, ending in /*,
+	// the path and everything below it. Empty matches any path.
+	Path string `yaml:"path"`
+	// Extensions are the file extensions matched, e.g. .css and .js; empty
+	// matches any file. Paths ending in / count as .html, as their
+	// index.html is served.
+	Extensions []string `yaml:"extensions"`
+	// CacheControl is the Cache-Control header sent, e.g. "public,
+	// max-age=31536000, immutable".
+	CacheControl string `yaml:"cacheControl"`
+	// Expires sets the Expires header to this long after the response, for
+	// old HTTP/1.0 caches; 0 leaves it out.
+	Expires time.Duration `yaml:"expires"`
+}
+
+// validateStaticCache checks the caching rules of the static files.
+func (c *Config) validateStaticCache() error {
+	for i, rule := range c.StaticCache {
+		if rule.Path != "" && !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("rule %d: path %q must start with /", i+1, rule.Path)
+		}
+		for _, ext := range rule.Extensions {
+			if !strings.HasPrefix(ext, ".") || len(ext) < 2 || strings.Contains(ext, "/") {
+				return fmt.Errorf("rule %d: extension %q must be like .css", i+1, ext)
+			}
+		}
+		if rule.CacheControl == "" && rule.Expires == 0 {
+			return fmt.Errorf("rule %d: cacheControl or expires is required", i+1)
+		}
+		if rule.Expires < 0 {
+			return fmt.Errorf("rule %d: expires %s is negative", i+1, rule.Expires)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to the static file at urlPath.
+func (rule *CacheRule) matches(urlPath string) bool {
+	if rule.Path != "" {
+		if _, _, ok := (&Route{Path: rule.Path}).match(urlPath); !ok {
+			return false
+		}
+	}
+	if len(rule.Extensions) == 0 {
+		return true
+	}
+	ext := path.Ext(urlPath)
+	if strings.HasSuffix(urlPath, "/") {
+		ext = ".html"
+	}
+	for _, e := range rule.Extensions {
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheStatic returns the ResponseWriter setting the caching headers of the
+// first rule matching the static file r asks for. They are only sent with
+// the file or 304 Not Modified, not with errors, so that a 404 isn't cached
+// for as long as the file would be.
+func (s *Spawner) cacheStatic(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	for i := range s.Config.StaticCache {
+		rule := &s.Config.StaticCache[i]
+		if !rule.matches(r.URL.Path) {
+			continue
+		}
+		headers := make(http.Header)
+		if rule.CacheControl != "" {
+			headers.Set("Cache-Control", rule.CacheControl)
+		}
+		if rule.Expires > 0 {
+			headers.Set("Expires", time.Now().Add(rule.Expires).UTC().Format(http.TimeFormat))
+		}
+		return &headerWriter{ResponseWriter: w, headers: headers, cacheable: true}
+	}
+	return w
+}
@@ -0,0 +1,78 @@
+package spawner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidateStaticCache(t *testing.T) {
+	tests := []struct {
+		rule    CacheRule
+		wantErr bool
+	}{
+		{rule: CacheRule{Extensions: []string{".css", ".js"}, CacheControl: "public, max-age=31536000, immutable"}},
+		{rule: CacheRule{Path: "/assets/*", Expires: time.Hour}},
+		{rule: CacheRule{Path: "assets/*", CacheControl: "no-cache"}, wantErr: true},
+		{rule: CacheRule{Extensions: []string{"css"}, CacheControl: "no-cache"}, wantErr: true},
+		{rule: CacheRule{Extensions: []string{".css"}}, wantErr: true},
+		{rule: CacheRule{CacheControl: "no-cache", Expires: -time.Hour}, wantErr: true},
+	}
+	for _, tt := range tests {
+		cfg := Config{StaticCache: []CacheRule{tt.rule}}
+		if err := cfg.validateStaticCache(); (err != nil) != tt.wantErr {
+			t.Errorf("validateStaticCache(%+v) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCacheStatic(t *testing.T) {
+	staticRoot := t.TempDir()
+	for _, name := range []string{"index.html", "app.3f2a.js", "logo.png"} {
+		if err := os.WriteFile(filepath.Join(staticRoot, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	s := NewSpawner(&Config{WebRoot: t.TempDir(), StaticRoot: staticRoot, StaticCache: []CacheRule{
+		{Extensions: []string{".JS", ".css"}, CacheControl: "public, max-age=31536000, immutable"},
+		{Extensions: []string{".html"}, CacheControl: "public, max-age=60", Expires: time.Minute},
+	}})
+
+	tests := []struct {
+		path         string
+		status       int
+		cacheControl string
+		expires      bool
+	}{
+		{path: "/app.3f2a.js", status: http.StatusOK, cacheControl: "public, max-age=31536000, immutable"},
+		{path: "/", status: http.StatusOK, cacheControl: "public, max-age=60", expires: true},
+		{path: "/logo.png", status: http.StatusOK},
+		// Missing files aren't cached.
+		{path: "/missing.js", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		s.spawnerHandler(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, w.Code, tt.status)
+		}
+		if got := w.Header().Get("Cache-Control"); got != tt.cacheControl {
+			t.Errorf("GET %s Cache-Control = %q, want %q", tt.path, got, tt.cacheControl)
+		}
+		if got := w.Header().Get("Expires"); (got != "") != tt.expires {
+			t.Errorf("GET %s Expires = %q, want set %t", tt.path, got, tt.expires)
+		}
+	}
+
+	// Revalidated files keep their caching headers.
+	r := httptest.NewRequest(http.MethodGet, "/app.3f2a.js", nil)
+	r.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	w := httptest.NewRecorder()
+	s.spawnerHandler(w, r)
+	if w.Code != http.StatusNotModified || w.Header().Get("Cache-Control") == "" {
+		t.Errorf("GET /app.3f2a.js = %d, Cache-Control %q, want 304 with Cache-Control", w.Code, w.Header().Get("Cache-Control"))
+	}
+}
@@ -0,0 +1,175 @@
+package spawner
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// cgiExtension is the extension of classic CGI scripts, which are run once
+// per request instead of being kept running.
+const cgiExtension = ".cgi"
+
+// cgiExitTimeout is how long a CGI script may keep running after sending its
+// response before it is killed.
+const cgiExitTimeout = 5 * time.Second
+
+// isCGI reports whether path is an executable CGI script.
+func isCGI(path string) bool {
+	return strings.HasSuffix(path, cgiExtension) && isExecutable(path)
+}
+
+// serveCGI runs the CGI script at appPath for r, which the script serves as
+// scriptName with pathInfo following it. The request is passed in the
+// environment and on standard input, and the response read from standard
+// output. The .env files and per-app settings apply like for FastCGI
+// applications.
+func (s *Spawner) serveCGI(w http.ResponseWriter, r *http.Request, appPath, scriptName, pathInfo string) {
+	app, err := s.appConfig(appPath)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		spawnLog.Error("Failed to run CGI script", "app", appPath, "error", err)
+		return
+	}
+	env, err := s.appEnv(appPath, app)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		spawnLog.Error("Failed to run CGI script", "app", appPath, "error", err)
+		return
+	}
+	body, contentLength, release, err := s.sizedBody(r)
+	var bodyErr *requestBodyError
+	if errors.As(err, &bodyErr) {
+		failRequestBody(w, appPath, err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		spawnLog.Error("Failed to run CGI script", "app", appPath, "error", err)
+		return
+	}
+	defer release()
+	params := s.requestParams(r, appPath, scriptName, pathInfo)
+	s.addAppParams(params, r, appPath, app)
+	if !s.preProxy(w, r, appPath, params) {
+		return
+	}
+	params["GATEWAY_INTERFACE"] = "CGI/1.1"
+	params["CONTENT_LENGTH"] = strconv.FormatInt(contentLength, 10)
+	// The Proxy header would end up as HTTP_PROXY, which many HTTP clients
+	// take as their proxy (httpoxy).
+	delete(params, "HTTP_PROXY")
+	for _, key := range slices.Sorted(maps.Keys(params)) {
+		env = setEnv(env, key, params[key])
+	}
+
+	// The script is killed when the client goes away.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	cmd := exec.CommandContext(ctx, appPath, app.Args...)
+	cmd.Dir = appWorkDir(appPath, app, filepath.Dir(appPath))
+	cmd.Env = env
+	cmd.Stdin = body
+	cred, err := s.credentialFor(app)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		spawnLog.Error("Failed to run CGI script", "app", appPath, "error", err)
+		return
+	}
+	// The script runs in its own process group, so that processes it starts
+	// are killed along with it.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Credential: cred}
+	var writable []string
+	if app.PrivateTmp {
+		tmpDir, err := makePrivateTmp(appPath, cred)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			spawnLog.Error("Failed to create private temporary directory", "app", appPath, "error", err)
+			return
+		}
+		defer os.RemoveAll(tmpDir)
+		cmd.Env = setEnv(cmd.Env, "TMPDIR", tmpDir)
+		writable = append(writable, tmpDir)
+	}
+	s.confine(cmd, appPath, app, writable...)
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		spawnLog.Error("Failed to create stdout pipe", "app", appPath, "error", err)
+		return
+	}
+	defer stdout.Close()
+	cmd.Stdout = stdoutWriter
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		stdoutWriter.Close()
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		spawnLog.Error("Failed to create stderr pipe", "app", appPath, "error", err)
+		return
+	}
+	err = cmd.Start()
+	stdoutWriter.Close()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		spawnLog.Error("Failed to start CGI script", "app", appPath, "error", err)
+		return
+	}
+	spawnLog.Debug("Started CGI script", "app", appPath, "pid", cmd.Process.Pid)
+	logged := make(chan struct{})
+	go func() {
+		logStream(stderr, appPath, cmd.Process.Pid, "stderr")
+		close(logged)
+	}()
+	completed := false
+	defer func() {
+		if !completed {
+			cancel()
+		}
+		// Standard error is closed once the script has exited.
+		select {
+		case <-logged:
+		case <-time.After(cgiExitTimeout):
+			spawnLog.Warn("CGI script still running after its response, killing it", "app", appPath, "pid", cmd.Process.Pid)
+			cancel()
+			<-logged
+		}
+		killed := ctx.Err() != nil
+		cancel()
+		if err := cmd.Wait(); err != nil && !killed {
+			spawnLog.Warn("CGI script failed", "app", appPath, "pid", cmd.Process.Pid, "error", err)
+		}
+	}()
+
+	// Like for FastCGI applications, the response headers must arrive in time.
+	timeout := s.upstreamTimeoutFor(app)
+	if timeout > 0 {
+		stdout.SetReadDeadline(time.Now().Add(timeout))
+	}
+	resp, err := readCGIResponse(bufio.NewReader(stdout))
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+		proxyLog.Warn("CGI script timed out", "app", appPath, "timeout", timeout)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		proxyLog.Error("CGI script sent no valid response", "app", appPath, "error", err)
+		return
+	}
+	stdout.SetReadDeadline(time.Time{})
+	s.writeResponse(w, r, appPath, resp)
+	completed = true
+}
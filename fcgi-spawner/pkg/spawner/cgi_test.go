@@ -0,0 +1,68 @@
+package spawner
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeCGI(t *testing.T) {
+	webRoot := t.TempDir()
+	scripts := map[string]string{
+		"echo.cgi": `#!/bin/sh
+printf 'Status: 201 Created\r\nContent-Type: text/plain\r\n\r\n'
+echo "$REQUEST_METHOD $SCRIPT_NAME $PATH_INFO $GREETING proxy=$HTTP_PROXY"
+cat
+echo "oops" >&2
+`,
+		"slow.cgi":   "#!/bin/sh\nsleep 5\n",
+		"broken.cgi": "#!/bin/sh\necho no headers\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(webRoot, name), []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(webRoot, "echo.env"), []byte("GREETING=hello\n"), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(webRoot, "plain.cgi"), []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatalf("Failed to write plain.cgi: %v", err)
+	}
+	timeout := 200 * time.Millisecond
+	s := NewSpawner(&Config{WebRoot: webRoot, UpstreamTimeout: timeout})
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "request", path: "/echo.cgi/extra", body: "posted\n", wantStatus: http.StatusCreated, wantBody: "POST /echo.cgi /extra hello proxy=\nposted\n"},
+		{name: "timeout", path: "/slow.cgi", wantStatus: http.StatusGatewayTimeout},
+		{name: "invalid response", path: "/broken.cgi", wantStatus: http.StatusBadGateway},
+		{name: "not executable", path: "/plain.cgi", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Proxy", "http://evil.example.com")
+			w := httptest.NewRecorder()
+			s.spawnerHandler(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" {
+				if body, _ := io.ReadAll(w.Body); string(body) != tt.wantBody {
+					t.Errorf("body = %q, want %q", body, tt.wantBody)
+				}
+			}
+		})
+	}
+}
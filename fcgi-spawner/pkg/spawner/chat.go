@@ -0,0 +1,139 @@
+package spawner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An application crash-loops when its processes crash crashLoopCrashes times
+// within crashLoopWindow.
+const (
+	crashLoopCrashes = 3
+	crashLoopWindow  = time.Minute
+)
+
+// chatNotifyInterval is how long after a message about an application no
+// further message of the same kind is posted for it, so that an application
+// failing over and over doesn't flood the channel.
+const chatNotifyInterval = 10 * time.Minute
+
+// Kinds of chat messages.
+const (
+	chatCrashLoop = "crash-loop"
+	chatNotReady  = "not-ready"
+)
+
+// chatNotifier keeps track of the crashes of applications and the messages
+// posted about them to Config.ChatWebhook.
+type chatNotifier struct {
+	mu      sync.Mutex
+	crashes map[string][]time.Time // Recent crashes, by app path
+	posted  map[string]time.Time   // Last message, by kind and app path
+}
+
+// crashed records a crash of the application at appPath and reports whether
+// it is crash-looping.
+func (n *chatNotifier) crashed(appPath string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.crashes == nil {
+		n.crashes = make(map[string][]time.Time)
+	}
+	now := time.Now()
+	crashes := slices.DeleteFunc(append(n.crashes[appPath], now), func(t time.Time) bool { return now.Sub(t) > crashLoopWindow })
+	n.crashes[appPath] = crashes
+	return len(crashes) >= crashLoopCrashes
+}
+
+// due reports whether a message of kind may be posted about the application
+// at appPath, and records it as posted if so.
+func (n *chatNotifier) due(kind, appPath string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.posted == nil {
+		n.posted = make(map[string]time.Time)
+	}
+	key := kind + " " + appPath
+	if last, ok := n.posted[key]; ok && time.Since(last) < chatNotifyInterval {
+		return false
+	}
+	n.posted[key] = time.Now()
+	return true
+}
+
+// notifyCrash tells the chat when the application of child, which crashed
+// with status, is crash-looping.
+func (s *Spawner) notifyCrash(child *childProcess, status string) {
+	if s.Config.ChatWebhook == "" || !s.chat.crashed(child.binaryPath) {
+		return
+	}
+	s.notifyChat(chatCrashLoop, child.binaryPath, fmt.Sprintf("crashed %d times within %s, last with %s", crashLoopCrashes, crashLoopWindow, status))
+}
+
+// notifyChat posts a message that the application at appPath failed as
+// described by what to Config.ChatWebhook in the background, unless one of
+// the same kind was posted recently.
+func (s *Spawner) notifyChat(kind, appPath, what string) {
+	if s.Config.ChatWebhook == "" || !s.chat.due(kind, appPath) {
+		return
+	}
+	go func() {
+		text := s.chatMessage(appPath, what)
+		if err := postChat(context.Background(), s.Config.ChatWebhook, text); err != nil {
+			eventLog.Error("Failed to post chat message", "app", appPath, "error", err)
+		}
+	}()
+}
+
+// chatMessage returns the text of a message that the application at appPath
+// failed as described by what, with its latest stderr lines.
+func (s *Spawner) chatMessage(appPath, what string) string {
+	name := s.adminName(appPath)
+	if name == "" {
+		name = filepath.Base(appPath)
+	}
+	host, _ := os.Hostname()
+	var b strings.Builder
+	fmt.Fprintf(&b, ":warning: **%s** on %s %s.", name, host, what)
+	lines := s.Config.ChatLogLines
+	if lines == 0 {
+		lines = 10
+	}
+	if stderr := appLogTail.stderr(appPath, lines); len(stderr) > 0 {
+		fmt.Fprintf(&b, "\n```\n%s\n```", strings.Join(stderr, "\n"))
+	}
+	return b.String()
+}
+
+// postChat posts text to a Mattermost or Slack incoming webhook.
+func postChat(ctx context.Context, webhook, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, eventWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
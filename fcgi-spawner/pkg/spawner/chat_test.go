@@ -0,0 +1,98 @@
+package spawner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChatNotifications(t *testing.T) {
+	messages := make(chan string, 4)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode message: %v", err)
+		}
+		messages <- payload.Text
+	}))
+	defer webhook.Close()
+	nextMessage := func() string {
+		t.Helper()
+		select {
+		case text := <-messages:
+			return text
+		case <-time.After(3 * time.Second):
+			t.Fatal("No message posted")
+			return ""
+		}
+	}
+
+	webRoot := t.TempDir()
+	apps := map[string]string{
+		"looping.fcgi": "#!/bin/sh\necho boom >&2\nsleep 0.1\nexit 1\n",
+		"unready.fcgi": "#!/bin/sh\necho still loading >&2\nexec sleep 30\n",
+	}
+	for name, script := range apps {
+		if err := os.WriteFile(filepath.Join(webRoot, name), []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to write app: %v", err)
+		}
+	}
+	s := NewSpawner(&Config{
+		WebRoot:      webRoot,
+		ChatWebhook:  webhook.URL,
+		ChatLogLines: 1,
+		Apps: map[string]AppConfig{
+			"unready.fcgi": {ReadinessTimeout: 300 * time.Millisecond, ReadinessPath: "/ping"},
+		},
+	})
+	defer s.stopAllChildren(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.cleanupChildProcesses(ctx)
+
+	looping := filepath.Join(webRoot, "looping.fcgi")
+	for range crashLoopCrashes {
+		child, _, err := s.getOrCreateChild(context.Background(), looping, nil)
+		if err != nil {
+			t.Fatalf("getOrCreateChild() error = %v", err)
+		}
+		s.releaseChild(child)
+		for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+			s.childProcessesMu.Lock()
+			running := len(s.pool(looping))
+			s.childProcessesMu.Unlock()
+			if running == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Crashed process not removed")
+			}
+		}
+	}
+	if text := nextMessage(); !strings.Contains(text, "**looping.fcgi**") || !strings.Contains(text, "crashed 3 times") || !strings.Contains(text, "boom") {
+		t.Errorf("crash-loop message = %q", text)
+	}
+
+	if _, _, err := s.getOrCreateChild(context.Background(), filepath.Join(webRoot, "unready.fcgi"), nil); err == nil {
+		t.Fatal("getOrCreateChild() of an app that never becomes ready succeeded")
+	}
+	if text := nextMessage(); !strings.Contains(text, "readiness probe") || !strings.Contains(text, "```\nstill loading\n```") {
+		t.Errorf("readiness message = %q", text)
+	}
+
+	// Further failures are not posted again right away.
+	if s.chat.due(chatNotReady, filepath.Join(webRoot, "unready.fcgi")) {
+		t.Error("due() = true right after a message")
+	}
+	if !s.chat.due(chatNotReady, looping) {
+		t.Error("due() = false for another app")
+	}
+}
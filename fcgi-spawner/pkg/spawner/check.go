@@ -0,0 +1,154 @@
+package spawner
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Check validates the configuration like Validate, and also checks what
+// would otherwise only fail once requests arrive: that the web roots and
+// socket directory are usable, that no route is shadowed by an earlier one,
+// and that the applications named in Apps, Routes and Prewarm exist and can
+// be run. It returns every problem found, for spawner -check.
+func (c *Config) Check() []error {
+	var errs []error
+	if err := c.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	webRoots := []string{c.WebRoot}
+	for _, host := range slices.Sorted(maps.Keys(c.VirtualHosts)) {
+		webRoots = append(webRoots, c.VirtualHosts[host].WebRoot)
+	}
+	for _, root := range webRoots {
+		if err := checkDir(root); err != nil {
+			errs = append(errs, fmt.Errorf("webRoot: %v", err))
+		}
+	}
+	for _, dir := range []struct{ name, path string }{
+		{"socketDir", c.SocketDir},
+		{"coordinationDir", c.CoordinationDir},
+	} {
+		if dir.path == "" {
+			continue
+		}
+		// These directories are created when needed, so only their parent
+		// has to exist.
+		if info, err := os.Stat(dir.path); err == nil && !info.IsDir() {
+			errs = append(errs, fmt.Errorf("%s: %s is not a directory", dir.name, dir.path))
+		} else if err != nil {
+			if err := checkDir(filepath.Dir(dir.path)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", dir.name, err))
+			}
+		}
+	}
+	if c.AccessLog != "" && c.AccessLog != "-" {
+		if err := checkDir(filepath.Dir(c.AccessLog)); err != nil {
+			errs = append(errs, fmt.Errorf("accessLog: %v", err))
+		}
+	}
+	if c.AuditLog != "" {
+		if err := checkDir(filepath.Dir(c.AuditLog)); err != nil {
+			errs = append(errs, fmt.Errorf("auditLog: %v", err))
+		}
+	}
+
+	errs = append(errs, c.checkRoutes()...)
+
+	// Applications are looked up in every web root, as settings and routes
+	// apply to all sites.
+	s := &Spawner{Config: c}
+	exists := func(rel string, run func(string) bool) bool {
+		return slices.ContainsFunc(webRoots, func(root string) bool {
+			return run(filepath.Join(root, filepath.FromSlash(rel)))
+		})
+	}
+	for _, rel := range slices.Sorted(maps.Keys(c.Apps)) {
+		if err := c.Apps[rel].validate(); err != nil {
+			errs = append(errs, fmt.Errorf("apps: %s: %v", rel, err))
+		}
+		if command := c.Apps[rel].Command; command != "" {
+			if _, err := exec.LookPath(command); err != nil {
+				errs = append(errs, fmt.Errorf("apps: %s: command: %v", rel, err))
+			}
+			continue
+		}
+		if !exists(rel, func(path string) bool { return s.isApp(path) || isCGI(path) }) {
+			errs = append(errs, fmt.Errorf("apps: %s: %v", rel, appProblem(s, webRoots, rel)))
+		}
+	}
+	for i, route := range c.Routes {
+		if route.App != "" && !exists(route.App, func(path string) bool { return s.isApp(path) || isCGI(path) }) {
+			errs = append(errs, fmt.Errorf("route %d: app %s: %v", i+1, route.App, appProblem(s, webRoots, route.App)))
+		}
+		if route.Canary != nil && !exists(route.Canary.App, func(path string) bool { return s.isApp(path) || isCGI(path) }) {
+			errs = append(errs, fmt.Errorf("route %d: canary app %s: %v", i+1, route.Canary.App, appProblem(s, webRoots, route.Canary.App)))
+		}
+	}
+	for _, rel := range c.Prewarm {
+		if exists(rel, isCGI) {
+			errs = append(errs, fmt.Errorf("prewarm: %s: CGI scripts run per request and can't be prewarmed", rel))
+		} else if !exists(rel, s.isApp) {
+			errs = append(errs, fmt.Errorf("prewarm: %s: %v", rel, appProblem(s, webRoots, rel)))
+		}
+	}
+	return errs
+}
+
+// checkDir returns an error unless dir is an existing directory.
+func checkDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// checkRoutes reports routes that never match, as every path they match is
+// matched by an earlier route. Regex routes can't be compared and are
+// skipped.
+func (c *Config) checkRoutes() []error {
+	var errs []error
+	for j, later := range c.Routes {
+		if later.Path == "" {
+			continue
+		}
+		prefix, isPrefix := strings.CutSuffix(later.Path, "/*")
+		for i, earlier := range c.Routes[:j] {
+			if earlier.Path == "" {
+				continue
+			}
+			_, earlierIsPrefix := strings.CutSuffix(earlier.Path, "/*")
+			// A prefix route is only shadowed by a prefix route covering its
+			// prefix, an exact route by any route matching its path.
+			if _, _, ok := earlier.match(prefix); ok && (!isPrefix || earlierIsPrefix) {
+				errs = append(errs, fmt.Errorf("route %d: path %s is shadowed by route %d (%s)", j+1, later.Path, i+1, earlier.Path))
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// appProblem explains why the application rel isn't found in any of
+// webRoots.
+func appProblem(s *Spawner, webRoots []string, rel string) error {
+	for _, root := range webRoots {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if _, err := os.Stat(path); err == nil {
+			if !s.isAppName(path) && !strings.HasSuffix(path, cgiExtension) {
+				return fmt.Errorf("%s is not an application (.fcgi, .cgi or a script with an interpreter)", path)
+			}
+			return fmt.Errorf("%s is not executable", path)
+		}
+	}
+	return fmt.Errorf("not found in %s", strings.Join(webRoots, ", "))
+}
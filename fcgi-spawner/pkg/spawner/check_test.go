@@ -0,0 +1,70 @@
+package spawner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	webRoot := t.TempDir()
+	for name, mode := range map[string]os.FileMode{"api.fcgi": 0755, "report.cgi": 0755, "broken.fcgi": 0644, "notes.txt": 0644} {
+		if err := os.WriteFile(filepath.Join(webRoot, name), []byte("#!/bin/sh\n"), mode); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	good := Config{
+		WebRoot:   webRoot,
+		SocketDir: filepath.Join(t.TempDir(), "sockets"),
+		Apps:      map[string]AppConfig{"api.fcgi": {MinInstances: 1}},
+		Routes:    []Route{{Path: "/api/*", App: "api.fcgi"}, {Path: "/reports", App: "report.cgi"}},
+		Prewarm:   []string{"api.fcgi"},
+	}
+	if errs := good.Check(); len(errs) != 0 {
+		t.Errorf("Check() = %v, want no problems", errs)
+	}
+
+	bad := Config{
+		WebRoot:   webRoot,
+		SocketDir: filepath.Join(webRoot, "missing", "sockets"),
+		Apps: map[string]AppConfig{
+			"broken.fcgi":  {},
+			"missing.fcgi": {},
+			"api.fcgi":     {MinInstances: -1},
+			"server":       {Command: filepath.Join(webRoot, "missing-server")},
+		},
+		Routes: []Route{
+			{Path: "/api/*", App: "api.fcgi"},
+			{Path: "/api/v2/*", App: "api.fcgi"},
+			{Path: "/api", App: "api.fcgi"},
+			{Path: "/notes", App: "notes.txt"},
+		},
+		Prewarm: []string{"report.cgi"},
+	}
+	want := []string{
+		"socketDir:",
+		"route 2: path /api/v2/* is shadowed by route 1 (/api/*)",
+		"route 3: path /api is shadowed by route 1 (/api/*)",
+		"apps: api.fcgi: instance counts must not be negative",
+		"apps: broken.fcgi: " + filepath.Join(webRoot, "broken.fcgi") + " is not executable",
+		"apps: missing.fcgi: not found in " + webRoot,
+		"apps: server: command:",
+		"route 4: app notes.txt: " + filepath.Join(webRoot, "notes.txt") + " is not an application",
+		"prewarm: report.cgi: CGI scripts run per request and can't be prewarmed",
+	}
+	errs := bad.Check()
+	if len(errs) != len(want) {
+		t.Fatalf("Check() = %v, want %d problems", errs, len(want))
+	}
+	for i, err := range errs {
+		if !strings.HasPrefix(err.Error(), want[i]) {
+			t.Errorf("problem %d = %q, want it to start with %q", i+1, err, want[i])
+		}
+	}
+
+	if errs := (&Config{WebRoot: filepath.Join(webRoot, "api.fcgi")}).Check(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "is not a directory") {
+		t.Errorf("Check() with a file as webRoot = %v", errs)
+	}
+}
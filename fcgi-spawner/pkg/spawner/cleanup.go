@@ -0,0 +1,142 @@
+package spawner
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+)
+
+// cleanupRetryDelay is how long the cleanup loop waits before looking again
+// at a child whose application is being started or stopped.
+const cleanupRetryDelay = time.Second
+
+// cleanupChildProcesses removes child processes that have exited and stops
+// idle ones until ctx is done. Rather than checking every child periodically,
+// it looks at a child when its process exits or its idle timer fires, see
+// watchChild.
+func (s *Spawner) cleanupChildProcesses(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.cleanupWake:
+		}
+		s.childProcessesMu.Lock()
+		pending := s.cleanupPending
+		s.cleanupPending = nil
+		for child := range pending {
+			s.cleanupChild(child)
+		}
+		s.childProcessesMu.Unlock()
+	}
+}
+
+// watchChild makes the cleanup loop look at child, which was just added to
+// the running processes, once its process exits and once it may have been
+// idle for its idle timeout. The caller must hold childProcessesMu.
+func (s *Spawner) watchChild(child *childProcess) {
+	if process := child.cmd.Process(); process != nil {
+		go func() {
+			process.Wait()
+			s.notifyCleanup(child)
+		}()
+	}
+	s.scheduleIdleCheck(child, s.idleTimeoutFor(child)-time.Since(child.lastUsed))
+}
+
+// scheduleIdleCheck makes the cleanup loop look at child again after d,
+// unless it has no idle timeout. The caller must hold childProcessesMu.
+func (s *Spawner) scheduleIdleCheck(child *childProcess, d time.Duration) {
+	if s.idleTimeoutFor(child) <= 0 {
+		return
+	}
+	if child.idleTimer == nil {
+		child.idleTimer = time.AfterFunc(d, func() { s.notifyCleanup(child) })
+	} else {
+		child.idleTimer.Reset(d)
+	}
+}
+
+// notifyCleanup wakes the cleanup loop to look at child.
+func (s *Spawner) notifyCleanup(child *childProcess) {
+	s.childProcessesMu.Lock()
+	if s.cleanupPending == nil {
+		s.cleanupPending = make(map[*childProcess]bool)
+	}
+	s.cleanupPending[child] = true
+	s.childProcessesMu.Unlock()
+	select {
+	case s.cleanupWake <- struct{}{}:
+	default: // The loop is awake already.
+	}
+}
+
+// cleanupChild removes child if its process has exited, and stops it if it
+// has been idle for its idle timeout. Otherwise its idle timer is set to the
+// time it may become idle. The caller must hold childProcessesMu.
+func (s *Spawner) cleanupChild(child *childProcess) {
+	if s.childProcesses[instanceKey(child.binaryPath, child.instance)] != child {
+		// Already replaced or stopped.
+		return
+	}
+	// Apps being started or stopped are looked at again shortly.
+	if lock := s.appLocks[child.binaryPath]; lock != nil {
+		if !lock.TryLock() {
+			time.AfterFunc(cleanupRetryDelay, func() { s.notifyCleanup(child) })
+			return
+		}
+		lock.Unlock()
+	}
+
+	// On Unix, signal 0 checks whether the process still exists.
+	if process := child.cmd.Process(); process != nil && (child.cmd.ProcessState() != nil || process.Signal(syscall.Signal(0)) != nil) {
+		cleanupLog.Info("Child process is no longer running, removing it", "app", child.binaryPath, "pid", process.Pid())
+		// Wait for the process to ensure it's reaped and doesn't become a zombie
+		if _, err := process.Wait(); err != nil {
+			cleanupLog.Error("Error waiting for child process", "pid", process.Pid(), "error", err)
+		}
+		s.recordExit(child)
+		status := s.statsFor(child.binaryPath).lastExit
+		s.publishEvent(EventCrashed, child, status)
+		s.notifyCrash(child, status)
+		if child.idleTimer != nil {
+			child.idleTimer.Stop()
+		}
+		child.closeConns()
+		if child.listener != nil {
+			child.listener.Close()
+		} else if err := os.Remove(child.socketPath); err != nil && !os.IsNotExist(err) {
+			cleanupLog.Error("Error removing socket file", "socket", child.socketPath, "error", err)
+		}
+		s.removeContainer(child)
+		removePrivateTmp(child)
+		delete(s.childProcesses, instanceKey(child.binaryPath, child.instance))
+		s.releaseSingleton(child.binaryPath)
+		return
+	}
+
+	idleTimeout := s.idleTimeoutFor(child)
+	if idleTimeout <= 0 {
+		return
+	}
+	if end := child.app.warmUpEnd(time.Now()); !end.IsZero() {
+		// Kept running until its warm-up window ends.
+		s.scheduleIdleCheck(child, time.Until(end))
+		return
+	}
+	idle := time.Since(child.lastUsed)
+	switch {
+	case child.active > 0:
+		s.scheduleIdleCheck(child, idleTimeout)
+	case idle <= idleTimeout:
+		s.scheduleIdleCheck(child, idleTimeout-idle)
+	case !s.canStopIdle(child, idleTimeout):
+		// Other instances of the app are still in use.
+		s.scheduleIdleCheck(child, idleTimeout)
+	default:
+		cleanupLog.Info("Child process is idle, terminating it", "app", child.binaryPath, "pid", child.cmd.Process().Pid(), "idle", idle.Round(time.Second))
+		s.publishEvent(EventIdleKilled, child, "")
+		s.terminateChild(child)
+	}
+}
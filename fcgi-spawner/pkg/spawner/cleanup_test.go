@@ -0,0 +1,72 @@
+package spawner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCleanupNotifications(t *testing.T) {
+	webRoot := t.TempDir()
+	apps := map[string]string{
+		"exiting-cleanup.fcgi": "#!/bin/sh\nexec sleep 0.2\n",
+		"idle-cleanup.fcgi":    "#!/bin/sh\nexec sleep 30\n",
+	}
+	for name, script := range apps {
+		if err := os.WriteFile(filepath.Join(webRoot, name), []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to write app: %v", err)
+		}
+	}
+	idleTimeout := 200 * time.Millisecond
+	s := NewSpawner(&Config{
+		WebRoot: webRoot,
+		Apps:    map[string]AppConfig{"idle-cleanup.fcgi": {IdleTimeout: &idleTimeout}},
+	})
+	defer s.stopAllChildren(time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.cleanupChildProcesses(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	for name := range apps {
+		child, _, err := s.getOrCreateChild(context.Background(), filepath.Join(webRoot, name), nil)
+		if err != nil {
+			t.Fatalf("getOrCreateChild(%s) error = %v", name, err)
+		}
+		s.releaseChild(child)
+	}
+
+	// Both are gone long before a polling loop would have looked at them.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.childProcessesMu.Lock()
+		running := len(s.childProcesses)
+		s.childProcessesMu.Unlock()
+		if running == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d child processes still running", running)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// Only the exit is counted, not the idle stop.
+	for _, stats := range s.appRestartStats() {
+		want := 0
+		if stats.Name == "exiting-cleanup.fcgi" {
+			want = 1
+		}
+		if stats.Exits != want {
+			t.Errorf("%s exits = %d, want %d", stats.Name, stats.Exits, want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package spawner
+
+import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Values of Config.TLSClientAuth.
+const (
+	clientAuthOptional = "optional"
+	clientAuthRequire  = "require"
+)
+
+// configureClientAuth makes tlsConfig ask clients for a certificate issued
+// by one of the CAs in cfg.TLSClientCA, if set. Clients without one are
+// turned away with TLSClientAuth "require".
+func configureClientAuth(cfg *Config, tlsConfig *tls.Config) error {
+	if cfg.TLSClientCA == "" {
+		return nil
+	}
+	data, err := os.ReadFile(cfg.TLSClientCA)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("%s: no PEM certificates found", cfg.TLSClientCA)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.TLSClientAuth == clientAuthRequire {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return nil
+}
+
+// clientCertificate returns the verified certificate the client of r
+// authenticated with: the one it presented to the spawner, or, for requests
+// from a trusted proxy terminating TLS, the one in the TLSClientCertHeader
+// header. It returns nil if there is none.
+func (s *Spawner) clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return r.TLS.VerifiedChains[0][0]
+	}
+	if s.Config.TLSClientCertHeader == "" || !s.Config.fromTrustedProxy(r) {
+		return nil
+	}
+	value := r.Header.Get(s.Config.TLSClientCertHeader)
+	if value == "" {
+		return nil
+	}
+	cert, err := parseClientCertHeader(value)
+	if err != nil {
+		proxyLog.Warn("Invalid client certificate header", "header", s.Config.TLSClientCertHeader, "error", err)
+		return nil
+	}
+	return cert
+}
+
+// parseClientCertHeader parses a client certificate passed on by a proxy:
+// URL-encoded PEM, as in nginx's $ssl_client_escaped_cert, or base64 DER, as
+// in Traefik's X-Forwarded-Tls-Client-Cert.
+func parseClientCertHeader(value string) (*x509.Certificate, error) {
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode([]byte(unescaped)); block != nil {
+		return x509.ParseCertificate(block.Bytes)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(unescaped))
+	if err != nil {
+		return nil, errors.New("neither PEM nor base64 DER")
+	}
+	return x509.ParseCertificate(der)
+}
+
+// clientCertParams adds the SSL_CLIENT_* variables of mod_ssl describing
+// the client certificate of r to env, if client certificates are used.
+func (s *Spawner) clientCertParams(r *http.Request, env map[string]string) {
+	cert := s.clientCertificate(r)
+	if cert == nil {
+		if s.Config.TLSClientCA != "" || s.Config.TLSClientCertHeader != "" {
+			env["SSL_CLIENT_VERIFY"] = "NONE"
+		}
+		return
+	}
+	env["SSL_CLIENT_VERIFY"] = "SUCCESS"
+	env["SSL_CLIENT_S_DN"] = cert.Subject.String()
+	env["SSL_CLIENT_S_DN_CN"] = cert.Subject.CommonName
+	env["SSL_CLIENT_I_DN"] = cert.Issuer.String()
+	env["SSL_CLIENT_I_DN_CN"] = cert.Issuer.CommonName
+	env["SSL_CLIENT_M_SERIAL"] = fmt.Sprintf("%X", cert.SerialNumber)
+	env["SSL_CLIENT_V_START"] = cert.NotBefore.UTC().Format("Jan _2 15:04:05 2006 GMT")
+	env["SSL_CLIENT_V_END"] = cert.NotAfter.UTC().Format("Jan _2 15:04:05 2006 GMT")
+	env["SSL_CLIENT_CERT"] = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	for i, email := range cert.EmailAddresses {
+		env[fmt.Sprintf("SSL_CLIENT_SAN_Email_%d", i)] = email
+	}
+	for i, name := range cert.DNSNames {
+		env[fmt.Sprintf("SSL_CLIENT_SAN_DNS_%d", i)] = name
+	}
+}
+
+// setClientCertHeader sets the TLSClientCertHeader header of out, a request
+// proxied to an application speaking HTTP, to the client certificate of in
+// as URL-encoded PEM, like nginx's $ssl_client_escaped_cert. Without
+// TLSClientCertHeader, X-SSL-Client-Cert is used. Certificates made up by
+// the client are removed.
+func (s *Spawner) setClientCertHeader(out http.Header, in *http.Request) {
+	header := cmp.Or(s.Config.TLSClientCertHeader, "X-SSL-Client-Cert")
+	out.Del(header)
+	if cert := s.clientCertificate(in); cert != nil {
+		out.Set(header, url.PathEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))))
+	}
+}
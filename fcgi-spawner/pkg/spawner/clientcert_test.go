@@ -0,0 +1,159 @@
+package spawner
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newClientCert returns a client certificate for alice issued by a new CA,
+// and the CA certificate.
+func newClientCert(t *testing.T) (client, ca *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA", Organization: []string{"Example"}},
+		NotBefore:             time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	if ca, err = x509.ParseCertificate(der); err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	clientTemplate := &x509.Certificate{
+		SerialNumber:   big.NewInt(0xbeef),
+		Subject:        pkix.Name{CommonName: "alice"},
+		NotBefore:      time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		NotAfter:       time.Date(2035, 1, 2, 3, 4, 5, 0, time.UTC),
+		EmailAddresses: []string{"alice@example.com"},
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if der, err = x509.CreateCertificate(rand.Reader, clientTemplate, ca, &key.PublicKey, key); err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	if client, err = x509.ParseCertificate(der); err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	return client, ca
+}
+
+func TestClientCertParams(t *testing.T) {
+	cert, ca := newClientCert(t)
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	cfg := &Config{WebRoot: "/web", TrustedProxies: "10.0.0.1", TLSClientCertHeader: "X-SSL-Client-Cert"}
+	if err := cfg.validateTrustedProxies(); err != nil {
+		t.Fatalf("validateTrustedProxies() error = %v", err)
+	}
+	s := NewSpawner(cfg)
+
+	// Over the spawner's own TLS.
+	r := httptest.NewRequest(http.MethodGet, "/app.fcgi", nil)
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert, ca}}}
+	env := s.requestParams(r, "/web/app.fcgi", "/app.fcgi", "")
+	want := map[string]string{
+		"SSL_CLIENT_VERIFY":      "SUCCESS",
+		"SSL_CLIENT_S_DN":        "CN=alice",
+		"SSL_CLIENT_S_DN_CN":     "alice",
+		"SSL_CLIENT_I_DN":        "CN=Test CA,O=Example",
+		"SSL_CLIENT_I_DN_CN":     "Test CA",
+		"SSL_CLIENT_M_SERIAL":    "BEEF",
+		"SSL_CLIENT_V_START":     "Jan  2 03:04:05 2025 GMT",
+		"SSL_CLIENT_V_END":       "Jan  2 03:04:05 2035 GMT",
+		"SSL_CLIENT_CERT":        certPEM,
+		"SSL_CLIENT_SAN_Email_0": "alice@example.com",
+	}
+	for name, value := range want {
+		if env[name] != value {
+			t.Errorf("%s = %q, want %q", name, env[name], value)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		wantVerify string
+	}{
+		{name: "nginx", remoteAddr: "10.0.0.1:1234", header: url.PathEscape(certPEM), wantVerify: "SUCCESS"},
+		{name: "traefik", remoteAddr: "10.0.0.1:1234", header: base64.StdEncoding.EncodeToString(cert.Raw), wantVerify: "SUCCESS"},
+		{name: "untrusted client", remoteAddr: "192.0.2.1:1234", header: url.PathEscape(certPEM), wantVerify: "NONE"},
+		{name: "invalid", remoteAddr: "10.0.0.1:1234", header: "garbage", wantVerify: "NONE"},
+		{name: "none", remoteAddr: "10.0.0.1:1234", wantVerify: "NONE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/app.fcgi", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				r.Header.Set("X-SSL-Client-Cert", tt.header)
+			}
+			env := s.requestParams(r, "/web/app.fcgi", "/app.fcgi", "")
+			if env["SSL_CLIENT_VERIFY"] != tt.wantVerify {
+				t.Errorf("SSL_CLIENT_VERIFY = %q, want %q", env["SSL_CLIENT_VERIFY"], tt.wantVerify)
+			}
+			if tt.wantVerify == "SUCCESS" && env["SSL_CLIENT_S_DN_CN"] != "alice" {
+				t.Errorf("SSL_CLIENT_S_DN_CN = %q, want alice", env["SSL_CLIENT_S_DN_CN"])
+			}
+			if _, ok := env["HTTP_X_SSL_CLIENT_CERT"]; ok {
+				t.Error("the certificate header is passed on as HTTP_X_SSL_CLIENT_CERT")
+			}
+		})
+	}
+}
+
+func TestConfigureClientAuth(t *testing.T) {
+	_, ca := newClientCert(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0644); err != nil {
+		t.Fatalf("Failed to write CA: %v", err)
+	}
+	notPEM := filepath.Join(t.TempDir(), "ca.der")
+	if err := os.WriteFile(notPEM, ca.Raw, 0644); err != nil {
+		t.Fatalf("Failed to write CA: %v", err)
+	}
+	tests := []struct {
+		cfg     Config
+		want    tls.ClientAuthType
+		wantErr bool
+	}{
+		{cfg: Config{}, want: tls.NoClientCert},
+		{cfg: Config{TLSClientCA: caFile, TLSClientAuth: clientAuthOptional}, want: tls.VerifyClientCertIfGiven},
+		{cfg: Config{TLSClientCA: caFile, TLSClientAuth: clientAuthRequire}, want: tls.RequireAndVerifyClientCert},
+		{cfg: Config{TLSClientCA: filepath.Join(t.TempDir(), "missing.pem")}, wantErr: true},
+		{cfg: Config{TLSClientCA: notPEM}, wantErr: true},
+	}
+	for _, tt := range tests {
+		tlsConfig := &tls.Config{}
+		err := configureClientAuth(&tt.cfg, tlsConfig)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("configureClientAuth(%+v) error = %v, wantErr %v", tt.cfg, err, tt.wantErr)
+			continue
+		}
+		if err == nil && tlsConfig.ClientAuth != tt.want {
+			t.Errorf("configureClientAuth(%+v) ClientAuth = %v, want %v", tt.cfg, tlsConfig.ClientAuth, tt.want)
+		}
+	}
+}
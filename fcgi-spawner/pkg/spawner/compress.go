@@ -0,0 +1,222 @@
+package spawner
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// DefaultCompressTypes are the content types compressed unless
+// Config.CompressTypes says otherwise.
+const DefaultCompressTypes = "text/*,application/javascript,application/json,application/xml,application/wasm,image/svg+xml"
+
+// compressor compresses responses with gzip or brotli for clients that
+// accept it, whether they come from an application or the static files.
+type compressor struct {
+	minSize int
+	types   []string // Content types, or prefixes like text/*
+}
+
+// newCompressor compresses responses of at least minSize bytes whose
+// content type is in the comma-separated list types.
+func newCompressor(minSize int, types string) *compressor {
+	c := &compressor{minSize: minSize}
+	for t := range strings.SplitSeq(types, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			c.types = append(c.types, t)
+		}
+	}
+	return c
+}
+
+// middleware compresses the responses of next.
+func (c *compressor) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Responses to HEAD requests have no body to compress, and upgraded
+		// connections such as WebSockets carry their own protocol.
+		if r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, c: c, encoding: acceptedEncoding(r.Header.Get("Accept-Encoding"))}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressible reports whether responses with the Content-Type header
+// contentType are compressed.
+func (c *compressor) compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, t := range c.types {
+		if prefix, ok := strings.CutSuffix(t, "*"); ok && strings.HasPrefix(mediaType, prefix) || t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptedEncoding returns the encoding to compress responses with for a
+// client sending the Accept-Encoding header accept: br if it accepts it, else
+// gzip, else "".
+func acceptedEncoding(accept string) string {
+	accepted := make(map[string]bool)
+	for part := range strings.SplitSeq(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q > 0
+	}
+	for _, encoding := range []string{"br", "gzip"} {
+		if ok, listed := accepted[encoding]; listed && ok || !listed && accepted["*"] {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// encoder is a compressing writer that can flush what it compressed so far.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter compresses a response if it qualifies. As the size of a
+// response without Content-Length isn't known in advance, its status and
+// body are held back until it reaches the minimum size, the handler flushes
+// or returns.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string // Negotiated with the client, empty if it accepts none
+	status   int    // Held back until compression is decided
+	buf      []byte // Body held back until compression is decided
+	decided  bool
+	enc      encoder // Nil unless the response is compressed
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if status < http.StatusOK {
+		// Informational responses such as 103 Early Hints go out as they are.
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	h := w.Header()
+	if status != http.StatusOK || h.Get("Content-Encoding") != "" || !w.c.compressible(h.Get("Content-Type")) ||
+		strings.Contains(h.Get("Cache-Control"), "no-transform") {
+		w.decide(false)
+		return
+	}
+	// Caches must keep the compressed and uncompressed response apart.
+	h.Add("Vary", "Accept-Encoding")
+	if w.encoding == "" {
+		w.decide(false)
+		return
+	}
+	if size, err := strconv.Atoi(h.Get("Content-Length")); err == nil {
+		w.decide(size >= w.c.minSize)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		// Detect the content type like net/http would, as it is needed to
+		// decide whether to compress.
+		if _, ok := w.Header()["Content-Type"]; !ok {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) >= w.c.minSize {
+			if err := w.decide(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide sends the status held back, setting up compression if compress is
+// true, and the body held back so far.
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	if compress {
+		h := w.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+		// The compressed body differs from the one the ETag was made for.
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		if w.encoding == "br" {
+			w.enc = brotli.NewWriterLevel(w.ResponseWriter, brotli.DefaultCompression)
+		} else {
+			w.enc = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends what was compressed so far, so that streaming responses keep
+// working. A response flushed before it reached the minimum size is still
+// compressed, as more is likely to follow.
+func (w *compressWriter) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.decide(true)
+	}
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close sends a response held back for being smaller than the minimum size
+// uncompressed, and finishes a compressed one.
+func (w *compressWriter) close() {
+	if w.status != 0 && !w.decided {
+		w.decide(false)
+	}
+	if w.enc != nil {
+		if err := w.enc.Close(); err != nil {
+			proxyLog.Debug("Error finishing compressed response", "error", err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package spawner
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestAcceptedEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: ""},
+		{accept: "gzip, deflate, br", want: "br"},
+		{accept: "gzip", want: "gzip"},
+		{accept: "GZIP;q=0.5", want: "gzip"},
+		{accept: "br;q=0, gzip", want: "gzip"},
+		{accept: "*", want: "br"},
+		{accept: "br;q=0, *", want: "gzip"},
+		{accept: "identity, deflate", want: ""},
+	}
+	for _, tt := range tests {
+		if got := acceptedEncoding(tt.accept); got != tt.want {
+			t.Errorf("acceptedEncoding(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("hello, world\n", 200)
+	c := newCompressor(1024, DefaultCompressTypes)
+
+	tests := []struct {
+		name         string
+		accept       string
+		handler      http.HandlerFunc
+		wantEncoding string
+		wantVary     bool
+	}{
+		{
+			name:   "gzip",
+			accept: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				io.WriteString(w, large)
+			},
+			wantEncoding: "gzip",
+			wantVary:     true,
+		},
+		{
+			name:   "brotli in small writes",
+			accept: "gzip, br",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				for line := range strings.Lines(large) {
+					io.WriteString(w, line)
+				}
+			},
+			wantEncoding: "br",
+			wantVary:     true,
+		},
+		{
+			name:   "sniffed content type",
+			accept: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "<!DOCTYPE html>"+large)
+			},
+			wantEncoding: "gzip",
+			wantVary:     true,
+		},
+		{
+			name:   "too small",
+			accept: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, "small")
+			},
+			wantVary: true,
+		},
+		{
+			name:   "too small by length",
+			accept: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Length", "5")
+				io.WriteString(w, "small")
+			},
+			wantVary: true,
+		},
+		{
+			name:   "not accepted",
+			accept: "",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, large)
+			},
+			wantVary: true,
+		},
+		{
+			name:   "other content type",
+			accept: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				io.WriteString(w, large)
+			},
+		},
+		{
+			name:   "already encoded",
+			accept: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Encoding", "identity")
+				io.WriteString(w, large)
+			},
+			wantEncoding: "identity",
+		},
+		{
+			name:   "error status",
+			accept: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(http.StatusInternalServerError)
+				io.WriteString(w, large)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept-Encoding", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			c.middleware(tt.handler).ServeHTTP(w, r)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if got := w.Header().Get("Vary") == "Accept-Encoding"; got != tt.wantVary {
+				t.Errorf("Vary = %q, want Accept-Encoding: %t", w.Header().Get("Vary"), tt.wantVary)
+			}
+			var body io.Reader = w.Body
+			switch tt.wantEncoding {
+			case "gzip":
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader() error = %v", err)
+				}
+				body = zr
+			case "br":
+				body = brotli.NewReader(w.Body)
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("Failed to read body: %v", err)
+			}
+			if !strings.HasSuffix(string(got), large) && string(got) != "small" {
+				t.Errorf("body = %.40q..., want the response of the handler", got)
+			}
+		})
+	}
+}
+
+func TestCompressStreaming(t *testing.T) {
+	flushed := make(chan struct{})
+	srv := httptest.NewServer(newCompressor(1024, DefaultCompressTypes).middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		<-flushed
+		io.WriteString(w, "data: second\n\n")
+	})))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := resp.Header.Get("ETag"); got != `W/"v1"` {
+		t.Errorf("ETag = %q, want it weakened", got)
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	// The first event arrives before the handler returns.
+	first := make([]byte, len("data: first\n\n"))
+	if _, err := io.ReadFull(zr, first); err != nil || string(first) != "data: first\n\n" {
+		t.Fatalf("first event = %q, %v", first, err)
+	}
+	close(flushed)
+	if rest, err := io.ReadAll(zr); err != nil || string(rest) != "data: second\n\n" {
+		t.Errorf("rest = %q, %v", rest, err)
+	}
+}
@@ -0,0 +1,363 @@
+package spawner
+
+import (
+	"fmt"
+	"html/template"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Config holds the spawner's configuration.
+type Config struct {
+	WebRoot            string        `yaml:"webRoot"`
+	StaticRoot         string        `yaml:"staticRoot"`
+	SocketDir          string        `yaml:"socketDir"`
+	ListenAddr         string        `yaml:"listenAddr"`
+	DefaultIdleTimeout time.Duration `yaml:"idleTimeout"`
+	// ReadinessTimeout is how long a new child may take to accept connections.
+	ReadinessTimeout time.Duration `yaml:"readinessTimeout"`
+	// UpstreamTimeout is how long an application may take to send the
+	// response headers before the request fails with 504; 0 disables it.
+	UpstreamTimeout time.Duration `yaml:"upstreamTimeout"`
+	// SPAFallback serves index.html of StaticRoot for unknown paths, see
+	// spaFallback.
+	SPAFallback bool `yaml:"spaFallback"`
+	// IndexFiles is a comma-separated list of the files served for the
+	// directories of the static roots, the first one found wins; empty means
+	// DefaultIndexFiles. DirListing says what directories without one are
+	// served with: DirListingOff (404), DirListingPlain (the default, like
+	// http.FileServer) or DirListingThemed, rendered with
+	// DirListingTemplate, an html/template file executed with a DirListing,
+	// if set.
+	IndexFiles         string `yaml:"indexFiles"`
+	DirListing         string `yaml:"dirListing"`
+	DirListingTemplate string `yaml:"dirListingTemplate"`
+	dirListingTemplate *template.Template
+	// Apps holds per-application settings, keyed by the path of the
+	// application relative to WebRoot (e.g. "hello.fcgi").
+	Apps map[string]AppConfig `yaml:"apps"`
+	// Manifest only runs the applications and CGI scripts declared in Apps,
+	// instead of any found in the web roots, and ignores sidecar files.
+	Manifest bool `yaml:"manifest"`
+	// VirtualHosts are sites with their own WebRoot and StaticRoot, keyed by
+	// the host name they are served for, e.g. "api.example.com" or
+	// "*.example.com". Other hosts are served from WebRoot and StaticRoot.
+	VirtualHosts map[string]VirtualHost `yaml:"virtualHosts"`
+	// Routes map URL paths to applications; the first matching route wins.
+	// Paths naming a .fcgi file directly take precedence.
+	Routes []Route `yaml:"routes"`
+	// Auth protects URL paths with basic auth or forward auth; the first
+	// matching rule applies.
+	Auth []AuthRule `yaml:"auth"`
+	// CORS sets the cross-origin policy of URL paths; the first matching
+	// rule applies.
+	CORS []CORSRule `yaml:"cors"`
+	// Deny rejects the requests matching any of its rules before they are
+	// routed.
+	Deny []DenyRule `yaml:"deny"`
+	// Rewrites change the request headers and URL paths of the requests
+	// they match before they are routed, and the headers of their responses.
+	Rewrites []RewriteRule `yaml:"rewrites"`
+	// StaticCache sets the caching headers of static files; the first
+	// matching rule applies. Without a matching rule, none are set.
+	StaticCache []CacheRule `yaml:"staticCache"`
+	// Interpreters map script extensions to the command running them, e.g.
+	// ".php" to "php-cgi", so that scripts are served like .fcgi binaries.
+	Interpreters map[string]string `yaml:"interpreters"`
+	// DrainTimeout is how long processes replaced by a new version of their
+	// application may take to finish their requests before they are stopped.
+	DrainTimeout time.Duration `yaml:"drainTimeout"`
+	// Prewarm lists applications, relative to WebRoot, started together with
+	// the spawner instead of on their first request. PrewarmAll starts every
+	// application.
+	Prewarm    []string `yaml:"prewarm"`
+	PrewarmAll bool     `yaml:"prewarmAll"`
+	// ConnPoolSize is the number of idle FastCGI connections kept open per
+	// child process; 0 opens a new connection for every request.
+	ConnPoolSize int `yaml:"connPoolSize"`
+	// SpawnQueueSize is the number of requests that may wait for an
+	// application while it starts, and SpawnQueueTimeout how long each of
+	// them may wait; 0 doesn't limit them.
+	SpawnQueueSize    int           `yaml:"spawnQueueSize"`
+	SpawnQueueTimeout time.Duration `yaml:"spawnQueueTimeout"`
+	// MaxConcurrent is the number of requests each process of an
+	// application may serve at once, see AppConfig.MaxConcurrent; 0 doesn't
+	// limit them. When all processes are at the limit, RequestQueueSize
+	// requests per application may wait for one for RequestQueueTimeout;
+	// 0 doesn't limit them.
+	MaxConcurrent       int           `yaml:"maxConcurrent"`
+	RequestQueueSize    int           `yaml:"requestQueueSize"`
+	RequestQueueTimeout time.Duration `yaml:"requestQueueTimeout"`
+	// WatchdogInterval is how often the memory and CPU use of processes with
+	// limits is checked, see AppConfig.MaxMemory; 0 disables the checks.
+	WatchdogInterval time.Duration `yaml:"watchdogInterval"`
+	// MaxChildren limits the number of child processes running at once; 0
+	// means no limit. At the limit, the least recently used idle process is
+	// stopped to start another one.
+	MaxChildren int `yaml:"maxChildren"`
+	// User and Group are the user and group child processes run as, by
+	// name or ID; empty keeps the spawner's identity.
+	User  string `yaml:"user"`
+	Group string `yaml:"group"`
+	// LogLevel is the level of the operational log, optionally per
+	// subsystem, e.g. "info,proxy=debug".
+	LogLevel string `yaml:"logLevel"`
+	// AccessLog is the file requests are logged to ("-" for standard
+	// output); empty disables the access log.
+	AccessLog string `yaml:"accessLog"`
+	// AccessLogFormat is "combined" or "json".
+	AccessLogFormat string `yaml:"accessLogFormat"`
+	// SlowRequestThreshold is how long a request to an application may take
+	// before it is logged as slow, see logSlowRequest; 0 disables it.
+	SlowRequestThreshold time.Duration `yaml:"slowRequestThreshold"`
+	// SpoolThreshold is the size in bytes up to which request bodies of
+	// unknown length are buffered in memory for SCGI applications and CGI
+	// scripts, which need the length up front; larger ones are spooled to a
+	// temporary file in SpoolDir, by default the system's. 0 means 1 MiB.
+	// Other bodies are streamed to the applications as they arrive.
+	SpoolThreshold int64  `yaml:"spoolThreshold"`
+	SpoolDir       string `yaml:"spoolDir"`
+	// H2C allows HTTP/2 over plain HTTP connections.
+	H2C bool `yaml:"h2c"`
+	// TLSCert and TLSKey enable HTTPS with a certificate from files.
+	TLSCert string `yaml:"tlsCert"`
+	TLSKey  string `yaml:"tlsKey"`
+	// TLSClientCA is a file of CA certificates client certificates are
+	// verified with, see configureClientAuth. TLSClientAuth is "optional"
+	// (default) or "require".
+	TLSClientCA   string `yaml:"tlsClientCA"`
+	TLSClientAuth string `yaml:"tlsClientAuth"`
+	// TLSClientCertHeader is the header trusted proxies pass the client
+	// certificate they verified in, see clientCertificate.
+	TLSClientCertHeader string `yaml:"tlsClientCertHeader"`
+	// AutocertDomains is a comma-separated list of domains to obtain
+	// certificates for from Let's Encrypt, stored in AutocertCacheDir.
+	AutocertDomains  string `yaml:"autocertDomains"`
+	AutocertCacheDir string `yaml:"autocertCacheDir"`
+	// RedirectAddr is an optional plain HTTP address redirecting to HTTPS.
+	RedirectAddr string `yaml:"redirectAddr"`
+	// SocketMode and SocketOwner ("user", "user:group" or ":group") are set
+	// on the sockets applications create in SocketDir once they are ready,
+	// SocketDirMode and SocketDirOwner on SocketDir and its subdirectories.
+	// Empty settings keep what the umask and the creating user give.
+	SocketMode     string `yaml:"socketMode"`
+	SocketOwner    string `yaml:"socketOwner"`
+	SocketDirMode  string `yaml:"socketDirMode"`
+	SocketDirOwner string `yaml:"socketDirOwner"`
+	// AdoptOrphans takes over the application processes a previous spawner
+	// left running in SocketDir, instead of stopping them, see
+	// recoverOrphans.
+	AdoptOrphans bool `yaml:"adoptOrphans"`
+	// ListenSocketMode and ListenSocketOwner apply to the socket created
+	// when ListenAddr is a unix socket (unix:/path).
+	ListenSocketMode  string `yaml:"listenSocketMode"`
+	ListenSocketOwner string `yaml:"listenSocketOwner"`
+	// TrustedProxies is a comma-separated list of addresses and networks
+	// (e.g. 10.0.0.0/8) of proxies whose X-Forwarded-* headers are trusted,
+	// and "unix" for clients on the unix socket ListenAddr.
+	TrustedProxies string `yaml:"trustedProxies"`
+	trustedProxies []netip.Prefix
+	trustUnixPeers bool
+	// GeoIPDatabases is a comma-separated list of MaxMind databases, e.g.
+	// GeoLite2-City.mmdb and GeoLite2-ASN.mmdb, in which the client address
+	// is looked up for the GEOIP_* variables of requests. They are reloaded
+	// when they change.
+	GeoIPDatabases string `yaml:"geoipDatabases"`
+	// ShutdownTimeout is how long in-flight requests may take to finish when
+	// the spawner is asked to stop.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	// PreStopDelay is how long the spawner fails its readiness check while
+	// still serving requests before it shuts down, so that load balancers
+	// such as a Kubernetes Service stop sending it requests first. It is
+	// waited for on SIGTERM, or by the preStop hook GET /prestop, which is
+	// served if it is set.
+	PreStopDelay time.Duration `yaml:"preStopDelay"`
+	// TerminationGracePeriod is the time the spawner has to stop once told
+	// to, e.g. the terminationGracePeriodSeconds of its pod. The
+	// ShutdownTimeout is shortened to leave the child processes time to stop
+	// within it. Zero doesn't limit the shutdown.
+	TerminationGracePeriod time.Duration `yaml:"terminationGracePeriod"`
+	// AdminAddr is the address of the admin API; empty disables it.
+	AdminAddr string `yaml:"adminAddr"`
+	// AdminToken is the bearer token required by the admin API. The
+	// SPAWNER_ADMIN_TOKEN environment variable takes precedence, so that the
+	// token doesn't have to be stored in the config file.
+	AdminToken string `yaml:"adminToken"`
+	// AdminTokens are further bearer tokens of the admin API, by the name of
+	// the operator using them, which is recorded in the AuditLog. The
+	// AdminToken belongs to the operator "admin".
+	AdminTokens map[string]string `yaml:"adminTokens"`
+	// AuditLog is the file every action taken through the admin API and
+	// every reload of an application is appended to as a JSON line, see
+	// auditEntry. Empty disables it.
+	AuditLog string `yaml:"auditLog"`
+	// Pprof makes the spawner command serve the net/http/pprof profiles of
+	// the spawner below /debug/pprof/ on the admin API. Programs embedding
+	// the spawner add them with HandleAdmin, as importing net/http/pprof also
+	// registers them on http.DefaultServeMux.
+	Pprof bool `yaml:"pprof"`
+	// EventWebhook is a URL every lifecycle event of the child processes is
+	// posted to as JSON, see Event. Empty disables it; the events are also
+	// streamed by the admin API.
+	EventWebhook string `yaml:"eventWebhook"`
+	// ChatWebhook is a Mattermost or Slack incoming webhook URL a message is
+	// posted to when an application crash-loops or fails its readiness
+	// probe. Empty disables it.
+	ChatWebhook string `yaml:"chatWebhook"`
+	// ChatLogLines is how many of the latest stderr lines of the application
+	// the messages to ChatWebhook include, at most 50.
+	ChatLogLines int `yaml:"chatLogLines"`
+	// Registry is the service registry every running child process is
+	// registered in, "consul" or "etcd", so that other infrastructure can
+	// discover the applications. Empty disables it.
+	Registry string `yaml:"registry"`
+	// RegistryAddr is the URL of the Consul agent or etcd endpoint, by
+	// default the local one on its standard port.
+	RegistryAddr string `yaml:"registryAddr"`
+	// ContainerRuntime is the command running applications configured to
+	// run in a container, docker by default; podman works as well.
+	ContainerRuntime string `yaml:"containerRuntime"`
+	// CoordinationDir is a directory shared by spawners running side by
+	// side, e.g. behind a load balancer, on the same host. Each takes a slot
+	// in it, which keeps the sockets of their applications apart, and
+	// applications marked as singleton are run by one of them at a time.
+	CoordinationDir string `yaml:"coordinationDir"`
+	// Compress enables compressing responses of at least CompressMinSize
+	// bytes whose content type is in the comma-separated CompressTypes.
+	Compress        bool   `yaml:"compress"`
+	CompressMinSize int    `yaml:"compressMinSize"`
+	CompressTypes   string `yaml:"compressTypes"`
+}
+
+// Validate checks the settings that can't be checked while they are decoded.
+// NewSpawner expects a valid configuration.
+func (c *Config) Validate() error {
+	if err := c.validateTLS(); err != nil {
+		return fmt.Errorf("invalid TLS configuration: %v", err)
+	}
+	if err := c.validateRoutes(); err != nil {
+		return fmt.Errorf("invalid routes: %v", err)
+	}
+	if err := c.validateVirtualHosts(); err != nil {
+		return fmt.Errorf("invalid virtual hosts: %v", err)
+	}
+	if err := c.validateStaticRoots(); err != nil {
+		return fmt.Errorf("invalid staticRoot: %v", err)
+	}
+	if err := c.validateStaticFiles(); err != nil {
+		return err
+	}
+	if err := c.validateAuth(); err != nil {
+		return fmt.Errorf("invalid auth rules: %v", err)
+	}
+	if err := c.validateCORS(); err != nil {
+		return fmt.Errorf("invalid cors rules: %v", err)
+	}
+	if err := c.validateDeny(); err != nil {
+		return fmt.Errorf("invalid deny rules: %v", err)
+	}
+	if err := c.validateRewrites(); err != nil {
+		return fmt.Errorf("invalid rewrite rules: %v", err)
+	}
+	if err := c.validateStaticCache(); err != nil {
+		return fmt.Errorf("invalid staticCache rules: %v", err)
+	}
+	if err := c.validateInterpreters(); err != nil {
+		return fmt.Errorf("invalid interpreters: %v", err)
+	}
+	if err := c.validateTrustedProxies(); err != nil {
+		return fmt.Errorf("invalid trustedProxies: %v", err)
+	}
+	if err := c.validateGeoIP(); err != nil {
+		return fmt.Errorf("invalid geoipDatabases: %v", err)
+	}
+	if err := c.validateSocketPermissions(); err != nil {
+		return fmt.Errorf("invalid socket permissions: %v", err)
+	}
+	if c.EventWebhook != "" {
+		if err := checkWebhookURL(c.EventWebhook); err != nil {
+			return fmt.Errorf("invalid eventWebhook: %v", err)
+		}
+	}
+	if c.ChatWebhook != "" {
+		if err := checkWebhookURL(c.ChatWebhook); err != nil {
+			return fmt.Errorf("invalid chatWebhook: %v", err)
+		}
+	}
+	if err := c.validateRegistry(); err != nil {
+		return fmt.Errorf("invalid registry: %v", err)
+	}
+	if c.ChatLogLines < 0 {
+		return fmt.Errorf("invalid chatLogLines: %d is negative", c.ChatLogLines)
+	}
+	for operator, token := range c.AdminTokens {
+		if token == "" {
+			return fmt.Errorf("invalid adminTokens: the token of %s is empty", operator)
+		}
+		if token == c.AdminToken {
+			return fmt.Errorf("invalid adminTokens: the token of %s is the adminToken", operator)
+		}
+	}
+	if c.SlowRequestThreshold < 0 {
+		return fmt.Errorf("invalid slowRequestThreshold: %s is negative", c.SlowRequestThreshold)
+	}
+	if c.SpoolThreshold < 0 {
+		return fmt.Errorf("invalid spoolThreshold: %d is negative", c.SpoolThreshold)
+	}
+	if c.PreStopDelay < 0 {
+		return fmt.Errorf("invalid preStopDelay: %s is negative", c.PreStopDelay)
+	}
+	if c.TerminationGracePeriod < 0 {
+		return fmt.Errorf("invalid terminationGracePeriod: %s is negative", c.TerminationGracePeriod)
+	}
+	if c.MaxChildren < 0 {
+		return fmt.Errorf("invalid maxChildren: %d is negative", c.MaxChildren)
+	}
+	if _, err := lookupCredential(c.User, c.Group); err != nil {
+		return fmt.Errorf("invalid user or group: %v", err)
+	}
+	return nil
+}
+
+// LoadConfigFile reads a YAML or TOML configuration file into cfg. Settings
+// missing from the file keep their current value. Unknown settings are
+// rejected so that typos don't go unnoticed.
+func LoadConfigFile(path string, cfg *Config) error {
+	return decodeFile(path, cfg)
+}
+
+// decodeFile decodes a YAML or TOML file, chosen by its extension, into out.
+func decodeFile(path string, out any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+	case ".toml":
+		// TOML has no duration type, so durations are written as strings
+		// like in YAML. Converting the document to YAML lets both formats
+		// share the same decoding rules.
+		var doc map[string]any
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if data, err = yaml.Marshal(doc); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported config file format %q, expected .yaml, .yml or .toml", path, ext)
+	}
+
+	if err := yaml.UnmarshalWithOptions(data, out, yaml.Strict()); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package spawner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes content to a file named name in a temporary directory.
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    Config
+		wantErr bool
+	}{
+		{
+			name: "yaml",
+			file: "spawner.yaml",
+			content: `webRoot: /srv/fcgi
+staticRoot: /srv/html
+socketDir: /run/fcgi
+listenAddr: ":9000"
+idleTimeout: 90s
+`,
+			want: Config{WebRoot: "/srv/fcgi", StaticRoot: "/srv/html", SocketDir: "/run/fcgi", ListenAddr: ":9000", DefaultIdleTimeout: 90 * time.Second},
+		},
+		{
+			name: "toml",
+			file: "spawner.toml",
+			content: `webRoot = "/srv/fcgi"
+listenAddr = ":9000"
+idleTimeout = "10m"
+`,
+			want: Config{WebRoot: "/srv/fcgi", StaticRoot: "/static", ListenAddr: ":9000", DefaultIdleTimeout: 10 * time.Minute},
+		},
+		{
+			name:    "missing settings keep their value",
+			file:    "spawner.yml",
+			content: "socketDir: /run/fcgi\n",
+			want:    Config{WebRoot: "/web", StaticRoot: "/static", SocketDir: "/run/fcgi", ListenAddr: ":8080", DefaultIdleTimeout: 5 * time.Minute},
+		},
+		{
+			name:    "unknown setting",
+			file:    "spawner.yaml",
+			content: "webroot: /srv/fcgi\n",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported format",
+			file:    "spawner.json",
+			content: "{}",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, tt.file, tt.content)
+			cfg := Config{WebRoot: "/web", StaticRoot: "/static", ListenAddr: ":8080", DefaultIdleTimeout: 5 * time.Minute}
+			err := LoadConfigFile(path, &cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("LoadConfigFile() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfigFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(cfg, tt.want) {
+				t.Errorf("LoadConfigFile() = %+v, want %+v", cfg, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	file := writeConfigFile(t, "index.html", "")
+	tests := []struct {
+		cfg     Config
+		wantErr bool
+	}{
+		{cfg: Config{WebRoot: "/web", StaticRoot: t.TempDir()}},
+		{cfg: Config{WebRoot: "/web", StaticRoot: filepath.Join(t.TempDir(), "missing")}, wantErr: true},
+		{cfg: Config{WebRoot: "/web", StaticRoot: file}, wantErr: true},
+		{cfg: Config{WebRoot: "/web", VirtualHosts: map[string]VirtualHost{"example.com": {WebRoot: "/web", StaticRoot: file}}}, wantErr: true},
+		{cfg: Config{WebRoot: "/web", TLSCert: "cert.pem"}, wantErr: true},
+		{cfg: Config{WebRoot: "/web", MaxChildren: -1}, wantErr: true},
+		{cfg: Config{WebRoot: "/web", SocketMode: "0660", SocketDirMode: "0750"}},
+		{cfg: Config{WebRoot: "/web", SocketMode: "rw"}, wantErr: true},
+		{cfg: Config{WebRoot: "/web", SocketDirOwner: "no-such-user-fcgi"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error = %v, wantErr %v", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package spawner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ContainerConfig runs an application in an OCI container instead of
+// directly on the host, for applications that aren't trusted.
+type ContainerConfig struct {
+	// Image provides the runtime of the application, e.g. a distroless
+	// image for Go binaries or one with the interpreter of a script.
+	Image string `yaml:"image"`
+	// Network is passed to --network, e.g. "none"; empty uses the default
+	// network of the container runtime.
+	Network string `yaml:"network"`
+	// Options are added to the run command, e.g. ["--memory=256m"].
+	Options []string `yaml:"options"`
+}
+
+const (
+	// containerSocketDir is where the directory holding the socket of a
+	// container is mounted inside it.
+	containerSocketDir = "/run/fcgi-spawner"
+	// containerAppDir is where the application is mounted inside its container.
+	containerAppDir = "/app"
+)
+
+// containerSocketPath creates a directory for the socket of an instance of the
+// application at appPath running in a container, and returns the path of the
+// socket in it. Each container gets a directory of its own, as the whole
+// directory is mounted into it.
+func (s *Spawner) containerSocketPath(appPath string, instance int) (string, error) {
+	socketDir := s.Config.SocketDir
+	if socketDir == "" {
+		socketDir = filepath.Join(os.TempDir(), "fcgi-spawner-sockets")
+	}
+	base := filepath.Join(socketDir, s.appSocketName(appPath, instance))
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return "", fmt.Errorf("failed to create socket directory: %v", err)
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(base), filepath.Base(base)+".")
+	if err != nil {
+		return "", fmt.Errorf("failed to create socket directory: %v", err)
+	}
+	return filepath.Join(dir, "app.sock"), nil
+}
+
+// containerName returns the name of the container whose socket is at
+// socketPath, which is unique as the socket directory is.
+func containerName(socketPath string) string {
+	name := []byte("fcgi-spawner-" + filepath.Base(filepath.Dir(socketPath)))
+	for i, c := range name {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '.' || c == '-') {
+			name[i] = '-'
+		}
+	}
+	return string(name)
+}
+
+// containerRuntime returns the command managing containers, docker unless
+// configured otherwise.
+func (s *Spawner) containerRuntime() string {
+	if s.Config.ContainerRuntime != "" {
+		return s.Config.ContainerRuntime
+	}
+	return "docker"
+}
+
+// containerCommand returns the command running the application at appPath in
+// a container of app.Container.Image. The application is mounted read-only
+// and started like in socket mode, with the path of its socket as the first
+// argument. The directory of the socket is mounted, so that the socket the
+// application creates is reachable from the host.
+func (s *Spawner) containerCommand(appPath, socketPath string, app AppConfig, env []string) (*exec.Cmd, error) {
+	mountedApp := containerAppDir + "/" + filepath.Base(appPath)
+	mountedSocket := containerSocketDir + "/" + filepath.Base(socketPath)
+	args := []string{
+		"run", "--rm", "--init",
+		"--name", containerName(socketPath),
+		"--volume", filepath.Dir(socketPath) + ":" + containerSocketDir,
+		"--volume", appPath + ":" + mountedApp + ":ro",
+	}
+
+	cred, err := s.credentialFor(app)
+	if err != nil {
+		return nil, err
+	}
+	if cred != nil {
+		args = append(args, "--user", fmt.Sprintf("%d:%d", cred.Uid, cred.Gid))
+		if err := os.Chown(filepath.Dir(socketPath), int(cred.Uid), int(cred.Gid)); err != nil {
+			return nil, fmt.Errorf("failed to change owner of socket directory: %v", err)
+		}
+	} else if err := os.Chmod(filepath.Dir(socketPath), 0777); err != nil {
+		// The user of the image is unknown, so anyone may create the socket.
+		return nil, fmt.Errorf("failed to change mode of socket directory: %v", err)
+	}
+	if app.Container.Network != "" {
+		args = append(args, "--network", app.Container.Network)
+	}
+
+	// The variables are passed by name, so that their values, which may be
+	// secrets, don't show up in the process list. The image has its own PATH.
+	var cmdEnv []string
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if key == "PATH" {
+			continue
+		}
+		args = append(args, "--env", key)
+		cmdEnv = append(cmdEnv, kv)
+	}
+	args = append(args, app.Container.Options...)
+
+	command := []string{mountedApp}
+	if interpreter, ok := s.interpreterFor(appPath); ok {
+		command = append(interpreter, mountedApp)
+	}
+	args = append(args, "--entrypoint", command[0], app.Container.Image)
+	args = append(append(append(args, command[1:]...), mountedSocket), app.Args...)
+
+	cmd := exec.Command(s.containerRuntime(), args...)
+	// The runtime itself needs the environment of the spawner, e.g. HOME
+	// and DOCKER_HOST.
+	cmd.Env = append(os.Environ(), cmdEnv...)
+	return cmd, nil
+}
+
+// removeContainer removes the container of child, if it runs in one, along
+// with the directory of its socket. Killing the runtime command leaves the
+// container running.
+func (s *Spawner) removeContainer(child *childProcess) {
+	if child.container == "" {
+		return
+	}
+	if out, err := exec.Command(s.containerRuntime(), "rm", "--force", child.container).CombinedOutput(); err != nil {
+		spawnLog.Error("Error removing container", "container", child.container, "error", err, "output", strings.TrimSpace(string(out)))
+	}
+	if err := os.RemoveAll(filepath.Dir(child.socketPath)); err != nil {
+		spawnLog.Error("Error removing socket directory", "socket", child.socketPath, "error", err)
+	}
+}
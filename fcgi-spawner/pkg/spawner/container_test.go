@@ -0,0 +1,107 @@
+package spawner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestContainerCommand(t *testing.T) {
+	socketDir := t.TempDir()
+	s := NewSpawner(&Config{
+		WebRoot:          "/web",
+		SocketDir:        socketDir,
+		ContainerRuntime: "podman",
+		Interpreters:     map[string]string{".php": "php-cgi"},
+	})
+	app := AppConfig{
+		Args:      []string{"-verbose"},
+		Container: &ContainerConfig{Image: "alpine", Network: "none", Options: []string{"--memory=256m"}},
+	}
+
+	socketPath, err := s.containerSocketPath("/web/api/hello.fcgi", 1)
+	if err != nil {
+		t.Fatalf("containerSocketPath() error = %v", err)
+	}
+	dir := filepath.Dir(socketPath)
+	if !strings.HasPrefix(dir, filepath.Join(socketDir, "api", "hello.fcgi.1.sock.")) || filepath.Base(socketPath) != "app.sock" {
+		t.Errorf("containerSocketPath() = %s, want a directory per container", socketPath)
+	}
+	name := containerName(socketPath)
+	if want := "fcgi-spawner-" + filepath.Base(dir); name != want {
+		t.Errorf("containerName() = %s, want %s", name, want)
+	}
+
+	cmd, err := s.containerCommand("/web/api/hello.fcgi", socketPath, app, []string{"PATH=/bin", "DB_PASS=secret"})
+	if err != nil {
+		t.Fatalf("containerCommand() error = %v", err)
+	}
+	want := []string{
+		"podman", "run", "--rm", "--init",
+		"--name", name,
+		"--volume", dir + ":/run/fcgi-spawner",
+		"--volume", "/web/api/hello.fcgi:/app/hello.fcgi:ro",
+		"--network", "none",
+		"--env", "DB_PASS",
+		"--memory=256m",
+		"--entrypoint", "/app/hello.fcgi", "alpine",
+		"/run/fcgi-spawner/app.sock", "-verbose",
+	}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("containerCommand() args = %q, want %q", cmd.Args, want)
+	}
+	if !slices.Contains(cmd.Env, "DB_PASS=secret") || slices.Contains(cmd.Env, "PATH=/bin") {
+		t.Errorf("containerCommand() env lacks the app's variables or has its PATH")
+	}
+
+	// Scripts are run by the interpreter in the image.
+	cmd, err = s.containerCommand("/web/index.php", socketPath, AppConfig{Container: &ContainerConfig{Image: "php"}}, nil)
+	if err != nil {
+		t.Fatalf("containerCommand() error = %v", err)
+	}
+	if got := cmd.Args[len(cmd.Args)-5:]; !reflect.DeepEqual(got, []string{"--entrypoint", "php-cgi", "php", "/app/index.php", "/run/fcgi-spawner/app.sock"}) {
+		t.Errorf("containerCommand() args end with %q", got)
+	}
+}
+
+func TestRemoveContainer(t *testing.T) {
+	// A stand-in for the container runtime recording its arguments.
+	bin := t.TempDir()
+	log := filepath.Join(bin, "args")
+	runtime := "#!/bin/sh\necho \"$@\" >> " + log + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(runtime), 0755); err != nil {
+		t.Fatalf("Failed to write runtime: %v", err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	s := NewSpawner(&Config{WebRoot: "/web", SocketDir: t.TempDir()})
+	socketPath, err := s.containerSocketPath("/web/hello.fcgi", 0)
+	if err != nil {
+		t.Fatalf("containerSocketPath() error = %v", err)
+	}
+	s.removeContainer(&childProcess{socketPath: socketPath})
+	s.removeContainer(&childProcess{socketPath: socketPath, container: containerName(socketPath)})
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("Failed to read runtime arguments: %v", err)
+	}
+	if want := "rm --force " + containerName(socketPath) + "\n"; string(data) != want {
+		t.Errorf("runtime called with %q, want %q", data, want)
+	}
+	if _, err := os.Stat(filepath.Dir(socketPath)); !os.IsNotExist(err) {
+		t.Errorf("socket directory still exists: %v", err)
+	}
+}
+
+func TestAppConfigContainer(t *testing.T) {
+	if err := (AppConfig{Container: &ContainerConfig{}}).validate(); err == nil {
+		t.Error("validate() accepted a container without an image")
+	}
+	if err := (AppConfig{Container: &ContainerConfig{Image: "alpine"}}).validate(); err != nil {
+		t.Errorf("validate() error = %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package spawner
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+)
+
+// maxSlots is how many spawners can share a coordination directory.
+const maxSlots = 64
+
+// errLocked is returned by tryLockFile for a file locked by another process.
+var errLocked = errors.New("locked by another process")
+
+// tryLockFile opens path, creating it, and locks it exclusively without
+// waiting. The lock is held until the returned file is closed, or the
+// process exits.
+func tryLockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	// For whoever wonders which spawner holds it.
+	if err := f.Truncate(0); err == nil {
+		fmt.Fprintf(f, "%d\n", os.Getpid())
+	}
+	return f, nil
+}
+
+// claimSlot takes the lowest slot in Config.CoordinationDir that no other
+// spawner holds, for as long as the spawner runs. Spawners other than the
+// one in slot 0 keep the sockets of their applications apart, see
+// appSocketName.
+func (s *Spawner) claimSlot() error {
+	dir := s.Config.CoordinationDir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for n := range maxSlots {
+		f, err := tryLockFile(filepath.Join(dir, fmt.Sprintf("spawner-%d.lock", n)))
+		if errors.Is(err, errLocked) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.slot, s.slotLock = n, f
+		mainLog.Info("Claimed spawner slot", "dir", dir, "slot", n)
+		return nil
+	}
+	return fmt.Errorf("all %d slots in %s are taken", maxSlots, dir)
+}
+
+// releaseSlot gives up the slot taken by claimSlot, if any.
+func (s *Spawner) releaseSlot() {
+	if s.slotLock != nil {
+		s.slotLock.Close()
+		s.slotLock = nil
+	}
+}
+
+// slotDir returns the directory below the socket directories holding the
+// sockets of the spawner, "" for the one in slot 0.
+func (s *Spawner) slotDir() string {
+	if s.slot == 0 {
+		return ""
+	}
+	return fmt.Sprintf("spawner-%d", s.slot)
+}
+
+// singletonError is returned instead of starting a singleton application
+// that another spawner runs.
+type singletonError struct {
+	app string
+}
+
+func (e *singletonError) Error() string {
+	return fmt.Sprintf("%s is a singleton running on another spawner", e.app)
+}
+
+// lockSingleton takes the lock of the application at appPath, if it's a
+// singleton and the spawner doesn't hold it yet, so that no other spawner
+// sharing Config.CoordinationDir runs it at the same time. The caller must
+// hold childProcessesMu.
+func (s *Spawner) lockSingleton(appPath string, app AppConfig) error {
+	if !app.Singleton || s.Config.CoordinationDir == "" || s.singletons[appPath] != nil {
+		return nil
+	}
+	dir := filepath.Join(s.Config.CoordinationDir, "apps")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// The lock file is named after the app's socket, which is unique across
+	// virtual hosts, without the slot.
+	name := instanceSocketName(s.relApp(appPath), 0)
+	if site := s.siteOf(appPath); site.host != "" {
+		name = site.host + "/" + name
+	}
+	f, err := tryLockFile(filepath.Join(dir, url.PathEscape(name)+".lock"))
+	if errors.Is(err, errLocked) {
+		return &singletonError{app: appPath}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock singleton %s: %v", appPath, err)
+	}
+	if s.singletons == nil {
+		s.singletons = make(map[string]*os.File)
+	}
+	s.singletons[appPath] = f
+	return nil
+}
+
+// releaseSingleton releases the lock of the singleton application at
+// appPath once the spawner runs no process of it anymore, neither starting,
+// running nor stopping. The caller must hold childProcessesMu.
+func (s *Spawner) releaseSingleton(appPath string) {
+	f := s.singletons[appPath]
+	if f == nil {
+		return
+	}
+	if lock := s.appLocks[appPath]; lock != nil && lock.starting {
+		return
+	}
+	if len(s.pool(appPath)) > 0 || slices.ContainsFunc(s.draining, func(c *childProcess) bool { return c.binaryPath == appPath }) {
+		return
+	}
+	f.Close()
+	delete(s.singletons, appPath)
+}
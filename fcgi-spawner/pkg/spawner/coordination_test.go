@@ -0,0 +1,78 @@
+package spawner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCoordinatedSpawners(t *testing.T) {
+	webRoot := t.TempDir()
+	for _, name := range []string{"shared.fcgi", "single.fcgi"} {
+		if err := os.WriteFile(filepath.Join(webRoot, name), []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+			t.Fatalf("Failed to write app: %v", err)
+		}
+	}
+	coordinationDir := t.TempDir()
+	newSpawner := func() *Spawner {
+		s := NewSpawner(&Config{
+			WebRoot:         webRoot,
+			CoordinationDir: coordinationDir,
+			Apps:            map[string]AppConfig{"single.fcgi": {Singleton: true}},
+		})
+		if err := s.claimSlot(); err != nil {
+			t.Fatalf("claimSlot() error = %v", err)
+		}
+		t.Cleanup(s.Stop)
+		return s
+	}
+	a, b := newSpawner(), newSpawner()
+	if a.slot != 0 || b.slot != 1 {
+		t.Fatalf("slots = %d and %d, want 0 and 1", a.slot, b.slot)
+	}
+	if name := b.appSocketName(filepath.Join(webRoot, "shared.fcgi"), 0); !strings.HasPrefix(name, "spawner-1/") {
+		t.Errorf("appSocketName() of slot 1 = %q, want it in the slot's directory", name)
+	}
+
+	// Both run the app, on sockets of their own.
+	for _, s := range []*Spawner{a, b} {
+		child, _, err := s.getOrCreateChild(context.Background(), filepath.Join(webRoot, "shared.fcgi"), nil)
+		if err != nil {
+			t.Fatalf("getOrCreateChild() of slot %d error = %v", s.slot, err)
+		}
+		s.releaseChild(child)
+	}
+
+	// Only one runs the singleton, until it stops it.
+	single := filepath.Join(webRoot, "single.fcgi")
+	child, _, err := a.getOrCreateChild(context.Background(), single, nil)
+	if err != nil {
+		t.Fatalf("getOrCreateChild() of the singleton error = %v", err)
+	}
+	a.releaseChild(child)
+	var singleton *singletonError
+	if _, _, err := b.getOrCreateChild(context.Background(), single, nil); !errors.As(err, &singleton) {
+		t.Fatalf("getOrCreateChild() of the singleton on another spawner error = %v, want a singletonError", err)
+	}
+	a.stopApp(single)
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		child, _, err := b.getOrCreateChild(context.Background(), single, nil)
+		if err == nil {
+			b.releaseChild(child)
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("getOrCreateChild() of the stopped singleton error = %v", err)
+		}
+	}
+
+	// A released slot is taken again.
+	a.Stop()
+	if c := newSpawner(); c.slot != 0 {
+		t.Errorf("slot after slot 0 was released = %d, want 0", c.slot)
+	}
+}
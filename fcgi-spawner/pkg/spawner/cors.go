@@ -0,0 +1,210 @@
+package spawner
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSRule is the cross-origin resource sharing policy of the URL paths it
+// matches, answering preflight requests and adding the Access-Control-*
+// headers to responses on behalf of the applications and static files.
+type CORSRule struct {
+	// Path matches like Route.Path: the URL path exactly, or, ending in /*,
+	// the path and everything below it, e.g. /api/*.
+	Path string `yaml:"path"`
+	// AllowOrigins are the origins allowed to make requests, like
+	// https://example.com, https://*.example.com for its subdomains, or *
+	// for any origin.
+	AllowOrigins []string `yaml:"allowOrigins"`
+	// AllowMethods are the methods allowed in cross-origin requests (default
+	// GET, HEAD and POST).
+	AllowMethods []string `yaml:"allowMethods"`
+	// AllowHeaders are the request headers allowed besides the ones any
+	// request may send; * allows any.
+	AllowHeaders []string `yaml:"allowHeaders"`
+	// ExposeHeaders are the response headers scripts may read besides the
+	// basic ones.
+	ExposeHeaders []string `yaml:"exposeHeaders"`
+	// AllowCredentials lets requests carry cookies and HTTP authentication.
+	AllowCredentials bool `yaml:"allowCredentials"`
+	// MaxAge is how long browsers may cache the answer to a preflight
+	// request; 0 leaves it to the browser.
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+// defaultCORSMethods are allowed unless CORSRule.AllowMethods says otherwise.
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// validateCORS checks the CORS rules.
+func (c *Config) validateCORS() error {
+	for i, rule := range c.CORS {
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("cors rule %d: path %q must start with /", i+1, rule.Path)
+		}
+		if len(rule.AllowOrigins) == 0 {
+			return fmt.Errorf("cors rule %d: allowOrigins is missing", i+1)
+		}
+		if rule.AllowCredentials && slices.Contains(rule.AllowOrigins, "*") {
+			return fmt.Errorf("cors rule %d: allowCredentials can't be used with any origin (*)", i+1)
+		}
+	}
+	return nil
+}
+
+// corsRuleFor returns the first CORS rule matching urlPath, or nil.
+func (s *Spawner) corsRuleFor(urlPath string) *CORSRule {
+	for i := range s.Config.CORS {
+		rule := &s.Config.CORS[i]
+		if _, _, ok := (&Route{Path: rule.Path}).match(urlPath); ok {
+			return rule
+		}
+	}
+	return nil
+}
+
+// allowsOrigin reports whether rule lets origin make requests.
+func (rule *CORSRule) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range rule.AllowOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		// https://*.example.com matches https://api.example.com.
+		if scheme, domain, ok := strings.Cut(allowed, "://*."); ok {
+			if rest, found := strings.CutPrefix(origin, scheme+"://"); found && strings.HasSuffix(rest, "."+domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyCORS applies the CORS rule of the path of r, if any. It answers
+// preflight requests itself and returns false; other requests get the
+// Access-Control-* headers of the rule, replacing any the application sets,
+// through the returned ResponseWriter.
+func (s *Spawner) applyCORS(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, bool) {
+	rule := s.corsRuleFor(r.URL.Path)
+	if rule == nil {
+		return w, true
+	}
+	// Responses depend on the origin even when it isn't allowed.
+	w.Header().Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return w, true
+	}
+	allowed := rule.allowsOrigin(origin)
+
+	if requestMethod := r.Header.Get("Access-Control-Request-Method"); r.Method == http.MethodOptions && requestMethod != "" {
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		methods := rule.AllowMethods
+		if len(methods) == 0 {
+			methods = defaultCORSMethods
+		}
+		requestHeaders := r.Header.Values("Access-Control-Request-Headers")
+		if !allowed || !slices.Contains(methods, requestMethod) || !rule.allowsHeaders(requestHeaders) {
+			http.Error(w, "Forbidden: cross-origin request not allowed", http.StatusForbidden)
+			proxyLog.Debug("Denied CORS preflight request", "path", r.URL.Path, "origin", origin, "method", requestMethod, "headers", requestHeaders)
+			return w, false
+		}
+		rule.setOriginHeaders(w.Header(), origin)
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if len(requestHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(requestHeaders, ", "))
+		}
+		if rule.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(rule.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return w, false
+	}
+
+	if !allowed {
+		// Without the headers, browsers don't let the script see the response.
+		return w, true
+	}
+	return &corsWriter{ResponseWriter: w, rule: rule, origin: origin}, true
+}
+
+// allowsHeaders reports whether rule allows the request headers listed in
+// the Access-Control-Request-Headers values requested.
+func (rule *CORSRule) allowsHeaders(requested []string) bool {
+	if slices.Contains(rule.AllowHeaders, "*") {
+		return true
+	}
+	for _, value := range requested {
+		for name := range strings.SplitSeq(value, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" && !slices.ContainsFunc(rule.AllowHeaders, func(h string) bool { return strings.EqualFold(h, name) }) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// setOriginHeaders sets the headers allowing origin to read a response.
+func (rule *CORSRule) setOriginHeaders(h http.Header, origin string) {
+	if slices.Contains(rule.AllowOrigins, "*") {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if rule.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// corsWriter sets the Access-Control-* headers of a CORS rule when the
+// response is sent.
+type corsWriter struct {
+	http.ResponseWriter
+	rule        *CORSRule
+	origin      string
+	wroteHeader bool
+}
+
+func (w *corsWriter) WriteHeader(status int) {
+	if !w.wroteHeader && status >= http.StatusOK {
+		w.wroteHeader = true
+		h := w.Header()
+		for name := range h {
+			if strings.HasPrefix(name, "Access-Control-") {
+				delete(h, name)
+			}
+		}
+		w.rule.setOriginHeaders(h, w.origin)
+		if len(w.rule.ExposeHeaders) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(w.rule.ExposeHeaders, ", "))
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *corsWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses working.
+func (w *corsWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *corsWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,128 @@
+package spawner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidateCORS(t *testing.T) {
+	tests := []struct {
+		rule    CORSRule
+		wantErr bool
+	}{
+		{rule: CORSRule{Path: "/api/*", AllowOrigins: []string{"https://example.com"}, AllowCredentials: true}},
+		{rule: CORSRule{Path: "/api/*", AllowOrigins: []string{"*"}}},
+		{rule: CORSRule{Path: "api", AllowOrigins: []string{"*"}}, wantErr: true},
+		{rule: CORSRule{Path: "/api/*"}, wantErr: true},
+		{rule: CORSRule{Path: "/api/*", AllowOrigins: []string{"*"}, AllowCredentials: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		cfg := Config{CORS: []CORSRule{tt.rule}}
+		if err := cfg.validateCORS(); (err != nil) != tt.wantErr {
+			t.Errorf("validateCORS(%+v) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAllowsOrigin(t *testing.T) {
+	rule := CORSRule{AllowOrigins: []string{"https://example.com", "https://*.example.org"}}
+	tests := map[string]bool{
+		"https://example.com":     true,
+		"https://EXAMPLE.com":     true,
+		"http://example.com":      false,
+		"https://api.example.org": true,
+		"https://a.b.example.org": true,
+		"https://example.org":     false,
+		"https://evilexample.org": false,
+		"http://api.example.org":  false,
+	}
+	for origin, want := range tests {
+		if got := rule.allowsOrigin(origin); got != want {
+			t.Errorf("allowsOrigin(%q) = %t, want %t", origin, got, want)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	webRoot := t.TempDir()
+	// The application sets its own, more permissive header.
+	script := "#!/bin/sh\nprintf 'Content-Type: text/plain\\r\\nAccess-Control-Allow-Origin: *\\r\\nX-Request-Id: 1\\r\\n\\r\\nok'\n"
+	if err := os.WriteFile(filepath.Join(webRoot, "api.cgi"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot, CORS: []CORSRule{{
+		Path:             "/api.cgi/*",
+		AllowOrigins:     []string{"https://app.example.com"},
+		AllowMethods:     []string{http.MethodGet, http.MethodPut},
+		AllowHeaders:     []string{"Content-Type", "X-Token"},
+		ExposeHeaders:    []string{"X-Request-Id"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}}})
+
+	preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodOptions, "/api.cgi/items", nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", method)
+		if headers != "" {
+			r.Header.Set("Access-Control-Request-Headers", headers)
+		}
+		w := httptest.NewRecorder()
+		s.spawnerHandler(w, r)
+		return w
+	}
+
+	w := preflight("https://app.example.com", http.MethodPut, "content-type, x-token")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Methods":     "GET, PUT",
+		"Access-Control-Allow-Headers":     "content-type, x-token",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("preflight %s = %q, want %q", name, got, want)
+		}
+	}
+	for _, tt := range []struct{ origin, method, headers string }{
+		{origin: "https://evil.example.com", method: http.MethodPut},
+		{origin: "https://app.example.com", method: http.MethodDelete},
+		{origin: "https://app.example.com", method: http.MethodGet, headers: "X-Other"},
+	} {
+		if w := preflight(tt.origin, tt.method, tt.headers); w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("preflight(%q, %s, %q) = %d, %v, want it denied", tt.origin, tt.method, tt.headers, w.Code, w.Header())
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api.cgi/items", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w = httptest.NewRecorder()
+	s.spawnerHandler(w, r)
+	if w.Body.String() != "ok" {
+		t.Fatalf("GET body = %q, want ok", w.Body.String())
+	}
+	if got := w.Header().Values("Access-Control-Allow-Origin"); len(got) != 1 || got[0] != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want only the origin", got)
+	}
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-Id" {
+		t.Errorf("Access-Control-Expose-Headers = %q", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Vary = %q, want Origin", got)
+	}
+
+	// Other origins don't get the headers.
+	r.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	s.spawnerHandler(w, r)
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q for another origin", got)
+	}
+}
@@ -0,0 +1,63 @@
+package spawner
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// lookupCredential returns the credential child processes run with for the
+// given user and group names or IDs. The group defaults to the user's primary
+// group. It returns nil if neither is set, so that children keep the
+// spawner's identity.
+func lookupCredential(userName, groupName string) (*syscall.Credential, error) {
+	if userName == "" && groupName == "" {
+		return nil, nil
+	}
+	cred := &syscall.Credential{Uid: uint32(syscall.Getuid()), Gid: uint32(syscall.Getgid())}
+	if userName != "" {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			if u, err = user.LookupId(userName); err != nil {
+				return nil, fmt.Errorf("unknown user %q", userName)
+			}
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("user %q has a non-numeric uid %q", userName, u.Uid)
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("user %q has a non-numeric gid %q", userName, u.Gid)
+		}
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+	}
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupName); err != nil {
+				return nil, fmt.Errorf("unknown group %q", groupName)
+			}
+		}
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("group %q has a non-numeric gid %q", groupName, g.Gid)
+		}
+		cred.Gid = uint32(gid)
+	}
+	return cred, nil
+}
+
+// credentialFor returns the credential the application runs with: its own
+// user and group, falling back to the spawner-wide ones.
+func (s *Spawner) credentialFor(app AppConfig) (*syscall.Credential, error) {
+	userName, groupName := s.Config.User, s.Config.Group
+	if app.User != "" {
+		userName = app.User
+	}
+	if app.Group != "" {
+		groupName = app.Group
+	}
+	return lookupCredential(userName, groupName)
+}
@@ -0,0 +1,53 @@
+package spawner
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestLookupCredential(t *testing.T) {
+	uid := uint32(syscall.Getuid())
+	tests := []struct {
+		name    string
+		user    string
+		group   string
+		want    *syscall.Credential
+		wantErr bool
+	}{
+		{name: "unset", want: nil},
+		{name: "user by name", user: "root", want: &syscall.Credential{Uid: 0, Gid: 0}},
+		{name: "user by uid", user: "0", want: &syscall.Credential{Uid: 0, Gid: 0}},
+		{name: "user and group", user: "root", group: "0", want: &syscall.Credential{Uid: 0, Gid: 0}},
+		{name: "group only", group: "root", want: &syscall.Credential{Uid: uid, Gid: 0}},
+		{name: "unknown user", user: "no-such-user-fcgi", wantErr: true},
+		{name: "unknown group", group: "no-such-group-fcgi", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lookupCredential(tt.user, tt.group)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lookupCredential() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && (got.Uid != tt.want.Uid || got.Gid != tt.want.Gid)) {
+				t.Errorf("lookupCredential() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialFor(t *testing.T) {
+	s := NewSpawner(&Config{User: "no-such-user-fcgi"})
+	if _, err := s.credentialFor(AppConfig{}); err == nil {
+		t.Error("credentialFor() with an unknown global user succeeded")
+	}
+	cred, err := s.credentialFor(AppConfig{User: "root"})
+	if err != nil {
+		t.Fatalf("credentialFor() error = %v", err)
+	}
+	if cred == nil || cred.Uid != 0 {
+		t.Errorf("credentialFor() = %+v, want the app's user", cred)
+	}
+}
@@ -0,0 +1,54 @@
+package spawner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronSchedule(t *testing.T) {
+	// 2026-03-02 is a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.March, day, hour, minute, 30, 0, time.Local)
+	}
+	tests := []struct {
+		spec string
+		t    time.Time
+		want bool
+	}{
+		{"55 8 * * 1-5", at(2, 8, 55), true},
+		{"55 8 * * 1-5", at(2, 8, 56), false},
+		{"55 8 * * 1-5", at(7, 8, 55), false}, // Saturday
+		{"*/15 * * * *", at(3, 17, 45), true},
+		{"*/15 * * * *", at(3, 17, 50), false},
+		{"0 9-17/2 * * *", at(3, 13, 0), true},
+		{"0 9-17/2 * * *", at(3, 14, 0), false},
+		{"30 6 1,15 * *", at(15, 6, 30), true},
+		{"0 0 * * 7", at(8, 0, 0), true}, // Sunday
+		{"0 0 * * 0", at(8, 0, 0), true},
+		{"0 0 1 3 *", at(1, 0, 0), true},
+		{"0 0 1 4 *", at(1, 0, 0), false},
+		// Both day fields restricted: either matches.
+		{"0 12 13 * 5", at(6, 12, 0), true},
+		{"0 12 13 * 5", at(13, 12, 0), true},
+		{"0 12 13 * 5", at(12, 12, 0), false},
+		// A step on a single value runs to the end of the range.
+		{"5/20 * * * *", at(2, 1, 45), true},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.spec)
+		if err != nil {
+			t.Fatalf("parseCron(%q) error = %v", tt.spec, err)
+		}
+		if got := schedule.matches(tt.t); got != tt.want {
+			t.Errorf("parseCron(%q).matches(%s) = %v, want %v", tt.spec, tt.t.Format("Mon 2006-01-02 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "mon * * * *", "1,,2 * * * *"} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package spawner
+
+import (
+	"embed"
+	"net/http"
+)
+
+// dashboardFS holds the admin dashboard, a page using the admin API.
+//
+//go:embed dashboard
+var dashboardFS embed.FS
+
+// dashboardHandler serves the admin dashboard below /dashboard/.
+func dashboardHandler() http.Handler {
+	return http.FileServerFS(dashboardFS)
+}
@@ -0,0 +1,164 @@
+// Dashboard over the admin API. The token is kept for the browser session
+// and sent as a bearer token with every request.
+"use strict";
+
+const refreshInterval = 5000;
+let timer;
+
+function token() {
+  return sessionStorage.getItem("spawnerAdminToken");
+}
+
+async function api(method, path) {
+  const resp = await fetch(path, {
+    method,
+    headers: { Authorization: "Bearer " + token() },
+  });
+  if (resp.status === 401) {
+    sessionStorage.removeItem("spawnerAdminToken");
+    showLogin("The admin token was rejected.");
+    throw new Error("unauthorized");
+  }
+  if (!resp.ok) {
+    throw new Error(`${method} ${path}: ${(await resp.text()).trim()}`);
+  }
+  return resp.json();
+}
+
+// el creates an element with the given text or child elements.
+function el(tag, ...content) {
+  const e = document.createElement(tag);
+  for (const c of content) {
+    e.append(c instanceof Node ? c : String(c));
+  }
+  return e;
+}
+
+function duration(ms) {
+  const s = Math.max(0, Math.round(ms / 1000));
+  if (s < 60) return s + "s";
+  if (s < 3600) return Math.floor(s / 60) + "m" + (s % 60) + "s";
+  return Math.floor(s / 3600) + "h" + Math.floor((s % 3600) / 60) + "m";
+}
+
+function renderApps(apps, metrics) {
+  const byApp = new Map();
+  for (const a of apps) byApp.set(a.app, { restarts: a });
+  for (const m of metrics) byApp.set(m.app, { ...byApp.get(m.app), metrics: m });
+
+  const rows = [...byApp.keys()].sort().map((app) => {
+    const { restarts: r = {}, metrics: m } = byApp.get(app);
+    const lastExit = el("td", r.lastExit ? `${r.lastExit} (${duration(Date.now() - Date.parse(r.lastExitAt))} ago)` : "");
+    if (r.notRestarted) {
+      lastExit.className = "held";
+      lastExit.title = "Not restarted: " + r.notRestarted;
+    }
+    const actions = el("td");
+    if (r.name) {
+      for (const action of ["restart", "stop"]) {
+        const button = el("button", action);
+        button.onclick = () => appAction(r.name, action);
+        actions.append(button, " ");
+      }
+    }
+    return el("tr",
+      el("td", app),
+      el("td", r.starts ?? ""),
+      el("td", r.restarts ?? ""),
+      lastExit,
+      el("td", m ? m.requests : ""),
+      el("td", m ? m.errors : ""),
+      el("td", m ? m.inFlight : ""),
+      el("td", m ? `${m.latencyMs.p50} / ${m.latencyMs.p99}` : ""),
+      actions);
+  });
+  document.getElementById("apps").replaceChildren(...rows);
+}
+
+function renderChildren(children) {
+  const rows = children.map((c) => el("tr",
+    el("td", c.app),
+    el("td", c.instance),
+    el("td", c.pid),
+    el("td", c.socket ?? "stdio"),
+    el("td", c.active),
+    el("td", c.active > 0 ? "busy" : duration(Date.now() - Date.parse(c.lastUsed)))));
+  document.getElementById("children").replaceChildren(...rows);
+}
+
+function renderLogs(logs) {
+  const sections = Object.keys(logs).sort().map((app) => {
+    const lines = logs[app].map((l) => `${new Date(l.time).toLocaleTimeString()} ${l.pid || ""} ${l.stream}: ${l.line}`);
+    const details = el("details", el("summary", `${app} (${logs[app].length} lines)`), el("pre", lines.join("\n")));
+    details.dataset.app = app;
+    return details;
+  });
+  const container = document.getElementById("logs");
+  // Keep open sections open across refreshes.
+  const open = new Set([...container.querySelectorAll("details[open]")].map((d) => d.dataset.app));
+  for (const details of sections) {
+    details.open = open.has(details.dataset.app);
+  }
+  container.replaceChildren(...(sections.length ? sections : [el("p", "No output yet.")]));
+}
+
+async function refresh() {
+  clearTimeout(timer);
+  const error = document.getElementById("error");
+  try {
+    const [children, apps, metrics, logs] = await Promise.all([
+      api("GET", "/children"), api("GET", "/apps"), api("GET", "/metrics"), api("GET", "/logs"),
+    ]);
+    renderApps(apps, metrics);
+    renderChildren(children);
+    renderLogs(logs);
+    error.textContent = "";
+    document.getElementById("updated").textContent = "Updated " + new Date().toLocaleTimeString();
+  } catch (e) {
+    if (e.message === "unauthorized") return;
+    error.textContent = e.message;
+  }
+  timer = setTimeout(refresh, refreshInterval);
+}
+
+async function appAction(name, action) {
+  if (!confirm(`${action} ${name}?`)) return;
+  try {
+    await api("POST", `/apps/${name.split("/").map(encodeURIComponent).join("/")}/${action}`);
+  } catch (e) {
+    if (e.message !== "unauthorized") alert(e.message);
+  }
+  refresh();
+}
+
+function showLogin(message) {
+  clearTimeout(timer);
+  document.getElementById("dashboard").hidden = true;
+  document.getElementById("logout").hidden = true;
+  document.getElementById("login").hidden = false;
+  document.getElementById("login-error").textContent = message || "";
+}
+
+function showDashboard() {
+  document.getElementById("login").hidden = true;
+  document.getElementById("dashboard").hidden = false;
+  document.getElementById("logout").hidden = false;
+  refresh();
+}
+
+document.getElementById("login").onsubmit = (event) => {
+  event.preventDefault();
+  sessionStorage.setItem("spawnerAdminToken", document.getElementById("token").value);
+  showDashboard();
+};
+
+document.getElementById("logout").onclick = () => {
+  sessionStorage.removeItem("spawnerAdminToken");
+  showLogin();
+};
+
+if (token()) {
+  showDashboard();
+} else {
+  showLogin();
+}
@@ -0,0 +1,54 @@
+package spawner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	s := NewSpawner(&Config{WebRoot: "/web", AdminToken: "secret"})
+	handler := s.AdminHandler()
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The dashboard is served without a token, the data it shows is not.
+	if rec := get("/", ""); rec.Code != http.StatusFound || rec.Header().Get("Location") != "/dashboard/" {
+		t.Errorf("GET / = %d to %q, want a redirect to the dashboard", rec.Code, rec.Header().Get("Location"))
+	}
+	for _, path := range []string{"/dashboard/", "/dashboard/dashboard.js", "/dashboard/dashboard.css"} {
+		if rec := get(path, ""); rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+			t.Errorf("GET %s = %d, want the asset", path, rec.Code)
+		}
+	}
+	if rec := get("/dashboard/", ""); !strings.Contains(rec.Body.String(), "dashboard.js") {
+		t.Errorf("GET /dashboard/ = %q, want the page", rec.Body)
+	}
+	if rec := get("/logs", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /logs without token = %d, want 401", rec.Code)
+	}
+
+	appLogTail.add("/web/dashboard.fcgi", 42, "stderr", "hello")
+	var logs map[string][]logLine
+	if err := json.NewDecoder(get("/logs", "secret").Body).Decode(&logs); err != nil {
+		t.Fatalf("Failed to decode logs: %v", err)
+	}
+	if lines := logs["/web/dashboard.fcgi"]; len(lines) != 1 || lines[0].Line != "hello" || lines[0].PID != 42 {
+		t.Errorf("GET /logs = %+v, want the line of the app", lines)
+	}
+	if got := s.adminName("/web/api/users.fcgi"); got != "api/users.fcgi" {
+		t.Errorf("adminName() = %q, want api/users.fcgi", got)
+	}
+	if got := s.adminName("/srv/other.fcgi"); got != "" {
+		t.Errorf("adminName() = %q for an app outside webRoot, want none", got)
+	}
+}
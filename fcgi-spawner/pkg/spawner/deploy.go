@@ -0,0 +1,114 @@
+package spawner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// deployApp replaces the binary of the application at appPath by the one at
+// binary, blue-green: a process running the new binary is started next to the
+// old ones and has to become ready, including the app's readiness probe. Only
+// then is the binary installed at appPath and requests switched over at once,
+// while the old processes drain. If the new binary doesn't start, nothing
+// changes.
+func (s *Spawner) deployApp(appPath, binary string) error {
+	if !filepath.IsAbs(binary) {
+		return fmt.Errorf("binary %s must be an absolute path", binary)
+	}
+	if !isExecutable(binary) {
+		return fmt.Errorf("binary %s is not an executable file", binary)
+	}
+
+	appLock := s.appLock(appPath)
+	appLock.Lock()
+	defer appLock.Unlock()
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+
+	app, err := s.appConfig(appPath)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.interpreterFor(appPath); ok || app.Command != "" || app.Container != nil {
+		return errors.New("only applications run from their own binary can be deployed")
+	}
+
+	if err := s.lockSingleton(appPath, app); err != nil {
+		return err
+	}
+	candidate := app
+	candidate.Command = binary
+	child, err := s.launchChild(appPath, freeInstance(s.pool(appPath)), candidate)
+	if err != nil {
+		s.releaseSingleton(appPath)
+		return fmt.Errorf("new binary failed to start: %v", err)
+	}
+	if err := installBinary(binary, appPath); err != nil {
+		s.drainChild(child)
+		return err
+	}
+	info, err := os.Stat(appPath)
+	if err != nil {
+		s.drainChild(child)
+		return err
+	}
+	child.app = app
+	child.binaryModTime = info.ModTime()
+
+	old := s.pool(appPath)
+	for _, c := range old {
+		delete(s.childProcesses, instanceKey(appPath, c.instance))
+	}
+	s.childProcesses[instanceKey(appPath, child.instance)] = child
+	s.watchChild(child)
+	s.recordStart(child)
+	s.saveState()
+	s.resetRestarts(appPath)
+	delete(s.breakers, appPath)
+	for _, c := range old {
+		s.drainChild(c)
+	}
+	spawnLog.Info("Deployed new version of application", "app", appPath, "binary", binary, "pid", child.cmd.Process().Pid())
+
+	if _, _, err := s.ensurePool(appPath); err != nil {
+		spawnLog.Error("Failed to start further instances of deployed application", "app", appPath, "error", err)
+	}
+	return nil
+}
+
+// installBinary copies the file at src to dst, replacing dst atomically, so
+// the application is never seen half written.
+func installBinary(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	// Hidden, so the watcher doesn't take it for an application.
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".deploy-*")
+	if err != nil {
+		return fmt.Errorf("failed to install binary: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, in)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), info.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to install binary: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package spawner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeployApp(t *testing.T) {
+	webRoot := t.TempDir()
+	v1 := "#!/bin/sh\nexec sleep 30\n"
+	v2 := "#!/bin/sh\n# v2\nexec sleep 30\n"
+	appPath := filepath.Join(webRoot, "app.fcgi")
+	probedPath := filepath.Join(webRoot, "probed.fcgi")
+	for _, path := range []string{appPath, probedPath} {
+		if err := os.WriteFile(path, []byte(v1), 0755); err != nil {
+			t.Fatalf("Failed to write app: %v", err)
+		}
+	}
+	binary := filepath.Join(t.TempDir(), "v2")
+	if err := os.WriteFile(binary, []byte(v2), 0755); err != nil {
+		t.Fatalf("Failed to write binary: %v", err)
+	}
+	notExecutable := filepath.Join(t.TempDir(), "v2.txt")
+	if err := os.WriteFile(notExecutable, []byte(v2), 0644); err != nil {
+		t.Fatalf("Failed to write binary: %v", err)
+	}
+
+	// The probed app never answers its readiness request, so no new binary
+	// of it becomes ready.
+	s := NewSpawner(&Config{
+		WebRoot:      webRoot,
+		AdminToken:   "secret",
+		DrainTimeout: time.Second,
+		Apps: map[string]AppConfig{
+			"probed.fcgi": {ReadinessTimeout: 500 * time.Millisecond, ReadinessPath: "/ping"},
+		},
+	})
+	defer s.stopAllChildren(time.Second)
+
+	if err := s.startApp(appPath); err != nil {
+		t.Fatalf("startApp() error = %v", err)
+	}
+	s.childProcessesMu.Lock()
+	old := s.childProcesses[appPath]
+	s.childProcessesMu.Unlock()
+
+	if err := s.deployApp(appPath, binary); err != nil {
+		t.Fatalf("deployApp() error = %v", err)
+	}
+	if data, _ := os.ReadFile(appPath); string(data) != v2 {
+		t.Errorf("app after deployApp() = %q, want the new binary", data)
+	}
+	s.childProcessesMu.Lock()
+	pool := s.pool(appPath)
+	s.childProcessesMu.Unlock()
+	if len(pool) != 1 || pool[0] == old {
+		t.Fatalf("pool after deployApp() = %v, want one new process", pool)
+	}
+	if pool[0].app.Command != "" {
+		t.Errorf("deployed process runs %s, want the installed binary", pool[0].app.Command)
+	}
+	// The old process is idle, so it is stopped right away.
+	for deadline := time.Now().Add(2 * time.Second); old.cmd.ProcessState() == nil; time.Sleep(50 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("old process still running after deployApp()")
+		}
+	}
+
+	// The deployed process is up to date, so requests keep using it.
+	child, _, err := s.getOrCreateChild(t.Context(), appPath, nil)
+	if err != nil {
+		t.Fatalf("getOrCreateChild() error = %v", err)
+	}
+	s.releaseChild(child)
+	if child != pool[0] {
+		t.Error("getOrCreateChild() replaced the deployed process")
+	}
+
+	if err := s.deployApp(probedPath, binary); err == nil {
+		t.Error("deployApp() of a binary that doesn't become ready succeeded")
+	}
+	if data, _ := os.ReadFile(probedPath); string(data) != v1 {
+		t.Errorf("app after failed deployApp() = %q, want the old binary", data)
+	}
+	if err := s.deployApp(appPath, notExecutable); err == nil {
+		t.Error("deployApp() of a file that isn't executable succeeded")
+	}
+
+	handler := s.AdminHandler()
+	for body, want := range map[string]int{
+		`{"binary": "` + binary + `"}`: http.StatusOK,
+		`{}`:                           http.StatusBadRequest,
+		`not json`:                     http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/apps/app.fcgi/deploy", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("POST /apps/app.fcgi/deploy %s = %d, want %d: %s", body, rec.Code, want, rec.Body)
+		}
+	}
+}
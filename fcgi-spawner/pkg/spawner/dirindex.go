@@ -0,0 +1,241 @@
+package spawner
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Directory listing modes of Config.DirListing.
+const (
+	DirListingOff    = "off"
+	DirListingPlain  = "plain"
+	DirListingThemed = "themed"
+)
+
+// DefaultIndexFiles are the files served for a directory of the static root
+// unless Config.IndexFiles says otherwise.
+const DefaultIndexFiles = "index.html"
+
+// DirListing is the data directory listing templates are executed with.
+type DirListing struct {
+	Path    string     // URL path of the directory, ending in /
+	Entries []DirEntry // Directories first, then by name
+}
+
+// DirEntry is a file or directory in a DirListing.
+type DirEntry struct {
+	Name    string
+	URL     string // Relative to the directory, ending in / for directories
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// plainListing is the listing http.FileServer generates.
+var plainListing = template.Must(template.New("plain").Parse(`<!doctype html>
+<meta name="viewport" content="width=device-width">
+<pre>
+{{range .Entries}}<a href="{{.URL}}">{{.Name}}{{if .IsDir}}/{{end}}</a>
+{{end}}</pre>
+`))
+
+// themedListing is a listing with sizes and modification times, which
+// follows the light or dark theme of the browser.
+var themedListing = template.Must(template.New("themed").Funcs(template.FuncMap{"size": formatSize}).Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<meta name="color-scheme" content="light dark">
+<title>Index of {{.Path}}</title>
+<style>
+body { font: 15px/1.5 system-ui, sans-serif; max-width: 60rem; margin: 2rem auto; padding: 0 1rem; }
+h1 { font-size: 1.3rem; font-weight: 500; word-break: break-all; }
+table { width: 100%; border-collapse: collapse; }
+th, td { padding: .3rem .6rem; text-align: left; border-bottom: 1px solid color-mix(in srgb, currentColor 15%, transparent); }
+th { font-weight: 500; opacity: .7; }
+td.size, td.time { white-space: nowrap; opacity: .8; }
+td.size, th.size { text-align: right; }
+a { text-decoration: none; }
+a:hover { text-decoration: underline; }
+</style>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th>Name</th><th class="size">Size</th><th>Modified</th></tr>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td class="size"></td><td class="time"></td></tr>
+{{end}}{{range .Entries}}<tr><td><a href="{{.URL}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td class="size">{{if not .IsDir}}{{size .Size}}{{end}}</td><td class="time">{{.ModTime.UTC.Format "2006-01-02 15:04"}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// formatSize formats a file size for people, e.g. 1.5 MiB.
+func formatSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, unit := float64(size)/1024, 0
+	for value >= 1024 && unit < 3 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[unit])
+}
+
+// validateStaticFiles checks the directory settings of the static roots and
+// parses DirListingTemplate.
+func (c *Config) validateStaticFiles() error {
+	switch c.DirListing {
+	case "", DirListingOff, DirListingPlain, DirListingThemed:
+	default:
+		return fmt.Errorf("invalid dirListing %q: must be off, plain or themed", c.DirListing)
+	}
+	for _, name := range c.indexFiles() {
+		if strings.ContainsAny(name, "/\\") || strings.HasPrefix(name, ".") {
+			return fmt.Errorf("invalid indexFiles: %q must be a file name like index.html", name)
+		}
+	}
+	if c.DirListingTemplate != "" {
+		if c.DirListing != DirListingThemed {
+			return fmt.Errorf("invalid dirListingTemplate: dirListing must be themed")
+		}
+		tmpl, err := template.New(path.Base(c.DirListingTemplate)).Funcs(template.FuncMap{"size": formatSize}).ParseFiles(c.DirListingTemplate)
+		if err != nil {
+			return fmt.Errorf("invalid dirListingTemplate: %v", err)
+		}
+		c.dirListingTemplate = tmpl
+	}
+	return nil
+}
+
+// indexFiles returns the names of the files served for a directory.
+func (c *Config) indexFiles() []string {
+	names := c.IndexFiles
+	if names == "" {
+		names = DefaultIndexFiles
+	}
+	var files []string
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// staticFiles serves the files of a static root like http.FileServer, and
+// its directories with the first of indexFiles they contain, else with a
+// listing rendered by listing, or 404 if listing is nil.
+type staticFiles struct {
+	fsys       http.FileSystem
+	files      http.Handler
+	indexFiles []string
+	listing    *template.Template
+}
+
+// newStaticFiles serves the files in fsys, with the index files and
+// directory listings of the configuration.
+func (s *Spawner) newStaticFiles(fsys http.FileSystem) staticFiles {
+	h := staticFiles{fsys: fsys, files: http.FileServer(fsys), indexFiles: s.Config.indexFiles()}
+	switch s.Config.DirListing {
+	case "", DirListingPlain:
+		h.listing = plainListing
+	case DirListingThemed:
+		h.listing = themedListing
+		if s.Config.dirListingTemplate != nil {
+			h.listing = s.Config.dirListingTemplate
+		}
+	}
+	return h
+}
+
+func (h staticFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// http.FileServer redirects directories to their path ending in /, and
+	// serves everything but directories.
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		h.files.ServeHTTP(w, r)
+		return
+	}
+	dirPath := path.Clean("/" + r.URL.Path)
+	dir, err := h.fsys.Open(dirPath)
+	if err != nil {
+		h.files.ServeHTTP(w, r)
+		return
+	}
+	defer dir.Close()
+	if info, err := dir.Stat(); err != nil || !info.IsDir() {
+		h.files.ServeHTTP(w, r)
+		return
+	}
+
+	for _, name := range h.indexFiles {
+		if h.serveIndex(w, r, path.Join(dirPath, name)) {
+			return
+		}
+	}
+
+	if h.listing == nil {
+		http.NotFound(w, r)
+		return
+	}
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		proxyLog.Error("Error reading directory", "path", dirPath, "error", err)
+		http.Error(w, "Error reading directory", http.StatusInternalServerError)
+		return
+	}
+	listing := DirListing{Path: r.URL.Path}
+	for _, info := range infos {
+		name := info.Name()
+		entry := DirEntry{Name: name, URL: (&url.URL{Path: name}).String(), IsDir: info.IsDir(), Size: info.Size(), ModTime: info.ModTime()}
+		if entry.IsDir {
+			entry.URL += "/"
+		}
+		listing.Entries = append(listing.Entries, entry)
+	}
+	slices.SortFunc(listing.Entries, func(a, b DirEntry) int {
+		if a.IsDir != b.IsDir {
+			if a.IsDir {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	var page bytes.Buffer
+	if err := h.listing.Execute(&page, listing); err != nil {
+		proxyLog.Error("Error rendering directory listing", "path", dirPath, "error", err)
+		http.Error(w, "Error rendering directory listing", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", fmt.Sprint(page.Len()))
+	if r.Method != http.MethodHead {
+		w.Write(page.Bytes())
+	}
+}
+
+// serveIndex serves the index file at name if it is a regular file, and
+// reports whether it did.
+func (h staticFiles) serveIndex(w http.ResponseWriter, r *http.Request, name string) bool {
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	return true
+}
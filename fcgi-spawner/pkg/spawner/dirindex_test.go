@@ -0,0 +1,101 @@
+package spawner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateStaticFiles(t *testing.T) {
+	tmpl := filepath.Join(t.TempDir(), "listing.html")
+	if err := os.WriteFile(tmpl, []byte(`{{range .Entries}}{{.Name}} {{size .Size}}{{end}}`), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	broken := filepath.Join(t.TempDir(), "broken.html")
+	if err := os.WriteFile(broken, []byte(`{{range .Entries}}`), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "off", cfg: Config{DirListing: DirListingOff, IndexFiles: "index.html, default.htm"}},
+		{name: "template", cfg: Config{DirListing: DirListingThemed, DirListingTemplate: tmpl}},
+		{name: "unknown mode", cfg: Config{DirListing: "fancy"}, wantErr: true},
+		{name: "index path", cfg: Config{IndexFiles: "docs/index.html"}, wantErr: true},
+		{name: "template without themed", cfg: Config{DirListingTemplate: tmpl}, wantErr: true},
+		{name: "broken template", cfg: Config{DirListing: DirListingThemed, DirListingTemplate: broken}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.validateStaticFiles(); (err != nil) != tt.wantErr {
+				t.Errorf("validateStaticFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStaticDirectories(t *testing.T) {
+	staticRoot := t.TempDir()
+	for _, name := range []string{"docs/default.htm", "docs/index.html", "files/b.txt", "files/a b.txt", "files/sub/c.txt", "files/.secret"} {
+		file := filepath.Join(staticRoot, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		path     string
+		status   int
+		contains []string
+		excludes []string
+	}{
+		{name: "default index", path: "/docs/", status: http.StatusOK, contains: []string{"docs/index.html"}},
+		{name: "custom index", cfg: Config{IndexFiles: "default.htm,index.html"}, path: "/docs/", status: http.StatusOK, contains: []string{"docs/default.htm"}},
+		{name: "plain listing", path: "/files/", status: http.StatusOK, contains: []string{`<a href="sub/">sub/</a>`, `<a href="a%20b.txt">a b.txt</a>`}, excludes: []string{".secret", "<table>"}},
+		{name: "themed listing", cfg: Config{DirListing: DirListingThemed}, path: "/files/", status: http.StatusOK, contains: []string{"Index of /files/", `<a href="../">`, "<td class=\"size\">11 B</td>"}, excludes: []string{".secret"}},
+		{name: "listing off", cfg: Config{DirListing: DirListingOff}, path: "/files/", status: http.StatusNotFound, excludes: []string{"b.txt"}},
+		{name: "index with listing off", cfg: Config{DirListing: DirListingOff}, path: "/docs/", status: http.StatusOK, contains: []string{"docs/index.html"}},
+		{name: "directory redirect", path: "/files", status: http.StatusMovedPermanently},
+		{name: "file", cfg: Config{DirListing: DirListingOff}, path: "/files/b.txt", status: http.StatusOK, contains: []string{"files/b.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewSpawner(&tt.cfg).newStaticFileServer(staticRoot, false)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.status {
+				t.Errorf("GET %s = %d, want %d", tt.path, w.Code, tt.status)
+			}
+			body := w.Body.String()
+			for _, s := range tt.contains {
+				if !strings.Contains(body, s) {
+					t.Errorf("GET %s body doesn't contain %q:\n%s", tt.path, s, body)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(body, s) {
+					t.Errorf("GET %s body contains %q:\n%s", tt.path, s, body)
+				}
+			}
+		})
+	}
+
+	// Listings put directories first.
+	w := httptest.NewRecorder()
+	NewSpawner(&Config{}).newStaticFileServer(staticRoot, false).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/", nil))
+	if body := w.Body.String(); strings.Index(body, "sub/") > strings.Index(body, "a b.txt") {
+		t.Errorf("directories aren't listed first:\n%s", body)
+	}
+}
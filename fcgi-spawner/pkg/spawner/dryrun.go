@@ -0,0 +1,184 @@
+package spawner
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/goccy/go-yaml"
+)
+
+// redacted replaces secrets in the configuration shown by DryRun.
+const redacted = "REDACTED"
+
+// DryRun writes what the spawner makes of its configuration to w, without
+// starting anything: the configuration with the defaults applied, the
+// applications found in the web roots with the command, socket and
+// environment each would be started with, and the routes. Each of urls, a
+// path or a URL whose host chooses the site, is resolved to the application
+// a request for it goes to. It's for spawner -dryRun, to find out why a
+// request reaches the wrong application.
+func (s *Spawner) DryRun(w io.Writer, urls ...string) error {
+	// Secrets are left out, but not the environment of the applications,
+	// which is the point. Secrets of .env files aren't resolved.
+	cfg := *s.Config
+	if cfg.AdminToken != "" {
+		cfg.AdminToken = redacted
+	}
+	if len(cfg.AdminTokens) > 0 {
+		cfg.AdminTokens = maps.Clone(cfg.AdminTokens)
+		for name := range cfg.AdminTokens {
+			cfg.AdminTokens[name] = redacted
+		}
+	}
+	if cfg.ChatWebhook != "" {
+		cfg.ChatWebhook = redacted
+	}
+	data, err := yaml.MarshalWithOptions(cfg, yaml.OmitEmpty())
+	if err != nil {
+		return fmt.Errorf("failed to encode configuration: %v", err)
+	}
+
+	fmt.Fprintln(w, "Configuration:")
+	for _, l := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		fmt.Fprintf(w, "  %s\n", l)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	line := func(format string, args ...any) {
+		fmt.Fprintf(tw, format+"\n", args...)
+	}
+
+	apps := s.discoverApps()
+	line("\nApplications (%d):", len(apps))
+	for _, appPath := range apps {
+		s.dryRunApp(line, appPath)
+	}
+
+	line("\nRoutes (%d), for paths not leading to an application:", len(s.Config.Routes))
+	for i, route := range s.Config.Routes {
+		match := route.Path
+		if route.Regex != "" {
+			match = "regex " + route.Regex
+		}
+		target := route.App + s.missingIn(route.App)
+		if canary := route.Canary; canary != nil {
+			target += fmt.Sprintf(", canary %s%s for %g%%", canary.App, s.missingIn(canary.App), canary.Percent)
+			if canary.Header != "" {
+				target += ", chosen by " + canary.Header
+			}
+		}
+		line("  %d.\t%s\t-> %s", i+1, match, target)
+	}
+
+	if len(urls) > 0 {
+		line("\nRequests:")
+		for _, rawURL := range urls {
+			line("  %s\t-> %s", rawURL, s.dryRunRequest(rawURL))
+		}
+	}
+	return nil
+}
+
+// dryRunApp writes how the application at appPath would be started.
+func (s *Spawner) dryRunApp(line func(string, ...any), appPath string) {
+	urlPath := "/" + filepath.ToSlash(s.relApp(appPath))
+	if site := s.siteOf(appPath); site.host != "" {
+		urlPath = site.host + urlPath
+	}
+	line("  %s", appPath)
+	line("    URL path:\t%s, %s/*", urlPath, urlPath)
+	app, err := s.appConfig(appPath)
+	if err != nil {
+		line("    Error:\t%v", err)
+		return
+	}
+	line("    Protocol:\t%s", cmp.Or(app.Protocol, protocolFastCGI))
+	args := app.Args
+	switch {
+	case app.Container != nil:
+		line("    Container:\t%s", app.Container.Image)
+	case s.Config.SocketDir != "":
+		socketPath := filepath.Join(s.Config.SocketDir, s.appSocketName(appPath, 0))
+		line("    Socket:\t%s", socketPath)
+		args = append([]string{socketPath}, args...)
+		fallthrough
+	default:
+		line("    Command:\t%s", strings.Join(s.appCommand(appPath, app, args).Args, " "))
+	}
+	env, err := s.loadAppEnv(appPath, app, false)
+	if err != nil {
+		line("    Environment:\t%v", err)
+		return
+	}
+	line("    Environment:")
+	for _, v := range env {
+		line("      %s", v)
+	}
+}
+
+// missingIn returns a note listing the web roots the application rel,
+// relative to them, isn't found in, if any.
+func (s *Spawner) missingIn(rel string) string {
+	var missing []string
+	for _, webRoot := range s.webRoots() {
+		appPath := filepath.Join(webRoot, filepath.FromSlash(rel))
+		if !s.isApp(appPath) && !s.isCGIScript(appPath) {
+			missing = append(missing, webRoot)
+		}
+	}
+	if len(missing) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (not found in %s)", strings.Join(missing, ", "))
+}
+
+// dryRunRequest describes where a request for rawURL goes, like
+// spawnerHandler decides it.
+func (s *Spawner) dryRunRequest(rawURL string) string {
+	r, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Sprintf("invalid URL: %v", err)
+	}
+	var notes []string
+	original := r.URL.Path
+	if _, r = s.rewrite(nil, r); r.URL.Path != original {
+		notes = append(notes, "rewritten to "+r.URL.Path)
+	}
+	vhost := s.virtualHostFor(r.Host)
+	appPath, err := s.findApp(vhost.webRoot, r.URL.Path)
+	if err != nil {
+		return "forbidden"
+	}
+	var scriptName, pathInfo string
+	if appPath != "" {
+		scriptName, pathInfo = s.splitScriptPath(r.URL.Path, appPath)
+	} else if route, routeScriptName, routePathInfo := s.findRoute(r.URL.Path); route != nil {
+		n := slices.IndexFunc(s.Config.Routes, func(r Route) bool { return r.Path == route.Path && r.Regex == route.Regex }) + 1
+		appPath = filepath.Join(vhost.webRoot, filepath.FromSlash(route.App))
+		if !s.isApp(appPath) && !s.isCGIScript(appPath) {
+			return fmt.Sprintf("route %d, whose application %s doesn't exist: 404", n, appPath)
+		}
+		scriptName, pathInfo = routeScriptName, routePathInfo
+		notes = append(notes, fmt.Sprintf("route %d", n))
+		if route.Canary != nil {
+			notes = append(notes, fmt.Sprintf("%s for %g%% of the requests", route.Canary.App, route.Canary.Percent))
+		}
+	}
+	if appPath == "" {
+		return strings.Join(append(notes, "no application, served from the static root or 404"), ", ")
+	}
+	kind := "application"
+	if isCGI(appPath) {
+		kind = "CGI script"
+	}
+	target := fmt.Sprintf("%s %s, SCRIPT_NAME=%s PATH_INFO=%s", kind, appPath, scriptName, pathInfo)
+	return strings.Join(append([]string{target}, notes...), ", ")
+}
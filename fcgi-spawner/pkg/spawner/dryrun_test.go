@@ -0,0 +1,65 @@
+package spawner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	webRoot, socketDir := t.TempDir(), t.TempDir()
+	if err := os.MkdirAll(filepath.Join(webRoot, "api"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for _, name := range []string{"hello.fcgi", "api/users.fcgi"} {
+		if err := os.WriteFile(filepath.Join(webRoot, name), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(webRoot, "hello.env"), []byte("DB_PASSWORD=vault:secret/data/db#password\n"), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	cfg := &Config{
+		WebRoot:     webRoot,
+		SocketDir:   socketDir,
+		AdminToken:  "hunter2",
+		AdminTokens: map[string]string{"alice": "s3cret"},
+		Apps:        map[string]AppConfig{"hello.fcgi": {Env: map[string]string{"MODE": "prod"}}},
+		Routes: []Route{
+			{Path: "/api/*", App: "api/users.fcgi"},
+			{Regex: "^/blog/", App: "blog.fcgi"},
+		},
+		Rewrites: []RewriteRule{{Path: "/old/*", RewritePrefix: "/api"}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	s := NewSpawner(cfg)
+
+	var out strings.Builder
+	if err := s.DryRun(&out, "/hello.fcgi/x", "/old/42", "/blog/post", "/nothing"); err != nil {
+		t.Fatalf("DryRun() error = %v", err)
+	}
+	text := out.String()
+	for _, want := range []string{
+		"webRoot: " + webRoot,
+		"adminToken: REDACTED",
+		"Applications (2):",
+		filepath.Join(webRoot, "hello.fcgi") + " " + filepath.Join(socketDir, "hello.fcgi.sock"),
+		"DB_PASSWORD=vault:secret/data/db#password",
+		"MODE=prod",
+		"blog.fcgi (not found in " + webRoot + ")",
+		"application " + filepath.Join(webRoot, "hello.fcgi") + ", SCRIPT_NAME=/hello.fcgi PATH_INFO=/x",
+		"SCRIPT_NAME=/api PATH_INFO=/42, rewritten to /api/42, route 1",
+		"route 2, whose application " + filepath.Join(webRoot, "blog.fcgi") + " doesn't exist",
+		"-> no application, served from the static root or 404",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("DryRun() output doesn't contain %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "hunter2") || strings.Contains(text, "s3cret") {
+		t.Errorf("DryRun() output shows secrets:\n%s", text)
+	}
+}
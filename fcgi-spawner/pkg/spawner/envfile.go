@@ -0,0 +1,341 @@
+package spawner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// globalEnvFile is the name of the .env file in a web root that applies to
+// all applications of the site.
+const globalEnvFile = "spawner.env"
+
+// envFiles returns the existing .env files of the application at appPath,
+// in the order they apply: spawner.env in the web root of its site, its own
+// .env file, and the .env files in its .env.d directory, sorted by name.
+func (s *Spawner) envFiles(appPath string) []string {
+	var files []string
+	for _, path := range []string{filepath.Join(s.siteOf(appPath).webRoot, globalEnvFile), envFilePath(appPath)} {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && !slices.Contains(files, path) {
+			files = append(files, path)
+		}
+	}
+	// ReadDir sorts the entries by name.
+	dir := envFilePath(appPath) + ".d"
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && filepath.Ext(entry.Name()) == ".env" {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files
+}
+
+// usesEnvFile reports whether path is, or could be, one of the envFiles of
+// the application at appPath, whether or not it exists.
+func (s *Spawner) usesEnvFile(appPath, path string) bool {
+	return path == filepath.Join(s.siteOf(appPath).webRoot, globalEnvFile) ||
+		path == envFilePath(appPath) ||
+		filepath.Dir(path) == envFilePath(appPath)+".d" && filepath.Ext(path) == ".env"
+}
+
+// latestModTime returns the latest modification time of files, or the zero
+// time if there are none.
+func latestModTime(files []string) time.Time {
+	var latest time.Time
+	for _, path := range files {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// envVar is a variable defined in a .env file.
+type envVar struct {
+	key, value string
+}
+
+// parseEnvFile parses the contents of a .env file, in the syntax understood
+// by most dotenv loaders:
+//
+//	# A comment
+//	export NAME=value        # An unquoted value, up to a comment
+//	GREETING="hello\n$NAME"  # Escapes and expansion, may span lines
+//	PATTERN='$literal'       # Taken as is
+//
+// $VAR, ${VAR} and ${VAR:-default} in unquoted and double-quoted values are
+// expanded from the variables defined on earlier lines, then from lookup.
+// Variables defined nowhere expand to nothing.
+func parseEnvFile(data string, lookup func(string) (string, bool)) ([]envVar, error) {
+	p := &envParser{data: data, line: 1, lookup: lookup, defined: make(map[string]string)}
+	for {
+		p.skipSpace(true)
+		if p.done() {
+			return p.vars, nil
+		}
+		if p.peek() == '#' {
+			p.skipLine()
+			continue
+		}
+		line := p.line
+		v, err := p.parseVar()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		p.vars = append(p.vars, v)
+		p.defined[v.key] = v.value
+	}
+}
+
+// envParser holds the state of parseEnvFile.
+type envParser struct {
+	data    string
+	pos     int
+	line    int
+	lookup  func(string) (string, bool)
+	defined map[string]string
+	vars    []envVar
+}
+
+func (p *envParser) done() bool { return p.pos >= len(p.data) }
+
+func (p *envParser) peek() byte { return p.data[p.pos] }
+
+// next consumes a byte, counting lines.
+func (p *envParser) next() byte {
+	c := p.data[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// skipSpace skips blanks, and line breaks if newlines is set.
+func (p *envParser) skipSpace(newlines bool) {
+	for !p.done() {
+		switch p.peek() {
+		case ' ', '\t', '\r':
+		case '\n':
+			if !newlines {
+				return
+			}
+		default:
+			return
+		}
+		p.next()
+	}
+}
+
+// skipLine skips to the start of the next line.
+func (p *envParser) skipLine() {
+	for !p.done() && p.next() != '\n' {
+	}
+}
+
+// endLine skips what's left of the line after a value, which may only be
+// blanks and a comment.
+func (p *envParser) endLine() error {
+	p.skipSpace(false)
+	if p.done() {
+		return nil
+	}
+	switch p.peek() {
+	case '\n':
+		p.next()
+		return nil
+	case '#':
+		p.skipLine()
+		return nil
+	}
+	return fmt.Errorf("unexpected %q after the value", p.rest())
+}
+
+// rest returns what's left of the current line.
+func (p *envParser) rest() string {
+	rest, _, _ := strings.Cut(p.data[p.pos:], "\n")
+	return strings.TrimSpace(rest)
+}
+
+// parseVar parses a KEY=value definition.
+func (p *envParser) parseVar() (envVar, error) {
+	key := p.name()
+	if key == "export" && !p.done() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.skipSpace(false)
+		key = p.name()
+	}
+	if key == "" {
+		return envVar{}, fmt.Errorf("expected a variable name, got %q", p.rest())
+	}
+	p.skipSpace(false)
+	if p.done() || p.peek() != '=' {
+		return envVar{}, fmt.Errorf("expected = after %s", key)
+	}
+	p.next()
+	p.skipSpace(false)
+
+	var value string
+	var err error
+	switch {
+	case p.done():
+	case p.peek() == '\'':
+		value, err = p.singleQuoted()
+	case p.peek() == '"':
+		value, err = p.doubleQuoted()
+	default:
+		value = p.unquoted()
+		return envVar{key, value}, nil
+	}
+	if err == nil {
+		err = p.endLine()
+	}
+	if err != nil {
+		return envVar{}, fmt.Errorf("%s: %v", key, err)
+	}
+	return envVar{key, value}, nil
+}
+
+// name parses a variable name, "" if there's none.
+func (p *envParser) name() string {
+	start := p.pos
+	for !p.done() && isNameByte(p.peek(), p.pos == start) {
+		p.pos++
+	}
+	return p.data[start:p.pos]
+}
+
+func isNameByte(c byte, first bool) bool {
+	return c == '_' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || !first && ('0' <= c && c <= '9' || c == '.')
+}
+
+// unquoted parses a value up to the end of the line, or a comment set off
+// by a blank, expanding variables.
+func (p *envParser) unquoted() string {
+	var b strings.Builder
+	for !p.done() && p.peek() != '\n' {
+		c := p.peek()
+		if c == '#' && p.pos > 0 && (p.data[p.pos-1] == ' ' || p.data[p.pos-1] == '\t') {
+			p.skipLine()
+			return strings.TrimRight(b.String(), " \t\r")
+		}
+		if c == '$' {
+			p.expand(&b)
+			continue
+		}
+		b.WriteByte(p.next())
+	}
+	if !p.done() {
+		p.next()
+	}
+	return strings.TrimRight(b.String(), " \t\r")
+}
+
+// singleQuoted parses a value in single quotes, taken as is.
+func (p *envParser) singleQuoted() (string, error) {
+	p.next()
+	end := strings.IndexByte(p.data[p.pos:], '\'')
+	if end < 0 {
+		return "", fmt.Errorf("missing closing '")
+	}
+	value := p.data[p.pos : p.pos+end]
+	for range end + 1 {
+		p.next()
+	}
+	return value, nil
+}
+
+// doubleQuoted parses a value in double quotes, with backslash escapes,
+// expanding variables.
+func (p *envParser) doubleQuoted() (string, error) {
+	p.next()
+	var b strings.Builder
+	for !p.done() {
+		switch c := p.peek(); c {
+		case '"':
+			p.next()
+			return b.String(), nil
+		case '$':
+			p.expand(&b)
+		case '\\':
+			p.next()
+			if p.done() {
+				break
+			}
+			switch e := p.next(); e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\', '$':
+				b.WriteByte(e)
+			case '\n':
+				// A continued line.
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(p.next())
+		}
+	}
+	return "", fmt.Errorf(`missing closing "`)
+}
+
+// expand writes the value of the variable referenced at the current '$' to
+// b, or the '$' alone if none is.
+func (p *envParser) expand(b *strings.Builder) {
+	p.next()
+	if !p.done() && p.peek() == '{' {
+		end := strings.IndexAny(p.data[p.pos:], "}\n")
+		if end >= 0 && p.data[p.pos+end] == '}' {
+			ref := p.data[p.pos+1 : p.pos+end]
+			name, def, hasDefault := strings.Cut(ref, ":-")
+			if name != "" && len(name) == len(envName(name)) {
+				value, ok := p.get(name)
+				if (!ok || value == "") && hasDefault {
+					value = def
+				}
+				b.WriteString(value)
+				p.pos += end + 1
+				return
+			}
+		}
+		b.WriteByte('$')
+		return
+	}
+	if name := envName(p.data[p.pos:]); name != "" {
+		value, _ := p.get(name)
+		b.WriteString(value)
+		p.pos += len(name)
+		return
+	}
+	b.WriteByte('$')
+}
+
+// envName returns the variable name at the start of s, "" if there's none.
+// Unlike in keys, dots end names being expanded.
+func envName(s string) string {
+	n := 0
+	for n < len(s) && s[n] != '.' && isNameByte(s[n], n == 0) {
+		n++
+	}
+	return s[:n]
+}
+
+// get returns the value of the variable name defined on an earlier line, or
+// else by lookup.
+func (p *envParser) get(name string) (string, bool) {
+	if value, ok := p.defined[name]; ok {
+		return value, true
+	}
+	if p.lookup != nil {
+		return p.lookup(name)
+	}
+	return "", false
+}
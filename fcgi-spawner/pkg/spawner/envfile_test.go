@@ -0,0 +1,124 @@
+package spawner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	parent := map[string]string{"HOME": "/home/app", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		value, ok := parent[name]
+		return value, ok
+	}
+	tests := []struct {
+		name string
+		data string
+		want []envVar
+	}{
+		{"plain", "A=1\n\n# comment\n  B = two words  \nC=\n", []envVar{{"A", "1"}, {"B", "two words"}, {"C", ""}}},
+		{"export", "export A=1\nexport=2\n", []envVar{{"A", "1"}, {"export", "2"}}},
+		{"inline comment", "A=1 # one\nB=a#b\nC= # none\n", []envVar{{"A", "1"}, {"B", "a#b"}, {"C", ""}}},
+		{"expansion", "A=x\nB=$A-${A}y\nC=${HOME}/$MISSING.\nD=${EMPTY:-def} ${A:-def}\n", []envVar{{"A", "x"}, {"B", "x-xy"}, {"C", "/home/app/."}, {"D", "def x"}}},
+		{"earlier lines first", "HOME=/srv\nH=$HOME\n", []envVar{{"HOME", "/srv"}, {"H", "/srv"}}},
+		{"lone dollar", "A=$ $1 ${ x\n", []envVar{{"A", "$ $1 ${ x"}}},
+		{"double quoted", `A="a \"b\" # c\n\t\$HOME \\ \q $HOME"` + "\n", []envVar{{"A", "a \"b\" # c\n\t$HOME \\ \\q /home/app"}}},
+		{"multi-line", "A=\"one\ntwo\"\nB=3\n", []envVar{{"A", "one\ntwo"}, {"B", "3"}}},
+		{"single quoted", "A='$HOME \\n \"x\"' # comment\n", []envVar{{"A", `$HOME \n "x"`}}},
+		{"vault reference", "A=vault:secret/data/app#password\n", []envVar{{"A", "vault:secret/data/app#password"}}},
+		{"CRLF", "A=1\r\nB=\"2\"\r\n", []envVar{{"A", "1"}, {"B", "2"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEnvFile(tt.data, lookup)
+			if err != nil {
+				t.Fatalf("parseEnvFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEnvFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEnvFileErrors(t *testing.T) {
+	tests := []struct {
+		data     string
+		wantLine string
+	}{
+		{"A=1\nNOVALUE\n", "line 2"},
+		{"A=1\n\n=x\n", "line 3"},
+		{"1A=x\n", "line 1"},
+		{"A=\"open\nB=2\n", "line 1"},
+		{"A='open\n", "line 1"},
+		{"A=\"x\" y\n", "line 1"},
+	}
+	for _, tt := range tests {
+		_, err := parseEnvFile(tt.data, nil)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.wantLine+":") {
+			t.Errorf("parseEnvFile(%q) error = %v, want one on %s", tt.data, err, tt.wantLine)
+		}
+	}
+}
+
+func TestLayeredEnvFiles(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "api", "app.fcgi")
+	os.MkdirAll(filepath.Join(webRoot, "api", "app.env.d"), 0755)
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(webRoot, name), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	write("spawner.env", "DB_HOST=db\nLEVEL=info\nREGION=eu\n")
+	write("api/app.env", "LEVEL=debug\nDB_URL=postgres://$DB_HOST/app\n")
+	write("api/app.env.d/20-local.env", "DB_HOST=localhost\nURL=$DB_URL\n")
+	write("api/app.env.d/10-first.env", "REGION=us\n")
+	write("api/app.env.d/notes.txt", "NOT=loaded\n")
+	s := NewSpawner(&Config{WebRoot: webRoot, DrainTimeout: time.Second})
+	defer s.stopAllChildren(time.Second)
+
+	env, err := s.appEnv(appPath, AppConfig{Env: map[string]string{"REGION": "ap"}})
+	if err != nil {
+		t.Fatalf("appEnv() error = %v", err)
+	}
+	want := []string{"PATH=/usr/local/bin:/usr/bin:/bin", "DB_HOST=localhost", "LEVEL=debug", "REGION=ap", "DB_URL=postgres://db/app", "URL=postgres://db/app"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("appEnv() = %q, want %q", env, want)
+	}
+
+	// A change to any layer replaces the running process, and so does the
+	// removal of one.
+	if err := s.startApp(appPath); err != nil {
+		t.Fatalf("startApp() error = %v", err)
+	}
+	for _, path := range []string{"spawner.env", "api/app.env.d/20-local.env"} {
+		if apps := s.appsUsingEnvFile(filepath.Join(webRoot, path)); len(apps) != 1 || apps[0] != appPath {
+			t.Errorf("appsUsingEnvFile(%s) = %v, want [%s]", path, apps, appPath)
+		}
+	}
+	if apps := s.appsUsingEnvFile(filepath.Join(webRoot, "api", "app.env.d", "notes.txt")); len(apps) != 0 {
+		t.Errorf("appsUsingEnvFile(notes.txt) = %v, want none", apps)
+	}
+	s.childProcessesMu.Lock()
+	old := s.childProcesses[instanceKey(appPath, 0)]
+	s.childProcessesMu.Unlock()
+	if err := os.Remove(filepath.Join(webRoot, "api", "app.env.d", "10-first.env")); err != nil {
+		t.Fatalf("Failed to remove env file: %v", err)
+	}
+	s.upgradeApp(appPath)
+	s.childProcessesMu.Lock()
+	current := s.childProcesses[instanceKey(appPath, 0)]
+	s.childProcessesMu.Unlock()
+	if current == nil || current == old {
+		t.Errorf("upgradeApp() didn't restart the app after one of its .env files was removed")
+	}
+}
@@ -0,0 +1,183 @@
+package spawner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Types of lifecycle events of child processes.
+const (
+	EventSpawned    = "spawned"     // The process was started
+	EventReady      = "ready"       // The process is ready and serves requests
+	EventIdleKilled = "idle-killed" // The process was stopped after its idle timeout
+	EventCrashed    = "crashed"     // The process exited without being stopped by the spawner
+	EventRestarted  = "restarted"   // A process is ready again after one crashed
+)
+
+// Event is a lifecycle event of a child process, as sent to the event stream
+// of the admin API and to Config.EventWebhook.
+type Event struct {
+	Type     string    `json:"type"`
+	App      string    `json:"app"`
+	Name     string    `json:"name,omitempty"` // Path used by /apps/{app}/..., if it's in WebRoot
+	Instance int       `json:"instance"`
+	PID      int       `json:"pid,omitempty"`
+	Time     time.Time `json:"time"`
+	Reason   string    `json:"reason,omitempty"` // Exit status of crashed processes
+}
+
+// eventBufferSize is how many events a subscriber may fall behind before
+// further events are dropped for it.
+const eventBufferSize = 64
+
+// eventBus passes the published events on to its subscribers.
+type eventBus struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// subscribe returns a channel receiving the events published from now on,
+// and a function ending the subscription.
+func (b *eventBus) subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventBufferSize)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		b.subs = make(map[chan Event]struct{})
+	}
+	b.subs[ch] = struct{}{}
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, ch)
+	}
+}
+
+// publish passes e on to the subscribers, without waiting for slow ones.
+func (b *eventBus) publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			eventLog.Warn("Event subscriber is too slow, dropping event", "type", e.Type, "app", e.App)
+		}
+	}
+}
+
+// publishEvent publishes an event of type typ about child. reason is
+// optional.
+func (s *Spawner) publishEvent(typ string, child *childProcess, reason string) {
+	e := Event{
+		Type:     typ,
+		App:      child.binaryPath,
+		Name:     s.adminName(child.binaryPath),
+		Instance: child.instance,
+		Time:     time.Now(),
+		Reason:   reason,
+	}
+	if process := child.cmd.Process(); process != nil {
+		e.PID = process.Pid()
+	}
+	s.events.publish(e)
+}
+
+// checkWebhookURL checks that webhook, e.g. Config.EventWebhook, is an http
+// or https URL.
+func checkWebhookURL(webhook string) error {
+	if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", webhook)
+	}
+	return nil
+}
+
+// eventWebhookTimeout is how long the webhook may take to accept an event.
+const eventWebhookTimeout = 10 * time.Second
+
+// sendEvents posts every event as JSON to Config.EventWebhook until ctx is
+// done. Events the webhook doesn't accept are logged and dropped.
+func (s *Spawner) sendEvents(ctx context.Context) {
+	if s.Config.EventWebhook == "" {
+		return
+	}
+	events, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+	client := &http.Client{Timeout: eventWebhookTimeout}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			if err := postEvent(ctx, client, s.Config.EventWebhook, e); err != nil {
+				eventLog.Error("Failed to send event to webhook", "type", e.Type, "app", e.App, "error", err)
+			}
+		}
+	}
+}
+
+// postEvent posts e as JSON to webhook.
+func postEvent(ctx context.Context, client *http.Client, webhook string, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// eventKeepAlive is how often a comment is sent on an idle event stream, so
+// that proxies don't close it.
+const eventKeepAlive = 30 * time.Second
+
+// handleAdminEvents streams the lifecycle events as server-sent events until
+// the client goes away.
+func (s *Spawner) handleAdminEvents(w http.ResponseWriter, r *http.Request) {
+	events, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(eventKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-events:
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
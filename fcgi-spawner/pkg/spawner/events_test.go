@@ -0,0 +1,149 @@
+package spawner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nextEvent returns the next event of events, failing t after a timeout.
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(3 * time.Second):
+		t.Fatal("No event received")
+		return Event{}
+	}
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	webRoot := t.TempDir()
+	apps := map[string]string{
+		"crashing.fcgi": "#!/bin/sh\nsleep 0.2\nexit 1\n",
+		"idle.fcgi":     "#!/bin/sh\nexec sleep 30\n",
+	}
+	for name, script := range apps {
+		if err := os.WriteFile(filepath.Join(webRoot, name), []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to write app: %v", err)
+		}
+	}
+	idleTimeout := 200 * time.Millisecond
+	s := NewSpawner(&Config{
+		WebRoot: webRoot,
+		Apps:    map[string]AppConfig{"idle.fcgi": {IdleTimeout: &idleTimeout}},
+	})
+	defer s.stopAllChildren(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.cleanupChildProcesses(ctx)
+
+	events, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+	start := func(name string) {
+		t.Helper()
+		child, _, err := s.getOrCreateChild(context.Background(), filepath.Join(webRoot, name), nil)
+		if err != nil {
+			t.Fatalf("getOrCreateChild(%s) error = %v", name, err)
+		}
+		s.releaseChild(child)
+	}
+	expect := func(want ...string) {
+		t.Helper()
+		for _, typ := range want {
+			e := nextEvent(t, events)
+			if e.Type != typ {
+				t.Fatalf("event %+v, want type %s", e, typ)
+			}
+			if e.PID == 0 || e.Name == "" {
+				t.Errorf("event %+v lacks the process", e)
+			}
+		}
+	}
+
+	start("crashing.fcgi")
+	expect(EventSpawned, EventReady, EventCrashed)
+	start("crashing.fcgi")
+	expect(EventSpawned, EventReady, EventRestarted, EventCrashed)
+
+	start("idle.fcgi")
+	expect(EventSpawned, EventReady, EventIdleKilled)
+}
+
+func TestAdminEventStream(t *testing.T) {
+	s := NewSpawner(&Config{WebRoot: t.TempDir(), AdminToken: "secret"})
+	server := httptest.NewServer(s.AdminHandler())
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /events error = %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	// The stream subscribed before answering.
+	s.events.publish(Event{Type: EventCrashed, App: "/srv/app.fcgi", Reason: "exit status 1"})
+	lines := bufio.NewScanner(resp.Body)
+	var got []string
+	for len(got) < 2 && lines.Scan() {
+		got = append(got, lines.Text())
+	}
+	if len(got) < 2 || got[0] != "event: crashed" || !strings.HasPrefix(got[1], "data: ") {
+		t.Fatalf("stream = %q, want a crashed event", got)
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(got[1], "data: ")), &e); err != nil || e.App != "/srv/app.fcgi" || e.Reason != "exit status 1" {
+		t.Errorf("data = %s (%v), want the published event", got[1], err)
+	}
+}
+
+func TestEventWebhook(t *testing.T) {
+	received := make(chan Event, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("Failed to decode event: %v", err)
+		}
+		received <- e
+	}))
+	defer webhook.Close()
+
+	s := NewSpawner(&Config{WebRoot: t.TempDir(), EventWebhook: webhook.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.sendEvents(ctx)
+	// sendEvents subscribes in the background.
+	for {
+		s.events.mu.Lock()
+		subscribed := len(s.events.subs) > 0
+		s.events.mu.Unlock()
+		if subscribed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.events.publish(Event{Type: EventReady, App: "/srv/app.fcgi", PID: 42})
+	if e := nextEvent(t, received); e.Type != EventReady || e.PID != 42 {
+		t.Errorf("webhook received %+v, want the published event", e)
+	}
+
+	for _, url := range []string{"ftp://example.com/events", "example.com/events"} {
+		if err := checkWebhookURL(url); err == nil {
+			t.Errorf("checkWebhookURL(%q) succeeded", url)
+		}
+	}
+}
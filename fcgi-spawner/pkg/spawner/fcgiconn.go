@@ -0,0 +1,383 @@
+package spawner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FastCGI record types and constants used by the client, see
+// https://fastcgi-archives.github.io/FastCGI_Specification.html.
+const (
+	fcgiVersion      = 1
+	fcgiBeginRequest = 1
+	fcgiAbortRequest = 2
+	fcgiEndRequest   = 3
+	fcgiParams       = 4
+	fcgiStdin        = 5
+	fcgiStdout       = 6
+	fcgiStderr       = 7
+	fcgiResponder    = 1
+	fcgiKeepConn     = 1
+	fcgiRequestID    = 1 // Requests on an fcgiConn aren't multiplexed, so every request uses the same ID.
+	fcgiMaxContent   = 65535
+)
+
+// fcgiPadding pads records to a multiple of 8 bytes.
+var fcgiPadding [7]byte
+
+// fcgiConn is a FastCGI connection to a child process. Requests are sent with
+// FCGI_KEEP_CONN, so the connection can be reused once a response has been
+// read completely.
+type fcgiConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	// done is set when the last response has been read up to its
+	// FCGI_END_REQUEST record, so that the next request may be sent.
+	done bool
+	// gotResponse is set as soon as the application has sent anything in
+	// reply to the current request.
+	gotResponse bool
+	stderr      func(line string)
+}
+
+// dialFCGI connects to the FastCGI application listening on socketPath.
+func dialFCGI(socketPath string) (*fcgiConn, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	return &fcgiConn{conn: conn, r: bufio.NewReader(conn), done: true}, nil
+}
+
+func (c *fcgiConn) Close() error {
+	return c.conn.Close()
+}
+
+// writeRecord writes a single record with the given content.
+func (c *fcgiConn) writeRecord(w io.Writer, recType uint8, content []byte) error {
+	return writeFCGIRecord(w, recType, fcgiRequestID, content)
+}
+
+// writeFCGIRecord writes a single record of the request id with the given
+// content.
+func writeFCGIRecord(w io.Writer, recType uint8, id uint16, content []byte) error {
+	padding := -len(content) & 7
+	header := [8]byte{fcgiVersion, recType}
+	binary.BigEndian.PutUint16(header[2:], id)
+	binary.BigEndian.PutUint16(header[4:], uint16(len(content)))
+	header[6] = byte(padding)
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(content); err != nil {
+		return err
+	}
+	_, err := w.Write(fcgiPadding[:padding])
+	return err
+}
+
+// writeStream writes data as a stream of records of recType, followed by the
+// empty record ending the stream.
+func (c *fcgiConn) writeStream(w io.Writer, recType uint8, data []byte) error {
+	for len(data) > 0 {
+		n := min(len(data), fcgiMaxContent)
+		if err := c.writeRecord(w, recType, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return c.writeRecord(w, recType, nil)
+}
+
+// encodeParams encodes params as FastCGI name-value pairs.
+func encodeParams(params map[string]string) []byte {
+	var buf bytes.Buffer
+	writeLength := func(n int) {
+		if n > 127 {
+			buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)|1<<31))
+		} else {
+			buf.WriteByte(byte(n))
+		}
+	}
+	for name, value := range params {
+		writeLength(len(name))
+		writeLength(len(value))
+		buf.WriteString(name)
+		buf.WriteString(value)
+	}
+	return buf.Bytes()
+}
+
+// request sends a request with params and body and returns the response once
+// its headers have arrived. The body is streamed to the application, which
+// must take every record and then send the response headers within timeout,
+// unless it is 0. The response body must be read up to io.EOF before the
+// connection can be reused.
+func (c *fcgiConn) request(params map[string]string, body io.Reader, timeout time.Duration) (*http.Response, error) {
+	if !c.done {
+		return nil, errors.New("fastcgi: previous response not read completely")
+	}
+	c.done = false
+	c.gotResponse = false
+
+	w := bufio.NewWriter(progressWriter{c.conn, timeout})
+	begin := []byte{0, fcgiResponder, fcgiKeepConn, 0, 0, 0, 0, 0}
+	if err := c.writeRecord(w, fcgiBeginRequest, begin); err != nil {
+		return nil, err
+	}
+	if err := c.writeStream(w, fcgiParams, encodeParams(params)); err != nil {
+		return nil, err
+	}
+	if body != nil {
+		body := clientBody{body}
+		buf := make([]byte, fcgiMaxContent)
+		for {
+			n, err := body.Read(buf)
+			if n > 0 {
+				if err := c.writeRecord(w, fcgiStdin, buf[:n]); err != nil {
+					return nil, err
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := c.writeRecord(w, fcgiStdin, nil); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	return readCGIResponse(bufio.NewReader(&fcgiStdoutReader{c: c}))
+}
+
+// readCGIResponse reads the CGI-style response headers that FastCGI and SCGI
+// applications send and returns the response, with its body read from stdout.
+func readCGIResponse(stdout *bufio.Reader) (*http.Response, error) {
+	header, err := textproto.NewReader(stdout).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("reading response headers: %w", err)
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header(header),
+		Body:       io.NopCloser(stdout),
+	}
+	// A chunked body is decoded, so that the HTTP server can frame the
+	// response itself. The rest of the stream is read so that the connection
+	// can be reused.
+	if slices.Contains(resp.Header.Values("Transfer-Encoding"), "chunked") {
+		resp.Body = io.NopCloser(io.MultiReader(httputil.NewChunkedReader(stdout), drainReader{stdout}))
+	}
+	for _, name := range hopByHopHeaders {
+		resp.Header.Del(name)
+	}
+	// Like CGI, the status is given by the Status header, and a redirect
+	// without one is a 302.
+	if status := resp.Header.Get("Status"); status != "" {
+		code, _, _ := strings.Cut(status, " ")
+		if resp.StatusCode, err = strconv.Atoi(code); err != nil || resp.StatusCode < 100 || resp.StatusCode > 999 {
+			return nil, fmt.Errorf("malformed status %q", status)
+		}
+		resp.Header.Del("Status")
+	} else if resp.Header.Get("Location") != "" {
+		resp.StatusCode = http.StatusFound
+	}
+	return resp, nil
+}
+
+// hopByHopHeaders only apply to the connection between the application and
+// the spawner and aren't passed on to the client.
+var hopByHopHeaders = []string{"Connection", "Keep-Alive", "Transfer-Encoding", "Upgrade"}
+
+// drainReader reads r to the end and reports io.EOF.
+type drainReader struct{ r io.Reader }
+
+func (d drainReader) Read([]byte) (int, error) {
+	if _, err := io.Copy(io.Discard, d.r); err != nil {
+		return 0, err
+	}
+	return 0, io.EOF
+}
+
+// fcgiStdoutReader reads the FCGI_STDOUT stream of the current request. Lines
+// on FCGI_STDERR are passed to the connection's stderr function. It returns
+// io.EOF once the FCGI_END_REQUEST record has been read.
+type fcgiStdoutReader struct {
+	c       *fcgiConn
+	pending []byte
+}
+
+func (sr *fcgiStdoutReader) Read(p []byte) (int, error) {
+	for len(sr.pending) == 0 {
+		if sr.c.done {
+			return 0, io.EOF
+		}
+		recType, _, content, err := readFCGIRecord(sr.c.r, func() { sr.c.gotResponse = true })
+		if err != nil {
+			return 0, err
+		}
+		switch recType {
+		case fcgiStdout:
+			sr.pending = content
+		case fcgiStderr:
+			logFCGIStderr(sr.c.stderr, content)
+		case fcgiEndRequest:
+			sr.c.done = true
+		}
+	}
+	n := copy(p, sr.pending)
+	sr.pending = sr.pending[n:]
+	return n, nil
+}
+
+// readFCGIRecord reads a record and returns its type, request ID and
+// content. started is called once the record has begun to arrive.
+func readFCGIRecord(r *bufio.Reader, started func()) (recType uint8, id uint16, content []byte, err error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	started()
+	if header[0] != fcgiVersion {
+		return 0, 0, nil, fmt.Errorf("fastcgi: invalid record version %d", header[0])
+	}
+	length := int(binary.BigEndian.Uint16(header[4:]))
+	content = make([]byte, length+int(header[6]))
+	if _, err := io.ReadFull(r, content); err != nil {
+		return 0, 0, nil, err
+	}
+	return header[1], binary.BigEndian.Uint16(header[2:]), content[:length], nil
+}
+
+// logFCGIStderr passes the lines of FCGI_STDERR content to stderr, if any.
+func logFCGIStderr(stderr func(line string), content []byte) {
+	if stderr == nil {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		stderr(line)
+	}
+}
+
+// getConn returns an idle connection to child, or a new one. reused tells
+// whether the connection was taken from the pool.
+func (s *Spawner) getConn(child *childProcess) (conn *fcgiConn, reused bool, err error) {
+	child.connsMu.Lock()
+	if n := len(child.idleConns); n > 0 {
+		conn = child.idleConns[n-1]
+		child.idleConns = child.idleConns[:n-1]
+		child.connsMu.Unlock()
+		return conn, true, nil
+	}
+	child.connsMu.Unlock()
+	conn, err = dialFCGI(child.socketPath)
+	return conn, false, err
+}
+
+// putConn returns conn to the pool of child if its last response was read
+// completely and the pool isn't full, and closes it otherwise. The pool holds
+// up to Config.ConnPoolSize connections, and no more than the application
+// accepts.
+func (s *Spawner) putConn(child *childProcess, conn *fcgiConn) {
+	conn.stderr = nil
+	child.connsMu.Lock()
+	if poolSize, _ := s.connLimits(child); conn.done && !child.connsClosed && len(child.idleConns) < poolSize {
+		child.idleConns = append(child.idleConns, conn)
+		conn = nil
+	}
+	child.connsMu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// closeConns closes the idle FastCGI and HTTP connections of child, which is going away, and
+// keeps it from pooling new ones. Multiplexed connections are closed once
+// their requests have ended.
+func (child *childProcess) closeConns() {
+	child.connsMu.Lock()
+	defer child.connsMu.Unlock()
+	for _, conn := range child.idleConns {
+		conn.Close()
+	}
+	child.idleConns = nil
+	child.muxConns = slices.DeleteFunc(child.muxConns, func(m *fcgiMux) bool {
+		if n, _ := m.state(); n == 0 {
+			m.Close()
+			return true
+		}
+		return false
+	})
+	child.connsClosed = true
+	if child.transport != nil {
+		child.transport.CloseIdleConnections()
+	}
+}
+
+// stderrLogger returns the function logging the FCGI_STDERR lines of child.
+func stderrLogger(child *childProcess) func(line string) {
+	return func(line string) {
+		appLog.Info(line, "app", filepath.Base(child.binaryPath), "stream", "fcgi-stderr")
+		appLogTail.add(child.binaryPath, 0, "fcgi-stderr", line)
+	}
+}
+
+// roundTrip sends a request to child over a pooled connection. If a pooled
+// connection turns out to have been closed by the application before anything
+// was sent back, a request without a body is retried on a new connection.
+// The response headers must arrive within timeout, unless it is 0, of the
+// request body having been sent. Sending the body stops when the client goes
+// away.
+func (s *Spawner) roundTrip(child *childProcess, params map[string]string, r *http.Request, timeout time.Duration) (*http.Response, *fcgiConn, error) {
+	stderr := stderrLogger(child)
+	for {
+		conn, reused, err := s.getConn(child)
+		if err != nil {
+			return nil, nil, err
+		}
+		conn.stderr = stderr
+		stop := context.AfterFunc(r.Context(), func() { conn.Close() })
+		resp, err := conn.request(params, r.Body, timeout)
+		if !stop() {
+			// The client went away, closing the connection.
+			err = r.Context().Err()
+		}
+		if err == nil {
+			conn.conn.SetDeadline(time.Time{})
+			return resp, conn, nil
+		}
+		conn.Close()
+		if reused && !conn.gotResponse && r.ContentLength == 0 && !errors.Is(err, os.ErrDeadlineExceeded) && r.Context().Err() == nil {
+			proxyLog.Debug("Pooled FastCGI connection failed, retrying on a new one", "app", child.binaryPath, "error", err)
+			continue
+		}
+		return nil, nil, err
+	}
+}
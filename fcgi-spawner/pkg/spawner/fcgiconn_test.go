@@ -0,0 +1,263 @@
+package spawner
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/fcgi"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingListener counts the connections it accepts.
+type countingListener struct {
+	net.Listener
+	accepted atomic.Int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.accepted.Add(1)
+	}
+	return conn, err
+}
+
+// serveFCGI serves handler over FastCGI on a unix socket and returns the
+// socket path and the listener.
+func serveFCGI(t *testing.T, handler http.HandlerFunc) (string, *countingListener) {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "app.sock")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	counting := &countingListener{Listener: ln}
+	t.Cleanup(func() { ln.Close() })
+	go fcgi.Serve(counting, handler)
+	return socketPath, counting
+}
+
+func TestFCGIConnRequest(t *testing.T) {
+	socketPath, _ := serveFCGI(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		env := fcgi.ProcessEnv(r)
+		w.Header().Set("X-Long-Value", strconv.Itoa(len(env["LONG_VALUE"])))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%s %s", r.Method, body)
+	})
+
+	conn, err := dialFCGI(socketPath)
+	if err != nil {
+		t.Fatalf("dialFCGI() error = %v", err)
+	}
+	defer conn.Close()
+
+	for i := range 3 {
+		params := map[string]string{
+			"REQUEST_METHOD":  "POST",
+			"SERVER_PROTOCOL": "HTTP/1.1",
+			"SCRIPT_NAME":     "/app.fcgi",
+			"CONTENT_LENGTH":  "5",
+			"LONG_VALUE":      strings.Repeat("x", 70000),
+		}
+		resp, err := conn.request(params, strings.NewReader("hello"), 0)
+		if err != nil {
+			t.Fatalf("request %d error = %v", i, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("reading body %d: %v", i, err)
+		}
+		if resp.StatusCode != http.StatusCreated || string(body) != "POST hello" || resp.Header.Get("X-Long-Value") != "70000" {
+			t.Errorf("request %d = %d %q %v, want 201 %q", i, resp.StatusCode, body, resp.Header, "POST hello")
+		}
+		if resp.Header.Get("Status") != "" {
+			t.Errorf("request %d: Status header not removed", i)
+		}
+		if !conn.done {
+			t.Errorf("request %d: connection not reusable after reading the response", i)
+		}
+	}
+}
+
+func TestProxyRequestReusesConnections(t *testing.T) {
+	socketPath, ln := serveFCGI(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+
+	for _, tt := range []struct {
+		poolSize     int
+		wantAccepted int32
+	}{
+		{poolSize: 4, wantAccepted: 1},
+		{poolSize: 0, wantAccepted: 3},
+	} {
+		ln.accepted.Store(0)
+		s := NewSpawner(&Config{ConnPoolSize: tt.poolSize})
+		child := &childProcess{cmd: &mockCmd{path: "/web/app.fcgi"}, socketPath: socketPath, binaryPath: "/web/app.fcgi"}
+		for range 3 {
+			rec := httptest.NewRecorder()
+			s.proxyRequest(rec, httptest.NewRequest(http.MethodGet, "/app.fcgi", nil), child, "/app.fcgi", "")
+			if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+				t.Fatalf("proxyRequest() = %d %q, want 200 ok", rec.Code, rec.Body.String())
+			}
+		}
+		if got := ln.accepted.Load(); got != tt.wantAccepted {
+			t.Errorf("poolSize %d: %d connections, want %d", tt.poolSize, got, tt.wantAccepted)
+		}
+		child.closeConns()
+	}
+}
+
+func TestRoundTripRetriesClosedConnection(t *testing.T) {
+	socketPath, _ := serveFCGI(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	s := NewSpawner(&Config{ConnPoolSize: 4})
+	child := &childProcess{socketPath: socketPath, binaryPath: "/web/app.fcgi"}
+
+	// A pooled connection the application has closed in the meantime.
+	client, server := net.Pipe()
+	server.Close()
+	stale := &fcgiConn{conn: client, r: bufio.NewReader(client), done: true}
+	child.idleConns = []*fcgiConn{stale}
+
+	resp, conn, err := s.roundTrip(child, map[string]string{"REQUEST_METHOD": "GET", "SERVER_PROTOCOL": "HTTP/1.1"}, httptest.NewRequest(http.MethodGet, "/app.fcgi", nil), 0)
+	if err != nil {
+		t.Fatalf("roundTrip() error = %v", err)
+	}
+	defer conn.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "ok" {
+		t.Errorf("roundTrip() body = %q, want ok", body)
+	}
+}
+
+func TestRoundTripClientGone(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	socketPath, _ := serveFCGI(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	s := NewSpawner(&Config{})
+	child := &childProcess{socketPath: socketPath, binaryPath: "/web/app.fcgi"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	r := httptest.NewRequestWithContext(ctx, http.MethodGet, "/app.fcgi", nil)
+	_, _, err := s.roundTrip(child, map[string]string{"REQUEST_METHOD": "GET", "SERVER_PROTOCOL": "HTTP/1.1"}, r, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("roundTrip() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestFCGIConnChunkedResponse(t *testing.T) {
+	socketPath, _ := serveFCGI(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Transfer-Encoding", "chunked")
+		w.Header().Set("Connection", "keep-alive")
+		fmt.Fprint(w, "5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n")
+	})
+	conn, err := dialFCGI(socketPath)
+	if err != nil {
+		t.Fatalf("dialFCGI() error = %v", err)
+	}
+	defer conn.Close()
+
+	resp, err := conn.request(map[string]string{"REQUEST_METHOD": "GET", "SERVER_PROTOCOL": "HTTP/1.1"}, nil, 0)
+	if err != nil {
+		t.Fatalf("request() error = %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	if string(body) != "hello world" {
+		t.Errorf("body = %q, want %q", body, "hello world")
+	}
+	if resp.Header.Get("Transfer-Encoding") != "" || resp.Header.Get("Connection") != "" {
+		t.Errorf("hop-by-hop headers passed on: %v", resp.Header)
+	}
+	if !conn.done {
+		t.Error("connection not reusable after reading a chunked response")
+	}
+}
+
+func TestProxyRequestStreams(t *testing.T) {
+	release := make(chan struct{})
+	stopped := make(chan struct{})
+	socketPath, _ := serveFCGI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/endless" {
+			// Writes until the spawner hangs up.
+			defer close(stopped)
+			for {
+				if _, err := fmt.Fprint(w, "tick\n"); err != nil {
+					return
+				}
+				if err := http.NewResponseController(w).Flush(); err != nil {
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		fmt.Fprint(w, "first\n")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "second\n")
+	})
+	s := NewSpawner(&Config{ConnPoolSize: 4})
+	child := &childProcess{cmd: &mockCmd{path: "/web/app.fcgi"}, socketPath: socketPath, binaryPath: "/web/app.fcgi"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("Connection")
+		s.proxyRequest(w, r, child, "/app.fcgi", r.URL.Path)
+	}))
+	defer server.Close()
+
+	t.Run("incremental", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/stream")
+		if err != nil {
+			t.Fatalf("GET error = %v", err)
+		}
+		defer resp.Body.Close()
+		r := bufio.NewReader(resp.Body)
+		// The first line arrives while the application is still busy.
+		if line, err := r.ReadString('\n'); err != nil || line != "first\n" {
+			t.Fatalf("first line = %q, %v", line, err)
+		}
+		close(release)
+		if line, err := r.ReadString('\n'); err != nil || line != "second\n" {
+			t.Fatalf("second line = %q, %v", line, err)
+		}
+	})
+
+	t.Run("client disconnects", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/endless", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET error = %v", err)
+		}
+		if line, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil || line != "tick\n" {
+			t.Fatalf("first line = %q, %v", line, err)
+		}
+		cancel()
+		resp.Body.Close()
+		select {
+		case <-stopped:
+		case <-time.After(2 * time.Second):
+			t.Error("application kept streaming after the client disconnected")
+		}
+	})
+}
@@ -0,0 +1,384 @@
+package spawner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// fcgiMuxRequests is the number of requests in flight at once on a
+// multiplexed connection, unless the application reports a lower
+// FCGI_MAX_REQS; further ones open another connection.
+const fcgiMuxRequests = 64
+
+// errRequestClosed is returned when reading the response of a request that
+// was closed.
+var errRequestClosed = errors.New("fastcgi: request closed")
+
+// fcgiMux is a FastCGI connection to a child process supporting
+// multiplexing (FCGI_MPXS_CONNS), on which several requests are in flight at
+// once, each with its own request ID. A goroutine reads the records and hands
+// them to the requests they belong to.
+type fcgiMux struct {
+	conn     net.Conn
+	writeMu  sync.Mutex // Records are written whole
+	stderr   func(line string)
+	mu       sync.Mutex
+	requests map[uint16]*fcgiMuxRequest // In flight, by ID, guarded by mu
+	nextID   uint16                     // Guarded by mu
+	err      error                      // Set once the connection failed, guarded by mu
+}
+
+// dialFCGIMux connects to the FastCGI application listening on socketPath
+// and starts reading its records. Lines on FCGI_STDERR are passed to stderr.
+func dialFCGIMux(socketPath string, stderr func(line string)) (*fcgiMux, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	m := &fcgiMux{conn: conn, stderr: stderr, requests: make(map[uint16]*fcgiMuxRequest)}
+	go m.readLoop()
+	return m, nil
+}
+
+// Close closes the connection, failing the requests in flight.
+func (m *fcgiMux) Close() error {
+	m.fail(net.ErrClosed)
+	return nil
+}
+
+// fail closes the connection because of err and fails the requests in
+// flight.
+func (m *fcgiMux) fail(err error) {
+	m.mu.Lock()
+	if m.err != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.err = err
+	requests := m.requests
+	m.requests = nil
+	m.mu.Unlock()
+	m.conn.Close()
+	for _, req := range requests {
+		req.fail(err)
+	}
+}
+
+// state returns the number of requests in flight, and whether the
+// connection has failed.
+func (m *fcgiMux) state() (inFlight int, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.requests), m.err != nil
+}
+
+// readLoop hands the records read from the connection to their requests
+// until it fails.
+func (m *fcgiMux) readLoop() {
+	r := bufio.NewReader(m.conn)
+	for {
+		recType, id, content, err := readFCGIRecord(r, func() {})
+		if err != nil {
+			m.fail(err)
+			return
+		}
+		m.mu.Lock()
+		req := m.requests[id]
+		if req != nil && recType == fcgiEndRequest {
+			delete(m.requests, id)
+		}
+		m.mu.Unlock()
+		if req == nil {
+			// The end of an aborted request.
+			continue
+		}
+		switch recType {
+		case fcgiStdout:
+			req.deliver(content)
+		case fcgiStderr:
+			logFCGIStderr(m.stderr, content)
+		case fcgiEndRequest:
+			req.end()
+		}
+	}
+}
+
+// open allocates a request ID for a new request. IDs are handed out in turn,
+// so that records still arriving for an aborted request don't reach the next
+// one.
+func (m *fcgiMux) open() (*fcgiMuxRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	for {
+		m.nextID++
+		if m.nextID == 0 {
+			m.nextID = 1
+		}
+		if _, used := m.requests[m.nextID]; !used {
+			break
+		}
+	}
+	req := &fcgiMuxRequest{mux: m, id: m.nextID}
+	req.cond = sync.NewCond(&req.mu)
+	m.requests[req.id] = req
+	return req, nil
+}
+
+// writeRecord writes a record of the request id, which the application must
+// take within timeout unless it is 0. A failed write leaves a partial record
+// behind, so it fails the connection.
+func (m *fcgiMux) writeRecord(recType uint8, id uint16, content []byte, timeout time.Duration) error {
+	var buf bytes.Buffer
+	writeFCGIRecord(&buf, recType, id, content)
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	if _, err := (progressWriter{m.conn, timeout}).Write(buf.Bytes()); err != nil {
+		m.fail(err)
+		return err
+	}
+	return nil
+}
+
+// writeStream writes data as a stream of records of recType of the request
+// id, followed by the empty record ending the stream.
+func (m *fcgiMux) writeStream(recType uint8, id uint16, data []byte, timeout time.Duration) error {
+	for len(data) > 0 {
+		n := min(len(data), fcgiMaxContent)
+		if err := m.writeRecord(recType, id, data[:n], timeout); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return m.writeRecord(recType, id, nil, timeout)
+}
+
+// fcgiMuxRequest is a request in flight on an fcgiMux. It reads the
+// FCGI_STDOUT stream of the request up to its FCGI_END_REQUEST record.
+type fcgiMuxRequest struct {
+	mux     *fcgiMux
+	id      uint16
+	release func() // Called once the request is closed
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending [][]byte // FCGI_STDOUT content not read yet
+	ended   bool     // FCGI_END_REQUEST has arrived
+	err     error    // Reading fails with it once pending is read
+	closed  bool
+}
+
+// roundTrip sends the request with params and body like fcgiConn.request
+// and returns the response once its headers have arrived. The request must
+// be closed once the response body has been read, or to abort it.
+func (req *fcgiMuxRequest) roundTrip(params map[string]string, body io.Reader, timeout time.Duration) (*http.Response, error) {
+	if err := req.send(params, body, timeout); err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() { req.fail(os.ErrDeadlineExceeded) })
+		defer timer.Stop()
+	}
+	return readCGIResponse(bufio.NewReader(req))
+}
+
+// send writes the records of the request, streaming body as FCGI_STDIN.
+func (req *fcgiMuxRequest) send(params map[string]string, body io.Reader, timeout time.Duration) error {
+	m := req.mux
+	begin := []byte{0, fcgiResponder, fcgiKeepConn, 0, 0, 0, 0, 0}
+	if err := m.writeRecord(fcgiBeginRequest, req.id, begin, timeout); err != nil {
+		return err
+	}
+	if err := m.writeStream(fcgiParams, req.id, encodeParams(params), timeout); err != nil {
+		return err
+	}
+	if body != nil {
+		body := clientBody{body}
+		buf := make([]byte, fcgiMaxContent)
+		for {
+			n, err := body.Read(buf)
+			if n > 0 {
+				if err := m.writeRecord(fcgiStdin, req.id, buf[:n], timeout); err != nil {
+					return err
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return m.writeRecord(fcgiStdin, req.id, nil, timeout)
+}
+
+// deliver queues FCGI_STDOUT content for Read.
+func (req *fcgiMuxRequest) deliver(content []byte) {
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	if !req.closed && len(content) > 0 {
+		req.pending = append(req.pending, content)
+		req.cond.Broadcast()
+	}
+}
+
+// end marks the end of the response.
+func (req *fcgiMuxRequest) end() {
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	req.ended = true
+	req.cond.Broadcast()
+}
+
+// fail makes reading the response fail with err once the content already
+// received has been read.
+func (req *fcgiMuxRequest) fail(err error) {
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	if req.err == nil {
+		req.err = err
+	}
+	req.cond.Broadcast()
+}
+
+func (req *fcgiMuxRequest) Read(p []byte) (int, error) {
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	for len(req.pending) == 0 {
+		if req.ended {
+			return 0, io.EOF
+		}
+		if req.err != nil {
+			return 0, req.err
+		}
+		req.cond.Wait()
+	}
+	n := copy(p, req.pending[0])
+	if req.pending[0] = req.pending[0][n:]; len(req.pending[0]) == 0 {
+		req.pending = req.pending[1:]
+	}
+	return n, nil
+}
+
+// Close ends the request. A request whose response hasn't ended yet is
+// aborted with FCGI_ABORT_REQUEST; its ID stays taken until the application
+// confirms with FCGI_END_REQUEST.
+func (req *fcgiMuxRequest) Close() error {
+	req.mu.Lock()
+	if req.closed {
+		req.mu.Unlock()
+		return nil
+	}
+	req.closed = true
+	ended := req.ended
+	req.pending = nil
+	if req.err == nil {
+		req.err = errRequestClosed
+	}
+	req.cond.Broadcast()
+	req.mu.Unlock()
+
+	m := req.mux
+	m.mu.Lock()
+	_, inFlight := m.requests[req.id]
+	m.mu.Unlock()
+	if !ended && inFlight {
+		m.writeRecord(fcgiAbortRequest, req.id, nil, 0)
+	}
+	if req.release != nil {
+		req.release()
+	}
+	return nil
+}
+
+// openMuxRequest opens a request on a multiplexed connection to child with
+// room for it, dialing a new connection if every one is full. Once the
+// application has as many connections as it accepts, the least busy one
+// takes the request. The request releases its connection with releaseMux
+// once it is closed.
+func (s *Spawner) openMuxRequest(child *childProcess) (*fcgiMuxRequest, error) {
+	child.connsMu.Lock()
+	defer child.connsMu.Unlock()
+	_, muxRequests := s.connLimits(child)
+	var mux, leastBusy *fcgiMux
+	open, leastRequests := 0, 0
+	for _, m := range child.muxConns {
+		n, failed := m.state()
+		if failed {
+			continue
+		}
+		if n < muxRequests {
+			mux = m
+			break
+		}
+		if open++; leastBusy == nil || n < leastRequests {
+			leastBusy, leastRequests = m, n
+		}
+	}
+	if mux == nil && child.values != nil && child.values.maxConns > 0 && open >= child.values.maxConns {
+		mux = leastBusy
+	}
+	if mux == nil {
+		m, err := dialFCGIMux(child.socketPath, stderrLogger(child))
+		if err != nil {
+			return nil, err
+		}
+		child.muxConns = append(child.muxConns, m)
+		mux = m
+	}
+	req, err := mux.open()
+	if err != nil {
+		return nil, err
+	}
+	req.release = func() { s.releaseMux(child, mux) }
+	return req, nil
+}
+
+// releaseMux is called once a request on m has been closed. Failed
+// connections are let go, and idle ones are closed, except for the first
+// connection of a child that isn't going away.
+func (s *Spawner) releaseMux(child *childProcess, m *fcgiMux) {
+	child.connsMu.Lock()
+	defer child.connsMu.Unlock()
+	n, failed := m.state()
+	if !failed && (n > 0 || !child.connsClosed && child.muxConns[0] == m) {
+		return
+	}
+	if i := slices.Index(child.muxConns, m); i >= 0 {
+		child.muxConns = slices.Delete(child.muxConns, i, i+1)
+	}
+	m.Close()
+}
+
+// roundTripMux sends a request to child over a multiplexed connection. The
+// application must take the request body and then send the response headers
+// within timeout, unless it is 0. The returned request must be closed once
+// the response body has been read, or to abort it.
+func (s *Spawner) roundTripMux(child *childProcess, params map[string]string, r *http.Request, timeout time.Duration) (*http.Response, io.Closer, error) {
+	req, err := s.openMuxRequest(child)
+	if err != nil {
+		return nil, nil, err
+	}
+	stop := context.AfterFunc(r.Context(), func() { req.fail(r.Context().Err()) })
+	resp, err := req.roundTrip(params, r.Body, timeout)
+	if !stop() {
+		// The client went away.
+		err = r.Context().Err()
+	}
+	if err != nil {
+		req.Close()
+		return nil, nil, err
+	}
+	return resp, req, nil
+}
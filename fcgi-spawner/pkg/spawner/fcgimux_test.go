@@ -0,0 +1,129 @@
+package spawner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProxyRequestMultiplexes(t *testing.T) {
+	const requests = 5
+	var arrived sync.WaitGroup
+	arrived.Add(requests)
+	socketPath, ln := serveFCGI(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		// Every request is in flight before any is answered.
+		arrived.Done()
+		arrived.Wait()
+		fmt.Fprintf(w, "%s", body)
+	})
+	s := NewSpawner(&Config{ConnPoolSize: 4})
+	multiplex := true
+	child := &childProcess{cmd: &mockCmd{path: "/web/app.fcgi"}, socketPath: socketPath, binaryPath: "/web/app.fcgi", app: AppConfig{Multiplex: &multiplex}}
+	defer child.closeConns()
+
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := strings.Repeat(fmt.Sprint(i), 70000)
+			rec := httptest.NewRecorder()
+			s.proxyRequest(rec, httptest.NewRequest(http.MethodPost, "/app.fcgi", strings.NewReader(body)), child, "/app.fcgi", "")
+			if rec.Code != http.StatusOK || rec.Body.String() != body {
+				t.Errorf("request %d = %d, %d bytes, want 200 with its body", i, rec.Code, rec.Body.Len())
+			}
+		}()
+	}
+	wg.Wait()
+	if got := ln.accepted.Load(); got != 1 {
+		t.Errorf("%d connections, want 1", got)
+	}
+}
+
+func TestMultiplexedRequestAborted(t *testing.T) {
+	socketPath, ln := serveFCGI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/endless" {
+			fmt.Fprint(w, "ok")
+			return
+		}
+		// Go's FastCGI server doesn't stop handlers of aborted requests.
+		for range 100 {
+			fmt.Fprint(w, "tick\n")
+			http.NewResponseController(w).Flush()
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	s := NewSpawner(&Config{ConnPoolSize: 4})
+	multiplex := true
+	child := &childProcess{cmd: &mockCmd{path: "/web/app.fcgi"}, socketPath: socketPath, binaryPath: "/web/app.fcgi", app: AppConfig{Multiplex: &multiplex}}
+	defer child.closeConns()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r := httptest.NewRequest(http.MethodGet, "/app.fcgi/endless", nil).WithContext(ctx)
+		s.proxyRequest(httptest.NewRecorder(), r, child, "/app.fcgi", "/endless")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("proxyRequest() kept going after the client went away")
+	}
+
+	// The connection is still good for other requests, which don't get the
+	// output of the aborted one.
+	for range 3 {
+		rec := httptest.NewRecorder()
+		s.proxyRequest(rec, httptest.NewRequest(http.MethodGet, "/app.fcgi", nil), child, "/app.fcgi", "")
+		if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+			t.Errorf("proxyRequest() after abort = %d %q, want 200 ok", rec.Code, rec.Body.String())
+		}
+	}
+	if got := ln.accepted.Load(); got != 1 {
+		t.Errorf("%d connections, want 1", got)
+	}
+}
+
+func TestRoundTripMuxClientGone(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	socketPath, _ := serveFCGI(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	s := NewSpawner(&Config{ConnPoolSize: 4})
+	multiplex := true
+	child := &childProcess{socketPath: socketPath, binaryPath: "/web/app.fcgi", app: AppConfig{Multiplex: &multiplex}}
+	defer child.closeConns()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	errc := make(chan error, 1)
+	go func() {
+		r := httptest.NewRequestWithContext(ctx, http.MethodGet, "/app.fcgi", nil)
+		_, _, err := s.roundTripMux(child, map[string]string{"REQUEST_METHOD": "GET", "SERVER_PROTOCOL": "HTTP/1.1"}, r, 0)
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("roundTripMux() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("roundTripMux() kept waiting after the client went away")
+	}
+}
@@ -0,0 +1,156 @@
+package spawner
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// FastCGI management records querying the capabilities of an application.
+const (
+	fcgiGetValues       = 9
+	fcgiGetValuesResult = 10
+	fcgiUnknownType     = 11
+)
+
+// fcgiValuesTimeout is how long an application may take to answer
+// FCGI_GET_VALUES.
+const fcgiValuesTimeout = 5 * time.Second
+
+// fcgiValues are the capabilities a FastCGI application reports in reply to
+// FCGI_GET_VALUES. Zero limits are unknown.
+type fcgiValues struct {
+	maxConns  int  // FCGI_MAX_CONNS, the connections it accepts at once
+	maxReqs   int  // FCGI_MAX_REQS, the requests it accepts at once
+	mpxsConns bool // FCGI_MPXS_CONNS, whether it multiplexes connections
+}
+
+// decodeParams decodes FastCGI name-value pairs, the reverse of
+// encodeParams.
+func decodeParams(data []byte) (map[string]string, error) {
+	readLength := func() (int, error) {
+		if len(data) == 0 {
+			return 0, errors.New("truncated name-value pair")
+		}
+		if data[0]&0x80 == 0 {
+			n := int(data[0])
+			data = data[1:]
+			return n, nil
+		}
+		if len(data) < 4 {
+			return 0, errors.New("truncated name-value pair")
+		}
+		n := int(binary.BigEndian.Uint32(data) &^ (1 << 31))
+		data = data[4:]
+		return n, nil
+	}
+	params := make(map[string]string)
+	for len(data) > 0 {
+		nameLen, err := readLength()
+		if err != nil {
+			return nil, err
+		}
+		valueLen, err := readLength()
+		if err != nil {
+			return nil, err
+		}
+		if nameLen+valueLen > len(data) {
+			return nil, errors.New("truncated name-value pair")
+		}
+		params[string(data[:nameLen])] = string(data[nameLen : nameLen+valueLen])
+		data = data[nameLen+valueLen:]
+	}
+	return params, nil
+}
+
+// queryValues asks the FastCGI application listening on socketPath for its
+// capabilities with FCGI_GET_VALUES, which it must answer within timeout.
+func queryValues(socketPath string, timeout time.Duration) (fcgiValues, error) {
+	conn, err := net.DialTimeout("unix", socketPath, timeout)
+	if err != nil {
+		return fcgiValues{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	query := encodeParams(map[string]string{"FCGI_MAX_CONNS": "", "FCGI_MAX_REQS": "", "FCGI_MPXS_CONNS": ""})
+	if err := writeFCGIRecord(conn, fcgiGetValues, 0, query); err != nil {
+		return fcgiValues{}, err
+	}
+	r := bufio.NewReader(conn)
+	for {
+		recType, _, content, err := readFCGIRecord(r, func() {})
+		if err != nil {
+			return fcgiValues{}, err
+		}
+		switch recType {
+		case fcgiUnknownType:
+			return fcgiValues{}, errors.New("FCGI_GET_VALUES not supported")
+		case fcgiGetValuesResult:
+			params, err := decodeParams(content)
+			if err != nil {
+				return fcgiValues{}, fmt.Errorf("invalid FCGI_GET_VALUES_RESULT: %v", err)
+			}
+			var values fcgiValues
+			values.maxConns, _ = strconv.Atoi(params["FCGI_MAX_CONNS"])
+			values.maxReqs, _ = strconv.Atoi(params["FCGI_MAX_REQS"])
+			values.mpxsConns = params["FCGI_MPXS_CONNS"] == "1"
+			return values, nil
+		}
+	}
+}
+
+// negotiate queries the capabilities of child, a new process of a FastCGI
+// application, which size its connection pool and decide whether its
+// requests are multiplexed. Until they are known, or if the application
+// doesn't answer, requests go over connections of their own, unless
+// AppConfig.Multiplex asks for multiplexing.
+func (s *Spawner) negotiate(child *childProcess) {
+	values, err := queryValues(child.socketPath, fcgiValuesTimeout)
+	if err != nil {
+		spawnLog.Debug("Application didn't report its FastCGI capabilities", "app", child.binaryPath, "error", err)
+		return
+	}
+	spawnLog.Debug("Application reported its FastCGI capabilities", "app", child.binaryPath, "maxConns", values.maxConns, "maxReqs", values.maxReqs, "multiplexing", values.mpxsConns)
+	if child.app.Multiplex != nil && *child.app.Multiplex && !values.mpxsConns {
+		spawnLog.Warn("Application doesn't support multiplexing, sending requests over connections of their own", "app", child.binaryPath)
+	}
+	child.connsMu.Lock()
+	child.values = &values
+	child.connsMu.Unlock()
+}
+
+// multiplexed reports whether the requests to child are multiplexed: if the
+// application supports it, unless AppConfig.Multiplex is false, and, as long
+// as it hasn't said whether it does, if AppConfig.Multiplex is true.
+func (child *childProcess) multiplexed() bool {
+	if child.app.Multiplex != nil && !*child.app.Multiplex {
+		return false
+	}
+	child.connsMu.Lock()
+	values := child.values
+	child.connsMu.Unlock()
+	if values != nil {
+		return values.mpxsConns
+	}
+	return child.app.Multiplex != nil
+}
+
+// connLimits returns the number of idle connections kept open to child, and
+// the requests in flight at once on a multiplexed connection, as limited by
+// what the application reported. It must be called with connsMu held.
+func (s *Spawner) connLimits(child *childProcess) (poolSize, muxRequests int) {
+	poolSize, muxRequests = s.Config.ConnPoolSize, fcgiMuxRequests
+	if values := child.values; values != nil {
+		if values.maxConns > 0 {
+			poolSize = min(poolSize, values.maxConns)
+		}
+		if values.maxReqs > 0 {
+			muxRequests = min(muxRequests, values.maxReqs)
+		}
+	}
+	return poolSize, muxRequests
+}
@@ -0,0 +1,73 @@
+package spawner
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDecodeParams(t *testing.T) {
+	params := map[string]string{"FCGI_MPXS_CONNS": "1", "LONG": string(make([]byte, 300)), "EMPTY": ""}
+	got, err := decodeParams(encodeParams(params))
+	if err != nil {
+		t.Fatalf("decodeParams() error = %v", err)
+	}
+	if len(got) != len(params) {
+		t.Fatalf("decodeParams() = %d pairs, want %d", len(got), len(params))
+	}
+	for name, value := range params {
+		if got[name] != value {
+			t.Errorf("decodeParams()[%q] = %q, want %q", name, got[name], value)
+		}
+	}
+	if _, err := decodeParams([]byte{5, 1, 'a'}); err == nil {
+		t.Error("decodeParams() of a truncated pair succeeded")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	socketPath, _ := serveFCGI(t, func(w http.ResponseWriter, r *http.Request) {})
+	values, err := queryValues(socketPath, time.Second)
+	if err != nil {
+		t.Fatalf("queryValues() error = %v", err)
+	}
+	// Go's FastCGI server only reports that it multiplexes connections.
+	if want := (fcgiValues{mpxsConns: true}); values != want {
+		t.Errorf("queryValues() = %+v, want %+v", values, want)
+	}
+
+	off := false
+	tests := []struct {
+		name      string
+		multiplex *bool
+		want      bool
+	}{
+		{name: "automatic", want: true},
+		{name: "disabled", multiplex: &off, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSpawner(&Config{ConnPoolSize: 4})
+			child := &childProcess{cmd: &mockCmd{path: "/web/app.fcgi"}, socketPath: socketPath, binaryPath: "/web/app.fcgi", app: AppConfig{Multiplex: tt.multiplex}}
+			if child.multiplexed() {
+				t.Error("multiplexed() = true before negotiating")
+			}
+			s.negotiate(child)
+			if got := child.multiplexed(); got != tt.want {
+				t.Errorf("multiplexed() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnLimits(t *testing.T) {
+	s := NewSpawner(&Config{ConnPoolSize: 4})
+	child := &childProcess{values: &fcgiValues{maxConns: 2, maxReqs: 10}}
+	if poolSize, muxRequests := s.connLimits(child); poolSize != 2 || muxRequests != 10 {
+		t.Errorf("connLimits() = %d, %d, want 2, 10", poolSize, muxRequests)
+	}
+	child.values = &fcgiValues{}
+	if poolSize, muxRequests := s.connLimits(child); poolSize != 4 || muxRequests != fcgiMuxRequests {
+		t.Errorf("connLimits() = %d, %d, want 4, %d", poolSize, muxRequests, fcgiMuxRequests)
+	}
+}
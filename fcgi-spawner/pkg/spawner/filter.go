@@ -0,0 +1,137 @@
+package spawner
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DenyRule rejects the requests matching all of its conditions before they
+// are routed, e.g. TRACE requests, encoded path traversal or the user agents
+// of vulnerability scanners. At least one condition must be set.
+type DenyRule struct {
+	// Name identifies the rule in the log; by default it's its position.
+	Name string `yaml:"name"`
+	// Methods matches requests with one of these methods, e.g. TRACE.
+	Methods []string `yaml:"methods"`
+	// Regex matches the request target as the client sent it, the path with
+	// its percent-escapes followed by the query, e.g. (?i)\.\.%2f.
+	Regex string `yaml:"regex"`
+	// Headers match requests with a value of the header matching the regular
+	// expression, by header name, e.g. User-Agent: (?i)sqlmap|nikto.
+	Headers map[string]string `yaml:"headers"`
+	// MaxBodySize matches requests with a body larger than this many bytes.
+	// Bodies of unknown length are cut off there.
+	MaxBodySize int64 `yaml:"maxBodySize"`
+
+	re      *regexp.Regexp
+	headers map[string]*regexp.Regexp // Canonical header name to value
+}
+
+// validateDeny checks the deny rules and compiles their regular expressions.
+func (c *Config) validateDeny() error {
+	for i := range c.Deny {
+		rule := &c.Deny[i]
+		if len(rule.Methods) == 0 && rule.Regex == "" && len(rule.Headers) == 0 && rule.MaxBodySize == 0 {
+			return fmt.Errorf("deny rule %d: no methods, regex, headers or maxBodySize to match", i+1)
+		}
+		if rule.MaxBodySize < 0 {
+			return fmt.Errorf("deny rule %d: maxBodySize %d is negative", i+1, rule.MaxBodySize)
+		}
+		if rule.Regex != "" {
+			re, err := regexp.Compile(rule.Regex)
+			if err != nil {
+				return fmt.Errorf("deny rule %d: %v", i+1, err)
+			}
+			rule.re = re
+		}
+		rule.headers = make(map[string]*regexp.Regexp, len(rule.Headers))
+		for name, expr := range rule.Headers {
+			if name == "" {
+				return fmt.Errorf("deny rule %d: empty header name", i+1)
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("deny rule %d: header %s: %v", i+1, name, err)
+			}
+			rule.headers[http.CanonicalHeaderKey(name)] = re
+		}
+	}
+	return nil
+}
+
+// name returns the name of the rule at index i for the log.
+func (rule *DenyRule) name(i int) string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return fmt.Sprintf("deny rule %d", i+1)
+}
+
+// match reports whether the rule matches r apart from its body size, which
+// is only known while the body is read.
+func (rule *DenyRule) match(r *http.Request) bool {
+	if len(rule.Methods) > 0 && !slices.ContainsFunc(rule.Methods, func(method string) bool { return strings.EqualFold(method, r.Method) }) {
+		return false
+	}
+	if rule.re != nil && !rule.re.MatchString(requestTarget(r)) {
+		return false
+	}
+	for name, re := range rule.headers {
+		values := r.Header.Values(name)
+		if name == "Host" {
+			values = []string{r.Host}
+		}
+		if !slices.ContainsFunc(values, re.MatchString) {
+			return false
+		}
+	}
+	return true
+}
+
+// denyMiddleware applies the deny rules before next routes the requests,
+// which would redirect paths like /a/..%2fb to their cleaned version.
+func (s *Spawner) denyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r = s.filterRequest(w, r); r != nil {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// filterRequest applies the deny rules to r. It answers requests a rule
+// denies itself and returns nil; bodies of unknown length of requests that
+// a rule with MaxBodySize otherwise matches are limited in the returned
+// request.
+func (s *Spawner) filterRequest(w http.ResponseWriter, r *http.Request) *http.Request {
+	target := requestTarget(r)
+	for i := range s.Config.Deny {
+		rule := &s.Config.Deny[i]
+		if !rule.match(r) {
+			continue
+		}
+		if rule.MaxBodySize == 0 {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			proxyLog.Warn("Denied request", "rule", rule.name(i), "method", r.Method, "target", target, "remote", r.RemoteAddr)
+			return nil
+		}
+		if r.ContentLength > rule.MaxBodySize {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			proxyLog.Warn("Denied request with a large body", "rule", rule.name(i), "method", r.Method, "target", target, "remote", r.RemoteAddr, "size", r.ContentLength)
+			return nil
+		}
+		if r.ContentLength < 0 {
+			// Reading past the limit fails, failing the request.
+			r.Body = http.MaxBytesReader(w, r.Body, rule.MaxBodySize)
+		}
+	}
+	return r
+}
+
+// requestTarget returns the request target of r as the client sent it.
+func requestTarget(r *http.Request) string {
+	return cmp.Or(r.RequestURI, r.URL.RequestURI())
+}
@@ -0,0 +1,88 @@
+package spawner
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDenyRules(t *testing.T) {
+	cfg := &Config{WebRoot: t.TempDir(), Deny: []DenyRule{
+		{Name: "trace", Methods: []string{"trace"}},
+		{Regex: `(?i)\.\.%2f`},
+		{Headers: map[string]string{"user-agent": `(?i)sqlmap|nikto`}},
+		{Regex: `^/upload`, MaxBodySize: 4},
+	}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	s := NewSpawner(cfg)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		userAgent  string
+		body       string
+		wantStatus int
+	}{
+		{"allowed", http.MethodGet, "/missing", "curl/8.0", "", http.StatusNotFound},
+		{"method", "TRACE", "/missing", "", "", http.StatusForbidden},
+		{"encoded traversal", http.MethodGet, "/a/..%2Fetc/passwd", "", "", http.StatusForbidden},
+		{"user agent", http.MethodGet, "/missing", "sqlmap/1.7", "", http.StatusForbidden},
+		{"small body", http.MethodPost, "/upload", "", "abc", http.StatusNotFound},
+		{"large body", http.MethodPost, "/upload", "", "abcdef", http.StatusRequestEntityTooLarge},
+		{"large body elsewhere", http.MethodPost, "/other", "", "abcdef", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.userAgent != "" {
+				req.Header.Set("User-Agent", tt.userAgent)
+			}
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s %s: status = %d, want %d", tt.method, tt.target, rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestDenyRulesLimitUnknownBodySize(t *testing.T) {
+	cfg := &Config{WebRoot: t.TempDir(), Deny: []DenyRule{{MaxBodySize: 4}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	s := NewSpawner(cfg)
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("abcdef"))
+	req.ContentLength = -1
+	r := s.filterRequest(httptest.NewRecorder(), req)
+	if r == nil {
+		t.Fatal("filterRequest() denied a body of unknown length")
+	}
+	if _, err := io.ReadAll(r.Body); err == nil {
+		t.Error("Reading a body of unknown length past maxBodySize succeeded")
+	}
+}
+
+func TestValidateDeny(t *testing.T) {
+	tests := []struct {
+		rule    DenyRule
+		wantErr bool
+	}{
+		{DenyRule{Methods: []string{"TRACE"}}, false},
+		{DenyRule{}, true},
+		{DenyRule{Regex: "("}, true},
+		{DenyRule{Headers: map[string]string{"User-Agent": "["}}, true},
+		{DenyRule{MaxBodySize: -1}, true},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Deny: []DenyRule{tt.rule}}
+		if err := cfg.validateDeny(); (err != nil) != tt.wantErr {
+			t.Errorf("validateDeny() of %+v error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package spawner
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// trustUnixPeers is the entry of Config.TrustedProxies trusting every client
+// connecting over the unix socket the spawner listens on.
+const trustUnixPeers = "unix"
+
+// validateTrustedProxies parses Config.TrustedProxies.
+func (c *Config) validateTrustedProxies() error {
+	c.trustedProxies, c.trustUnixPeers = nil, false
+	for _, entry := range strings.Split(c.TrustedProxies, ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+		case entry == trustUnixPeers:
+			c.trustUnixPeers = true
+		case strings.Contains(entry, "/"):
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy %q: %v", entry, err)
+			}
+			c.trustedProxies = append(c.trustedProxies, prefix.Masked())
+		default:
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy %q: %v", entry, err)
+			}
+			c.trustedProxies = append(c.trustedProxies, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return nil
+}
+
+// isTrustedProxy reports whether addr belongs to a trusted proxy.
+func (c *Config) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range c.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromTrustedProxy reports whether r was sent by a trusted proxy, whose
+// X-Forwarded-* headers can be believed.
+func (c *Config) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// Connections over a unix socket have no address.
+		return c.trustUnixPeers
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && c.isTrustedProxy(addr)
+}
+
+// clientInfo describes where a request comes from and where it was sent to,
+// as seen by the client.
+type clientInfo struct {
+	addr, port string // Empty port if the request was forwarded
+	https      bool
+	serverPort string
+}
+
+// clientInfo returns the client of r. For requests from a trusted proxy the
+// client address, scheme and port are taken from the X-Forwarded-For,
+// X-Forwarded-Proto and X-Forwarded-Port headers.
+func (s *Spawner) clientInfo(r *http.Request) clientInfo {
+	info := clientInfo{https: r.TLS != nil}
+	var err error
+	if info.addr, info.port, err = net.SplitHostPort(r.RemoteAddr); err != nil {
+		info.addr = r.RemoteAddr
+	}
+	if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if _, port, err := net.SplitHostPort(local.String()); err == nil {
+			info.serverPort = port
+		}
+	}
+	if s.Config.fromTrustedProxy(r) {
+		if client := s.forwardedFor(r); client != "" {
+			info.addr, info.port = client, ""
+		}
+		switch strings.ToLower(firstHeaderValue(r, "X-Forwarded-Proto")) {
+		case "https":
+			info.https, info.serverPort = true, "443"
+		case "http":
+			info.https, info.serverPort = false, "80"
+		}
+		if port := firstHeaderValue(r, "X-Forwarded-Port"); port != "" {
+			if _, err := strconv.ParseUint(port, 10, 16); err == nil {
+				info.serverPort = port
+			}
+		}
+	}
+	if info.serverPort == "" {
+		// Listening on a unix socket.
+		info.serverPort = "80"
+		if info.https {
+			info.serverPort = "443"
+		}
+	}
+	return info
+}
+
+// forwardedFor returns the client address from the X-Forwarded-For header of
+// r, which comes from a trusted proxy: the last address that isn't a trusted
+// proxy itself, as earlier ones may have been made up by the client.
+func (s *Spawner) forwardedFor(r *http.Request) string {
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap().String()
+		if !s.Config.isTrustedProxy(addr) {
+			break
+		}
+	}
+	return client
+}
+
+// firstHeaderValue returns the first of the comma-separated values of the
+// header name, as added by the proxy closest to the client.
+func firstHeaderValue(r *http.Request, name string) string {
+	value, _, _ := strings.Cut(r.Header.Get(name), ",")
+	return strings.TrimSpace(value)
+}
+
+// setForwardedHeaders sets the X-Forwarded-* headers of out, a request
+// proxied to an application speaking HTTP, from in. The headers of in are
+// only kept if it comes from a trusted proxy.
+func (s *Spawner) setForwardedHeaders(out http.Header, in *http.Request) {
+	trusted := s.Config.fromTrustedProxy(in)
+	forwardedFor := ""
+	if trusted {
+		forwardedFor = strings.Join(in.Header.Values("X-Forwarded-For"), ", ")
+	}
+	if host, _, err := net.SplitHostPort(in.RemoteAddr); err == nil {
+		if forwardedFor != "" {
+			forwardedFor += ", "
+		}
+		forwardedFor += host
+	}
+	if forwardedFor != "" {
+		out.Set("X-Forwarded-For", forwardedFor)
+	}
+	host := in.Host
+	if forwardedHost := firstHeaderValue(in, "X-Forwarded-Host"); trusted && forwardedHost != "" {
+		host = forwardedHost
+	}
+	out.Set("X-Forwarded-Host", host)
+	if s.clientInfo(in).https {
+		out.Set("X-Forwarded-Proto", "https")
+	} else {
+		out.Set("X-Forwarded-Proto", "http")
+	}
+}
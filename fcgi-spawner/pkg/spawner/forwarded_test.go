@@ -0,0 +1,137 @@
+package spawner
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateTrustedProxies(t *testing.T) {
+	for _, proxies := range []string{"", "127.0.0.1", "10.0.0.0/8, ::1, unix"} {
+		cfg := Config{TrustedProxies: proxies}
+		if err := cfg.validateTrustedProxies(); err != nil {
+			t.Errorf("validateTrustedProxies(%q) error = %v", proxies, err)
+		}
+	}
+	for _, proxies := range []string{"localhost", "10.0.0.0/33"} {
+		cfg := Config{TrustedProxies: proxies}
+		if err := cfg.validateTrustedProxies(); err == nil {
+			t.Errorf("validateTrustedProxies(%q) accepted an invalid entry", proxies)
+		}
+	}
+}
+
+func TestClientInfo(t *testing.T) {
+	cfg := &Config{TrustedProxies: "10.0.0.0/8,unix"}
+	if err := cfg.validateTrustedProxies(); err != nil {
+		t.Fatalf("validateTrustedProxies() error = %v", err)
+	}
+	s := NewSpawner(cfg)
+	local := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9000}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		tls        bool
+		headers    map[string]string
+		want       clientInfo
+	}{
+		{
+			name:       "direct",
+			remoteAddr: "192.0.2.1:50000",
+			want:       clientInfo{addr: "192.0.2.1", port: "50000", serverPort: "9000"},
+		},
+		{
+			name:       "direct over TLS",
+			remoteAddr: "192.0.2.1:50000",
+			tls:        true,
+			want:       clientInfo{addr: "192.0.2.1", port: "50000", https: true, serverPort: "9000"},
+		},
+		{
+			name:       "untrusted client with forged headers",
+			remoteAddr: "192.0.2.1:50000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7", "X-Forwarded-Proto": "https"},
+			want:       clientInfo{addr: "192.0.2.1", port: "50000", serverPort: "9000"},
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.0.0.2:40000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7", "X-Forwarded-Proto": "https"},
+			want:       clientInfo{addr: "198.51.100.7", https: true, serverPort: "443"},
+		},
+		{
+			name:       "chain of proxies",
+			remoteAddr: "10.0.0.2:40000",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.9, 198.51.100.7, 10.0.0.3", "X-Forwarded-Proto": "http", "X-Forwarded-Port": "8080"},
+			want:       clientInfo{addr: "198.51.100.7", serverPort: "8080"},
+		},
+		{
+			name:       "unix socket",
+			remoteAddr: "@",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7", "X-Forwarded-Proto": "https"},
+			want:       clientInfo{addr: "198.51.100.7", https: true, serverPort: "443"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, net.Addr(local)))
+			r.RemoteAddr = tt.remoteAddr
+			if !tt.tls {
+				r.TLS = nil
+			} else {
+				r.TLS = &tls.ConnectionState{}
+			}
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := s.clientInfo(r); got != tt.want {
+				t.Errorf("clientInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetForwardedHeaders(t *testing.T) {
+	cfg := &Config{TrustedProxies: "10.0.0.0/8"}
+	if err := cfg.validateTrustedProxies(); err != nil {
+		t.Fatalf("validateTrustedProxies() error = %v", err)
+	}
+	s := NewSpawner(cfg)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       http.Header
+	}{
+		{
+			name:       "untrusted",
+			remoteAddr: "192.0.2.1:50000",
+			want:       http.Header{"X-Forwarded-For": {"192.0.2.1"}, "X-Forwarded-Host": {"example.com"}, "X-Forwarded-Proto": {"http"}},
+		},
+		{
+			name:       "trusted",
+			remoteAddr: "10.0.0.2:40000",
+			want:       http.Header{"X-Forwarded-For": {"198.51.100.7, 10.0.0.2"}, "X-Forwarded-Host": {"www.example.com"}, "X-Forwarded-Proto": {"https"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r.Header.Set("X-Forwarded-For", "198.51.100.7")
+			r.Header.Set("X-Forwarded-Host", "www.example.com")
+			r.Header.Set("X-Forwarded-Proto", "https")
+			out := http.Header{}
+			s.setForwardedHeaders(out, r)
+			for name, want := range tt.want {
+				if got := out.Get(name); got != want[0] {
+					t.Errorf("%s = %q, want %q", name, got, want[0])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package spawner
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoipCheckInterval is how often a GeoIP database is checked for a new
+// version, as installed by geoipupdate.
+const geoipCheckInterval = time.Minute
+
+// geoipLanguage is the language of the names looked up.
+const geoipLanguage = "en"
+
+// geoipRecord is what is looked up in MaxMind databases: GeoIP2 and
+// GeoLite2 Country, City and ASN ones, or others using the same fields.
+type geoipRecord struct {
+	Continent struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"continent"`
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+		TimeZone  string   `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+	ASN          uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// params returns the GEOIP_* variables of the record that it has.
+func (g *geoipRecord) params() map[string]string {
+	params := map[string]string{
+		"GEOIP_CONTINENT_CODE": g.Continent.Code,
+		"GEOIP_COUNTRY_CODE":   g.Country.ISOCode,
+		"GEOIP_COUNTRY_NAME":   g.Country.Names[geoipLanguage],
+		"GEOIP_CITY":           g.City.Names[geoipLanguage],
+		"GEOIP_POSTAL_CODE":    g.Postal.Code,
+		"GEOIP_TIME_ZONE":      g.Location.TimeZone,
+		"GEOIP_ORGANIZATION":   g.Organization,
+	}
+	if len(g.Subdivisions) > 0 {
+		params["GEOIP_REGION"] = g.Subdivisions[0].ISOCode
+		params["GEOIP_REGION_NAME"] = g.Subdivisions[0].Names[geoipLanguage]
+	}
+	if g.Location.Latitude != nil && g.Location.Longitude != nil {
+		params["GEOIP_LATITUDE"] = strconv.FormatFloat(*g.Location.Latitude, 'f', -1, 64)
+		params["GEOIP_LONGITUDE"] = strconv.FormatFloat(*g.Location.Longitude, 'f', -1, 64)
+	}
+	if g.ASN != 0 {
+		params["GEOIP_ASN"] = strconv.FormatUint(uint64(g.ASN), 10)
+	}
+	return params
+}
+
+// geoipPaths returns the files of GeoIPDatabases.
+func (c *Config) geoipPaths() []string {
+	var paths []string
+	for _, path := range strings.Split(c.GeoIPDatabases, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// validateGeoIP checks that GeoIPDatabases are MaxMind databases.
+func (c *Config) validateGeoIP() error {
+	for _, path := range c.geoipPaths() {
+		if _, err := openGeoIPDatabase(path); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// openGeoIPDatabase reads the MaxMind database at path into memory, so that
+// it can be replaced without disturbing lookups in progress.
+func openGeoIPDatabase(path string) (*maxminddb.Reader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return maxminddb.FromBytes(data)
+}
+
+// geoipDatabase is a MaxMind database, reloaded when its file changes.
+type geoipDatabase struct {
+	path    string
+	mu      sync.Mutex
+	reader  *maxminddb.Reader // Nil until loaded, or if it can't be
+	modTime time.Time         // Of the file loaded
+	checked time.Time         // When the file was last looked at
+}
+
+// newGeoIPDatabases returns the databases of cfg, loaded on first use.
+func newGeoIPDatabases(cfg *Config) []*geoipDatabase {
+	var dbs []*geoipDatabase
+	for _, path := range cfg.geoipPaths() {
+		dbs = append(dbs, &geoipDatabase{path: path})
+	}
+	return dbs
+}
+
+// current returns the reader of the latest version of the database, or nil
+// if it can't be loaded. The file is looked at every geoipCheckInterval.
+func (db *geoipDatabase) current() *maxminddb.Reader {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if time.Since(db.checked) < geoipCheckInterval {
+		return db.reader
+	}
+	db.checked = time.Now()
+	info, err := os.Stat(db.path)
+	if err != nil {
+		proxyLog.Warn("GeoIP database is unavailable", "path", db.path, "error", err)
+		return db.reader
+	}
+	if db.reader != nil && info.ModTime().Equal(db.modTime) {
+		return db.reader
+	}
+	reader, err := openGeoIPDatabase(db.path)
+	if err != nil {
+		proxyLog.Warn("Failed to load GeoIP database", "path", db.path, "error", err)
+		return db.reader
+	}
+	if db.reader != nil {
+		proxyLog.Info("Reloaded GeoIP database", "path", db.path)
+	}
+	db.reader, db.modTime = reader, info.ModTime()
+	return db.reader
+}
+
+// geoipParams adds the GEOIP_* variables of the client address addr found
+// in the GeoIP databases to env. The first database having a variable wins.
+func (s *Spawner) geoipParams(env map[string]string, addr string) {
+	if len(s.geoip) == 0 {
+		return
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		// e.g. a client on a unix socket
+		return
+	}
+	for _, db := range s.geoip {
+		reader := db.current()
+		if reader == nil {
+			continue
+		}
+		var record geoipRecord
+		if err := reader.Lookup(ip, &record); err != nil {
+			proxyLog.Debug("GeoIP lookup failed", "path", db.path, "addr", addr, "error", err)
+			continue
+		}
+		for name, value := range record.params() {
+			if _, ok := env[name]; !ok && value != "" {
+				env[name] = value
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package spawner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mmdbMap is a map of the MaxMind DB format, as keys followed by values.
+type mmdbMap []any
+
+// mmdbEncode encodes v in the data section format of MaxMind databases.
+func mmdbEncode(v any) []byte {
+	control := func(typ, size int) []byte {
+		var extra []byte
+		if size >= 29 {
+			size, extra = 29, []byte{byte(size - 29)}
+		}
+		if typ > 7 {
+			// Extended type
+			return append([]byte{byte(size), byte(typ - 7)}, extra...)
+		}
+		return append([]byte{byte(typ<<5 | size)}, extra...)
+	}
+	uint := func(typ int, n uint64) []byte {
+		var b []byte
+		for ; n > 0; n >>= 8 {
+			b = append([]byte{byte(n)}, b...)
+		}
+		return append(control(typ, len(b)), b...)
+	}
+	switch v := v.(type) {
+	case string:
+		return append(control(2, len(v)), v...)
+	case float64:
+		return binary.BigEndian.AppendUint64(control(3, 8), math.Float64bits(v))
+	case uint16:
+		return uint(5, uint64(v))
+	case uint32:
+		return uint(6, uint64(v))
+	case uint64:
+		return uint(9, v)
+	case []any:
+		b := control(11, len(v))
+		for _, e := range v {
+			b = append(b, mmdbEncode(e)...)
+		}
+		return b
+	case mmdbMap:
+		b := control(7, len(v)/2)
+		for _, e := range v {
+			b = append(b, mmdbEncode(e)...)
+		}
+		return b
+	}
+	panic("unsupported value")
+}
+
+// writeMMDB writes an IPv4 MaxMind database in which the addresses of the
+// 24-bit network prefix have the record data, to a file in dir.
+func writeMMDB(t *testing.T, dir string, prefix [3]byte, data mmdbMap) string {
+	t.Helper()
+	// A node per bit of the prefix, with 24-bit records; the last one points
+	// to the data. Records equal to the node count mean no data.
+	const nodeCount = 24
+	var db bytes.Buffer
+	for i := 0; i < nodeCount; i++ {
+		next := uint32(i + 1)
+		if i == nodeCount-1 {
+			next = nodeCount + 16 // The data, right after the separator
+		}
+		left, right := next, uint32(nodeCount)
+		if prefix[i/8]&(0x80>>(i%8)) != 0 {
+			left, right = right, left
+		}
+		db.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)})
+	}
+	db.Write(make([]byte, 16))
+	db.Write(mmdbEncode(data))
+	db.WriteString("\xab\xcd\xefMaxMind.com")
+	db.Write(mmdbEncode(mmdbMap{
+		"node_count", uint32(nodeCount),
+		"record_size", uint16(24),
+		"ip_version", uint16(4),
+		"database_type", "Test",
+		"binary_format_major_version", uint16(2),
+		"binary_format_minor_version", uint16(0),
+		"build_epoch", uint64(1700000000),
+	}))
+	path := filepath.Join(dir, "test.mmdb")
+	if err := os.WriteFile(path, db.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write database: %v", err)
+	}
+	return path
+}
+
+func TestGeoIPParams(t *testing.T) {
+	names := func(name string) mmdbMap { return mmdbMap{"en", name} }
+	city := writeMMDB(t, t.TempDir(), [3]byte{1, 2, 3}, mmdbMap{
+		"continent", mmdbMap{"code", "EU"},
+		"country", mmdbMap{"iso_code", "FR", "names", names("France")},
+		"subdivisions", []any{mmdbMap{"iso_code", "IDF", "names", names("Île-de-France")}},
+		"city", mmdbMap{"names", names("Paris")},
+		"postal", mmdbMap{"code", "75001"},
+		"location", mmdbMap{"latitude", 48.8566, "longitude", 2.3522, "time_zone", "Europe/Paris"},
+	})
+	asn := writeMMDB(t, t.TempDir(), [3]byte{1, 2, 3}, mmdbMap{
+		"autonomous_system_number", uint32(64500),
+		"autonomous_system_organization", "Example Networks",
+	})
+	cfg := &Config{GeoIPDatabases: city + ", " + asn}
+	if err := cfg.validateGeoIP(); err != nil {
+		t.Fatalf("validateGeoIP() error = %v", err)
+	}
+	s := NewSpawner(cfg)
+
+	r := httptest.NewRequest(http.MethodGet, "/app.fcgi", nil)
+	r.RemoteAddr = "1.2.3.4:5678"
+	env := s.requestParams(r, "/web/app.fcgi", "/app.fcgi", "")
+	want := map[string]string{
+		"GEOIP_CONTINENT_CODE": "EU",
+		"GEOIP_COUNTRY_CODE":   "FR",
+		"GEOIP_COUNTRY_NAME":   "France",
+		"GEOIP_REGION":         "IDF",
+		"GEOIP_REGION_NAME":    "Île-de-France",
+		"GEOIP_CITY":           "Paris",
+		"GEOIP_POSTAL_CODE":    "75001",
+		"GEOIP_LATITUDE":       "48.8566",
+		"GEOIP_LONGITUDE":      "2.3522",
+		"GEOIP_TIME_ZONE":      "Europe/Paris",
+		"GEOIP_ASN":            "64500",
+		"GEOIP_ORGANIZATION":   "Example Networks",
+	}
+	for name, value := range want {
+		if env[name] != value {
+			t.Errorf("%s = %q, want %q", name, env[name], value)
+		}
+	}
+
+	// Addresses that aren't in the databases get no variables.
+	r.RemoteAddr = "5.6.7.8:5678"
+	for name, value := range s.requestParams(r, "/web/app.fcgi", "/app.fcgi", "") {
+		if _, ok := want[name]; ok {
+			t.Errorf("%s = %q for an unknown address", name, value)
+		}
+	}
+}
+
+func TestValidateGeoIP(t *testing.T) {
+	invalid := filepath.Join(t.TempDir(), "invalid.mmdb")
+	if err := os.WriteFile(invalid, []byte("not a database"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	for _, path := range []string{invalid, filepath.Join(t.TempDir(), "missing.mmdb")} {
+		cfg := &Config{GeoIPDatabases: path}
+		if err := cfg.validateGeoIP(); err == nil {
+			t.Errorf("validateGeoIP() accepted %s", filepath.Base(path))
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package spawner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// childStatus describes a running child process.
+type childStatus struct {
+	App      string    `json:"app"`
+	Instance int       `json:"instance"`
+	PID      int       `json:"pid"`
+	Socket   string    `json:"socket,omitempty"`
+	LastUsed time.Time `json:"lastUsed"`
+	Active   int       `json:"active"`
+}
+
+type healthResponse struct {
+	Status   string        `json:"status"`
+	Uptime   string        `json:"uptime"`
+	Children []childStatus `json:"children"`
+	Failing  []failingApp  `json:"failing,omitempty"`
+	Errors   []string      `json:"errors,omitempty"`
+}
+
+// children returns the status of all running child processes, ordered by app
+// and instance.
+func (s *Spawner) children() []childStatus {
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+
+	children := make([]childStatus, 0, len(s.childProcesses))
+	for key, child := range s.childProcesses {
+		status := childStatus{
+			App:      key,
+			Instance: child.instance,
+			LastUsed: child.lastUsed,
+			Active:   child.active,
+		}
+		if child.binaryPath != "" {
+			status.App = child.binaryPath
+		}
+		if child.cmd.Process() != nil {
+			status.PID = child.cmd.Process().Pid()
+		}
+		if child.listener == nil {
+			status.Socket = child.socketPath
+		}
+		children = append(children, status)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].App != children[j].App {
+			return children[i].App < children[j].App
+		}
+		return children[i].Instance < children[j].Instance
+	})
+	return children
+}
+
+// readinessErrors returns the reasons why the spawner can't serve
+// applications, if any.
+func (s *Spawner) readinessErrors() []string {
+	var errs []string
+	for _, webRoot := range s.webRoots() {
+		if info, err := os.Stat(webRoot); err != nil {
+			errs = append(errs, fmt.Sprintf("webRoot: %v", err))
+		} else if !info.IsDir() {
+			errs = append(errs, fmt.Sprintf("webRoot: %s is not a directory", webRoot))
+		}
+	}
+	if s.Config.SocketDir != "" {
+		if err := os.MkdirAll(s.Config.SocketDir, 0755); err != nil {
+			errs = append(errs, fmt.Sprintf("socketDir: %v", err))
+		}
+	}
+	if s.prewarming.Load() {
+		errs = append(errs, "prewarming applications")
+	}
+	if s.isStopping() {
+		errs = append(errs, "shutting down")
+	}
+	return errs
+}
+
+// handleHealthz reports that the spawner is alive, along with a summary of
+// its child processes.
+func (s *Spawner) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	s.writeHealth(w, r, nil)
+}
+
+// handleReadyz reports whether the spawner can serve applications. It responds
+// with 503 if the web root or the socket directory are unusable, while the
+// apps to prewarm are started and once the spawner is stopping, so that a
+// load balancer stops sending traffic.
+func (s *Spawner) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	s.writeHealth(w, r, s.readinessErrors())
+}
+
+func (s *Spawner) writeHealth(w http.ResponseWriter, r *http.Request, errs []string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := healthResponse{
+		Status:   "ok",
+		Uptime:   time.Since(s.startedAt).Round(time.Second).String(),
+		Children: s.children(),
+		Failing:  s.failingApps(),
+		Errors:   errs,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if len(errs) > 0 {
+		resp.Status = "unavailable"
+		adminLog.Warn("Readiness check failed", "errors", errs)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		adminLog.Error("Failed to encode health response", "error", err)
+	}
+}
@@ -0,0 +1,61 @@
+package spawner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHealthHandlers(t *testing.T) {
+	webRoot := t.TempDir()
+	s := NewSpawner(&Config{WebRoot: webRoot})
+	s.childProcesses = map[string]*childProcess{
+		"/web/app.fcgi#1": {
+			cmd:        &mockCmd{process: &mockProcess{pid: 201}},
+			binaryPath: "/web/app.fcgi",
+			instance:   1,
+			socketPath: "/tmp/app.fcgi.1.sock",
+			lastUsed:   time.Now(),
+			active:     1,
+		},
+		"/web/app.fcgi": {
+			cmd:        &mockCmd{process: &mockProcess{pid: 200}},
+			binaryPath: "/web/app.fcgi",
+			socketPath: "/tmp/app.fcgi.sock",
+			lastUsed:   time.Now(),
+		},
+	}
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		webRoot    string
+		wantStatus int
+	}{
+		{"healthz", s.handleHealthz, webRoot, http.StatusOK},
+		{"readyz", s.handleReadyz, webRoot, http.StatusOK},
+		{"readyz without webRoot", s.handleReadyz, filepath.Join(webRoot, "missing"), http.StatusServiceUnavailable},
+		{"healthz without webRoot", s.handleHealthz, filepath.Join(webRoot, "missing"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.Config.WebRoot = tt.webRoot
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var resp healthResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(resp.Children) != 2 || resp.Children[0].PID != 200 || resp.Children[1].PID != 201 {
+				t.Errorf("children = %+v, want both instances in order", resp.Children)
+			}
+		})
+	}
+}
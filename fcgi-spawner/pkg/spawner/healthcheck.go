@@ -0,0 +1,102 @@
+package spawner
+
+import (
+	"context"
+	"time"
+)
+
+// Defaults of the health checks of an application, see AppConfig.
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 2 * time.Second
+	defaultHealthCheckFailures = 3
+)
+
+// healthCheckTick is how often healthChecks looks for processes due for a
+// health check.
+const healthCheckTick = time.Second
+
+// healthChecks runs the health checks of the child processes until ctx is
+// done.
+func (s *Spawner) healthChecks(ctx context.Context) {
+	ticker := time.NewTicker(healthCheckTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkHealth()
+		}
+	}
+}
+
+// checkHealth starts a health check of every process of an application with
+// a HealthCheckPath that was started or last checked its HealthCheckInterval
+// ago. Signal 0 only tells whether a process exists; a health check also
+// finds processes that are alive but wedged. Checks run in the background,
+// so that processes that don't answer don't hold up the others.
+func (s *Spawner) checkHealth() {
+	now := time.Now()
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	for _, child := range s.childProcesses {
+		if child.app.HealthCheckPath == "" || child.healthChecking || child.cmd.ProcessState() != nil {
+			continue
+		}
+		last := child.healthCheckedAt
+		if last.Before(child.started) {
+			last = child.started
+		}
+		if now.Sub(last) < healthCheckIntervalFor(child.app) {
+			continue
+		}
+		child.healthChecking = true
+		go s.healthCheck(child)
+	}
+}
+
+// healthCheck requests the HealthCheckPath of child, and replaces child once
+// it failed HealthCheckFailures checks in a row.
+func (s *Spawner) healthCheck(child *childProcess) {
+	timeout := child.app.HealthCheckTimeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	err := s.probePath(child, child.app.HealthCheckPath, timeout)
+
+	s.childProcessesMu.Lock()
+	child.healthChecking = false
+	child.healthCheckedAt = time.Now()
+	if err == nil {
+		if child.healthFailures > 0 {
+			spawnLog.Info("Child process passes its health check again", "app", child.binaryPath, "pid", child.cmd.Process().Pid())
+		}
+		child.healthFailures = 0
+		s.childProcessesMu.Unlock()
+		return
+	}
+	child.healthFailures++
+	failures := child.healthFailures
+	s.childProcessesMu.Unlock()
+
+	threshold := child.app.HealthCheckFailures
+	if threshold <= 0 {
+		threshold = defaultHealthCheckFailures
+	}
+	if failures < threshold {
+		spawnLog.Warn("Child process failed its health check", "app", child.binaryPath, "pid", child.cmd.Process().Pid(), "failures", failures, "error", err)
+		return
+	}
+	spawnLog.Error("Child process failed its health checks, replacing it", "app", child.binaryPath, "pid", child.cmd.Process().Pid(), "failures", failures, "error", err)
+	s.replaceChild(child, "failing its health checks")
+}
+
+// healthCheckIntervalFor returns the time between health checks of the
+// processes of the application.
+func healthCheckIntervalFor(app AppConfig) time.Duration {
+	if app.HealthCheckInterval > 0 {
+		return app.HealthCheckInterval
+	}
+	return defaultHealthCheckInterval
+}
@@ -0,0 +1,80 @@
+package spawner
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckReplacesWedgedProcess(t *testing.T) {
+	// In stdio mode the socket accepts connections, but the application
+	// never answers a request, like a wedged process.
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "wedged.fcgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot, DrainTimeout: time.Second, Apps: map[string]AppConfig{
+		"wedged.fcgi": {HealthCheckPath: "/healthz", HealthCheckInterval: time.Millisecond, HealthCheckTimeout: 50 * time.Millisecond, HealthCheckFailures: 2},
+	}})
+	defer s.stopAllChildren(time.Second)
+	if err := s.startApp(appPath); err != nil {
+		t.Fatalf("startApp() error = %v", err)
+	}
+	current := func() *childProcess {
+		s.childProcessesMu.Lock()
+		defer s.childProcessesMu.Unlock()
+		return s.childProcesses[instanceKey(appPath, 0)]
+	}
+	wedged := current()
+
+	// The instance has no process while the replacement starts.
+	var replacement *childProcess
+	for deadline := time.Now().Add(3 * time.Second); replacement == nil || replacement == wedged; time.Sleep(10 * time.Millisecond) {
+		s.checkHealth()
+		if time.Now().After(deadline) {
+			t.Fatal("wedged process wasn't replaced")
+		}
+		replacement = current()
+	}
+	s.childProcessesMu.Lock()
+	failures := wedged.healthFailures
+	s.childProcessesMu.Unlock()
+	if failures != 2 {
+		t.Errorf("process replaced after %d failed health checks, want 2", failures)
+	}
+	if replacement.cmd.Process().Pid() == wedged.cmd.Process().Pid() {
+		t.Errorf("no new process was started in place of the wedged one")
+	}
+}
+
+func TestHealthCheckPasses(t *testing.T) {
+	healthy := true
+	socketPath, _ := serveFCGI(t, func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			http.Error(w, "wedged", http.StatusServiceUnavailable)
+		}
+	})
+	webRoot := t.TempDir()
+	s := NewSpawner(&Config{WebRoot: webRoot})
+	child := &childProcess{
+		cmd:        &mockCmd{process: &mockProcess{pid: 100}, path: filepath.Join(webRoot, "app.fcgi")},
+		socketPath: socketPath,
+		binaryPath: filepath.Join(webRoot, "app.fcgi"),
+		app:        AppConfig{HealthCheckPath: "/healthz", HealthCheckFailures: 5},
+	}
+	defer child.closeConns()
+
+	healthy = false
+	s.healthCheck(child)
+	if child.healthFailures != 1 || child.healthCheckedAt.IsZero() {
+		t.Errorf("after a failed check: %d failures, checked at %s", child.healthFailures, child.healthCheckedAt)
+	}
+	healthy = true
+	s.healthCheck(child)
+	if child.healthFailures != 0 {
+		t.Errorf("after a passed check: %d failures, want 0", child.healthFailures)
+	}
+}
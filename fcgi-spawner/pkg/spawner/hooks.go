@@ -0,0 +1,148 @@
+package spawner
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// PreRouteHook is implemented by hooks run for every request before it is
+// checked against the CORS and auth rules and routed to an application or
+// static file.
+type PreRouteHook interface {
+	// PreRoute returns the request to serve, which may be r itself or a
+	// modified copy, or nil if the hook has answered the request itself,
+	// e.g. to deny it.
+	PreRoute(w http.ResponseWriter, r *http.Request) *http.Request
+}
+
+// PreSpawnHook is implemented by hooks run before an instance of an
+// application is started, for requests as well as for prewarming and the
+// admin API.
+type PreSpawnHook interface {
+	// PreSpawn returns an error to keep the application at appPath, with the
+	// settings app, from being started. Requests for it fail with 503.
+	PreSpawn(appPath string, app AppConfig) error
+}
+
+// PreProxyHook is implemented by hooks run before a request is passed to an
+// application.
+type PreProxyHook interface {
+	// PreProxy may change params, the CGI variables sent to the application
+	// at appPath, and the headers of r. For applications speaking HTTP,
+	// params is nil. An error fails the request with 502.
+	PreProxy(r *http.Request, appPath string, params map[string]string) error
+}
+
+// PostResponseHook is implemented by hooks run once a request has been
+// answered.
+type PostResponseHook interface {
+	PostResponse(r *http.Request, resp ResponseInfo)
+}
+
+// ResponseInfo describes the response to a request, as passed to
+// PostResponseHook.
+type ResponseInfo struct {
+	Status   int
+	Bytes    int64
+	App      string // Path of the application that served the request, if any
+	Duration time.Duration
+}
+
+// hooks are the hooks added with AddHook, by hook point.
+type hooks struct {
+	preRoute     []PreRouteHook
+	preSpawn     []PreSpawnHook
+	preProxy     []PreProxyHook
+	postResponse []PostResponseHook
+}
+
+// AddHook adds hook at every hook point whose interface it implements:
+// PreRouteHook, PreSpawnHook, PreProxyHook and PostResponseHook. Hooks run in
+// the order they were added. AddHook must be called before the spawner
+// serves requests; it panics if hook implements none of the interfaces.
+func (s *Spawner) AddHook(hook any) {
+	added := false
+	if h, ok := hook.(PreRouteHook); ok {
+		s.hooks.preRoute = append(s.hooks.preRoute, h)
+		added = true
+	}
+	if h, ok := hook.(PreSpawnHook); ok {
+		s.hooks.preSpawn = append(s.hooks.preSpawn, h)
+		added = true
+	}
+	if h, ok := hook.(PreProxyHook); ok {
+		s.hooks.preProxy = append(s.hooks.preProxy, h)
+		added = true
+	}
+	if h, ok := hook.(PostResponseHook); ok {
+		s.hooks.postResponse = append(s.hooks.postResponse, h)
+		added = true
+	}
+	if !added {
+		panic(fmt.Sprintf("spawner: %T implements none of the hook interfaces", hook))
+	}
+}
+
+// preRoute runs the PreRouteHooks. It returns the request to serve, or nil
+// if a hook has answered it.
+func (s *Spawner) preRoute(w http.ResponseWriter, r *http.Request) *http.Request {
+	for _, h := range s.hooks.preRoute {
+		if r = h.PreRoute(w, r); r == nil {
+			return nil
+		}
+	}
+	return r
+}
+
+// spawnDeniedError is returned for applications a PreSpawnHook doesn't
+// allow to start.
+type spawnDeniedError struct {
+	app    string
+	reason error
+}
+
+func (e *spawnDeniedError) Error() string {
+	return fmt.Sprintf("starting %s denied by hook: %v", e.app, e.reason)
+}
+
+// preSpawn runs the PreSpawnHooks for the application at appPath.
+func (s *Spawner) preSpawn(appPath string, app AppConfig) error {
+	for _, h := range s.hooks.preSpawn {
+		if err := h.PreSpawn(appPath, app); err != nil {
+			return &spawnDeniedError{app: appPath, reason: err}
+		}
+	}
+	return nil
+}
+
+// preProxy runs the PreProxyHooks for a request to the application at
+// appPath. If one fails, the request is answered with 502 and false
+// returned.
+func (s *Spawner) preProxy(w http.ResponseWriter, r *http.Request, appPath string, params map[string]string) bool {
+	for _, h := range s.hooks.preProxy {
+		if err := h.PreProxy(r, appPath, params); err != nil {
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			proxyLog.Warn("Request rejected by hook", "app", appPath, "error", err)
+			return false
+		}
+	}
+	return true
+}
+
+// postResponse runs the PostResponseHooks once r has been answered through
+// rec, which started at start. appPath is the application that served it.
+func (s *Spawner) postResponse(r *http.Request, rec *statusRecorder, appPath string, start time.Time) {
+	resp := ResponseInfo{
+		Status:   rec.status,
+		Bytes:    rec.bytes,
+		App:      appPath,
+		Duration: time.Since(start),
+	}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	for _, h := range s.hooks.postResponse {
+		h.PostResponse(r, resp)
+	}
+}
@@ -0,0 +1,105 @@
+package spawner
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testHook implements every hook interface.
+type testHook struct {
+	spawned   []string
+	responses []ResponseInfo
+}
+
+func (h *testHook) PreRoute(w http.ResponseWriter, r *http.Request) *http.Request {
+	if r.Header.Get("X-Blocked") != "" {
+		http.Error(w, "blocked", http.StatusTeapot)
+		return nil
+	}
+	r = r.Clone(r.Context())
+	r.Header.Set("X-Tenant", "acme")
+	return r
+}
+
+func (h *testHook) PreSpawn(appPath string, app AppConfig) error {
+	h.spawned = append(h.spawned, filepath.Base(appPath))
+	return errors.New("over quota")
+}
+
+func (h *testHook) PreProxy(r *http.Request, appPath string, params map[string]string) error {
+	params["TENANT"] = r.Header.Get("X-Tenant")
+	return nil
+}
+
+func (h *testHook) PostResponse(r *http.Request, resp ResponseInfo) {
+	h.responses = append(h.responses, resp)
+}
+
+func TestHooks(t *testing.T) {
+	webRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(webRoot, "tenant.cgi"), []byte("#!/bin/sh\nprintf 'Content-Type: text/plain\\r\\n\\r\\n%s' \"$TENANT\"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(webRoot, "quota-hook.fcgi"), []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot})
+	hook := &testHook{}
+	s.AddHook(hook)
+	defer s.stopAllChildren(time.Second)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tenant.cgi", nil))
+	if w.Body.String() != "acme" {
+		t.Errorf("body = %q, want the param set by the hook", w.Body.String())
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/tenant.cgi", nil)
+	r.Header.Set("X-Blocked", "1")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot {
+		t.Errorf("blocked request = %d, want %d", w.Code, http.StatusTeapot)
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/quota-hook.fcgi", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("denied start = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if len(hook.spawned) != 1 || hook.spawned[0] != "quota-hook.fcgi" {
+		t.Errorf("PreSpawn() called for %v", hook.spawned)
+	}
+	if failing := s.failingApps(); len(failing) != 0 {
+		t.Errorf("failingApps() = %+v, want a denied start not to count as a failure", failing)
+	}
+
+	want := []ResponseInfo{
+		{Status: http.StatusOK, Bytes: 4, App: filepath.Join(webRoot, "tenant.cgi")},
+		{Status: http.StatusTeapot, Bytes: 8},
+		{Status: http.StatusServiceUnavailable, Bytes: 20, App: filepath.Join(webRoot, "quota-hook.fcgi")},
+	}
+	if len(hook.responses) != len(want) {
+		t.Fatalf("PostResponse() called %d times, want %d", len(hook.responses), len(want))
+	}
+	for i, resp := range hook.responses {
+		resp.Duration = 0
+		if resp != want[i] {
+			t.Errorf("response %d = %+v, want %+v", i, resp, want[i])
+		}
+	}
+}
+
+func TestAddHookPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("AddHook() of a value implementing no hook didn't panic")
+		}
+	}()
+	NewSpawner(&Config{}).AddHook(struct{}{})
+}
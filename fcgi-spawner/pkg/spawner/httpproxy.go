@@ -0,0 +1,92 @@
+package spawner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+)
+
+// Protocols an application can speak on its socket, see AppConfig.Protocol.
+const (
+	protocolFastCGI = "fastcgi"
+	protocolHTTP    = "http"
+	protocolSCGI    = "scgi"
+)
+
+// httpMarkerExtensions are the extensions of empty marker files selecting the
+// HTTP protocol for an application, e.g. hello.fcgi.http.
+var httpMarkerExtensions = []string{".http", ".proxy"}
+
+// hasHTTPMarker reports whether a marker file selects the HTTP protocol for
+// the application at appPath.
+func hasHTTPMarker(appPath string) bool {
+	for _, ext := range httpMarkerExtensions {
+		if _, err := os.Stat(appPath + ext); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// httpTransport returns the transport connecting to child, which speaks HTTP
+// on its socket. Connections are kept alive like FastCGI connections.
+func (s *Spawner) httpTransport(child *childProcess) *http.Transport {
+	child.connsMu.Lock()
+	defer child.connsMu.Unlock()
+	if child.transport == nil {
+		socketPath := child.socketPath
+		child.transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+			DisableKeepAlives:     s.Config.ConnPoolSize <= 0,
+			MaxIdleConnsPerHost:   s.Config.ConnPoolSize,
+			ResponseHeaderTimeout: s.upstreamTimeoutFor(child.app),
+			DisableCompression:    true,
+		}
+	}
+	return child.transport
+}
+
+// proxyHTTP forwards r to child, which speaks plain HTTP instead of FastCGI.
+// The application sees the original path and Host; the path it is mounted on
+// is passed in X-Forwarded-Prefix. Responses are streamed and protocol
+// upgrades such as WebSockets are passed through.
+func (s *Spawner) proxyHTTP(w http.ResponseWriter, r *http.Request, child *childProcess, scriptName string) {
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			// The transport dials the socket of child whatever the host.
+			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Host = "localhost"
+			s.setForwardedHeaders(pr.Out.Header, pr.In)
+			s.setClientCertHeader(pr.Out.Header, pr.In)
+			if scriptName != "" {
+				pr.Out.Header.Set("X-Forwarded-Prefix", scriptName)
+			}
+		},
+		Transport:     s.httpTransport(child),
+		FlushInterval: -1,
+		ModifyResponse: func(*http.Response) error {
+			s.recordSuccess(child.binaryPath)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			var netErr net.Error
+			switch {
+			case r.Context().Err() != nil:
+				proxyLog.Debug("Client disconnected during response", "app", child.binaryPath)
+			case errors.As(err, &netErr) && netErr.Timeout():
+				http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+				proxyLog.Warn("HTTP request timed out", "app", child.binaryPath, "timeout", s.upstreamTimeoutFor(child.app))
+			default:
+				http.Error(w, "Bad Gateway", http.StatusBadGateway)
+				proxyLog.Error("HTTP request failed", "app", child.binaryPath, "socket", child.socketPath, "error", err)
+			}
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,150 @@
+package spawner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// serveHTTP serves handler over plain HTTP on a unix socket, like an app
+// speaking the HTTP protocol, and returns the socket path.
+func serveHTTP(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "app.sock")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &http.Server{Handler: handler}
+	t.Cleanup(func() { server.Close() })
+	go server.Serve(ln)
+	return socketPath
+}
+
+func TestHTTPMarker(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "ws.fcgi")
+	s := NewSpawner(&Config{WebRoot: webRoot})
+
+	if app, err := s.appConfig(appPath); err != nil || app.Protocol != "" {
+		t.Fatalf("appConfig() = %+v, %v, want the default protocol", app, err)
+	}
+	if err := os.WriteFile(appPath+".proxy", nil, 0644); err != nil {
+		t.Fatalf("Failed to write marker: %v", err)
+	}
+	if app, err := s.appConfig(appPath); err != nil || app.Protocol != protocolHTTP {
+		t.Errorf("appConfig() = %+v, %v, want protocol http", app, err)
+	}
+	if !s.isSidecarFile(appPath + ".proxy") {
+		t.Errorf("isSidecarFile(%q) = false, want true", appPath+".proxy")
+	}
+
+	// A sidecar file may switch back to FastCGI.
+	if err := os.WriteFile(appPath+".yaml", []byte("protocol: fastcgi\n"), 0644); err != nil {
+		t.Fatalf("Failed to write sidecar: %v", err)
+	}
+	if app, err := s.appConfig(appPath); err != nil || app.Protocol != protocolFastCGI {
+		t.Errorf("appConfig() = %+v, %v, want protocol fastcgi", app, err)
+	}
+	if err := os.WriteFile(appPath+".yaml", []byte("protocol: gopher\n"), 0644); err != nil {
+		t.Fatalf("Failed to write sidecar: %v", err)
+	}
+	if _, err := s.appConfig(appPath); err == nil {
+		t.Error("appConfig() accepted an unknown protocol")
+	}
+}
+
+func TestProxyHTTP(t *testing.T) {
+	socketPath := serveHTTP(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(time.Second)
+		case "/echo":
+			// A protocol upgrade, like a WebSocket handshake.
+			w.Header().Set("Connection", "Upgrade")
+			w.Header().Set("Upgrade", "echo")
+			w.WriteHeader(http.StatusSwitchingProtocols)
+			conn, rw, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			line, _ := rw.ReadString('\n')
+			rw.WriteString("echo: " + line)
+			rw.Flush()
+			return
+		}
+		w.Header().Set("X-Host", r.Host)
+		w.Header().Set("X-Prefix", r.Header.Get("X-Forwarded-Prefix"))
+		fmt.Fprint(w, r.URL.RequestURI())
+	})
+	timeout := 200 * time.Millisecond
+	s := NewSpawner(&Config{ConnPoolSize: 4})
+	child := &childProcess{
+		cmd:        &mockCmd{path: "/web/app.fcgi"},
+		socketPath: socketPath,
+		binaryPath: "/web/app.fcgi",
+		app:        AppConfig{Protocol: protocolHTTP, UpstreamTimeout: &timeout},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.proxyRequest(w, r, child, "/app.fcgi", "")
+	}))
+	defer server.Close()
+
+	t.Run("request", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/app.fcgi/items?id=1")
+		if err != nil {
+			t.Fatalf("GET error = %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != "/app.fcgi/items?id=1" {
+			t.Errorf("body = %q, want the original request URI", body)
+		}
+		if got, want := resp.Header.Get("X-Host"), server.Listener.Addr().String(); got != want {
+			t.Errorf("Host = %q, want %q", got, want)
+		}
+		if got := resp.Header.Get("X-Prefix"); got != "/app.fcgi" {
+			t.Errorf("X-Forwarded-Prefix = %q, want /app.fcgi", got)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/slow")
+		if err != nil {
+			t.Fatalf("GET error = %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusGatewayTimeout {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusGatewayTimeout)
+		}
+	})
+
+	t.Run("upgrade", func(t *testing.T) {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "GET /echo HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		r := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(r, nil)
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+		}
+		fmt.Fprint(conn, "hello\n")
+		if line, err := r.ReadString('\n'); err != nil || line != "echo: hello\n" {
+			t.Errorf("upgraded connection read %q, %v, want %q", line, err, "echo: hello\n")
+		}
+	})
+}
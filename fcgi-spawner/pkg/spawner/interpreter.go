@@ -0,0 +1,77 @@
+package spawner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// validateInterpreters checks the extension to interpreter mapping.
+func (c *Config) validateInterpreters() error {
+	for ext, command := range c.Interpreters {
+		if !strings.HasPrefix(ext, ".") || strings.ContainsAny(ext[1:], "./") {
+			return fmt.Errorf("interpreter extension %q must look like .php", ext)
+		}
+		if ext == ".fcgi" {
+			return fmt.Errorf("interpreter extension .fcgi is reserved for FastCGI binaries")
+		}
+		if len(strings.Fields(command)) == 0 {
+			return fmt.Errorf("interpreter for %s is empty", ext)
+		}
+	}
+	return nil
+}
+
+// interpreterFor returns the interpreter command configured for the extension
+// of name, split into fields.
+func (s *Spawner) interpreterFor(name string) ([]string, bool) {
+	command, ok := s.Config.Interpreters[filepath.Ext(name)]
+	if !ok {
+		return nil, false
+	}
+	return strings.Fields(command), true
+}
+
+// isAppName reports whether name looks like an application: a .fcgi binary
+// or a script with an extension mapped to an interpreter.
+func (s *Spawner) isAppName(name string) bool {
+	if strings.HasSuffix(name, ".fcgi") {
+		return true
+	}
+	_, ok := s.interpreterFor(name)
+	return ok
+}
+
+// isApp reports whether path is an application: an executable .fcgi binary
+// or a regular file run by an interpreter, which needn't be executable, or
+// an application declared with a command. In manifest mode, only declared
+// applications are.
+func (s *Spawner) isApp(path string) bool {
+	if s.hasCommand(path) {
+		return true
+	}
+	if !s.isAppName(path) || !s.mayRun(path) {
+		return false
+	}
+	if strings.HasSuffix(path, ".fcgi") {
+		return isExecutable(path)
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// appCommand returns the command running the application at appPath with
+// args: the command of app, the binary itself, or its interpreter with the
+// script as the first argument.
+func (s *Spawner) appCommand(appPath string, app AppConfig, args []string) *exec.Cmd {
+	if app.Command != "" {
+		return exec.Command(app.Command, args...)
+	}
+	if interpreter, ok := s.interpreterFor(appPath); ok {
+		args = append(append(interpreter[1:len(interpreter):len(interpreter)], appPath), args...)
+		return exec.Command(interpreter[0], args...)
+	}
+	return exec.Command(appPath, args...)
+}
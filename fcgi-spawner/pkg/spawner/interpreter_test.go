@@ -0,0 +1,80 @@
+package spawner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateInterpreters(t *testing.T) {
+	tests := []struct {
+		name         string
+		interpreters map[string]string
+		wantErr      bool
+	}{
+		{name: "valid", interpreters: map[string]string{".php": "php-cgi", ".py": "python3 -u"}},
+		{name: "missing dot", interpreters: map[string]string{"php": "php-cgi"}, wantErr: true},
+		{name: "nested extension", interpreters: map[string]string{".tar.gz": "tar"}, wantErr: true},
+		{name: "fcgi", interpreters: map[string]string{".fcgi": "sh"}, wantErr: true},
+		{name: "empty command", interpreters: map[string]string{".php": " "}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Interpreters: tt.interpreters}
+			if err := cfg.validateInterpreters(); (err != nil) != tt.wantErr {
+				t.Errorf("validateInterpreters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsApp(t *testing.T) {
+	webRoot := t.TempDir()
+	files := map[string]os.FileMode{
+		"hello.fcgi": 0755,
+		"plain.fcgi": 0644,
+		"index.php":  0644,
+		"script.py":  0755,
+	}
+	for name, mode := range files {
+		if err := os.WriteFile(filepath.Join(webRoot, name), nil, mode); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(webRoot, "dir.php"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot, Interpreters: map[string]string{".php": "php-cgi"}})
+
+	tests := map[string]bool{
+		"hello.fcgi":   true,
+		"plain.fcgi":   false, // not executable
+		"index.php":    true,  // scripts needn't be executable
+		"script.py":    false, // no interpreter configured
+		"dir.php":      false,
+		"missing.php":  false,
+		"missing.fcgi": false,
+	}
+	for name, want := range tests {
+		if got := s.isApp(filepath.Join(webRoot, name)); got != want {
+			t.Errorf("isApp(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestAppCommand(t *testing.T) {
+	s := NewSpawner(&Config{Interpreters: map[string]string{".php": "php-cgi -d display_errors=0"}})
+
+	cmd := s.appCommand("/web/index.php", AppConfig{}, []string{"-x"})
+	want := []string{"php-cgi", "-d", "display_errors=0", "/web/index.php", "-x"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("appCommand() args = %q, want %q", cmd.Args, want)
+	}
+
+	cmd = s.appCommand("/web/hello.fcgi", AppConfig{}, []string{"/run/hello.fcgi.sock"})
+	want = []string{"/web/hello.fcgi", "/run/hello.fcgi.sock"}
+	if cmd.Path != "/web/hello.fcgi" || !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("appCommand() = %s %q, want %q", cmd.Path, cmd.Args, want)
+	}
+}
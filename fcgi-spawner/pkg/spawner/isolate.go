@@ -0,0 +1,217 @@
+package spawner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// isolatedDevices are the devices of /dev visible to isolated applications.
+var isolatedDevices = []string{"null", "zero", "full", "random", "urandom", "tty"}
+
+// isolatedMount is a file or directory of the host visible at the same path
+// to an isolated application.
+type isolatedMount struct {
+	Path     string `json:"path"`
+	Writable bool   `json:"writable,omitempty"`
+}
+
+// validateIsolation checks the paths isolated applications may see.
+func (c *AppConfig) validateIsolation() error {
+	if !c.Isolate && (len(c.BindPaths) > 0 || len(c.BindReadOnlyPaths) > 0) {
+		return errors.New("bindPaths and bindReadOnlyPaths need isolate")
+	}
+	for _, path := range slices.Concat(c.BindPaths, c.BindReadOnlyPaths) {
+		if !filepath.IsAbs(path) || filepath.Clean(path) != path || path == "/" {
+			return fmt.Errorf("bind path %q must be a clean absolute path other than /", path)
+		}
+	}
+	return nil
+}
+
+// isolateCommand sets up sandbox to isolate the application at appPath, run
+// by cmd: it only sees the web root of its site, read-only, the program
+// cmd runs if it is elsewhere, its BindReadOnlyPaths, its BindPaths and
+// the writable paths, see isolate. The process starts in a mount namespace
+// of its own, as root, and the sandbox helper takes on the credential of
+// cmd once it has set up the mounts.
+func (s *Spawner) isolateCommand(cmd *exec.Cmd, appPath string, app AppConfig, writable []string, sandbox *sandboxSpec) error {
+	if os.Geteuid() != 0 {
+		return errors.New("isolating applications requires the spawner to run as root")
+	}
+	webRoot := s.siteOf(appPath).webRoot
+	mounts := []isolatedMount{{Path: webRoot}}
+	if !isBelow(cmd.Path, webRoot) {
+		// A command or interpreter.
+		mounts = append(mounts, isolatedMount{Path: cmd.Path})
+	}
+	for _, path := range app.BindReadOnlyPaths {
+		mounts = append(mounts, isolatedMount{Path: path})
+	}
+	for _, path := range slices.Concat(app.BindPaths, writable) {
+		mounts = append(mounts, isolatedMount{Path: path, Writable: true})
+	}
+	sandbox.Isolate = true
+	sandbox.Mounts = mounts
+	sandbox.Dir = cmd.Dir
+	if sandbox.Dir == "" {
+		// The spawner's working directory isn't visible.
+		sandbox.Dir = "/"
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	sandbox.Credential = cmd.SysProcAttr.Credential
+	cmd.SysProcAttr.Credential = nil
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNS
+	return nil
+}
+
+// isolate makes mounts the only files of the host visible to the process,
+// which must run as root in a mount namespace of its own, and changes to
+// the directory dir. The process also gets a /dev with isolatedDevices, a
+// /proc and an empty /tmp; everything else is read-only. Like bubblewrap,
+// the new root is built on a tmpfs mounted over /tmp, which becomes the
+// root for a while, with the host's root moved to /oldroot.
+func isolate(mounts []isolatedMount, dir string) error {
+	// Mounts made from now on don't propagate to the host.
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making mounts private: %v", err)
+	}
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755"); err != nil {
+		return fmt.Errorf("mounting tmpfs: %v", err)
+	}
+	for _, name := range []string{"/tmp/newroot", "/tmp/oldroot"} {
+		if err := os.Mkdir(name, 0755); err != nil {
+			return err
+		}
+	}
+	if err := unix.PivotRoot("/tmp", "/tmp/oldroot"); err != nil {
+		return fmt.Errorf("pivot_root: %v", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+
+	type fsMount struct {
+		target, fstype string
+		flags          uintptr
+		data           string
+	}
+	for _, m := range []fsMount{
+		{"/newroot", "tmpfs", unix.MS_NOSUID | unix.MS_NODEV, "mode=0755"},
+		{"/newroot/tmp", "tmpfs", unix.MS_NOSUID | unix.MS_NODEV, "mode=1777"},
+		{"/newroot/proc", "proc", unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC, ""},
+		{"/newroot/dev", "tmpfs", unix.MS_NOSUID | unix.MS_NOEXEC, "mode=0755"},
+	} {
+		if err := os.MkdirAll(m.target, 0755); err != nil {
+			return err
+		}
+		if err := unix.Mount(m.fstype, m.target, m.fstype, m.flags, m.data); err != nil {
+			return fmt.Errorf("mounting %s on %s: %v", m.fstype, strings.TrimPrefix(m.target, "/newroot"), err)
+		}
+	}
+	for _, name := range isolatedDevices {
+		if err := bindIsolated("/dev/"+name, true, unix.MS_NOSUID|unix.MS_NOEXEC); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	// Parents are mounted before what is below them.
+	mounts = slices.Clone(mounts)
+	slices.SortStableFunc(mounts, func(a, b isolatedMount) int { return strings.Compare(a.Path, b.Path) })
+	for _, m := range mounts {
+		if err := bindIsolated(m.Path, m.Writable, unix.MS_NOSUID|unix.MS_NODEV); err != nil {
+			return err
+		}
+	}
+	if err := unix.Mount("", "/newroot", "", unix.MS_REMOUNT|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("making the root read-only: %v", err)
+	}
+
+	if err := unix.Unmount("/oldroot", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("unmounting the host's root: %v", err)
+	}
+	if err := os.Chdir("/newroot"); err != nil {
+		return err
+	}
+	// Stacks the old root on the new one, so that it can be unmounted.
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot_root: %v", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("unmounting the tmpfs: %v", err)
+	}
+	return os.Chdir(dir)
+}
+
+// bindIsolated makes the file or directory of the host at path visible at
+// the same path below /newroot, with the mount flags, read-only unless
+// writable.
+func bindIsolated(path string, writable bool, flags uintptr) error {
+	source, target := "/oldroot"+path, "/newroot"+path
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if err := makeMountPoint(target, info.IsDir()); err != nil {
+		return err
+	}
+	if err := unix.Mount(source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("mounting %s: %v", path, err)
+	}
+	flags |= unix.MS_BIND | unix.MS_REMOUNT
+	if !writable {
+		flags |= unix.MS_RDONLY
+	}
+	if err := unix.Mount("", target, "", flags, ""); err != nil {
+		return fmt.Errorf("remounting %s: %v", path, err)
+	}
+	return nil
+}
+
+// makeMountPoint creates the directory or empty file at target to mount
+// on, unless it exists, e.g. below a path mounted already, which may be
+// read-only.
+func makeMountPoint(target string, dir bool) error {
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+	if dir {
+		return os.MkdirAll(target, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// dropPrivileges makes the process, which runs as root, take on cred.
+func dropPrivileges(cred *syscall.Credential) error {
+	if !cred.NoSetGroups {
+		groups := make([]int, len(cred.Groups))
+		for i, gid := range cred.Groups {
+			groups[i] = int(gid)
+		}
+		if err := syscall.Setgroups(groups); err != nil {
+			return fmt.Errorf("setgroups: %v", err)
+		}
+	}
+	if err := syscall.Setgid(int(cred.Gid)); err != nil {
+		return fmt.Errorf("setgid: %v", err)
+	}
+	if err := syscall.Setuid(int(cred.Uid)); err != nil {
+		return fmt.Errorf("setuid: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package spawner
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestValidateIsolation(t *testing.T) {
+	tests := []struct {
+		name    string
+		app     AppConfig
+		wantErr bool
+	}{
+		{name: "isolated", app: AppConfig{Isolate: true, BindReadOnlyPaths: []string{"/usr", "/etc/ssl"}, BindPaths: []string{"/var/lib/app"}}},
+		{name: "without isolate", app: AppConfig{BindPaths: []string{"/var/lib/app"}}, wantErr: true},
+		{name: "relative", app: AppConfig{Isolate: true, BindPaths: []string{"data"}}, wantErr: true},
+		{name: "unclean", app: AppConfig{Isolate: true, BindReadOnlyPaths: []string{"/usr/"}}, wantErr: true},
+		{name: "root", app: AppConfig{Isolate: true, BindReadOnlyPaths: []string{"/"}}, wantErr: true},
+		{name: "container", app: AppConfig{Isolate: true, Container: &ContainerConfig{Image: "app"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.app.validateSandbox(); (err != nil) != tt.wantErr {
+				t.Errorf("validateSandbox() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsolate(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("isolation requires root")
+	}
+	if err := exec.Command("unshare", "--mount", "true").Run(); err != nil {
+		t.Skipf("mount namespaces aren't available: %v", err)
+	}
+	webRoot, dataDir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(webRoot, "hello.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	os.Chmod(webRoot, 0755)
+	os.Chmod(dataDir, 0777)
+	var system []string
+	for _, dir := range []string{"/bin", "/lib", "/lib64", "/usr"} {
+		if _, err := os.Stat(dir); err == nil {
+			system = append(system, dir)
+		}
+	}
+
+	s := NewSpawner(&Config{WebRoot: webRoot})
+	script := strings.Join([]string{
+		"cat " + webRoot + "/hello.txt",
+		"pwd",
+		"id -u",
+		"test -e /etc/passwd && echo host visible",
+		"touch " + webRoot + "/new 2>/dev/null && echo web root writable",
+		"touch " + dataDir + "/new && echo data writable",
+		"touch /tmp/new && echo tmp writable",
+		"echo > /dev/null && echo dev null",
+	}, "; ")
+	cmd := exec.Command("/bin/sh", "-c", script)
+	cmd.Dir = webRoot
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: 65534, Gid: 65534}}
+	s.confine(cmd, filepath.Join(webRoot, "app.fcgi"), AppConfig{Isolate: true, BindReadOnlyPaths: system}, dataDir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("isolated command failed: %v: %s", err, out)
+	}
+	want := "hello\n" + webRoot + "\n65534\ndata writable\ntmp writable\ndev null\n"
+	if string(out) != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "new")); err != nil {
+		t.Errorf("file written to the writable path isn't on the host: %v", err)
+	}
+	if _, err := os.Stat("/tmp/new"); err == nil {
+		t.Error("file written to /tmp is on the host")
+	}
+}
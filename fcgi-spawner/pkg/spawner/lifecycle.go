@@ -0,0 +1,67 @@
+package spawner
+
+import (
+	"net/http"
+	"time"
+)
+
+// preStopPath is where the preStop hook of a Kubernetes pod asks the spawner
+// to get ready to stop, see handlePreStop.
+const preStopPath = "/prestop"
+
+// beginStopping marks the spawner as stopping, which fails its readiness
+// check, and returns when it started stopping.
+func (s *Spawner) beginStopping() time.Time {
+	s.stoppingMu.Lock()
+	defer s.stoppingMu.Unlock()
+	if s.stoppingSince.IsZero() {
+		s.stoppingSince = time.Now()
+		mainLog.Info("Stopping, failing readiness checks", "preStopDelay", s.Config.PreStopDelay)
+	}
+	return s.stoppingSince
+}
+
+// isStopping reports whether the spawner was told to stop.
+func (s *Spawner) isStopping() bool {
+	s.stoppingMu.Lock()
+	defer s.stoppingMu.Unlock()
+	return !s.stoppingSince.IsZero()
+}
+
+// waitPreStop marks the spawner as stopping and waits until
+// Config.PreStopDelay has passed since it began to, so that load balancers
+// see it's no longer ready and stop sending requests before the listeners are
+// closed. Requests keep being served in the meantime.
+func (s *Spawner) waitPreStop() {
+	since := s.beginStopping()
+	time.Sleep(time.Until(since.Add(s.Config.PreStopDelay)))
+}
+
+// handlePreStop is the preStop hook: it answers once the spawner has failed
+// its readiness checks for Config.PreStopDelay. Kubernetes sends SIGTERM
+// only after the hook has returned.
+func (s *Spawner) handlePreStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.waitPreStop()
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// shutdownTimeout returns how long in-flight requests may take to finish
+// during shutdown: Config.ShutdownTimeout, cut short so that the child
+// processes can still be stopped within Config.TerminationGracePeriod,
+// counted from when the spawner began stopping.
+func (s *Spawner) shutdownTimeout() time.Duration {
+	timeout := s.Config.ShutdownTimeout
+	if grace := s.Config.TerminationGracePeriod; grace > 0 {
+		left := max(grace-time.Since(s.beginStopping())-childStopTimeout, 0)
+		if left < timeout {
+			mainLog.Warn("Shortening the shutdown timeout to the termination grace period", "shutdownTimeout", timeout, "left", left.Round(time.Millisecond))
+			timeout = left
+		}
+	}
+	return timeout
+}
@@ -0,0 +1,90 @@
+package spawner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadinessWhilePrewarming(t *testing.T) {
+	webRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(webRoot, "app.fcgi"), []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot, Prewarm: []string{"app.fcgi"}})
+	defer s.stopAllChildren(time.Second)
+	readyz := func() int {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+
+	// As set by Start.
+	s.prewarming.Store(true)
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("GET /readyz while prewarming = %d, want 503", code)
+	}
+	s.prewarm()
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("GET /readyz after prewarming = %d, want 200", code)
+	}
+	if n := len(s.children()); n != 1 {
+		t.Errorf("%d children running after prewarming, want 1", n)
+	}
+}
+
+func TestPreStop(t *testing.T) {
+	s := NewSpawner(&Config{WebRoot: t.TempDir(), PreStopDelay: 300 * time.Millisecond})
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	start := time.Now()
+	done := make(chan int)
+	go func() { done <- get("/prestop") }()
+	time.Sleep(50 * time.Millisecond)
+	if code := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("GET /readyz during preStop = %d, want 503", code)
+	}
+	if code := <-done; code != http.StatusNoContent {
+		t.Errorf("GET /prestop = %d, want 204", code)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("GET /prestop returned after %s, want the preStopDelay", elapsed)
+	}
+
+	// SIGTERM after the hook doesn't wait again.
+	start = time.Now()
+	s.waitPreStop()
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("waitPreStop() after the hook took %s", elapsed)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		shutdown    time.Duration
+		grace       time.Duration
+		wantAtMost  time.Duration
+		wantAtLeast time.Duration
+	}{
+		{"no grace period", 30 * time.Second, 0, 30 * time.Second, 30 * time.Second},
+		{"within grace period", 10 * time.Second, time.Minute, 10 * time.Second, 10 * time.Second},
+		{"cut to grace period", 30 * time.Second, 15 * time.Second, 10 * time.Second, 9 * time.Second},
+		{"grace period too short", 30 * time.Second, 2 * time.Second, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSpawner(&Config{ShutdownTimeout: tt.shutdown, TerminationGracePeriod: tt.grace})
+			if got := s.shutdownTimeout(); got > tt.wantAtMost || got < tt.wantAtLeast {
+				t.Errorf("shutdownTimeout() = %s, want between %s and %s", got, tt.wantAtLeast, tt.wantAtMost)
+			}
+		})
+	}
+}
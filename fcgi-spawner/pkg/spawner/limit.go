@@ -0,0 +1,61 @@
+package spawner
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// tooManyChildrenError is returned instead of starting an application when
+// Config.MaxChildren child processes are running and none of them is idle.
+type tooManyChildrenError struct {
+	max int
+}
+
+func (e *tooManyChildrenError) Error() string {
+	return fmt.Sprintf("all %d child processes allowed by maxChildren are busy", e.max)
+}
+
+// makeRoom makes room for another child process of the application at
+// appPath if Config.MaxChildren processes are running or starting, by
+// stopping the least recently used idle process of another application. It
+// returns a *tooManyChildrenError if there is none. The caller must hold the
+// app's lock and childProcessesMu.
+func (s *Spawner) makeRoom(appPath string) error {
+	limit := s.Config.MaxChildren
+	if limit <= 0 {
+		return nil
+	}
+	for len(s.childProcesses)+s.starting >= limit {
+		if !s.evictIdleChild(appPath) {
+			return &tooManyChildrenError{max: limit}
+		}
+	}
+	return nil
+}
+
+// evictIdleChild stops the least recently used child process serving no
+// requests and reports whether there was one. Processes of the application at
+// appPath are kept, and so are those of applications being started or
+// stopped, like in the cleanup loop. The caller must hold childProcessesMu.
+func (s *Spawner) evictIdleChild(appPath string) bool {
+	var idle []*childProcess
+	for _, child := range s.childProcesses {
+		if child.binaryPath != appPath && child.active == 0 {
+			idle = append(idle, child)
+		}
+	}
+	slices.SortFunc(idle, func(a, b *childProcess) int { return a.lastUsed.Compare(b.lastUsed) })
+	for _, child := range idle {
+		if lock := s.appLocks[child.binaryPath]; lock != nil {
+			if !lock.TryLock() {
+				continue
+			}
+			defer lock.Unlock()
+		}
+		spawnLog.Info("Child limit reached, stopping least recently used process", "app", child.binaryPath, "pid", child.cmd.Process().Pid(), "idle", time.Since(child.lastUsed).Round(time.Second))
+		s.terminateChild(child)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package spawner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMaxChildren(t *testing.T) {
+	webRoot := t.TempDir()
+	apps := map[string]string{}
+	for _, name := range []string{"first.fcgi", "second.fcgi", "third.fcgi"} {
+		apps[name] = filepath.Join(webRoot, name)
+		if err := os.WriteFile(apps[name], []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+			t.Fatalf("Failed to write app: %v", err)
+		}
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot, MaxChildren: 2})
+	defer s.stopAllChildren(time.Second)
+
+	running := func() map[string]bool {
+		s.childProcessesMu.Lock()
+		defer s.childProcessesMu.Unlock()
+		got := map[string]bool{}
+		for _, child := range s.childProcesses {
+			got[filepath.Base(child.binaryPath)] = true
+		}
+		return got
+	}
+
+	// Start two apps and leave them idle, the first one used longest ago.
+	for _, name := range []string{"first.fcgi", "second.fcgi"} {
+		child, _, err := s.getOrCreateChild(context.Background(), apps[name], nil)
+		if err != nil {
+			t.Fatalf("getOrCreateChild(%s) error = %v", name, err)
+		}
+		s.releaseChild(child)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// At the limit, the least recently used process makes room.
+	third, _, err := s.getOrCreateChild(context.Background(), apps["third.fcgi"], nil)
+	if err != nil {
+		t.Fatalf("getOrCreateChild(third.fcgi) error = %v", err)
+	}
+	if got := running(); len(got) != 2 || got["first.fcgi"] {
+		t.Errorf("Running apps = %v, want second.fcgi and third.fcgi", got)
+	}
+
+	// With every process busy, nothing is started.
+	second, _, err := s.getOrCreateChild(context.Background(), apps["second.fcgi"], nil)
+	if err != nil {
+		t.Fatalf("getOrCreateChild(second.fcgi) error = %v", err)
+	}
+	var tooMany *tooManyChildrenError
+	if _, _, err := s.getOrCreateChild(context.Background(), apps["first.fcgi"], nil); !errors.As(err, &tooMany) {
+		t.Errorf("getOrCreateChild(first.fcgi) error = %v, want *tooManyChildrenError", err)
+	}
+
+	// Once a process is idle again, it makes room.
+	s.releaseChild(second)
+	child, _, err := s.getOrCreateChild(context.Background(), apps["first.fcgi"], nil)
+	if err != nil {
+		t.Fatalf("getOrCreateChild(first.fcgi) error = %v", err)
+	}
+	s.releaseChild(child)
+	s.releaseChild(third)
+	if got := running(); len(got) != 2 || got["second.fcgi"] {
+		t.Errorf("Running apps = %v, want first.fcgi and third.fcgi", got)
+	}
+}
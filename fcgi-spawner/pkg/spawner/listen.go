@@ -0,0 +1,80 @@
+package spawner
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// unixAddrPrefix marks a listen address as a unix socket path, e.g.
+// unix:/run/fcgi-spawner.sock.
+const unixAddrPrefix = "unix:"
+
+// listen opens the listener of the spawner on Config.ListenAddr. A unix
+// socket is created with Config.ListenSocketMode and, if set, owned by
+// Config.ListenSocketOwner ("user", "user:group" or ":group").
+func (c *Config) listen() (net.Listener, error) {
+	path, ok := strings.CutPrefix(c.ListenAddr, unixAddrPrefix)
+	if !ok {
+		return net.Listen("tcp", c.ListenAddr)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("missing socket path in %q", c.ListenAddr)
+	}
+	mode, err := parseFileMode(c.ListenSocketMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket mode: %v", err)
+	}
+	// A socket left behind by a previous run would make listening fail.
+	if info, err := os.Lstat(path); err == nil && info.Mode().Type() == os.ModeSocket {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if err := chownTo(path, c.ListenSocketOwner); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// parseFileMode parses an octal permission mode like 0660.
+func parseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("%q isn't an octal mode like 0660", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// chownTo changes the owner of path to owner: "user", "user:group" or
+// ":group". An empty owner leaves it unchanged.
+func chownTo(path, owner string) error {
+	if owner == "" {
+		return nil
+	}
+	userName, groupName, _ := strings.Cut(owner, ":")
+	cred, err := lookupCredential(userName, groupName)
+	if err == nil {
+		uid := int(cred.Uid)
+		if userName == "" {
+			uid = -1 // Keep the owner, only change the group.
+		}
+		err = os.Chown(path, uid, int(cred.Gid))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set the owner of %s: %v", path, err)
+	}
+	return nil
+}
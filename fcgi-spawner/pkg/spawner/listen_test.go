@@ -0,0 +1,62 @@
+package spawner
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "spawner.sock")
+
+	// A socket left behind by a previous run.
+	stale, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		wantMode os.FileMode
+		wantErr  bool
+	}{
+		{name: "tcp", cfg: Config{ListenAddr: "127.0.0.1:0"}},
+		{name: "unix", cfg: Config{ListenAddr: "unix:" + socketPath, ListenSocketMode: "0600"}, wantMode: 0600},
+		{name: "unix with owner", cfg: Config{ListenAddr: "unix:" + socketPath, ListenSocketMode: "0660", ListenSocketOwner: "root:root"}, wantMode: 0660},
+		{name: "missing path", cfg: Config{ListenAddr: "unix:", ListenSocketMode: "0660"}, wantErr: true},
+		{name: "invalid mode", cfg: Config{ListenAddr: "unix:" + socketPath, ListenSocketMode: "rw"}, wantErr: true},
+		{name: "unknown owner", cfg: Config{ListenAddr: "unix:" + socketPath, ListenSocketMode: "0660", ListenSocketOwner: "no-such-user-fcgi"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := tt.cfg.listen()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("listen() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer ln.Close()
+			if tt.wantMode == 0 {
+				return
+			}
+			info, err := os.Stat(socketPath)
+			if err != nil {
+				t.Fatalf("Failed to stat socket: %v", err)
+			}
+			if info.Mode().Perm() != tt.wantMode {
+				t.Errorf("socket mode = %v, want %v", info.Mode().Perm(), tt.wantMode)
+			}
+			conn, err := net.Dial("unix", socketPath)
+			if err != nil {
+				t.Fatalf("Failed to connect: %v", err)
+			}
+			conn.Close()
+		})
+	}
+}
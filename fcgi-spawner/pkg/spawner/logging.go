@@ -0,0 +1,231 @@
+package spawner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logHandler is the handler all loggers write to. Filtering by level is done
+// per subsystem, so it lets everything through. Errors are also kept in
+// recentErrors.
+var logHandler slog.Handler = errorRecorder{Handler: slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})}
+
+// logLevels holds the level of every subsystem logger.
+var logLevels = make(map[string]*slog.LevelVar)
+
+// Loggers of the spawner's subsystems. Their levels can be set separately
+// with -logLevel, e.g. "info,proxy=debug".
+var (
+	mainLog    = newLogger("main")
+	spawnLog   = newLogger("spawn")   // Starting and stopping child processes
+	proxyLog   = newLogger("proxy")   // Requests forwarded to applications
+	watcherLog = newLogger("watcher") // Changes to binaries and app configs
+	cleanupLog = newLogger("cleanup") // Idle and exited child processes
+	adminLog   = newLogger("admin")   // Admin API and health checks
+	eventLog   = newLogger("event")   // Lifecycle events sent to subscribers and the webhook
+	appLog     = newLogger("app")     // Output of the applications
+)
+
+// newLogger returns the logger of a subsystem, logging at info level until
+// configured otherwise.
+func newLogger(subsystem string) *slog.Logger {
+	level := new(slog.LevelVar)
+	logLevels[subsystem] = level
+	return slog.New(levelHandler{level: level, Handler: logHandler}).With("subsystem", subsystem)
+}
+
+// SetLogLevels applies a -logLevel specification: a level for all
+// subsystems, optionally followed by per-subsystem levels, e.g.
+// "warn,spawn=info,proxy=debug".
+func SetLogLevels(spec string) error {
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		subsystem, levelName, ok := strings.Cut(part, "=")
+		if !ok {
+			subsystem, levelName = "", part
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(levelName)); err != nil {
+			return fmt.Errorf("invalid log level %q", levelName)
+		}
+		if subsystem == "" {
+			for _, lv := range logLevels {
+				lv.Set(level)
+			}
+			continue
+		}
+		lv, ok := logLevels[subsystem]
+		if !ok {
+			return fmt.Errorf("unknown log subsystem %q", subsystem)
+		}
+		lv.Set(level)
+	}
+	return nil
+}
+
+// appLogLines is how many lines of the output of each application are kept
+// for the admin API.
+const appLogLines = 50
+
+// logLine is a line of output of an application.
+type logLine struct {
+	Time   time.Time `json:"time"`
+	PID    int       `json:"pid,omitempty"`
+	Stream string    `json:"stream"`
+	Line   string    `json:"line"`
+}
+
+// logTail keeps the latest lines of output of every application.
+type logTail struct {
+	mu   sync.Mutex
+	apps map[string][]logLine // By app path
+}
+
+// appLogTail holds the output of the applications, next to appLog.
+var appLogTail logTail
+
+// add appends a line of output of the application at appPath, dropping the
+// oldest one if there are too many.
+func (t *logTail) add(appPath string, pid int, stream, line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.apps == nil {
+		t.apps = make(map[string][]logLine)
+	}
+	lines := append(t.apps[appPath], logLine{Time: time.Now(), PID: pid, Stream: stream, Line: line})
+	if len(lines) > appLogLines {
+		lines = slices.Delete(lines, 0, len(lines)-appLogLines)
+	}
+	t.apps[appPath] = lines
+}
+
+// snapshot returns a copy of the lines of every application.
+func (t *logTail) snapshot() map[string][]logLine {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	apps := make(map[string][]logLine, len(t.apps))
+	for appPath, lines := range t.apps {
+		apps[appPath] = slices.Clone(lines)
+	}
+	return apps
+}
+
+// stderr returns the latest n lines the application at appPath wrote to
+// stderr, either its own or the FastCGI stderr stream.
+func (t *logTail) stderr(appPath string, n int) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var lines []string
+	for _, line := range t.apps[appPath] {
+		if line.Stream == "stderr" || line.Stream == "fcgi-stderr" {
+			lines = append(lines, line.Line)
+		}
+	}
+	return lines[max(len(lines)-n, 0):]
+}
+
+// Logger returns the logger of the main subsystem, e.g. to route the log
+// package through it with slog.SetDefault.
+func Logger() *slog.Logger {
+	return mainLog
+}
+
+// levelHandler filters records below a level before passing them on.
+type levelHandler struct {
+	level slog.Leveler
+	slog.Handler
+}
+
+func (h levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return levelHandler{level: h.level, Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h levelHandler) WithGroup(name string) slog.Handler {
+	return levelHandler{level: h.level, Handler: h.Handler.WithGroup(name)}
+}
+
+// recentErrorCount is how many of the latest errors logged are kept for the
+// status page.
+const recentErrorCount = 20
+
+// errorEntry is an error logged by the spawner.
+type errorEntry struct {
+	Time      time.Time         `json:"time"`
+	Subsystem string            `json:"subsystem,omitempty"`
+	Message   string            `json:"message"`
+	Attrs     map[string]string `json:"attrs,omitempty"`
+}
+
+// errorLog keeps the latest errors logged.
+type errorLog struct {
+	mu      sync.Mutex
+	entries []errorEntry
+}
+
+// recentErrors holds the errors logged by all subsystems.
+var recentErrors errorLog
+
+// add appends entry, dropping the oldest one if there are too many.
+func (l *errorLog) add(entry errorEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > recentErrorCount {
+		l.entries = slices.Delete(l.entries, 0, len(l.entries)-recentErrorCount)
+	}
+}
+
+// snapshot returns a copy of the errors, oldest first.
+func (l *errorLog) snapshot() []errorEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.entries)
+}
+
+// errorRecorder adds the records of level error and above to recentErrors,
+// with the attributes of the logger, before passing them on.
+type errorRecorder struct {
+	slog.Handler
+	attrs []slog.Attr
+}
+
+func (h errorRecorder) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		entry := errorEntry{Time: r.Time, Message: r.Message, Attrs: make(map[string]string)}
+		add := func(a slog.Attr) bool {
+			if a.Key == "subsystem" {
+				entry.Subsystem = a.Value.String()
+			} else {
+				entry.Attrs[a.Key] = a.Value.String()
+			}
+			return true
+		}
+		for _, a := range h.attrs {
+			add(a)
+		}
+		r.Attrs(add)
+		recentErrors.add(entry)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h errorRecorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return errorRecorder{Handler: h.Handler.WithAttrs(attrs), attrs: slices.Concat(h.attrs, attrs)}
+}
+
+func (h errorRecorder) WithGroup(name string) slog.Handler {
+	return errorRecorder{Handler: h.Handler.WithGroup(name), attrs: h.attrs}
+}
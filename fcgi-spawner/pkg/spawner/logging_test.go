@@ -0,0 +1,61 @@
+package spawner
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"testing"
+)
+
+func TestSetLogLevels(t *testing.T) {
+	t.Cleanup(func() { SetLogLevels("info") })
+
+	tests := []struct {
+		spec      string
+		wantErr   bool
+		wantSpawn slog.Level
+		wantProxy slog.Level
+	}{
+		{spec: "debug", wantSpawn: slog.LevelDebug, wantProxy: slog.LevelDebug},
+		{spec: "warn,proxy=debug", wantSpawn: slog.LevelWarn, wantProxy: slog.LevelDebug},
+		{spec: "ERROR, spawn=info", wantSpawn: slog.LevelInfo, wantProxy: slog.LevelError},
+		{spec: "loud", wantErr: true},
+		{spec: "info,nosuch=debug", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			err := SetLogLevels(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetLogLevels(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := logLevels["spawn"].Level(); got != tt.wantSpawn {
+				t.Errorf("spawn level = %v, want %v", got, tt.wantSpawn)
+			}
+			if got := logLevels["proxy"].Level(); got != tt.wantProxy {
+				t.Errorf("proxy level = %v, want %v", got, tt.wantProxy)
+			}
+			if proxyLog.Enabled(context.Background(), slog.LevelDebug) != (tt.wantProxy <= slog.LevelDebug) {
+				t.Errorf("proxy logger does not follow its level")
+			}
+		})
+	}
+}
+
+func TestLogTail(t *testing.T) {
+	var tail logTail
+	for i := range appLogLines + 5 {
+		tail.add("/web/a.fcgi", 1, "stdout", strconv.Itoa(i))
+	}
+	tail.add("/web/b.fcgi", 2, "stderr", "b")
+
+	apps := tail.snapshot()
+	if lines := apps["/web/a.fcgi"]; len(lines) != appLogLines || lines[0].Line != "5" || lines[len(lines)-1].Line != strconv.Itoa(appLogLines+4) {
+		t.Errorf("snapshot() kept %d lines from %q, want the latest %d", len(lines), lines[0].Line, appLogLines)
+	}
+	if lines := apps["/web/b.fcgi"]; len(lines) != 1 || lines[0].Stream != "stderr" {
+		t.Errorf("snapshot() = %+v for b.fcgi, want its line", lines)
+	}
+}
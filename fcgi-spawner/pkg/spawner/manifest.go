@@ -0,0 +1,50 @@
+package spawner
+
+import (
+	"os/exec"
+	"path/filepath"
+)
+
+// declaredApp returns the entry of Config.Apps for the application at
+// appPath, keyed by its path relative to the web root of its site.
+func (s *Spawner) declaredApp(appPath string) (AppConfig, bool) {
+	rel, err := filepath.Rel(s.siteOf(appPath).webRoot, appPath)
+	if err != nil || !filepath.IsLocal(rel) {
+		return AppConfig{}, false
+	}
+	app, ok := s.Config.Apps[filepath.ToSlash(rel)]
+	return app, ok
+}
+
+// hasCommand reports whether the application at appPath is declared with a
+// command, in which case no file needs to exist at appPath.
+func (s *Spawner) hasCommand(appPath string) bool {
+	app, ok := s.declaredApp(appPath)
+	return ok && app.Command != ""
+}
+
+// mayRun reports whether the application or CGI script at path may be run.
+// In manifest mode only those declared in Config.Apps may, so that
+// executables appearing in a web root are never run.
+func (s *Spawner) mayRun(path string) bool {
+	if !s.Config.Manifest {
+		return true
+	}
+	_, ok := s.declaredApp(path)
+	return ok
+}
+
+// isCGIScript reports whether path is a CGI script that may be run.
+func (s *Spawner) isCGIScript(path string) bool {
+	return isCGI(path) && s.mayRun(path)
+}
+
+// appBinary returns the file run for the application at appPath, whose
+// changes restart it: the command of the app, if it has one, looked up in
+// PATH, and the file at appPath otherwise.
+func (s *Spawner) appBinary(appPath string, app AppConfig) (string, error) {
+	if app.Command == "" {
+		return appPath, nil
+	}
+	return exec.LookPath(app.Command)
+}
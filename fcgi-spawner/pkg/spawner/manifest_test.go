@@ -0,0 +1,74 @@
+package spawner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManifest(t *testing.T) {
+	webRoot, bin := t.TempDir(), t.TempDir()
+	script := []byte("#!/bin/sh\nexec sleep 30\n")
+	for _, path := range []string{
+		filepath.Join(webRoot, "declared.fcgi"),
+		filepath.Join(webRoot, "stray.fcgi"),
+		filepath.Join(webRoot, "stray.cgi"),
+		filepath.Join(bin, "server"),
+	} {
+		if err := os.WriteFile(path, script, 0755); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(webRoot, "declared.fcgi.yaml"), []byte("args: [-debug]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write sidecar file: %v", err)
+	}
+	apps := map[string]AppConfig{
+		"declared.fcgi": {},
+		"api":           {Command: filepath.Join(bin, "server")},
+	}
+
+	tests := []struct {
+		manifest bool
+		urlPath  string
+		want     string
+	}{
+		{true, "/declared.fcgi/x", "declared.fcgi"},
+		{true, "/api/users", "api"},
+		{true, "/stray.fcgi", ""},
+		{true, "/stray.cgi", ""},
+		{false, "/stray.fcgi", "stray.fcgi"},
+		{false, "/stray.cgi", "stray.cgi"},
+		{false, "/api/users", "api"},
+	}
+	for _, tt := range tests {
+		s := NewSpawner(&Config{WebRoot: webRoot, Apps: apps, Manifest: tt.manifest})
+		got, err := s.findApp(webRoot, tt.urlPath)
+		want := ""
+		if tt.want != "" {
+			want = filepath.Join(webRoot, tt.want)
+		}
+		if err != nil || got != want {
+			t.Errorf("findApp(%q) with manifest %v = %q, %v, want %q", tt.urlPath, tt.manifest, got, err, want)
+		}
+	}
+
+	s := NewSpawner(&Config{WebRoot: webRoot, Apps: apps, Manifest: true})
+	defer s.stopAllChildren(time.Second)
+	if app, err := s.appConfig(filepath.Join(webRoot, "declared.fcgi")); err != nil || app.Args != nil {
+		t.Errorf("appConfig() = %+v, %v, want the sidecar file ignored", app, err)
+	}
+	child, _, err := s.getOrCreateChild(context.Background(), filepath.Join(webRoot, "api"), nil)
+	if err != nil {
+		t.Fatalf("getOrCreateChild() of a command error = %v", err)
+	}
+	s.releaseChild(child)
+	if apps := s.prewarmApps(); len(apps) != 0 {
+		t.Errorf("prewarmApps() = %q without prewarmAll", apps)
+	}
+	s.Config.PrewarmAll = true
+	if apps := s.prewarmApps(); len(apps) != 2 {
+		t.Errorf("prewarmApps() = %q, want the declared applications", apps)
+	}
+}
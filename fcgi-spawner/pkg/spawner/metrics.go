@@ -0,0 +1,118 @@
+package spawner
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencySamples is how many of the latest request durations of an
+// application are kept to compute its latency percentiles.
+const latencySamples = 1024
+
+// requestMetrics counts the requests served by each application. The zero
+// value is ready to use.
+type requestMetrics struct {
+	mu   sync.Mutex
+	apps map[string]*appMetrics // By app path
+}
+
+// appMetrics are the request metrics of a single application.
+type appMetrics struct {
+	requests  int64
+	errors    int64 // Requests answered with a 5xx status
+	inFlight  int
+	latencies [latencySamples]time.Duration // Ring buffer of the latest durations
+	next      int
+	samples   int
+}
+
+// begin counts a request to the application at appPath as in flight. The
+// returned function records its completion with the status it was answered
+// with.
+func (m *requestMetrics) begin(appPath string) func(status int) {
+	start := time.Now()
+	m.mu.Lock()
+	if m.apps == nil {
+		m.apps = make(map[string]*appMetrics)
+	}
+	app := m.apps[appPath]
+	if app == nil {
+		app = &appMetrics{}
+		m.apps[appPath] = app
+	}
+	app.inFlight++
+	m.mu.Unlock()
+
+	return func(status int) {
+		elapsed := time.Since(start)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		app.inFlight--
+		app.requests++
+		if status >= http.StatusInternalServerError {
+			app.errors++
+		}
+		app.latencies[app.next] = elapsed
+		app.next = (app.next + 1) % latencySamples
+		app.samples = min(app.samples+1, latencySamples)
+	}
+}
+
+// appRequestStats describes the requests served by an application.
+type appRequestStats struct {
+	App       string             `json:"app"`
+	Requests  int64              `json:"requests"`
+	Errors    int64              `json:"errors"`
+	InFlight  int                `json:"inFlight"`
+	LatencyMs latencyPercentiles `json:"latencyMs"`
+}
+
+// latencyPercentiles summarizes the latest request durations in
+// milliseconds.
+type latencyPercentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// snapshot returns the metrics of every application that got requests,
+// ordered by path.
+func (m *requestMetrics) snapshot() []appRequestStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]appRequestStats, 0, len(m.apps))
+	for appPath, app := range m.apps {
+		latencies := slices.Clone(app.latencies[:app.samples])
+		slices.Sort(latencies)
+		stats = append(stats, appRequestStats{
+			App:      appPath,
+			Requests: app.requests,
+			Errors:   app.errors,
+			InFlight: app.inFlight,
+			LatencyMs: latencyPercentiles{
+				P50: percentile(latencies, 0.5),
+				P90: percentile(latencies, 0.9),
+				P99: percentile(latencies, 0.99),
+				Max: percentile(latencies, 1),
+			},
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].App < stats[j].App })
+	return stats
+}
+
+// percentile returns the p-th percentile of the sorted durations in
+// milliseconds, or 0 if there are none.
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := max(int(math.Ceil(p*float64(len(sorted))))-1, 0)
+	return float64(sorted[i].Microseconds()) / 1000
+}
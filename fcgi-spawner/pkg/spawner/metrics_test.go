@@ -0,0 +1,71 @@
+package spawner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	var m requestMetrics
+	done := m.begin("/web/a.fcgi")
+	if stats := m.snapshot(); len(stats) != 1 || stats[0].InFlight != 1 || stats[0].Requests != 0 {
+		t.Errorf("snapshot() = %+v, want one request in flight", stats)
+	}
+	done(http.StatusOK)
+	m.begin("/web/a.fcgi")(http.StatusBadGateway)
+	m.begin("/web/b.fcgi")(http.StatusNotFound)
+
+	stats := m.snapshot()
+	if len(stats) != 2 || stats[0].App != "/web/a.fcgi" || stats[1].App != "/web/b.fcgi" {
+		t.Fatalf("snapshot() = %+v, want both apps in order", stats)
+	}
+	if a := stats[0]; a.Requests != 2 || a.Errors != 1 || a.InFlight != 0 {
+		t.Errorf("snapshot() = %+v, want 2 requests, one of them failed", a)
+	}
+	if b := stats[1]; b.Requests != 1 || b.Errors != 0 {
+		t.Errorf("snapshot() = %+v, want one successful request", b)
+	}
+
+	// Only the latest durations count.
+	app := m.apps["/web/a.fcgi"]
+	for i := range latencySamples + 10 {
+		app.latencies[app.next] = time.Duration(i+1) * time.Millisecond
+		app.next = (app.next + 1) % latencySamples
+		app.samples = min(app.samples+1, latencySamples)
+	}
+	want := latencyPercentiles{P50: 522, P90: 932, P99: 1024, Max: 1034}
+	if got := m.snapshot()[0].LatencyMs; got != want {
+		t.Errorf("latencies = %+v, want %+v", got, want)
+	}
+}
+
+func TestAdminMetrics(t *testing.T) {
+	webRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(webRoot, "ok.cgi"), []byte("#!/bin/sh\nprintf 'Content-Type: text/plain\\r\\n\\r\\nok'\n"), 0755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(webRoot, "page.txt"), []byte("static"), 0644); err != nil {
+		t.Fatalf("Failed to write page: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot, AdminToken: "secret"})
+	for _, path := range []string{"/ok.cgi", "/ok.cgi/sub", "/page.txt"} {
+		s.spawnerHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	s.AdminHandler().ServeHTTP(rec, req)
+	var stats []appRequestStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode metrics: %v", err)
+	}
+	if len(stats) != 1 || stats[0].App != filepath.Join(webRoot, "ok.cgi") || stats[0].Requests != 2 || stats[0].LatencyMs.Max <= 0 {
+		t.Errorf("GET /metrics = %+v, want two requests to ok.cgi", stats)
+	}
+}
@@ -0,0 +1,432 @@
+package spawner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// stateFileName is the file in the socket directory of a spawner listing
+// the processes it runs, see saveState.
+const stateFileName = "spawner-state.json"
+
+// orphanDialTimeout is how long the socket of an orphaned process may take
+// to accept a connection before it counts as dead.
+const orphanDialTimeout = time.Second
+
+// slotDirPattern matches the directories of spawners in other slots below
+// the socket directory, see slotDir.
+var slotDirPattern = regexp.MustCompile(`^spawner-[0-9]+$`)
+
+// childState is a process in the state file.
+type childState struct {
+	App      string `json:"app"`
+	Instance int    `json:"instance"`
+	PID      int    `json:"pid"`
+	// StartTime tells the process apart from a later one reusing its PID,
+	// see procStartTime.
+	StartTime     int64     `json:"startTime"`
+	Socket        string    `json:"socket"`
+	Binary        string    `json:"binary"`
+	Started       time.Time `json:"started"`
+	BinaryModTime time.Time `json:"binaryModTime"`
+	EnvFiles      []string  `json:"envFiles,omitempty"`
+	EnvModTime    time.Time `json:"envModTime"`
+	TmpDir        string    `json:"tmpDir,omitempty"`
+	Draining      bool      `json:"draining,omitempty"`
+	// Settings are the AppConfig the process was started with.
+	Settings json.RawMessage `json:"settings"`
+}
+
+// procStartTime returns the time the process with the given PID started, in
+// clock ticks after boot.
+func procStartTime(pid int) (int64, error) {
+	field, err := readProcStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	return field(22)
+}
+
+// stateFile returns the path of the state file of the spawner.
+func (s *Spawner) stateFile() string {
+	return filepath.Join(s.Config.SocketDir, s.slotDir(), stateFileName)
+}
+
+// saveState writes the processes the spawner runs in socket mode to its
+// state file, so that the next spawner can deal with them if it exits
+// without stopping them, see recoverOrphans. Processes that have exited
+// since are told apart by their start time, so the file is only written
+// when processes are added. The caller must hold childProcessesMu.
+func (s *Spawner) saveState() {
+	if s.Config.SocketDir == "" {
+		return
+	}
+	entries := []childState{}
+	running := slices.Collect(maps.Values(s.childProcesses))
+	for i, child := range slices.Concat(running, s.draining) {
+		process := child.cmd.Process()
+		// Stdio processes end with the spawner, and containers are
+		// left to the container runtime.
+		if process == nil || child.listener != nil || child.container != "" {
+			continue
+		}
+		startTime, err := procStartTime(process.Pid())
+		if err != nil {
+			// Exited already
+			continue
+		}
+		settings, err := json.Marshal(child.app)
+		if err != nil {
+			spawnLog.Error("Failed to encode settings for the state file", "app", child.binaryPath, "error", err)
+			continue
+		}
+		entries = append(entries, childState{
+			App:           child.binaryPath,
+			Instance:      child.instance,
+			PID:           process.Pid(),
+			StartTime:     startTime,
+			Socket:        child.socketPath,
+			Binary:        child.cmd.Path(),
+			Started:       child.started,
+			BinaryModTime: child.binaryModTime,
+			EnvFiles:      child.envFiles,
+			EnvModTime:    child.envModTime,
+			TmpDir:        child.tmpDir,
+			Draining:      i >= len(running),
+			Settings:      settings,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].App != entries[j].App {
+			return entries[i].App < entries[j].App
+		}
+		return entries[i].Instance < entries[j].Instance
+	})
+	path := s.stateFile()
+	if err := writeStateFile(path, entries); err != nil {
+		spawnLog.Error("Failed to save state file", "path", path, "error", err)
+	}
+}
+
+// writeStateFile writes entries to the state file at path, replacing it
+// atomically, so that a spawner killed meanwhile doesn't leave it half
+// written.
+func writeStateFile(path string, entries []childState) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// recoverOrphans deals with what a previous spawner using the same socket
+// directory left behind when it exited without stopping its processes,
+// e.g. because it was killed or crashed. The processes of its state file
+// that still run are adopted if Config.AdoptOrphans is set and they match
+// their application as it is now, and stopped otherwise. Sockets that no
+// process accepts connections on anymore are removed, so that they don't
+// get in the way of new processes. It runs before any process starts.
+func (s *Spawner) recoverOrphans() {
+	path := s.stateFile()
+	if err := s.makeSocketDir(filepath.Dir(path)); err != nil {
+		spawnLog.Error("Failed to create socket directory", "dir", filepath.Dir(path), "error", err)
+		return
+	}
+	var entries []childState
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &entries)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		spawnLog.Warn("Ignoring invalid state file", "path", path, "error", err)
+	}
+
+	var wg sync.WaitGroup
+	s.childProcessesMu.Lock()
+	adopted := make(map[string]bool)
+	for _, entry := range entries {
+		child, err := orphanedChild(entry)
+		if err != nil {
+			// Most likely, it exited with the previous spawner.
+			spawnLog.Debug("Orphaned child process is gone", "app", entry.App, "pid", entry.PID, "error", err)
+			continue
+		}
+		reason := s.adoptOrphan(child, entry)
+		if reason == "" {
+			adopted[child.socketPath] = true
+			continue
+		}
+		spawnLog.Info("Stopping orphaned child process", "app", entry.App, "pid", entry.PID, "reason", reason)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.stopChild(child)
+		}()
+	}
+	s.childProcessesMu.Unlock()
+	wg.Wait()
+
+	s.removeStaleSockets(adopted)
+	s.childProcessesMu.Lock()
+	s.saveState()
+	s.childProcessesMu.Unlock()
+}
+
+// orphanedChild returns the process of entry as a child process, if it
+// still runs.
+func orphanedChild(entry childState) (*childProcess, error) {
+	process, err := newAdoptedProcess(entry.PID)
+	if err != nil {
+		return nil, err
+	}
+	// Checked once the process is held by its pidfd, so that its PID can't
+	// be reused meanwhile.
+	if startTime, err := procStartTime(entry.PID); err != nil || startTime != entry.StartTime {
+		process.close()
+		return nil, fmt.Errorf("PID %d was reused", entry.PID)
+	}
+	var app AppConfig
+	if err := json.Unmarshal(entry.Settings, &app); err != nil {
+		// The defaults are good enough to stop it.
+		spawnLog.Warn("Invalid settings in state file", "app", entry.App, "error", err)
+	}
+	return &childProcess{
+		cmd:           &adoptedCmd{path: entry.Binary, process: process},
+		socketPath:    entry.Socket,
+		lastUsed:      time.Now(),
+		started:       entry.Started,
+		binaryPath:    entry.App,
+		instance:      entry.Instance,
+		app:           app,
+		binaryModTime: entry.BinaryModTime,
+		envFiles:      entry.EnvFiles,
+		envModTime:    entry.EnvModTime,
+		tmpDir:        entry.TmpDir,
+	}, nil
+}
+
+// adoptOrphan adds child, the process of entry, to the running processes
+// if it may be adopted, and otherwise returns why it may not. The caller
+// must hold childProcessesMu.
+func (s *Spawner) adoptOrphan(child *childProcess, entry childState) string {
+	appPath := child.binaryPath
+	switch {
+	case !s.Config.AdoptOrphans:
+		return "adoptOrphans is off"
+	case entry.Draining:
+		return "it was being stopped"
+	case !s.isApp(appPath):
+		return "no longer an application"
+	case s.childProcesses[instanceKey(appPath, child.instance)] != nil:
+		return "instance already running"
+	}
+	app, err := s.appConfig(appPath)
+	if err != nil {
+		return err.Error()
+	}
+	settings, err := json.Marshal(app)
+	if err != nil {
+		return err.Error()
+	}
+	binary, err := s.appBinary(appPath, app)
+	if err != nil {
+		return err.Error()
+	}
+	info, err := os.Stat(binary)
+	if err != nil {
+		return err.Error()
+	}
+	// The settings of the state file are indented.
+	var saved bytes.Buffer
+	if err := json.Compact(&saved, entry.Settings); err != nil {
+		return err.Error()
+	}
+	envFiles := s.envFiles(appPath)
+	if !info.ModTime().Equal(child.binaryModTime) || !latestModTime(envFiles).Equal(child.envModTime) || !slices.Equal(envFiles, child.envFiles) || !bytes.Equal(settings, saved.Bytes()) {
+		return "application changed"
+	}
+	conn, err := net.DialTimeout("unix", child.socketPath, orphanDialTimeout)
+	if err != nil {
+		return fmt.Sprintf("socket doesn't accept connections: %v", err)
+	}
+	conn.Close()
+	if err := s.lockSingleton(appPath, app); err != nil {
+		return err.Error()
+	}
+
+	// The parsed settings, which the state file leaves out, are needed as
+	// well for the process to count as up to date, see ensurePool.
+	child.app = app
+	s.childProcesses[instanceKey(appPath, child.instance)] = child
+	s.watchChild(child)
+	spawnLog.Info("Adopted orphaned child process", "app", instanceKey(appPath, child.instance), "pid", entry.PID, "socket", child.socketPath)
+	if app.Protocol == "" || app.Protocol == protocolFastCGI {
+		go s.negotiate(child)
+	}
+	return ""
+}
+
+// removeStaleSockets removes the sockets in the socket directory of the
+// spawner that no process accepts connections on, except those of adopted
+// processes.
+func (s *Spawner) removeStaleSockets(adopted map[string]bool) {
+	root := filepath.Join(s.Config.SocketDir, s.slotDir())
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && filepath.Dir(path) == root && s.slotDir() == "" && slotDirPattern.MatchString(d.Name()) {
+			// Sockets of another spawner
+			return filepath.SkipDir
+		}
+		if d.Type()&fs.ModeSocket == 0 || adopted[path] {
+			return nil
+		}
+		conn, err := net.DialTimeout("unix", path, orphanDialTimeout)
+		if err == nil {
+			conn.Close()
+			spawnLog.Warn("Socket is in use by an unknown process", "socket", path)
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			spawnLog.Error("Error removing stale socket file", "socket", path, "error", err)
+			return nil
+		}
+		spawnLog.Info("Removed stale socket file", "socket", path)
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		spawnLog.Error("Failed to look for stale sockets", "dir", root, "error", err)
+	}
+}
+
+// adoptedCmd implements cmdInterface for a process started by a previous
+// spawner, see recoverOrphans.
+type adoptedCmd struct {
+	path    string
+	process *adoptedProcess
+}
+
+func (c *adoptedCmd) Start() error {
+	return errors.New("adopted process is running already")
+}
+
+func (c *adoptedCmd) Process() processInterface {
+	return c.process
+}
+
+// ProcessState is always nil, as the exit status of a process that isn't a
+// child of the spawner is unknown.
+func (c *adoptedCmd) ProcessState() *os.ProcessState {
+	return nil
+}
+
+func (c *adoptedCmd) Path() string {
+	return c.path
+}
+
+// adoptedProcess implements processInterface for a process that isn't a
+// child of the spawner, through a pidfd, which keeps signals from reaching
+// another process reusing its PID and tells when it exits.
+type adoptedProcess struct {
+	pid  int
+	done chan struct{} // Closed once the process has exited
+
+	mu sync.Mutex
+	fd int // -1 once closed
+}
+
+// newAdoptedProcess opens the process with the given PID.
+func newAdoptedProcess(pid int) (*adoptedProcess, error) {
+	fd, err := unix.PidfdOpen(pid, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("pidfd_open", err)
+	}
+	p := &adoptedProcess{pid: pid, fd: fd, done: make(chan struct{})}
+	go p.wait()
+	return p, nil
+}
+
+// wait closes done once the process has exited, or its pidfd is closed.
+func (p *adoptedProcess) wait() {
+	defer close(p.done)
+	defer p.close()
+	for {
+		p.mu.Lock()
+		fd := p.fd
+		p.mu.Unlock()
+		if fd < 0 {
+			return
+		}
+		// The pidfd becomes readable once the process exits. The timeout
+		// notices the pidfd being closed.
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, 1000)
+		if err != nil && err != unix.EINTR {
+			spawnLog.Error("Error waiting for adopted process", "pid", p.pid, "error", err)
+			return
+		}
+		if n > 0 {
+			return
+		}
+	}
+}
+
+// close closes the pidfd.
+func (p *adoptedProcess) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fd >= 0 {
+		unix.Close(p.fd)
+		p.fd = -1
+	}
+}
+
+func (p *adoptedProcess) Signal(sig os.Signal) error {
+	signal, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("unsupported signal %v", sig)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fd < 0 {
+		return os.ErrProcessDone
+	}
+	err := unix.PidfdSendSignal(p.fd, signal, nil, 0)
+	if errors.Is(err, unix.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+func (p *adoptedProcess) Wait() (*os.ProcessState, error) {
+	<-p.done
+	return nil, nil
+}
+
+func (p *adoptedProcess) Kill() error {
+	return p.Signal(syscall.SIGKILL)
+}
+
+func (p *adoptedProcess) Pid() int {
+	return p.pid
+}
@@ -0,0 +1,126 @@
+package spawner
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecoverOrphans(t *testing.T) {
+	webRoot, socketDir := t.TempDir(), t.TempDir()
+	appPath := filepath.Join(webRoot, "app.fcgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	info, err := os.Stat(appPath)
+	if err != nil {
+		t.Fatalf("Failed to stat app: %v", err)
+	}
+	s := NewSpawner(&Config{
+		WebRoot:      webRoot,
+		SocketDir:    socketDir,
+		AdoptOrphans: true,
+		Apps:         map[string]AppConfig{"app.fcgi": {Protocol: protocolSCGI}},
+	})
+	t.Cleanup(func() { s.stopAllChildren(time.Second) })
+
+	// Processes left by a previous spawner, with the sockets they listen
+	// on, as recorded in its state file.
+	orphan := func(instance int, app AppConfig) (<-chan struct{}, childState) {
+		cmd := exec.Command("sleep", "30")
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Failed to start orphan: %v", err)
+		}
+		exited := make(chan struct{})
+		go func() {
+			cmd.Wait()
+			close(exited)
+		}()
+		t.Cleanup(func() {
+			cmd.Process.Kill()
+			<-exited
+		})
+		startTime, err := procStartTime(cmd.Process.Pid)
+		if err != nil {
+			t.Fatalf("procStartTime() error = %v", err)
+		}
+		socketPath := filepath.Join(socketDir, s.appSocketName(appPath, instance))
+		ln, err := net.Listen("unix", socketPath)
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		settings, _ := json.Marshal(app)
+		return exited, childState{
+			App:           appPath,
+			Instance:      instance,
+			PID:           cmd.Process.Pid,
+			StartTime:     startTime,
+			Socket:        socketPath,
+			Binary:        appPath,
+			Started:       time.Now(),
+			BinaryModTime: info.ModTime(),
+			Settings:      settings,
+		}
+	}
+	adoptedExited, adoptableEntry := orphan(0, AppConfig{Protocol: protocolSCGI})
+	changedExited, changedEntry := orphan(1, AppConfig{Protocol: protocolSCGI, Env: map[string]string{"OLD": "1"}})
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Fatalf("Failed to run process: %v", err)
+	}
+	gone := childState{App: appPath, Instance: 2, PID: exited.Process.Pid, StartTime: 1}
+	if err := writeStateFile(s.stateFile(), []childState{adoptableEntry, changedEntry, gone}); err != nil {
+		t.Fatalf("writeStateFile() error = %v", err)
+	}
+
+	// A socket nothing listens on anymore.
+	stale := filepath.Join(socketDir, "stale.fcgi.sock")
+	ln, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	s.recoverOrphans()
+
+	child := s.childProcesses[appPath]
+	if child == nil || child.cmd.Process().Pid() != adoptableEntry.PID {
+		t.Fatalf("recoverOrphans() didn't adopt the matching orphan, children = %v", s.childProcesses)
+	}
+	if _, ok := s.childProcesses[instanceKey(appPath, 1)]; ok {
+		t.Error("recoverOrphans() adopted the orphan with other settings")
+	}
+	select {
+	case <-changedExited:
+	case <-time.After(5 * time.Second):
+		t.Error("recoverOrphans() didn't stop the orphan with other settings")
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Stale socket still exists: %v", err)
+	}
+	if _, err := os.Stat(adoptableEntry.Socket); err != nil {
+		t.Errorf("Socket of the adopted orphan is gone: %v", err)
+	}
+	var entries []childState
+	data, err := os.ReadFile(s.stateFile())
+	if err == nil {
+		err = json.Unmarshal(data, &entries)
+	}
+	if err != nil || len(entries) != 1 || entries[0].PID != adoptableEntry.PID {
+		t.Errorf("State file = %s, %v, want the adopted orphan", data, err)
+	}
+
+	// The adopted orphan is stopped like the others.
+	s.stopAllChildren(time.Second)
+	select {
+	case <-adoptedExited:
+	case <-time.After(5 * time.Second):
+		t.Error("stopAllChildren() didn't stop the adopted orphan")
+	}
+}
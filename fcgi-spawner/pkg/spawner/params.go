@@ -0,0 +1,107 @@
+package spawner
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// paramData is what the templates of AppConfig.Params can refer to, e.g.
+// SERVER_NAME: "{{.Host}}".
+type paramData struct {
+	Host       string      // Host name of the request, without port
+	Scheme     string      // http or https, as seen by the client
+	Method     string      // Request method
+	Path       string      // URL path
+	RemoteAddr string      // Client address
+	App        string      // Path of the application relative to its webRoot
+	Header     http.Header // Request headers, e.g. {{.Header.Get "Accept-Language"}}
+}
+
+// paramTemplates caches the parsed templates of AppConfig.Params by text.
+var paramTemplates sync.Map
+
+// paramTemplate returns the parsed template text.
+func paramTemplate(text string) (*template.Template, error) {
+	if tmpl, ok := paramTemplates.Load(text); ok {
+		return tmpl.(*template.Template), nil
+	}
+	tmpl, err := template.New("param").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	paramTemplates.Store(text, tmpl)
+	return tmpl, nil
+}
+
+// validateParams checks the Params templates and PassEnv names of an app.
+func (c AppConfig) validateParams() error {
+	for name, text := range c.Params {
+		if name == "" {
+			return errors.New("params: empty name")
+		}
+		if _, err := paramTemplate(text); err != nil {
+			return fmt.Errorf("params: %s: %v", name, err)
+		}
+	}
+	for _, name := range c.PassEnv {
+		if name == "" || strings.Contains(name, "=") {
+			return fmt.Errorf("passEnv: invalid variable name %q", name)
+		}
+	}
+	return nil
+}
+
+// addAppParams adds the PassEnv variables of the spawner's environment and
+// the Params of app to env, the variables describing r sent to the
+// application at appPath. They take precedence over the standard variables.
+func (s *Spawner) addAppParams(env map[string]string, r *http.Request, appPath string, app AppConfig) {
+	for _, name := range app.PassEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = value
+		}
+	}
+	if len(app.Params) == 0 {
+		return
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	client := s.clientInfo(r)
+	data := paramData{
+		Host:       host,
+		Scheme:     "http",
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		RemoteAddr: client.addr,
+		App:        filepath.ToSlash(s.relApp(appPath)),
+		Header:     r.Header,
+	}
+	if client.https {
+		data.Scheme = "https"
+	}
+	for name, text := range app.Params {
+		if !strings.Contains(text, "{{") {
+			env[name] = text
+			continue
+		}
+		tmpl, err := paramTemplate(text)
+		if err != nil {
+			proxyLog.Warn("Invalid param template", "app", appPath, "param", name, "error", err)
+			continue
+		}
+		var value strings.Builder
+		if err := tmpl.Execute(&value, data); err != nil {
+			proxyLog.Warn("Error expanding param", "app", appPath, "param", name, "error", err)
+			continue
+		}
+		env[name] = value.String()
+	}
+}
@@ -0,0 +1,79 @@
+package spawner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddAppParams(t *testing.T) {
+	t.Setenv("SPAWNER_TEST_REGION", "eu-west-1")
+	s := NewSpawner(&Config{WebRoot: "/web"})
+	app := AppConfig{
+		Params: map[string]string{
+			"APP_ENV":     "prod",
+			"SERVER_NAME": "{{.Host}}",
+			"BASE_URL":    "{{.Scheme}}://{{.Host}}/{{.App}}",
+			"LANG":        `{{.Header.Get "Accept-Language"}}`,
+			"BROKEN":      "{{.Missing}}",
+		},
+		PassEnv: []string{"SPAWNER_TEST_REGION", "SPAWNER_TEST_UNSET"},
+	}
+	r := httptest.NewRequest(http.MethodGet, "http://example.com:8080/api/users.fcgi/42", nil)
+	r.Header.Set("Accept-Language", "fr")
+	env := map[string]string{"SERVER_NAME": "overridden"}
+	s.addAppParams(env, r, "/web/api/users.fcgi", app)
+
+	want := map[string]string{
+		"APP_ENV":             "prod",
+		"SERVER_NAME":         "example.com",
+		"BASE_URL":            "http://example.com/api/users.fcgi",
+		"LANG":                "fr",
+		"SPAWNER_TEST_REGION": "eu-west-1",
+	}
+	for name, value := range want {
+		if env[name] != value {
+			t.Errorf("%s = %q, want %q", name, env[name], value)
+		}
+	}
+	for _, name := range []string{"BROKEN", "SPAWNER_TEST_UNSET"} {
+		if value, ok := env[name]; ok {
+			t.Errorf("%s = %q, want it unset", name, value)
+		}
+	}
+}
+
+func TestAppParamsValidation(t *testing.T) {
+	tests := []struct {
+		app     AppConfig
+		wantErr bool
+	}{
+		{app: AppConfig{Params: map[string]string{"A": "{{.Host}}"}, PassEnv: []string{"HOME"}}},
+		{app: AppConfig{Params: map[string]string{"A": "{{.Host"}}, wantErr: true},
+		{app: AppConfig{PassEnv: []string{"A=B"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.app.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("validate(%+v) error = %v, wantErr %v", tt.app, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAppParamsCGI(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "env.cgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nprintf 'Content-Type: text/plain\\r\\n\\r\\n%s %s' \"$APP_ENV\" \"$SERVER_NAME\"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	if err := os.WriteFile(appPath+".yaml", []byte("params:\n  APP_ENV: staging\n  SERVER_NAME: \"{{.Host}}\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot})
+	w := httptest.NewRecorder()
+	s.spawnerHandler(w, httptest.NewRequest(http.MethodGet, "http://shop.example.com/env.cgi", nil))
+	if got := w.Body.String(); got != "staging shop.example.com" {
+		t.Errorf("body = %q, want the params", got)
+	}
+}
@@ -0,0 +1,156 @@
+package spawner
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Strategies for spreading requests over the instances of an application.
+const (
+	balanceLeastConnections = "least-connections"
+	balanceRoundRobin       = "round-robin"
+)
+
+// minInstances returns how many instances of the app are started together and
+// kept running while the app is in use.
+func (c AppConfig) minInstances() int {
+	return max(c.MinInstances, 1)
+}
+
+// maxInstances returns how many instances of the app may run at once.
+func (c AppConfig) maxInstances() int {
+	return max(c.MaxInstances, c.minInstances())
+}
+
+// scaleThreshold returns the number of concurrent requests of an instance at
+// which another instance of the app is started.
+func (c AppConfig) scaleThreshold() int {
+	return max(c.ScaleThreshold, 1)
+}
+
+// backoffMultiplier returns the factor by which the time an application isn't
+// respawned after failing grows with every consecutive failure.
+func (c AppConfig) backoffMultiplier() float64 {
+	if c.BackoffMultiplier > 0 {
+		return c.BackoffMultiplier
+	}
+	return 2
+}
+
+// instanceKey returns the key of an instance in Spawner.childProcesses. The
+// first instance is keyed by the application path alone.
+func instanceKey(appPath string, instance int) string {
+	if instance == 0 {
+		return appPath
+	}
+	return fmt.Sprintf("%s#%d", appPath, instance)
+}
+
+// instanceSocketName returns the path of the socket of an instance relative
+// to the socket directory, given the path of the app relative to WebRoot. Apps
+// in subdirectories get their sockets in the same subdirectories.
+func instanceSocketName(relApp string, instance int) string {
+	if instance == 0 {
+		return relApp + ".sock"
+	}
+	return fmt.Sprintf("%s.%d.sock", relApp, instance)
+}
+
+// pool returns the running instances of the application at appPath, ordered by
+// instance. The caller must hold childProcessesMu.
+func (s *Spawner) pool(appPath string) []*childProcess {
+	var pool []*childProcess
+	for _, child := range s.childProcesses {
+		if child.binaryPath == appPath {
+			pool = append(pool, child)
+		}
+	}
+	slices.SortFunc(pool, func(a, b *childProcess) int { return a.instance - b.instance })
+	return pool
+}
+
+// freeInstance returns the lowest instance number not used in pool.
+func freeInstance(pool []*childProcess) int {
+	for n := 0; ; n++ {
+		if !slices.ContainsFunc(pool, func(c *childProcess) bool { return c.instance == n }) {
+			return n
+		}
+	}
+}
+
+// pick chooses the instance of pool that serves the request r, which may be
+// nil, and reports whether the client of r sticks to it, see stickyChild. The
+// caller must hold childProcessesMu.
+func (s *Spawner) pick(appPath string, pool []*childProcess, balance string, r *http.Request) (*childProcess, bool) {
+	if child := s.stickyChild(appPath, pool, balance, r); child != nil {
+		return child, true
+	}
+	if balance == balanceRoundRobin {
+		if s.nextInstance == nil {
+			s.nextInstance = make(map[string]int)
+		}
+		n := s.nextInstance[appPath] % len(pool)
+		s.nextInstance[appPath] = n + 1
+		return pool[n], false
+	}
+	return leastBusy(pool), false
+}
+
+// leastBusy returns the instance in pool serving the fewest requests.
+func leastBusy(pool []*childProcess) *childProcess {
+	best := pool[0]
+	for _, child := range pool[1:] {
+		if child.active < best.active {
+			best = child
+		}
+	}
+	return best
+}
+
+// appLock returns the lock serializing the starting and stopping of the
+// instances of the application at appPath, so that a slow start holds up only
+// requests for the same app. It is taken before childProcessesMu.
+func (s *Spawner) appLock(appPath string) *appMutex {
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	if s.appLocks == nil {
+		s.appLocks = make(map[string]*appMutex)
+	}
+	lock, ok := s.appLocks[appPath]
+	if !ok {
+		lock = newAppMutex()
+		s.appLocks[appPath] = lock
+	}
+	return lock
+}
+
+// releaseChild hands back an instance returned by getOrCreateChild once the
+// request is done.
+func (s *Spawner) releaseChild(child *childProcess) {
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	child.active--
+	child.lastUsed = time.Now()
+	if lock := s.appLocks[child.binaryPath]; lock != nil && lock.freed != nil {
+		// Wakes the requests waiting for an instance, see waitForSlot.
+		close(lock.freed)
+		lock.freed = nil
+	}
+}
+
+// canStopIdle reports whether the idle child may be stopped. Instances beyond
+// the app's minimum can always be stopped, the others only once every instance
+// of the app is idle. The caller must hold childProcessesMu.
+func (s *Spawner) canStopIdle(child *childProcess, idleTimeout time.Duration) bool {
+	if child.instance >= child.app.minInstances() {
+		return true
+	}
+	for _, other := range s.childProcesses {
+		if other.binaryPath == child.binaryPath && (other.active > 0 || time.Since(other.lastUsed) <= idleTimeout) {
+			return false
+		}
+	}
+	return true
+}
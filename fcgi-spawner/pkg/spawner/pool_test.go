@@ -0,0 +1,185 @@
+package spawner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPick(t *testing.T) {
+	pool := []*childProcess{
+		{instance: 0, active: 2},
+		{instance: 1, active: 0},
+		{instance: 2, active: 1},
+	}
+	s := NewSpawner(&Config{})
+
+	if got, _ := s.pick("/web/app.fcgi", pool, "", nil); got != pool[1] {
+		t.Errorf("pick() least-connections = instance %d, want 1", got.instance)
+	}
+
+	for i, want := range []int{0, 1, 2, 0} {
+		if got, _ := s.pick("/web/app.fcgi", pool, balanceRoundRobin, nil); got.instance != want {
+			t.Errorf("pick() round-robin #%d = instance %d, want %d", i, got.instance, want)
+		}
+	}
+}
+
+func TestFreeInstance(t *testing.T) {
+	pool := []*childProcess{{instance: 0}, {instance: 2}}
+	if got := freeInstance(pool); got != 1 {
+		t.Errorf("freeInstance() = %d, want 1", got)
+	}
+	if got := freeInstance(nil); got != 0 {
+		t.Errorf("freeInstance(nil) = %d, want 0", got)
+	}
+	if got := instanceSocketName("app.fcgi", 1); got != "app.fcgi.1.sock" {
+		t.Errorf("instanceSocketName() = %q, want app.fcgi.1.sock", got)
+	}
+}
+
+func TestCanStopIdle(t *testing.T) {
+	app := AppConfig{MinInstances: 2}
+	idle := time.Now().Add(-10 * time.Minute)
+	first := &childProcess{binaryPath: "/web/app.fcgi", instance: 0, app: app, lastUsed: idle}
+	second := &childProcess{binaryPath: "/web/app.fcgi", instance: 1, app: app, lastUsed: idle}
+	extra := &childProcess{binaryPath: "/web/app.fcgi", instance: 2, app: app, lastUsed: idle}
+
+	s := NewSpawner(&Config{})
+	s.childProcesses = map[string]*childProcess{
+		instanceKey(first.binaryPath, 0): first,
+		instanceKey(first.binaryPath, 1): second,
+		instanceKey(first.binaryPath, 2): extra,
+	}
+
+	if !s.canStopIdle(extra, 5*time.Minute) {
+		t.Errorf("canStopIdle() = false for an instance beyond the minimum")
+	}
+	if !s.canStopIdle(first, 5*time.Minute) {
+		t.Errorf("canStopIdle() = false while the whole pool is idle")
+	}
+	second.active = 1
+	if s.canStopIdle(first, 5*time.Minute) {
+		t.Errorf("canStopIdle() = true while another instance is busy")
+	}
+}
+
+func TestAppConfigValidate(t *testing.T) {
+	tests := []struct {
+		app     AppConfig
+		wantErr bool
+	}{
+		{AppConfig{}, false},
+		{AppConfig{MinInstances: 2, MaxInstances: 4, Balance: balanceRoundRobin}, false},
+		{AppConfig{MinInstances: -1}, true},
+		{AppConfig{Balance: "random"}, true},
+		{AppConfig{Restart: restartOnFailure, MaxRestarts: 5, RestartWindow: time.Minute, BackoffMultiplier: 1.5}, false},
+		{AppConfig{Restart: "sometimes"}, true},
+		{AppConfig{MaxRestarts: -1}, true},
+		{AppConfig{BackoffMultiplier: 0.5}, true},
+		{AppConfig{MaxMemory: "512M", MaxCPU: 80, OnLimit: onLimitAlert}, false},
+		{AppConfig{MaxMemory: "lots"}, true},
+		{AppConfig{MaxCPU: -1}, true},
+		{AppConfig{OnLimit: "ignore"}, true},
+		{AppConfig{Command: "/opt/app/server"}, false},
+		{AppConfig{SocketMode: "0777"}, false},
+		{AppConfig{SocketMode: "01777"}, true},
+		{AppConfig{Command: "/opt/app/server", Container: &ContainerConfig{Image: "alpine"}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.app.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("validate(%+v) error = %v, wantErr %v", tt.app, err, tt.wantErr)
+		}
+	}
+	if got := (AppConfig{MinInstances: 3, MaxInstances: 2}).maxInstances(); got != 3 {
+		t.Errorf("maxInstances() = %d, want at least minInstances", got)
+	}
+}
+
+func TestSlowStartDoesNotBlockOtherApps(t *testing.T) {
+	webRoot := t.TempDir()
+	for _, name := range []string{"slow-start.fcgi", "fast-start.fcgi"} {
+		if err := os.WriteFile(filepath.Join(webRoot, name), []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+			t.Fatalf("Failed to write app: %v", err)
+		}
+	}
+	// The slow app never answers its readiness request.
+	s := NewSpawner(&Config{
+		WebRoot: webRoot,
+		Apps: map[string]AppConfig{
+			"slow-start.fcgi": {ReadinessTimeout: time.Second, ReadinessPath: "/ping"},
+		},
+	})
+	defer s.stopAllChildren(time.Second)
+
+	done := make(chan error)
+	go func() {
+		_, _, err := s.getOrCreateChild(context.Background(), filepath.Join(webRoot, "slow-start.fcgi"), nil)
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	begin := time.Now()
+	child, _, err := s.getOrCreateChild(context.Background(), filepath.Join(webRoot, "fast-start.fcgi"), nil)
+	if err != nil {
+		t.Fatalf("getOrCreateChild() error = %v", err)
+	}
+	s.releaseChild(child)
+	if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+		t.Errorf("getOrCreateChild() took %s while another app was starting", elapsed)
+	}
+	if err := <-done; err == nil {
+		t.Error("getOrCreateChild() of the slow app succeeded")
+	}
+}
+
+func TestScaling(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "scaled.fcgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	noIdleTimeout := time.Duration(0)
+	s := NewSpawner(&Config{
+		WebRoot: webRoot,
+		Apps: map[string]AppConfig{
+			"scaled.fcgi": {IdleTimeout: &noIdleTimeout, MaxInstances: 3, ScaleThreshold: 2, ScaleDownDelay: 50 * time.Millisecond},
+		},
+	})
+	defer s.stopAllChildren(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.cleanupChildProcesses(ctx)
+
+	instances := func() int {
+		s.childProcessesMu.Lock()
+		defer s.childProcessesMu.Unlock()
+		return len(s.pool(appPath))
+	}
+
+	var busy []*childProcess
+	for i, want := range []int{1, 1, 2, 2, 3, 3, 3} {
+		child, _, err := s.getOrCreateChild(context.Background(), appPath, nil)
+		if err != nil {
+			t.Fatalf("getOrCreateChild() error = %v", err)
+		}
+		busy = append(busy, child)
+		if got := instances(); got != want {
+			t.Errorf("%d concurrent requests: %d instances, want %d", i+1, got, want)
+		}
+	}
+	for _, child := range busy {
+		s.releaseChild(child)
+	}
+
+	// The extra instances are stopped once idle, the first one is kept.
+	deadline := time.Now().Add(2 * time.Second)
+	for instances() > 1 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got := instances(); got != 1 {
+		t.Errorf("%d instances once idle, want 1", got)
+	}
+}
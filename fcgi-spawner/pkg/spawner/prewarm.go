@@ -0,0 +1,80 @@
+package spawner
+
+import (
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// prewarmApps returns the applications to start when the spawner starts:
+// every application with PrewarmAll, see discoverApps, the ones listed in
+// Prewarm otherwise.
+func (s *Spawner) prewarmApps() []string {
+	if s.Config.PrewarmAll {
+		return s.discoverApps()
+	}
+	var apps []string
+	for _, rel := range s.Config.Prewarm {
+		appPath, err := s.resolveApp(rel)
+		if err != nil {
+			spawnLog.Warn("Not prewarming application", "app", rel, "error", err)
+			continue
+		}
+		apps = append(apps, appPath)
+	}
+	return apps
+}
+
+// discoverApps returns the applications below the web roots: every one
+// found in them, or every declared one in manifest mode. CGI scripts aren't
+// included.
+func (s *Spawner) discoverApps() []string {
+	var apps []string
+	if s.Config.Manifest {
+		for _, webRoot := range s.webRoots() {
+			for _, rel := range slices.Sorted(maps.Keys(s.Config.Apps)) {
+				if appPath := filepath.Join(webRoot, filepath.FromSlash(rel)); s.isApp(appPath) {
+					apps = append(apps, appPath)
+				}
+			}
+		}
+		return apps
+	}
+	for _, webRoot := range s.webRoots() {
+		err := filepath.WalkDir(webRoot, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != webRoot && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.IsDir() && s.isApp(path) {
+				apps = append(apps, path)
+			}
+			return nil
+		})
+		if err != nil {
+			spawnLog.Error("Failed to look for applications", "path", webRoot, "error", err)
+		}
+	}
+	return apps
+}
+
+// prewarm starts the applications to prewarm, so that their first requests
+// don't wait for them to start. The spawner isn't ready until it has tried
+// to start all of them.
+func (s *Spawner) prewarm() {
+	defer s.prewarming.Store(false)
+	for _, appPath := range s.prewarmApps() {
+		if err := s.startApp(appPath); err != nil {
+			spawnLog.Error("Failed to prewarm application", "app", appPath, "error", err)
+			continue
+		}
+		spawnLog.Info("Prewarmed application", "app", appPath)
+	}
+}
@@ -0,0 +1,52 @@
+package spawner
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPrewarmApps(t *testing.T) {
+	webRoot := t.TempDir()
+	files := map[string]os.FileMode{
+		"hello.fcgi":         0755,
+		"api/users.fcgi":     0755,
+		"docs/readme.txt":    0644,
+		".hidden/admin.fcgi": 0755,
+		"plain.fcgi":         0644,
+	}
+	for name, mode := range files {
+		path := filepath.Join(webRoot, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, nil, mode); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want []string
+	}{
+		{name: "none", cfg: Config{}},
+		{name: "list", cfg: Config{Prewarm: []string{"api/users.fcgi", "missing.fcgi", "plain.fcgi", "../hello.fcgi"}}, want: []string{"api/users.fcgi"}},
+		{name: "all", cfg: Config{PrewarmAll: true}, want: []string{"api/users.fcgi", "hello.fcgi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.WebRoot = webRoot
+			s := NewSpawner(&tt.cfg)
+			var got []string
+			for _, appPath := range s.prewarmApps() {
+				got = append(got, s.relApp(appPath))
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("prewarmApps() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package spawner
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// appMutex is the lock of an application, see appLock. Unlike a
+// sync.Mutex, requests waiting for it can give up, see lockQueued.
+type appMutex struct {
+	ch       chan struct{}
+	starting bool // An instance is being started, guarded by childProcessesMu
+	waiting  int  // Requests in lockQueued, guarded by childProcessesMu
+	// Requests waiting for an instance below the concurrency limit, and the
+	// channel closed when one finishes a request, see waitForSlot. Guarded
+	// by childProcessesMu.
+	queued int
+	freed  chan struct{}
+}
+
+func newAppMutex() *appMutex {
+	return &appMutex{ch: make(chan struct{}, 1)}
+}
+
+func (m *appMutex) Lock() {
+	m.ch <- struct{}{}
+}
+
+func (m *appMutex) TryLock() bool {
+	select {
+	case m.ch <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *appMutex) Unlock() {
+	<-m.ch
+}
+
+// spawnQueueError is returned to requests that didn't get to wait for an
+// application being started, or waited too long.
+type spawnQueueError struct {
+	app        string
+	reason     string
+	retryAfter time.Duration
+}
+
+func (e *spawnQueueError) Error() string {
+	return fmt.Sprintf("%s is starting and %s", e.app, e.reason)
+}
+
+// lockQueued takes the lock of the application at appPath for a request.
+// While an instance of the app is being started, at most
+// Config.SpawnQueueSize requests wait for it, each for at most
+// Config.SpawnQueueTimeout; others get a *spawnQueueError right away. It also
+// gives up when ctx is done.
+func (s *Spawner) lockQueued(ctx context.Context, appPath string) (*appMutex, error) {
+	lock := s.appLock(appPath)
+	if lock.TryLock() {
+		return lock, nil
+	}
+	s.childProcessesMu.Lock()
+	if limit := s.Config.SpawnQueueSize; limit > 0 && lock.starting && lock.waiting >= limit {
+		s.childProcessesMu.Unlock()
+		return nil, &spawnQueueError{app: appPath, reason: fmt.Sprintf("%d requests are waiting for it already", limit), retryAfter: s.readinessTimeoutFor(AppConfig{})}
+	}
+	lock.waiting++
+	s.childProcessesMu.Unlock()
+	defer func() {
+		s.childProcessesMu.Lock()
+		lock.waiting--
+		s.childProcessesMu.Unlock()
+	}()
+
+	var timeout <-chan time.Time
+	if s.Config.SpawnQueueTimeout > 0 {
+		timer := time.NewTimer(s.Config.SpawnQueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case lock.ch <- struct{}{}:
+		return lock, nil
+	case <-timeout:
+		return nil, &spawnQueueError{app: appPath, reason: fmt.Sprintf("didn't become available within %s", s.Config.SpawnQueueTimeout), retryAfter: s.readinessTimeoutFor(AppConfig{})}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// overloadedError is returned to requests for an application whose instances
+// all serve as many requests as it allows, when no more of them may wait, or
+// when they waited too long.
+type overloadedError struct {
+	app    string
+	reason string
+}
+
+func (e *overloadedError) Error() string {
+	return fmt.Sprintf("%s is at its concurrency limit and %s", e.app, e.reason)
+}
+
+// maxConcurrentFor returns the number of requests an instance of the
+// application may serve at once; 0 doesn't limit them.
+func (s *Spawner) maxConcurrentFor(app AppConfig) int {
+	if app.MaxConcurrent > 0 {
+		return app.MaxConcurrent
+	}
+	return s.Config.MaxConcurrent
+}
+
+// requestQueueSizeFor returns the number of requests that may wait for an
+// instance of the application below its concurrency limit; 0 doesn't limit
+// them.
+func (s *Spawner) requestQueueSizeFor(app AppConfig) int {
+	if app.RequestQueueSize > 0 {
+		return app.RequestQueueSize
+	}
+	return s.Config.RequestQueueSize
+}
+
+// queueRequest adds a request to those waiting for an instance of the
+// application at appPath, whose lock is held, and returns the channel closed
+// when an instance finishes a request. If the queue is full, it returns an
+// *overloadedError instead. The caller must hold childProcessesMu and call
+// waitForSlot.
+func (s *Spawner) queueRequest(appPath string, lock *appMutex, app AppConfig) (<-chan struct{}, error) {
+	if limit := s.requestQueueSizeFor(app); limit > 0 && lock.queued >= limit {
+		return nil, &overloadedError{app: appPath, reason: fmt.Sprintf("%d requests are waiting for it already", limit)}
+	}
+	lock.queued++
+	if lock.freed == nil {
+		lock.freed = make(chan struct{})
+	}
+	return lock.freed, nil
+}
+
+// waitForSlot waits for an instance of the application at appPath to finish
+// a request, after queueRequest, for at most Config.RequestQueueTimeout. It
+// gives up when ctx is done.
+func (s *Spawner) waitForSlot(ctx context.Context, appPath string, freed <-chan struct{}) error {
+	lock := s.appLock(appPath)
+	defer func() {
+		s.childProcessesMu.Lock()
+		lock.queued--
+		s.childProcessesMu.Unlock()
+	}()
+	var timeout <-chan time.Time
+	if s.Config.RequestQueueTimeout > 0 {
+		timer := time.NewTimer(s.Config.RequestQueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-freed:
+		return nil
+	case <-timeout:
+		return &overloadedError{app: appPath, reason: fmt.Sprintf("no instance became available within %s", s.Config.RequestQueueTimeout)}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
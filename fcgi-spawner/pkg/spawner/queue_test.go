@@ -0,0 +1,147 @@
+package spawner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockQueued(t *testing.T) {
+	s := NewSpawner(&Config{WebRoot: t.TempDir(), SpawnQueueSize: 1, SpawnQueueTimeout: 100 * time.Millisecond})
+	const appPath = "/web/app.fcgi"
+
+	lock, err := s.lockQueued(context.Background(), appPath)
+	if err != nil {
+		t.Fatalf("lockQueued() of a free app error = %v", err)
+	}
+	// Pretend an instance is being started.
+	s.childProcessesMu.Lock()
+	lock.starting = true
+	s.childProcessesMu.Unlock()
+
+	waited := make(chan error)
+	go func() {
+		lock, err := s.lockQueued(context.Background(), appPath)
+		if err == nil {
+			lock.Unlock()
+		}
+		waited <- err
+	}()
+	for {
+		s.childProcessesMu.Lock()
+		waiting := lock.waiting
+		s.childProcessesMu.Unlock()
+		if waiting == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The queue is full.
+	var queueErr *spawnQueueError
+	if _, err := s.lockQueued(context.Background(), appPath); !errors.As(err, &queueErr) {
+		t.Errorf("lockQueued() with a full queue error = %v, want *spawnQueueError", err)
+	}
+
+	// The waiting request gets the lock once the app is started.
+	s.childProcessesMu.Lock()
+	lock.starting = false
+	s.childProcessesMu.Unlock()
+	lock.Unlock()
+	if err := <-waited; err != nil {
+		t.Errorf("lockQueued() of a waiting request error = %v", err)
+	}
+
+	// Requests wait no longer than the timeout, or until they are canceled.
+	lock.Lock()
+	defer lock.Unlock()
+	begin := time.Now()
+	if _, err := s.lockQueued(context.Background(), appPath); !errors.As(err, &queueErr) {
+		t.Errorf("lockQueued() of a busy app error = %v, want *spawnQueueError", err)
+	}
+	if elapsed := time.Since(begin); elapsed < 100*time.Millisecond {
+		t.Errorf("lockQueued() gave up after %s, before the timeout", elapsed)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.lockQueued(ctx, appPath); !errors.Is(err, context.Canceled) {
+		t.Errorf("lockQueued() of a canceled request error = %v, want context.Canceled", err)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "limited.fcgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	s := NewSpawner(&Config{
+		WebRoot:             webRoot,
+		MaxConcurrent:       1,
+		RequestQueueSize:    1,
+		RequestQueueTimeout: 100 * time.Millisecond,
+		Apps:                map[string]AppConfig{"limited.fcgi": {MaxInstances: 2}},
+	})
+	defer s.stopAllChildren(time.Second)
+
+	// Each of the two instances serves one request.
+	var busy []*childProcess
+	for range 2 {
+		child, _, err := s.getOrCreateChild(context.Background(), appPath, nil)
+		if err != nil {
+			t.Fatalf("getOrCreateChild() error = %v", err)
+		}
+		busy = append(busy, child)
+	}
+	if busy[0] == busy[1] {
+		t.Fatal("getOrCreateChild() returned an instance at the limit")
+	}
+
+	waited := make(chan error)
+	go func() {
+		child, _, err := s.getOrCreateChild(context.Background(), appPath, nil)
+		if err == nil && child != busy[0] {
+			err = errors.New("got an instance still at the limit")
+		}
+		waited <- err
+	}()
+	lock := s.appLock(appPath)
+	for {
+		s.childProcessesMu.Lock()
+		queued := lock.queued
+		s.childProcessesMu.Unlock()
+		if queued == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The queue is full.
+	var overloaded *overloadedError
+	if _, _, err := s.getOrCreateChild(context.Background(), appPath, nil); !errors.As(err, &overloaded) {
+		t.Errorf("getOrCreateChild() with a full queue error = %v, want *overloadedError", err)
+	}
+
+	// The waiting request gets the instance that finished a request.
+	s.releaseChild(busy[0])
+	if err := <-waited; err != nil {
+		t.Errorf("getOrCreateChild() of a waiting request error = %v", err)
+	}
+
+	// Requests wait no longer than the timeout, or until they are canceled.
+	begin := time.Now()
+	if _, _, err := s.getOrCreateChild(context.Background(), appPath, nil); !errors.As(err, &overloaded) {
+		t.Errorf("getOrCreateChild() of a busy app error = %v, want *overloadedError", err)
+	}
+	if elapsed := time.Since(begin); elapsed < 100*time.Millisecond {
+		t.Errorf("getOrCreateChild() gave up after %s, before the timeout", elapsed)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := s.getOrCreateChild(ctx, appPath, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("getOrCreateChild() of a canceled request error = %v, want context.Canceled", err)
+	}
+}
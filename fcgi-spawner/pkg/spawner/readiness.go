@@ -0,0 +1,124 @@
+package spawner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// notReadyError is returned when a new process of an application doesn't
+// pass its readiness probe in time.
+type notReadyError struct {
+	app    string
+	reason error
+}
+
+func (e *notReadyError) Error() string {
+	return fmt.Sprintf("%s did not become ready: %v", e.app, e.reason)
+}
+
+func (e *notReadyError) Unwrap() error {
+	return e.reason
+}
+
+// readinessIntervalFor returns how long to wait between readiness probes of
+// the application.
+func (s *Spawner) readinessIntervalFor(app AppConfig) time.Duration {
+	if app.ReadinessInterval > 0 {
+		return app.ReadinessInterval
+	}
+	return 20 * time.Millisecond
+}
+
+// waitReady probes the new process child until it is ready, it exits or the
+// readiness timeout has passed.
+func (s *Spawner) waitReady(child *childProcess) error {
+	timeout := s.readinessTimeoutFor(child.app)
+	deadline := time.Now().Add(timeout)
+	for {
+		err := s.probe(child, max(time.Until(deadline), 50*time.Millisecond))
+		if err == nil {
+			return nil
+		}
+		if state := child.cmd.ProcessState(); state != nil {
+			return fmt.Errorf("application exited during startup: %v", state)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not ready after %s: %v", timeout, err)
+		}
+		time.Sleep(s.readinessIntervalFor(child.app))
+	}
+}
+
+// probe checks once whether child is ready: its socket accepts connections
+// and, if the application has a readiness path, a GET request for it is
+// answered with a status below 400 within timeout. The path is requested
+// below the path of the application, e.g. /hello.fcgi/ping for /ping.
+func (s *Spawner) probe(child *childProcess, timeout time.Duration) error {
+	return s.probePath(child, child.app.ReadinessPath, timeout)
+}
+
+// probePath checks once that the socket of child accepts connections and
+// that a GET request for path, unless empty, is answered like for probe.
+func (s *Spawner) probePath(child *childProcess, path string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("unix", child.socketPath, min(timeout, 50*time.Millisecond))
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	if path == "" {
+		return nil
+	}
+
+	scriptName := "/" + s.relApp(child.binaryPath)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost"+scriptName+path, nil)
+	if err != nil {
+		return err
+	}
+	var resp *http.Response
+	switch child.app.Protocol {
+	case protocolHTTP:
+		resp, err = s.httpTransport(child).RoundTrip(r)
+	case protocolSCGI:
+		var conn net.Conn
+		resp, conn, err = s.roundTripSCGI(child, s.requestParams(r, child.binaryPath, scriptName, path), r, timeout)
+		if err == nil {
+			stop := context.AfterFunc(ctx, func() { conn.Close() })
+			defer func() {
+				stop()
+				conn.Close()
+			}()
+		}
+	default:
+		var fcgi *fcgiConn
+		resp, fcgi, err = s.roundTrip(child, s.requestParams(r, child.binaryPath, scriptName, path), r, timeout)
+		if err == nil {
+			stop := context.AfterFunc(ctx, func() { fcgi.Close() })
+			defer func() {
+				if !stop() {
+					fcgi.done = false // closed, don't reuse
+				}
+				s.putConn(child, fcgi)
+			}()
+		}
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("GET %s timed out", path)
+		}
+		return fmt.Errorf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("GET %s answered %d %s", path, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package spawner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbe(t *testing.T) {
+	ready := false
+	socketPath, _ := serveFCGI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/app.fcgi/ping" || !ready {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("pong"))
+	})
+	webRoot := t.TempDir()
+	s := NewSpawner(&Config{WebRoot: webRoot})
+	child := &childProcess{
+		cmd:        &mockCmd{path: filepath.Join(webRoot, "app.fcgi")},
+		socketPath: socketPath,
+		binaryPath: filepath.Join(webRoot, "app.fcgi"),
+	}
+
+	if err := s.probe(child, time.Second); err != nil {
+		t.Errorf("probe() without a readiness path error = %v", err)
+	}
+	child.app.ReadinessPath = "/ping"
+	if err := s.probe(child, time.Second); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("probe() error = %v, want the status of the application", err)
+	}
+	ready = true
+	if err := s.probe(child, time.Second); err != nil {
+		t.Errorf("probe() error = %v", err)
+	}
+	child.closeConns()
+
+	child.socketPath = filepath.Join(t.TempDir(), "missing.sock")
+	if err := s.probe(child, time.Second); err == nil {
+		t.Error("probe() succeeded without a socket")
+	}
+}
+
+func TestNotReadyApp(t *testing.T) {
+	// In stdio mode the socket accepts connections right away, but the
+	// application never answers the readiness request.
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "unready-probe.fcgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	s := NewSpawner(&Config{
+		WebRoot: webRoot,
+		Apps: map[string]AppConfig{
+			"unready-probe.fcgi": {ReadinessTimeout: 300 * time.Millisecond, ReadinessInterval: 50 * time.Millisecond, ReadinessPath: "/ping"},
+		},
+	})
+
+	rec := httptest.NewRecorder()
+	s.spawnerHandler(rec, httptest.NewRequest(http.MethodGet, "/unready-probe.fcgi", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "GET /ping timed out") {
+		t.Errorf("spawnerHandler() = %d %q, want 503 with the reason", rec.Code, rec.Body.String())
+	}
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	if len(s.childProcesses) != 0 {
+		t.Errorf("%d child processes running, want none", len(s.childProcesses))
+	}
+}
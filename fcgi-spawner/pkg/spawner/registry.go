@@ -0,0 +1,377 @@
+package spawner
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Service registries the spawner registers its applications in.
+const (
+	registryConsul = "consul"
+	registryEtcd   = "etcd"
+)
+
+// Default addresses of the local agent of each registry.
+var defaultRegistryAddrs = map[string]string{
+	registryConsul: "http://127.0.0.1:8500",
+	registryEtcd:   "http://127.0.0.1:2379",
+}
+
+// registryTTL is how long a registration outlives the spawner if it isn't
+// renewed, e.g. because the spawner was killed. Registrations are renewed
+// every registryRefresh.
+const (
+	registryTTL     = 30 * time.Second
+	registryRefresh = 10 * time.Second
+)
+
+// etcdPrefix is the prefix of the etcd keys of the registrations.
+const etcdPrefix = "/fcgi-spawner/services/"
+
+// validateRegistry checks Registry and RegistryAddr.
+func (c *Config) validateRegistry() error {
+	if c.Registry == "" {
+		return nil
+	}
+	if _, ok := defaultRegistryAddrs[c.Registry]; !ok {
+		return fmt.Errorf("unknown registry %q, want consul or etcd", c.Registry)
+	}
+	if c.RegistryAddr != "" {
+		return checkWebhookURL(c.RegistryAddr)
+	}
+	return nil
+}
+
+// registration describes a running child process in a service registry.
+type registration struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"` // Service name, derived from the app's path
+	App      string `json:"app"`
+	Path     string `json:"path,omitempty"`   // URL path of the app, if it's in WebRoot
+	Socket   string `json:"socket,omitempty"` // Socket the app listens on, in socket mode
+	Instance int    `json:"instance"`
+	PID      int    `json:"pid"`
+	Address  string `json:"address,omitempty"` // Host and port the spawner serves the app on
+	Port     int    `json:"port,omitempty"`
+	Status   string `json:"status"`
+}
+
+// serviceRegistry is a service registry such as Consul or etcd.
+type serviceRegistry interface {
+	register(ctx context.Context, r registration) error
+	deregister(ctx context.Context, r registration) error
+	// keepAlive renews regs, registering them again if the registry has
+	// lost them.
+	keepAlive(ctx context.Context, regs []registration) error
+}
+
+// newServiceRegistry returns the registry configured with Config.Registry.
+func (s *Spawner) newServiceRegistry() serviceRegistry {
+	addr := s.Config.RegistryAddr
+	if addr == "" {
+		addr = defaultRegistryAddrs[s.Config.Registry]
+	}
+	addr = strings.TrimSuffix(addr, "/")
+	if s.Config.Registry == registryEtcd {
+		return &etcdRegistry{addr: addr}
+	}
+	return &consulRegistry{addr: addr}
+}
+
+// serviceName returns the name of the application at appPath in a service
+// registry, e.g. api-users for api/users.fcgi.
+func (s *Spawner) serviceName(appPath string) string {
+	name := s.adminName(appPath)
+	if name == "" {
+		name = filepath.Base(appPath)
+	}
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.Trim(strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, name), "-")
+}
+
+// advertisedAddr returns the host and port the spawner serves applications
+// on, from Config.ListenAddr, or "" and 0 for a unix socket.
+func (s *Spawner) advertisedAddr() (string, int) {
+	host, portStr, err := net.SplitHostPort(s.Config.ListenAddr)
+	if err != nil {
+		return "", 0
+	}
+	port, _ := strconv.Atoi(portStr)
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host, _ = os.Hostname()
+	}
+	return host, port
+}
+
+// registrations returns the registrations of the running child processes, by
+// ID.
+func (s *Spawner) registrations() map[string]registration {
+	host, _ := os.Hostname()
+	address, port := s.advertisedAddr()
+	regs := make(map[string]registration)
+	for _, child := range s.children() {
+		r := registration{
+			Name:     s.serviceName(child.App),
+			App:      child.App,
+			Socket:   child.Socket,
+			Instance: child.Instance,
+			PID:      child.PID,
+			Address:  address,
+			Port:     port,
+			Status:   "passing",
+		}
+		if name := s.adminName(child.App); name != "" {
+			r.Path = "/" + name
+		}
+		r.ID = fmt.Sprintf("%s-%s-%d", host, r.Name, r.Instance)
+		regs[r.ID] = r
+	}
+	return regs
+}
+
+// runRegistry keeps the running child processes registered in
+// Config.Registry until ctx is done, and deregisters them then. The
+// registrations are brought up to date on every lifecycle event, and renewed
+// every registryRefresh.
+func (s *Spawner) runRegistry(ctx context.Context, events <-chan Event) {
+	reg := s.newServiceRegistry()
+	registered := make(map[string]registration)
+	ticker := time.NewTicker(registryRefresh)
+	defer ticker.Stop()
+	s.syncRegistry(ctx, reg, registered, false)
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is done, but the registrations are still to be removed.
+			deregisterCtx, cancel := context.WithTimeout(context.Background(), eventWebhookTimeout)
+			for _, r := range registered {
+				if err := reg.deregister(deregisterCtx, r); err != nil {
+					eventLog.Error("Failed to deregister application", "registry", s.Config.Registry, "id", r.ID, "error", err)
+				}
+			}
+			cancel()
+			return
+		case <-events:
+			s.syncRegistry(ctx, reg, registered, false)
+		case <-ticker.C:
+			s.syncRegistry(ctx, reg, registered, true)
+		}
+	}
+}
+
+// syncRegistry registers the running child processes missing from
+// registered and deregisters the ones that are gone, updating registered.
+// With renew, the remaining registrations are renewed as well.
+func (s *Spawner) syncRegistry(ctx context.Context, reg serviceRegistry, registered map[string]registration, renew bool) {
+	running := s.registrations()
+	for id, r := range registered {
+		if current, ok := running[id]; ok && current == r {
+			continue
+		}
+		if err := reg.deregister(ctx, r); err != nil {
+			eventLog.Error("Failed to deregister application", "registry", s.Config.Registry, "id", id, "error", err)
+			continue
+		}
+		delete(registered, id)
+		eventLog.Info("Deregistered application", "registry", s.Config.Registry, "id", id)
+	}
+	var kept []registration
+	for id, r := range running {
+		if _, ok := registered[id]; ok {
+			kept = append(kept, r)
+			continue
+		}
+		if err := reg.register(ctx, r); err != nil {
+			eventLog.Error("Failed to register application", "registry", s.Config.Registry, "id", id, "error", err)
+			continue
+		}
+		registered[id] = r
+		eventLog.Info("Registered application", "registry", s.Config.Registry, "id", id, "socket", r.Socket)
+	}
+	if renew && len(kept) > 0 {
+		if err := reg.keepAlive(ctx, kept); err != nil {
+			eventLog.Error("Failed to renew registrations", "registry", s.Config.Registry, "error", err)
+		}
+	}
+}
+
+// registryRequest sends a request with an optional JSON body to a registry
+// and decodes the JSON response into out, if not nil.
+func registryRequest(ctx context.Context, method, url string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	ctx, cancel := context.WithTimeout(ctx, eventWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &registryError{status: resp.StatusCode, msg: strings.TrimSpace(string(msg))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// registryError is returned for requests a registry answers with an error
+// status.
+type registryError struct {
+	status int
+	msg    string
+}
+
+func (e *registryError) Error() string {
+	return fmt.Sprintf("registry answered %d %s: %s", e.status, http.StatusText(e.status), e.msg)
+}
+
+// consulRegistry registers applications as services of the local Consul
+// agent, with a TTL check that keepAlive passes.
+type consulRegistry struct {
+	addr string
+}
+
+func (c *consulRegistry) register(ctx context.Context, r registration) error {
+	service := map[string]any{
+		"ID":      r.ID,
+		"Name":    r.Name,
+		"Tags":    []string{"fcgi-spawner"},
+		"Address": r.Address,
+		"Port":    r.Port,
+		"Meta": map[string]string{
+			"app":      r.App,
+			"path":     r.Path,
+			"socket":   r.Socket,
+			"instance": strconv.Itoa(r.Instance),
+			"pid":      strconv.Itoa(r.PID),
+		},
+		"Check": map[string]any{
+			"TTL":                            registryTTL.String(),
+			"Status":                         r.Status,
+			"DeregisterCriticalServiceAfter": (10 * registryTTL).String(),
+		},
+	}
+	return registryRequest(ctx, http.MethodPut, c.addr+"/v1/agent/service/register", service, nil)
+}
+
+func (c *consulRegistry) deregister(ctx context.Context, r registration) error {
+	return registryRequest(ctx, http.MethodPut, c.addr+"/v1/agent/service/deregister/"+r.ID, nil, nil)
+}
+
+func (c *consulRegistry) keepAlive(ctx context.Context, regs []registration) error {
+	var errs []error
+	for _, r := range regs {
+		err := registryRequest(ctx, http.MethodPut, c.addr+"/v1/agent/check/pass/service:"+r.ID, nil, nil)
+		var regErr *registryError
+		if errors.As(err, &regErr) && regErr.status == http.StatusNotFound {
+			// The agent restarted and lost the service.
+			err = c.register(ctx, r)
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// etcdRegistry stores the registrations as JSON under etcdPrefix in etcd,
+// through its JSON gateway, attached to a lease that keepAlive renews.
+type etcdRegistry struct {
+	addr  string
+	lease string // ID of the lease, "" until granted
+}
+
+// etcdKey returns the base64 encoded key of r, as the JSON gateway expects.
+func etcdKey(r registration) string {
+	return base64.StdEncoding.EncodeToString([]byte(etcdPrefix + r.Name + "/" + r.ID))
+}
+
+// grant obtains a new lease.
+func (e *etcdRegistry) grant(ctx context.Context) error {
+	var resp struct {
+		ID string `json:"ID"`
+	}
+	if err := registryRequest(ctx, http.MethodPost, e.addr+"/v3/lease/grant", map[string]any{"TTL": int(registryTTL.Seconds())}, &resp); err != nil {
+		return err
+	}
+	if resp.ID == "" {
+		return errors.New("etcd granted no lease")
+	}
+	e.lease = resp.ID
+	return nil
+}
+
+func (e *etcdRegistry) register(ctx context.Context, r registration) error {
+	if e.lease == "" {
+		if err := e.grant(ctx); err != nil {
+			return err
+		}
+	}
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	put := map[string]string{
+		"key":   etcdKey(r),
+		"value": base64.StdEncoding.EncodeToString(value),
+		"lease": e.lease,
+	}
+	return registryRequest(ctx, http.MethodPost, e.addr+"/v3/kv/put", put, nil)
+}
+
+func (e *etcdRegistry) deregister(ctx context.Context, r registration) error {
+	return registryRequest(ctx, http.MethodPost, e.addr+"/v3/kv/deleterange", map[string]string{"key": etcdKey(r)}, nil)
+}
+
+func (e *etcdRegistry) keepAlive(ctx context.Context, regs []registration) error {
+	var resp struct {
+		Result struct {
+			TTL string `json:"TTL"`
+		} `json:"result"`
+	}
+	if e.lease != "" {
+		if err := registryRequest(ctx, http.MethodPost, e.addr+"/v3/lease/keepalive", map[string]string{"ID": e.lease}, &resp); err != nil {
+			return err
+		}
+	}
+	if ttl, _ := strconv.Atoi(resp.Result.TTL); ttl > 0 {
+		return nil
+	}
+	// The lease expired along with the registrations.
+	e.lease = ""
+	var errs []error
+	for _, r := range regs {
+		errs = append(errs, e.register(ctx, r))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,159 @@
+package spawner
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRegistry records the requests sent to a registry and answers them
+// with the responses set by path.
+type fakeRegistry struct {
+	mu        sync.Mutex
+	requests  []string         // Method and path
+	bodies    []map[string]any // Decoded JSON bodies, nil if none
+	responses map[string]func(w http.ResponseWriter)
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]any
+	json.NewDecoder(r.Body).Decode(&body)
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	f.bodies = append(f.bodies, body)
+	respond := f.responses[r.URL.Path]
+	f.mu.Unlock()
+	if respond != nil {
+		respond(w)
+	}
+}
+
+// take returns and forgets the requests received so far.
+func (f *fakeRegistry) take() ([]string, []map[string]any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	requests, bodies := f.requests, f.bodies
+	f.requests, f.bodies = nil, nil
+	return requests, bodies
+}
+
+func TestConsulRegistry(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "api", "Users.fcgi")
+	os.Mkdir(filepath.Dir(appPath), 0755)
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	fake := &fakeRegistry{responses: map[string]func(http.ResponseWriter){}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	s := NewSpawner(&Config{WebRoot: webRoot, ListenAddr: "10.0.0.1:8080", Registry: registryConsul, RegistryAddr: server.URL})
+	defer s.stopAllChildren(time.Second)
+	if err := s.startApp(appPath); err != nil {
+		t.Fatalf("startApp() error = %v", err)
+	}
+
+	reg := s.newServiceRegistry()
+	registered := make(map[string]registration)
+	host, _ := os.Hostname()
+	id := host + "-api-users-0"
+	s.syncRegistry(context.Background(), reg, registered, false)
+	requests, bodies := fake.take()
+	if len(requests) != 1 || requests[0] != "PUT /v1/agent/service/register" {
+		t.Fatalf("requests = %q, want a registration", requests)
+	}
+	if bodies[0]["ID"] != id || bodies[0]["Name"] != "api-users" || bodies[0]["Address"] != "10.0.0.1" || bodies[0]["Port"] != 8080.0 {
+		t.Errorf("registration = %v", bodies[0])
+	}
+	if meta, _ := bodies[0]["Meta"].(map[string]any); meta["path"] != "/api/Users.fcgi" || meta["pid"] == "0" {
+		t.Errorf("registration meta = %v", meta)
+	}
+
+	// Unchanged registrations are only renewed. An agent that lost them
+	// gets them again.
+	fake.responses["/v1/agent/check/pass/service:"+id] = func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) }
+	s.syncRegistry(context.Background(), reg, registered, true)
+	requests, _ = fake.take()
+	if want := []string{"PUT /v1/agent/check/pass/service:" + id, "PUT /v1/agent/service/register"}; strings.Join(requests, ",") != strings.Join(want, ",") {
+		t.Errorf("requests = %q, want %q", requests, want)
+	}
+
+	s.stopApp(appPath)
+	s.syncRegistry(context.Background(), reg, registered, false)
+	requests, _ = fake.take()
+	if len(requests) != 1 || requests[0] != "PUT /v1/agent/service/deregister/"+id {
+		t.Errorf("requests = %q, want a deregistration", requests)
+	}
+	if len(registered) != 0 {
+		t.Errorf("registered = %v after stopping the app", registered)
+	}
+}
+
+func TestEtcdRegistry(t *testing.T) {
+	fake := &fakeRegistry{responses: map[string]func(http.ResponseWriter){
+		"/v3/lease/grant": func(w http.ResponseWriter) { w.Write([]byte(`{"ID":"42","TTL":"30"}`)) },
+		// An expired lease has no TTL.
+		"/v3/lease/keepalive": func(w http.ResponseWriter) { w.Write([]byte(`{"result":{"ID":"42"}}`)) },
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	reg := &etcdRegistry{addr: server.URL}
+	r := registration{ID: "host-hello-0", Name: "hello", App: "/srv/hello.fcgi", PID: 1234, Status: "passing"}
+
+	if err := reg.register(context.Background(), r); err != nil {
+		t.Fatalf("register() error = %v", err)
+	}
+	requests, bodies := fake.take()
+	if want := "POST /v3/lease/grant,POST /v3/kv/put"; strings.Join(requests, ",") != want {
+		t.Fatalf("requests = %q, want %s", requests, want)
+	}
+	key, _ := base64.StdEncoding.DecodeString(bodies[1]["key"].(string))
+	value, _ := base64.StdEncoding.DecodeString(bodies[1]["value"].(string))
+	var stored registration
+	json.Unmarshal(value, &stored)
+	if string(key) != etcdPrefix+"hello/host-hello-0" || stored != r || bodies[1]["lease"] != "42" {
+		t.Errorf("put %s = %s with lease %v", key, value, bodies[1]["lease"])
+	}
+
+	if err := reg.keepAlive(context.Background(), []registration{r}); err != nil {
+		t.Fatalf("keepAlive() error = %v", err)
+	}
+	requests, _ = fake.take()
+	if want := "POST /v3/lease/keepalive,POST /v3/lease/grant,POST /v3/kv/put"; strings.Join(requests, ",") != want {
+		t.Errorf("requests = %q, want %s", requests, want)
+	}
+
+	if err := reg.deregister(context.Background(), r); err != nil {
+		t.Fatalf("deregister() error = %v", err)
+	}
+	if requests, _ = fake.take(); len(requests) != 1 || requests[0] != "POST /v3/kv/deleterange" {
+		t.Errorf("requests = %q, want a deletion", requests)
+	}
+}
+
+func TestValidateRegistry(t *testing.T) {
+	tests := []struct {
+		registry, addr string
+		wantErr        bool
+	}{
+		{"", "", false},
+		{"consul", "", false},
+		{"etcd", "https://etcd.example.com:2379", false},
+		{"zookeeper", "", true},
+		{"consul", "127.0.0.1:8500", true},
+	}
+	for _, tt := range tests {
+		err := (&Config{Registry: tt.registry, RegistryAddr: tt.addr}).validateRegistry()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateRegistry(%q, %q) error = %v, wantErr %v", tt.registry, tt.addr, err, tt.wantErr)
+		}
+	}
+}
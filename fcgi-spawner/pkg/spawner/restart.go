@@ -0,0 +1,176 @@
+package spawner
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Restart policies, deciding whether an application whose process exited is
+// started again.
+const (
+	restartAlways    = "always"
+	restartOnFailure = "on-failure"
+	restartNever     = "never"
+)
+
+// restartStats counts the starts and exits of an application over the
+// lifetime of the spawner.
+type restartStats struct {
+	starts     int
+	restarts   int
+	exits      int
+	failures   int // Exits with an error status or by a signal
+	lastExit   string
+	lastExitAt time.Time
+	crashed    bool        // Set from an exit until the next start, for EventRestarted
+	recent     []time.Time // Restarts counting against MaxRestarts
+	held       error       // Why the application isn't started again, if it isn't
+}
+
+// notRestartedError is returned instead of starting an application that its
+// restart policy keeps from being started again.
+type notRestartedError struct {
+	app    string
+	reason error
+}
+
+func (e *notRestartedError) Error() string {
+	return fmt.Sprintf("%s is not restarted: %v", e.app, e.reason)
+}
+
+// statsFor returns the restart statistics of the application at appPath. The
+// caller must hold childProcessesMu.
+func (s *Spawner) statsFor(appPath string) *restartStats {
+	if s.restarts == nil {
+		s.restarts = make(map[string]*restartStats)
+	}
+	st := s.restarts[appPath]
+	if st == nil {
+		st = &restartStats{}
+		s.restarts[appPath] = st
+	}
+	return st
+}
+
+// recordStart counts child, a started process that was just added to the
+// running processes, and publishes that it's ready. The caller must hold
+// childProcessesMu.
+func (s *Spawner) recordStart(child *childProcess) {
+	st := s.statsFor(child.binaryPath)
+	st.starts++
+	s.publishEvent(EventReady, child, "")
+	if st.crashed {
+		st.crashed = false
+		s.publishEvent(EventRestarted, child, "")
+	}
+}
+
+// recordExit counts the exit of child, which wasn't stopped by the spawner,
+// and decides by the restart policy of its application whether the
+// application may be started again. The caller must hold childProcessesMu.
+func (s *Spawner) recordExit(child *childProcess) {
+	st := s.statsFor(child.binaryPath)
+	st.exits++
+	st.lastExitAt = time.Now()
+	st.lastExit = "unknown status"
+	failed := true
+	if state := child.cmd.ProcessState(); state != nil {
+		st.lastExit, failed = state.String(), !state.Success()
+	}
+	if failed {
+		st.failures++
+	}
+
+	app := child.app
+	switch {
+	case app.Restart == restartNever:
+		st.held = fmt.Errorf("exited (%s) and the restart policy is never", st.lastExit)
+	case app.Restart == restartOnFailure && !failed:
+		st.held = fmt.Errorf("exited successfully and the restart policy is on-failure")
+	case app.MaxRestarts > 0:
+		recent := st.recent[:0]
+		for _, t := range st.recent {
+			if app.RestartWindow == 0 || time.Since(t) < app.RestartWindow {
+				recent = append(recent, t)
+			}
+		}
+		st.recent = recent
+		if len(recent) >= app.MaxRestarts {
+			if app.RestartWindow == 0 {
+				st.held = fmt.Errorf("restarted %d times", len(recent))
+			} else {
+				st.held = fmt.Errorf("restarted %d times within %s", len(recent), app.RestartWindow)
+			}
+		}
+	}
+	if st.held != nil {
+		spawnLog.Warn("Application exited, not restarting it", "app", child.binaryPath, "reason", st.held)
+		return
+	}
+	st.restarts++
+	st.crashed = true
+	st.recent = append(st.recent, st.lastExitAt)
+}
+
+// checkRestartPolicy returns a *notRestartedError if the restart policy of the
+// application at appPath keeps it from being started again. The caller must
+// hold childProcessesMu.
+func (s *Spawner) checkRestartPolicy(appPath string) error {
+	if st := s.restarts[appPath]; st != nil && st.held != nil {
+		return &notRestartedError{app: appPath, reason: st.held}
+	}
+	return nil
+}
+
+// resetRestarts lets the application at appPath be started again, after it
+// was started by hand or has changed. The counters are kept. The caller must
+// hold childProcessesMu.
+func (s *Spawner) resetRestarts(appPath string) {
+	if st := s.restarts[appPath]; st != nil {
+		st.held, st.recent = nil, nil
+	}
+}
+
+// appRestarts describes the starts and exits of an application.
+type appRestarts struct {
+	App          string     `json:"app"`
+	Name         string     `json:"name,omitempty"` // Path used by /apps/{app}/..., if it's in WebRoot
+	Starts       int        `json:"starts"`
+	Restarts     int        `json:"restarts"`
+	Exits        int        `json:"exits"`
+	Failures     int        `json:"failures"`
+	LastExit     string     `json:"lastExit,omitempty"`
+	LastExitAt   *time.Time `json:"lastExitAt,omitempty"`
+	NotRestarted string     `json:"notRestarted,omitempty"`
+}
+
+// appRestartStats returns the restart statistics of every application started
+// so far, ordered by path.
+func (s *Spawner) appRestartStats() []appRestarts {
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+
+	apps := make([]appRestarts, 0, len(s.restarts))
+	for appPath, st := range s.restarts {
+		app := appRestarts{
+			App:      appPath,
+			Name:     s.adminName(appPath),
+			Starts:   st.starts,
+			Restarts: st.restarts,
+			Exits:    st.exits,
+			Failures: st.failures,
+			LastExit: st.lastExit,
+		}
+		if !st.lastExitAt.IsZero() {
+			lastExitAt := st.lastExitAt
+			app.LastExitAt = &lastExitAt
+		}
+		if st.held != nil {
+			app.NotRestarted = st.held.Error()
+		}
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].App < apps[j].App })
+	return apps
+}
@@ -0,0 +1,113 @@
+package spawner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exitedChild returns a child of the app at appPath whose process has exited
+// with the given shell exit status.
+func exitedChild(t *testing.T, appPath string, app AppConfig, status string) *childProcess {
+	t.Helper()
+	cmd := &execCmdWrapper{cmd: exec.Command("/bin/sh", "-c", "exit "+status)}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	<-cmd.process.done
+	return &childProcess{cmd: cmd, binaryPath: appPath, app: app}
+}
+
+func TestRecordExit(t *testing.T) {
+	tests := []struct {
+		name        string
+		app         AppConfig
+		statuses    []string
+		wantHeld    bool
+		wantRestart int
+	}{
+		{name: "always", statuses: []string{"0", "1", "0"}, wantRestart: 3},
+		{name: "never", app: AppConfig{Restart: restartNever}, statuses: []string{"1"}, wantHeld: true},
+		{name: "on-failure after failure", app: AppConfig{Restart: restartOnFailure}, statuses: []string{"1", "2"}, wantRestart: 2},
+		{name: "on-failure after success", app: AppConfig{Restart: restartOnFailure}, statuses: []string{"1", "0"}, wantHeld: true, wantRestart: 1},
+		{name: "max restarts", app: AppConfig{MaxRestarts: 2}, statuses: []string{"1", "1", "1"}, wantHeld: true, wantRestart: 2},
+		{name: "max restarts in window", app: AppConfig{MaxRestarts: 2, RestartWindow: time.Hour}, statuses: []string{"1", "1"}, wantRestart: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSpawner(&Config{WebRoot: "/web"})
+			for _, status := range tt.statuses {
+				s.recordExit(exitedChild(t, "/web/app.fcgi", tt.app, status))
+			}
+			err := s.checkRestartPolicy("/web/app.fcgi")
+			var notRestarted *notRestartedError
+			if held := errors.As(err, &notRestarted); held != tt.wantHeld {
+				t.Errorf("checkRestartPolicy() = %v, want held %v", err, tt.wantHeld)
+			}
+			st := s.restarts["/web/app.fcgi"]
+			if st.exits != len(tt.statuses) || st.restarts != tt.wantRestart {
+				t.Errorf("%d exits and %d restarts, want %d and %d", st.exits, st.restarts, len(tt.statuses), tt.wantRestart)
+			}
+
+			s.resetRestarts("/web/app.fcgi")
+			if err := s.checkRestartPolicy("/web/app.fcgi"); err != nil {
+				t.Errorf("checkRestartPolicy() after reset = %v", err)
+			}
+		})
+	}
+
+	// Restarts outside the window don't count.
+	s := NewSpawner(&Config{WebRoot: "/web"})
+	app := AppConfig{MaxRestarts: 1, RestartWindow: time.Minute}
+	s.recordExit(exitedChild(t, "/web/app.fcgi", app, "1"))
+	s.restarts["/web/app.fcgi"].recent[0] = time.Now().Add(-2 * time.Minute)
+	s.recordExit(exitedChild(t, "/web/app.fcgi", app, "1"))
+	if err := s.checkRestartPolicy("/web/app.fcgi"); err != nil {
+		t.Errorf("checkRestartPolicy() = %v, want old restarts to expire", err)
+	}
+}
+
+func TestRestartPolicyNever(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "once-restart.fcgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexec sleep 0.2\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	if err := os.WriteFile(appPath+".yaml", []byte("restart: never\n"), 0644); err != nil {
+		t.Fatalf("Failed to write sidecar: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot, AdminToken: "secret"})
+
+	child, _, err := s.getOrCreateChild(context.Background(), appPath, nil)
+	if err != nil {
+		t.Fatalf("getOrCreateChild() error = %v", err)
+	}
+	s.releaseChild(child)
+	time.Sleep(500 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	s.spawnerHandler(rec, httptest.NewRequest(http.MethodGet, "/once-restart.fcgi", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "restart policy is never") {
+		t.Errorf("spawnerHandler() = %d %q, want 503 with the reason", rec.Code, rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/apps", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	s.AdminHandler().ServeHTTP(rec, req)
+	var apps []appRestarts
+	if err := json.NewDecoder(rec.Body).Decode(&apps); err != nil {
+		t.Fatalf("Failed to decode apps: %v", err)
+	}
+	if len(apps) != 1 || apps[0].Starts != 1 || apps[0].Exits != 1 || apps[0].Restarts != 0 || apps[0].NotRestarted == "" {
+		t.Errorf("GET /apps = %+v, want one start and exit and no restart", apps)
+	}
+}
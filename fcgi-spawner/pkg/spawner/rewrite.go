@@ -0,0 +1,150 @@
+package spawner
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RewriteRule changes the requests to the URL paths it matches before they
+// are routed, and their responses on the way out, e.g. to serve an API below
+// another prefix or to add security headers like Strict-Transport-Security.
+type RewriteRule struct {
+	// Path matches like Route.Path: the URL path exactly, or, ending in /*,
+	// the path and everything below it, e.g. /v1/*.
+	Path string `yaml:"path"`
+	// RewritePrefix replaces the prefix of a Path ending in /*, e.g. /api
+	// turns /v1/users into /api/users; / strips the prefix.
+	RewritePrefix string `yaml:"rewritePrefix"`
+	// RemoveRequestHeaders are removed from the requests.
+	RemoveRequestHeaders []string `yaml:"removeRequestHeaders"`
+	// SetRequestHeaders are set on the requests, by header name, replacing
+	// the values the client sent.
+	SetRequestHeaders map[string]string `yaml:"setRequestHeaders"`
+	// SetResponseHeaders are set on the responses, by header name, replacing
+	// the values the application sets, e.g. X-Frame-Options: DENY.
+	SetResponseHeaders map[string]string `yaml:"setResponseHeaders"`
+}
+
+// validateRewrites checks the rewrite rules.
+func (c *Config) validateRewrites() error {
+	for i, rule := range c.Rewrites {
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("rewrite rule %d: path %q must start with /", i+1, rule.Path)
+		}
+		if rule.RewritePrefix != "" {
+			if !strings.HasSuffix(rule.Path, "/*") {
+				return fmt.Errorf("rewrite rule %d: rewritePrefix needs a path ending in /*", i+1)
+			}
+			if !strings.HasPrefix(rule.RewritePrefix, "/") {
+				return fmt.Errorf("rewrite rule %d: rewritePrefix %q must start with /", i+1, rule.RewritePrefix)
+			}
+		}
+		for _, name := range rule.RemoveRequestHeaders {
+			if name == "" {
+				return fmt.Errorf("rewrite rule %d: empty header name", i+1)
+			}
+		}
+		for _, headers := range []map[string]string{rule.SetRequestHeaders, rule.SetResponseHeaders} {
+			for name := range headers {
+				if name == "" {
+					return fmt.Errorf("rewrite rule %d: empty header name", i+1)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// rewrite applies the rewrite rules to r, each matching the URL path as
+// rewritten by the rules before it. It returns the request to route, a copy
+// of r if a rule matches, and the ResponseWriter setting the response
+// headers of the matching rules.
+func (s *Spawner) rewrite(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request) {
+	var responseHeaders http.Header
+	cloned := false
+	for i := range s.Config.Rewrites {
+		rule := &s.Config.Rewrites[i]
+		_, rest, ok := (&Route{Path: rule.Path}).match(r.URL.Path)
+		if !ok {
+			continue
+		}
+		if !cloned {
+			// The rules don't change the request of the caller.
+			r = r.Clone(r.Context())
+			cloned = true
+		}
+		if rule.RewritePrefix != "" {
+			urlPath := strings.TrimSuffix(rule.RewritePrefix, "/") + rest
+			if urlPath == "" {
+				urlPath = "/"
+			}
+			proxyLog.Debug("Rewrote request path", "path", r.URL.Path, "rewritten", urlPath)
+			r.URL.Path, r.URL.RawPath = urlPath, ""
+		}
+		for _, name := range rule.RemoveRequestHeaders {
+			r.Header.Del(name)
+		}
+		for name, value := range rule.SetRequestHeaders {
+			if http.CanonicalHeaderKey(name) == "Host" {
+				r.Host = value
+				continue
+			}
+			r.Header.Set(name, value)
+		}
+		for name, value := range rule.SetResponseHeaders {
+			if responseHeaders == nil {
+				responseHeaders = make(http.Header)
+			}
+			responseHeaders.Set(name, value)
+		}
+	}
+	if responseHeaders != nil {
+		w = &headerWriter{ResponseWriter: w, headers: responseHeaders}
+	}
+	return w, r
+}
+
+// headerWriter sets the response headers of rewrite rules when the response
+// is sent. With cacheable, they are only set on responses that may be
+// cached: 2xx and 304 Not Modified.
+type headerWriter struct {
+	http.ResponseWriter
+	headers     http.Header
+	cacheable   bool
+	wroteHeader bool
+}
+
+func (w *headerWriter) WriteHeader(status int) {
+	if !w.wroteHeader && status >= http.StatusOK {
+		w.wroteHeader = true
+		if !w.cacheable || status < http.StatusMultipleChoices || status == http.StatusNotModified {
+			h := w.Header()
+			for name, values := range w.headers {
+				h[name] = values
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses working.
+func (w *headerWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *headerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,74 @@
+package spawner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateRewrites(t *testing.T) {
+	tests := []struct {
+		rule    RewriteRule
+		wantErr bool
+	}{
+		{rule: RewriteRule{Path: "/v1/*", RewritePrefix: "/api"}},
+		{rule: RewriteRule{Path: "/*", SetResponseHeaders: map[string]string{"X-Frame-Options": "DENY"}}},
+		{rule: RewriteRule{Path: "v1/*"}, wantErr: true},
+		{rule: RewriteRule{Path: "/v1", RewritePrefix: "/api"}, wantErr: true},
+		{rule: RewriteRule{Path: "/v1/*", RewritePrefix: "api"}, wantErr: true},
+		{rule: RewriteRule{Path: "/*", RemoveRequestHeaders: []string{""}}, wantErr: true},
+		{rule: RewriteRule{Path: "/*", SetRequestHeaders: map[string]string{"": "x"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		cfg := Config{Rewrites: []RewriteRule{tt.rule}}
+		if err := cfg.validateRewrites(); (err != nil) != tt.wantErr {
+			t.Errorf("validateRewrites(%+v) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	webRoot := t.TempDir()
+	script := "#!/bin/sh\nprintf 'Content-Type: text/plain\\r\\nX-Frame-Options: SAMEORIGIN\\r\\n\\r\\n'\necho \"$PATH_INFO $HTTP_X_DEBUG $HTTP_X_PREFIX\"\n"
+	if err := os.WriteFile(filepath.Join(webRoot, "api.cgi"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot, Rewrites: []RewriteRule{
+		{
+			Path:                 "/v1/*",
+			RewritePrefix:        "/api.cgi",
+			RemoveRequestHeaders: []string{"X-Debug"},
+			SetRequestHeaders:    map[string]string{"X-Prefix": "/v1"},
+		},
+		{
+			Path:               "/*",
+			SetResponseHeaders: map[string]string{"X-Frame-Options": "DENY", "Strict-Transport-Security": "max-age=63072000"},
+		},
+	}})
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+	r.Header.Set("X-Debug", "1")
+	w := httptest.NewRecorder()
+	s.spawnerHandler(w, r)
+	if got, want := w.Body.String(), "/users  /v1\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	if got := w.Header().Values("X-Frame-Options"); len(got) != 1 || got[0] != "DENY" {
+		t.Errorf("X-Frame-Options = %q, want only DENY", got)
+	}
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=63072000" {
+		t.Errorf("Strict-Transport-Security = %q", got)
+	}
+	if r.URL.Path != "/v1/users" || r.Header.Get("X-Debug") != "1" {
+		t.Errorf("rewrite changed the request of the caller: %s %v", r.URL.Path, r.Header)
+	}
+
+	// Responses the spawner makes itself get the headers as well.
+	w = httptest.NewRecorder()
+	s.spawnerHandler(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get("X-Frame-Options") != "DENY" {
+		t.Errorf("GET /missing = %d, %v, want 404 with X-Frame-Options", w.Code, w.Header())
+	}
+}
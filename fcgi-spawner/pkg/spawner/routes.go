@@ -0,0 +1,157 @@
+package spawner
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Route maps URL paths to an application, so that clean URLs work without
+// .fcgi in them. Exactly one of Path and Regex must be set.
+type Route struct {
+	// Path matches the URL path exactly, or, ending in /*, the path and
+	// everything below it, e.g. /api/*.
+	Path string `yaml:"path"`
+	// Regex matches the URL path with a regular expression.
+	Regex string `yaml:"regex"`
+	// App is the path of the application relative to WebRoot.
+	App string `yaml:"app"`
+	// Canary sends part of the requests to another version of App.
+	Canary *Canary `yaml:"canary"`
+
+	re *regexp.Regexp
+}
+
+// Canary is a new version of the application of a route, rolled out
+// gradually.
+type Canary struct {
+	// App is the path of the new version relative to WebRoot, e.g.
+	// app-canary.fcgi.
+	App string `yaml:"app"`
+	// Percent of the requests are sent to App, chosen at random.
+	Percent float64 `yaml:"percent"`
+	// Header is a request header choosing the version regardless of
+	// Percent, e.g. X-Canary: "canary" selects App and "stable" the app of
+	// the route.
+	Header string `yaml:"header"`
+}
+
+// Values of Canary.Header.
+const (
+	canaryVersion = "canary"
+	stableVersion = "stable"
+)
+
+// validateRoutes checks the routes and compiles their regular expressions.
+func (c *Config) validateRoutes() error {
+	for i := range c.Routes {
+		route := &c.Routes[i]
+		if (route.Path == "") == (route.Regex == "") {
+			return fmt.Errorf("route %d: exactly one of path and regex must be set", i+1)
+		}
+		if route.Path != "" && !strings.HasPrefix(route.Path, "/") {
+			return fmt.Errorf("route %d: path %q must start with /", i+1, route.Path)
+		}
+		if route.App == "" {
+			return fmt.Errorf("route %d: app is missing", i+1)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(route.App)) {
+			return fmt.Errorf("route %d: app %q must be a path below webRoot", i+1, route.App)
+		}
+		if canary := route.Canary; canary != nil {
+			if canary.App == "" || !filepath.IsLocal(filepath.FromSlash(canary.App)) {
+				return fmt.Errorf("route %d: canary app %q must be a path below webRoot", i+1, canary.App)
+			}
+			if canary.Percent < 0 || canary.Percent > 100 {
+				return fmt.Errorf("route %d: canary percent %g must be between 0 and 100", i+1, canary.Percent)
+			}
+		}
+		if route.Regex != "" {
+			re, err := regexp.Compile(route.Regex)
+			if err != nil {
+				return fmt.Errorf("route %d: %v", i+1, err)
+			}
+			route.re = re
+		}
+	}
+	return nil
+}
+
+// match reports whether the route matches urlPath and splits the path into
+// SCRIPT_NAME and PATH_INFO. Prefix routes use the prefix as SCRIPT_NAME;
+// regex routes pass the whole path as PATH_INFO.
+func (route *Route) match(urlPath string) (scriptName, pathInfo string, ok bool) {
+	if route.re != nil {
+		return "", urlPath, route.re.MatchString(urlPath)
+	}
+	prefix, isPrefix := strings.CutSuffix(route.Path, "/*")
+	if !isPrefix {
+		return urlPath, "", urlPath == route.Path
+	}
+	rest, found := strings.CutPrefix(urlPath, prefix)
+	if !found || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return "", "", false
+	}
+	return prefix, rest, true
+}
+
+// version returns the application of the route serving a request with the
+// given header, the canary for Canary.Percent of the requests.
+func (route *Route) version(header http.Header) string {
+	canary := route.Canary
+	if canary == nil {
+		return route.App
+	}
+	if canary.Header != "" {
+		switch header.Get(canary.Header) {
+		case canaryVersion:
+			return canary.App
+		case stableVersion:
+			return route.App
+		}
+	}
+	if rand.Float64()*100 < canary.Percent {
+		return canary.App
+	}
+	return route.App
+}
+
+// matchRoute returns the application below webRoot of the first route
+// matching urlPath, in the version chosen for a request with the given
+// header, along with SCRIPT_NAME and PATH_INFO. It returns an empty path if
+// no route matches or the application doesn't exist. A missing canary falls
+// back to the app of the route.
+func (s *Spawner) matchRoute(webRoot, urlPath string, header http.Header) (appPath, scriptName, pathInfo string) {
+	route, scriptName, pathInfo := s.findRoute(urlPath)
+	if route == nil {
+		return "", "", ""
+	}
+	if app := route.version(header); app != route.App {
+		appPath = filepath.Join(webRoot, filepath.FromSlash(app))
+		if s.isApp(appPath) || s.isCGIScript(appPath) {
+			return appPath, scriptName, pathInfo
+		}
+		proxyLog.Warn("Canary application doesn't exist, using the stable one", "path", urlPath, "app", app)
+	}
+	appPath = filepath.Join(webRoot, filepath.FromSlash(route.App))
+	if !s.isApp(appPath) && !s.isCGIScript(appPath) {
+		proxyLog.Warn("Routed application doesn't exist", "path", urlPath, "app", route.App)
+		return "", "", ""
+	}
+	return appPath, scriptName, pathInfo
+}
+
+// findRoute returns the first route matching urlPath, along with SCRIPT_NAME
+// and PATH_INFO, or nil if none does.
+func (s *Spawner) findRoute(urlPath string) (route *Route, scriptName, pathInfo string) {
+	for i := range s.Config.Routes {
+		route := &s.Config.Routes[i]
+		if scriptName, pathInfo, ok := route.match(urlPath); ok {
+			return route, scriptName, pathInfo
+		}
+	}
+	return nil, "", ""
+}
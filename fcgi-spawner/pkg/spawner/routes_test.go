@@ -0,0 +1,134 @@
+package spawner
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   Route
+		wantErr bool
+	}{
+		{name: "prefix", route: Route{Path: "/api/*", App: "api.fcgi"}},
+		{name: "regex", route: Route{Regex: `^/posts/\d+$`, App: "blog/posts.fcgi"}},
+		{name: "path and regex", route: Route{Path: "/", Regex: "^/$", App: "index.fcgi"}, wantErr: true},
+		{name: "neither path nor regex", route: Route{App: "index.fcgi"}, wantErr: true},
+		{name: "relative path", route: Route{Path: "api/*", App: "api.fcgi"}, wantErr: true},
+		{name: "missing app", route: Route{Path: "/"}, wantErr: true},
+		{name: "app outside webRoot", route: Route{Path: "/", App: "../index.fcgi"}, wantErr: true},
+		{name: "invalid regex", route: Route{Regex: "(", App: "index.fcgi"}, wantErr: true},
+		{name: "canary", route: Route{Path: "/*", App: "app.fcgi", Canary: &Canary{App: "app-canary.fcgi", Percent: 5, Header: "X-Canary"}}},
+		{name: "canary without app", route: Route{Path: "/*", App: "app.fcgi", Canary: &Canary{Percent: 5}}, wantErr: true},
+		{name: "canary percent above 100", route: Route{Path: "/*", App: "app.fcgi", Canary: &Canary{App: "app-canary.fcgi", Percent: 101}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Routes: []Route{tt.route}}
+			err := cfg.validateRoutes()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateRoutes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchRoute(t *testing.T) {
+	webRoot := t.TempDir()
+	for _, name := range []string{"index.fcgi", "api.fcgi", "posts.fcgi"} {
+		if err := os.WriteFile(filepath.Join(webRoot, name), nil, 0755); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	cfg := &Config{
+		WebRoot: webRoot,
+		Routes: []Route{
+			{Path: "/api/*", App: "api.fcgi"},
+			{Regex: `^/posts/\d+$`, App: "posts.fcgi"},
+			{Path: "/missing", App: "missing.fcgi"},
+			{Path: "/", App: "index.fcgi"},
+		},
+	}
+	if err := cfg.validateRoutes(); err != nil {
+		t.Fatalf("validateRoutes() error = %v", err)
+	}
+	s := NewSpawner(cfg)
+
+	tests := []struct {
+		urlPath              string
+		app                  string
+		scriptName, pathInfo string
+	}{
+		{"/", "index.fcgi", "/", ""},
+		{"/api", "api.fcgi", "/api", ""},
+		{"/api/users/42", "api.fcgi", "/api", "/users/42"},
+		{"/posts/7", "posts.fcgi", "", "/posts/7"},
+		{"/apiv2", "", "", ""},
+		{"/posts/new", "", "", ""},
+		{"/missing", "", "", ""},
+	}
+	for _, tt := range tests {
+		appPath, scriptName, pathInfo := s.matchRoute(webRoot, tt.urlPath, nil)
+		wantPath := ""
+		if tt.app != "" {
+			wantPath = filepath.Join(webRoot, tt.app)
+		}
+		if appPath != wantPath || scriptName != tt.scriptName || pathInfo != tt.pathInfo {
+			t.Errorf("matchRoute(%q) = %q, %q, %q, want %q, %q, %q", tt.urlPath, appPath, scriptName, pathInfo, wantPath, tt.scriptName, tt.pathInfo)
+		}
+	}
+}
+
+func TestCanaryRoute(t *testing.T) {
+	webRoot := t.TempDir()
+	for _, name := range []string{"app.fcgi", "app-canary.fcgi"} {
+		if err := os.WriteFile(filepath.Join(webRoot, name), nil, 0755); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	stable, canary := filepath.Join(webRoot, "app.fcgi"), filepath.Join(webRoot, "app-canary.fcgi")
+
+	count := func(s *Spawner, header http.Header) int {
+		n := 0
+		for range 1000 {
+			appPath, _, _ := s.matchRoute(webRoot, "/", header)
+			switch appPath {
+			case canary:
+				n++
+			case stable:
+			default:
+				t.Fatalf("matchRoute() = %q, want one of the versions", appPath)
+			}
+		}
+		return n
+	}
+
+	tests := []struct {
+		name             string
+		canary           Canary
+		header           http.Header
+		wantMin, wantMax int // Requests out of 1000 sent to the canary
+	}{
+		{name: "none", canary: Canary{App: "app-canary.fcgi", Percent: 0}, wantMax: 0},
+		{name: "all", canary: Canary{App: "app-canary.fcgi", Percent: 100}, wantMin: 1000, wantMax: 1000},
+		{name: "half", canary: Canary{App: "app-canary.fcgi", Percent: 50}, wantMin: 400, wantMax: 600},
+		{name: "header selects canary", canary: Canary{App: "app-canary.fcgi", Header: "X-Canary"}, header: http.Header{"X-Canary": {"canary"}}, wantMin: 1000, wantMax: 1000},
+		{name: "header selects stable", canary: Canary{App: "app-canary.fcgi", Percent: 100, Header: "X-Canary"}, header: http.Header{"X-Canary": {"stable"}}, wantMax: 0},
+		{name: "other header value", canary: Canary{App: "app-canary.fcgi", Percent: 100, Header: "X-Canary"}, header: http.Header{"X-Canary": {"yes"}}, wantMin: 1000, wantMax: 1000},
+		{name: "missing canary", canary: Canary{App: "missing.fcgi", Percent: 100}, wantMax: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{WebRoot: webRoot, Routes: []Route{{Path: "/*", App: "app.fcgi", Canary: &tt.canary}}}
+			if err := cfg.validateRoutes(); err != nil {
+				t.Fatalf("validateRoutes() error = %v", err)
+			}
+			if got := count(NewSpawner(cfg), tt.header); got < tt.wantMin || got > tt.wantMax {
+				t.Errorf("%d of 1000 requests sent to the canary, want %d to %d", got, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
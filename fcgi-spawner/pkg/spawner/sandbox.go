@@ -0,0 +1,263 @@
+package spawner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxHelper is the name the spawner runs itself under to sandbox an
+// application, see confine.
+const sandboxHelper = "fcgi-spawner-sandbox"
+
+// seccompDefault stands for defaultSeccompDeny in AppConfig.Seccomp.
+const seccompDefault = "default"
+
+// defaultSeccompDeny are the system calls denied by the default seccomp
+// filter: those administering the host, changing namespaces and mounts,
+// loading kernel code, inspecting other processes, and the kernel
+// interfaces most often exploited, which applications serving HTTP don't
+// need.
+var defaultSeccompDeny = []string{
+	"acct", "add_key", "bpf", "chroot", "clock_adjtime", "clock_settime",
+	"delete_module", "finit_module", "fsconfig", "fsmount", "fsopen",
+	"init_module", "io_uring_enter", "io_uring_register", "io_uring_setup",
+	"ioperm", "iopl", "kcmp", "kexec_file_load", "kexec_load", "keyctl",
+	"lookup_dcookie", "mount", "move_mount", "move_pages",
+	"name_to_handle_at", "open_by_handle_at", "open_tree", "perf_event_open",
+	"pivot_root", "process_vm_readv", "process_vm_writev", "ptrace",
+	"quotactl", "reboot", "request_key", "setdomainname", "sethostname",
+	"setns", "settimeofday", "swapoff", "swapon", "syslog", "umount2",
+	"unshare", "userfaultfd", "vhangup",
+}
+
+// sandboxSpec is what the sandbox helper sets up before it runs the
+// application.
+type sandboxSpec struct {
+	Umask           string    `json:"umask,omitempty"`
+	AppArmorProfile string    `json:"appArmorProfile,omitempty"`
+	NoNewPrivileges bool      `json:"noNewPrivileges,omitempty"`
+	Seccomp         []uintptr `json:"seccomp,omitempty"` // System call numbers
+	// Isolate makes Mounts the only files visible, see isolate, in the
+	// working directory Dir. The helper then takes on Credential itself.
+	Isolate    bool                `json:"isolate,omitempty"`
+	Mounts     []isolatedMount     `json:"mounts,omitempty"`
+	Dir        string              `json:"dir,omitempty"`
+	Credential *syscall.Credential `json:"credential,omitempty"`
+}
+
+func init() {
+	if len(os.Args) > 2 && os.Args[0] == sandboxHelper {
+		runSandboxHelper(os.Args[1], os.Args[2:])
+	}
+}
+
+// sandboxed reports whether the application runs sandboxed.
+func (c *AppConfig) sandboxed() bool {
+	return len(c.Seccomp) > 0 || c.AppArmorProfile != "" || c.NoNewPrivileges || c.Isolate
+}
+
+// validateSandbox checks the sandbox settings of the application.
+func (c *AppConfig) validateSandbox() error {
+	if err := c.validateIsolation(); err != nil {
+		return err
+	}
+	if !c.sandboxed() {
+		return nil
+	}
+	if c.Container != nil {
+		return errors.New("seccomp, appArmorProfile, noNewPrivileges and isolate can't be combined with container")
+	}
+	if strings.ContainsAny(c.AppArmorProfile, " \t\n") {
+		return fmt.Errorf("invalid appArmorProfile %q", c.AppArmorProfile)
+	}
+	if len(c.Seccomp) > 0 && seccompSyscalls == nil {
+		return fmt.Errorf("seccomp isn't supported on %s", runtime.GOARCH)
+	}
+	for _, name := range c.Seccomp {
+		if _, ok := seccompSyscalls[name]; !ok && name != seccompDefault {
+			return fmt.Errorf("unknown system call %q in seccomp", name)
+		}
+	}
+	return nil
+}
+
+// seccompNumbers returns the numbers of the system calls named in seccomp,
+// where seccompDefault stands for defaultSeccompDeny. System calls that
+// don't exist on this architecture are left out.
+func seccompNumbers(seccomp []string) []uintptr {
+	var numbers []uintptr
+	for _, name := range seccomp {
+		names := []string{name}
+		if name == seccompDefault {
+			names = defaultSeccompDeny
+		}
+		for _, name := range names {
+			if nr, ok := seccompSyscalls[name]; ok && !slices.Contains(numbers, nr) {
+				numbers = append(numbers, nr)
+			}
+		}
+	}
+	return numbers
+}
+
+// confine applies the umask and the sandbox of the application at appPath
+// to cmd, which must be ready to start. Go can't change either in the child
+// process before it runs the command, so a helper does: withUmask's shell,
+// or, for sandboxed applications, the spawner's own binary run as
+// sandboxHelper, which isolates the files of the application, sets the
+// umask, the AppArmor profile, no_new_privs and the seccomp filter, and
+// then replaces itself with the command, keeping its PID and file
+// descriptors. The spawner's binary must be executable by the user of the
+// application. Isolated applications can also write to the writable
+// paths, e.g. their socket directory.
+func (s *Spawner) confine(cmd *exec.Cmd, appPath string, app AppConfig, writable ...string) {
+	if !app.sandboxed() {
+		if app.Umask != "" {
+			withUmask(cmd, app.Umask)
+		}
+		return
+	}
+	if cmd.Err != nil {
+		// Start reports it.
+		return
+	}
+	helper, err := os.Executable()
+	if err != nil {
+		cmd.Err = fmt.Errorf("finding the spawner's binary to sandbox the application: %v", err)
+		return
+	}
+	sandbox := sandboxSpec{
+		Umask:           app.Umask,
+		AppArmorProfile: app.AppArmorProfile,
+		NoNewPrivileges: app.NoNewPrivileges,
+		Seccomp:         seccompNumbers(app.Seccomp),
+	}
+	if app.Isolate {
+		if err := s.isolateCommand(cmd, appPath, app, writable, &sandbox); err != nil {
+			cmd.Err = err
+			return
+		}
+	}
+	spec, err := json.Marshal(sandbox)
+	if err != nil {
+		cmd.Err = err
+		return
+	}
+	cmd.Args = append([]string{sandboxHelper, string(spec), cmd.Path}, cmd.Args...)
+	cmd.Path = helper
+}
+
+// runSandboxHelper sets up the sandbox described by spec, see confine, and
+// runs the command args, the path of the program followed by its argv. It
+// only returns by exiting with status 126 if that fails.
+func runSandboxHelper(spec string, args []string) {
+	fail := func(err error) {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", sandboxHelper, err)
+		os.Exit(126)
+	}
+	if len(args) < 2 {
+		fail(errors.New("missing command"))
+	}
+	var sandbox sandboxSpec
+	if err := json.Unmarshal([]byte(spec), &sandbox); err != nil {
+		fail(fmt.Errorf("invalid sandbox: %v", err))
+	}
+	// The AppArmor profile, no_new_privs and the seccomp filter are set on
+	// the thread, which then runs the command.
+	runtime.LockOSThread()
+	if sandbox.Isolate {
+		if err := isolate(sandbox.Mounts, sandbox.Dir); err != nil {
+			fail(fmt.Errorf("isolating the application: %v", err))
+		}
+		if cred := sandbox.Credential; cred != nil {
+			if err := dropPrivileges(cred); err != nil {
+				fail(err)
+			}
+		}
+	}
+	if sandbox.Umask != "" {
+		mode, err := parseFileMode(sandbox.Umask)
+		if err != nil {
+			fail(err)
+		}
+		syscall.Umask(int(mode))
+	}
+	if sandbox.AppArmorProfile != "" {
+		if err := setAppArmorExecProfile(sandbox.AppArmorProfile); err != nil {
+			fail(fmt.Errorf("setting AppArmor profile %s: %v", sandbox.AppArmorProfile, err))
+		}
+	}
+	// Seccomp filters require no_new_privs from unprivileged processes.
+	if sandbox.NoNewPrivileges || len(sandbox.Seccomp) > 0 {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			fail(fmt.Errorf("setting no_new_privs: %v", err))
+		}
+	}
+	if len(sandbox.Seccomp) > 0 {
+		if err := loadSeccompFilter(sandbox.Seccomp); err != nil {
+			fail(fmt.Errorf("loading seccomp filter: %v", err))
+		}
+	}
+	if err := syscall.Exec(args[0], args[1:], os.Environ()); err != nil {
+		fail(fmt.Errorf("running %s: %v", args[0], err))
+	}
+}
+
+// setAppArmorExecProfile makes the next program the thread runs confined
+// by the AppArmor profile, which must be loaded.
+func setAppArmorExecProfile(profile string) error {
+	err := os.WriteFile("/proc/thread-self/attr/apparmor/exec", []byte("exec "+profile), 0)
+	if errors.Is(err, os.ErrNotExist) {
+		// Kernels before 5.8 only have the attributes of the major LSM.
+		err = os.WriteFile("/proc/thread-self/attr/exec", []byte("exec "+profile), 0)
+	}
+	return err
+}
+
+// loadSeccompFilter installs a seccomp filter on the thread that fails the
+// system calls numbered denied with EPERM and kills the process on system
+// calls of other ABIs, such as 32-bit ones, which would bypass it.
+func loadSeccompFilter(denied []uintptr) error {
+	if len(denied) > 250 {
+		return errors.New("too many system calls")
+	}
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+	jump := func(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+	}
+	n := uint8(len(denied))
+	filter := []unix.SockFilter{
+		// seccomp_data.arch
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, 4),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, seccompArch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+		// seccomp_data.nr, with the x32 ABI of x86-64 in the high bits.
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, 0),
+		jump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, 0x40000000, 0, 1),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+	}
+	for i, nr := range denied {
+		filter = append(filter, jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(nr), n-uint8(i), 0))
+	}
+	filter = append(filter,
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ERRNO|uint32(unix.EPERM)),
+	)
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if _, _, errno := unix.Syscall(unix.SYS_SECCOMP, unix.SECCOMP_SET_MODE_FILTER, 0, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package spawner
+
+import "golang.org/x/sys/unix"
+
+// seccompArch is the audit architecture of the system calls seccomp
+// filters allow.
+const seccompArch = unix.AUDIT_ARCH_X86_64
+
+// seccompSyscalls are the system calls AppConfig.Seccomp may deny, by name.
+var seccompSyscalls = map[string]uintptr{
+	"acct":               unix.SYS_ACCT,
+	"add_key":            unix.SYS_ADD_KEY,
+	"bpf":                unix.SYS_BPF,
+	"chroot":             unix.SYS_CHROOT,
+	"clock_adjtime":      unix.SYS_CLOCK_ADJTIME,
+	"clock_settime":      unix.SYS_CLOCK_SETTIME,
+	"delete_module":      unix.SYS_DELETE_MODULE,
+	"finit_module":       unix.SYS_FINIT_MODULE,
+	"fsconfig":           unix.SYS_FSCONFIG,
+	"fsmount":            unix.SYS_FSMOUNT,
+	"fsopen":             unix.SYS_FSOPEN,
+	"init_module":        unix.SYS_INIT_MODULE,
+	"io_uring_enter":     unix.SYS_IO_URING_ENTER,
+	"io_uring_register":  unix.SYS_IO_URING_REGISTER,
+	"io_uring_setup":     unix.SYS_IO_URING_SETUP,
+	"ioperm":             unix.SYS_IOPERM,
+	"iopl":               unix.SYS_IOPL,
+	"kcmp":               unix.SYS_KCMP,
+	"kexec_file_load":    unix.SYS_KEXEC_FILE_LOAD,
+	"kexec_load":         unix.SYS_KEXEC_LOAD,
+	"keyctl":             unix.SYS_KEYCTL,
+	"lookup_dcookie":     unix.SYS_LOOKUP_DCOOKIE,
+	"memfd_create":       unix.SYS_MEMFD_CREATE,
+	"mlock":              unix.SYS_MLOCK,
+	"mlockall":           unix.SYS_MLOCKALL,
+	"mount":              unix.SYS_MOUNT,
+	"move_mount":         unix.SYS_MOVE_MOUNT,
+	"move_pages":         unix.SYS_MOVE_PAGES,
+	"name_to_handle_at":  unix.SYS_NAME_TO_HANDLE_AT,
+	"open_by_handle_at":  unix.SYS_OPEN_BY_HANDLE_AT,
+	"open_tree":          unix.SYS_OPEN_TREE,
+	"perf_event_open":    unix.SYS_PERF_EVENT_OPEN,
+	"pivot_root":         unix.SYS_PIVOT_ROOT,
+	"process_vm_readv":   unix.SYS_PROCESS_VM_READV,
+	"process_vm_writev":  unix.SYS_PROCESS_VM_WRITEV,
+	"ptrace":             unix.SYS_PTRACE,
+	"quotactl":           unix.SYS_QUOTACTL,
+	"reboot":             unix.SYS_REBOOT,
+	"request_key":        unix.SYS_REQUEST_KEY,
+	"sched_setscheduler": unix.SYS_SCHED_SETSCHEDULER,
+	"setdomainname":      unix.SYS_SETDOMAINNAME,
+	"sethostname":        unix.SYS_SETHOSTNAME,
+	"setns":              unix.SYS_SETNS,
+	"setpriority":        unix.SYS_SETPRIORITY,
+	"settimeofday":       unix.SYS_SETTIMEOFDAY,
+	"swapoff":            unix.SYS_SWAPOFF,
+	"swapon":             unix.SYS_SWAPON,
+	"syslog":             unix.SYS_SYSLOG,
+	"umount2":            unix.SYS_UMOUNT2,
+	"unshare":            unix.SYS_UNSHARE,
+	"userfaultfd":        unix.SYS_USERFAULTFD,
+	"vhangup":            unix.SYS_VHANGUP,
+}
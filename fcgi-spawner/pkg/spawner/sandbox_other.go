@@ -0,0 +1,9 @@
+//go:build !amd64 && !arm64
+
+package spawner
+
+// seccompArch and seccompSyscalls are only known on amd64 and arm64;
+// elsewhere AppConfig.Seccomp is rejected.
+const seccompArch = 0
+
+var seccompSyscalls map[string]uintptr
@@ -0,0 +1,103 @@
+package spawner
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestValidateSandbox(t *testing.T) {
+	tests := []struct {
+		name    string
+		app     AppConfig
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "seccomp", app: AppConfig{Seccomp: []string{"default", "memfd_create"}}},
+		{name: "apparmor", app: AppConfig{AppArmorProfile: "fcgi-app", NoNewPrivileges: true}},
+		{name: "unknown system call", app: AppConfig{Seccomp: []string{"execve"}}, wantErr: true},
+		{name: "invalid profile", app: AppConfig{AppArmorProfile: "fcgi app"}, wantErr: true},
+		{name: "container", app: AppConfig{NoNewPrivileges: true, Container: &ContainerConfig{Image: "app"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.app.validateSandbox(); (err != nil) != tt.wantErr {
+				t.Errorf("validateSandbox() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSandboxOverlay(t *testing.T) {
+	app := AppConfig{Seccomp: []string{"default"}, AppArmorProfile: "strict"}
+	app = app.overlay(AppConfig{Seccomp: []string{"memfd_create"}, AppArmorProfile: "unconfined", NoNewPrivileges: true})
+	if len(app.Seccomp) != 2 || app.AppArmorProfile != "strict" || !app.NoNewPrivileges {
+		t.Errorf("overlay() = %v, %q, %t, want both system calls, strict and no new privileges", app.Seccomp, app.AppArmorProfile, app.NoNewPrivileges)
+	}
+}
+
+func TestConfine(t *testing.T) {
+	if _, err := os.Stat("/proc/self/status"); err != nil {
+		t.Skip("/proc isn't available")
+	}
+	tests := []struct {
+		name string
+		app  AppConfig
+		want []string
+	}{
+		{name: "umask only", app: AppConfig{Umask: "027"}, want: []string{"0027", "NoNewPrivs:\t0", "Seccomp:\t0"}},
+		{name: "no new privileges", app: AppConfig{NoNewPrivileges: true}, want: []string{"NoNewPrivs:\t1", "Seccomp:\t0"}},
+		{name: "seccomp", app: AppConfig{Umask: "077", Seccomp: []string{"default"}}, want: []string{"0077", "NoNewPrivs:\t1", "Seccomp:\t2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The test binary runs the sandbox helper like the spawner's.
+			cmd := exec.Command("/bin/sh", "-c", "umask; grep -E '^(NoNewPrivs|Seccomp):' /proc/self/status", "arg")
+			NewSpawner(&Config{}).confine(cmd, "/bin/sh", tt.app)
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("command failed: %v: %s", err, out)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(out), want) {
+					t.Errorf("output doesn't contain %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestSeccompDenies(t *testing.T) {
+	if _, err := exec.LookPath("unshare"); err != nil {
+		t.Skip("unshare isn't installed")
+	}
+	// unshare(2) is denied by default, whatever the privileges.
+	cmd := exec.Command("unshare", "--user", "true")
+	NewSpawner(&Config{}).confine(cmd, "unshare", AppConfig{Seccomp: []string{"default"}})
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("unshare succeeded under the default seccomp filter: %s", out)
+	}
+	if !strings.Contains(string(out), "Operation not permitted") {
+		t.Errorf("unshare failed with %v: %s, want EPERM", err, out)
+	}
+}
+
+func TestSeccompKillsOtherABIs(t *testing.T) {
+	if os.Getenv("SECCOMP_X32_SYSCALL") == "1" {
+		// getpid(2) of the x32 ABI, run under the filter.
+		syscall.Syscall(0x40000000|syscall.SYS_GETPID, 0, 0, 0)
+		os.Exit(0)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSeccompKillsOtherABIs$")
+	cmd.Env = append(os.Environ(), "SECCOMP_X32_SYSCALL=1")
+	NewSpawner(&Config{}).confine(cmd, "x32", AppConfig{Seccomp: []string{"default"}})
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Sys().(syscall.WaitStatus).Signal() != syscall.SIGSYS {
+		t.Errorf("x32 system call under the default seccomp filter: %v: %s, want SIGSYS", err, out)
+	}
+}
@@ -0,0 +1,86 @@
+package spawner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// encodeSCGIHeaders encodes params as the netstring starting an SCGI request,
+// see https://python.ca/scgi/protocol.txt. CONTENT_LENGTH must come first and
+// SCGI=1 must be present.
+func encodeSCGIHeaders(params map[string]string, contentLength int64) []byte {
+	var headers bytes.Buffer
+	add := func(name, value string) {
+		headers.WriteString(name)
+		headers.WriteByte(0)
+		headers.WriteString(value)
+		headers.WriteByte(0)
+	}
+	add("CONTENT_LENGTH", strconv.FormatInt(contentLength, 10))
+	add("SCGI", "1")
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		if name != "CONTENT_LENGTH" && name != "SCGI" {
+			add(name, params[name])
+		}
+	}
+	netstring := []byte(strconv.Itoa(headers.Len()) + ":")
+	netstring = append(netstring, headers.Bytes()...)
+	return append(netstring, ',')
+}
+
+// sendSCGI sends a request with params and a body of contentLength bytes on
+// conn and returns the response once its headers have arrived.
+func sendSCGI(conn net.Conn, params map[string]string, body io.Reader, contentLength int64, timeout time.Duration) (*http.Response, error) {
+	w := bufio.NewWriter(progressWriter{conn, timeout})
+	w.Write(encodeSCGIHeaders(params, contentLength))
+	if _, err := io.CopyN(w, clientBody{body}, contentLength); err != nil {
+		return nil, fmt.Errorf("sending request body: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	return readCGIResponse(bufio.NewReader(conn))
+}
+
+// roundTripSCGI sends a request to child, which speaks SCGI. SCGI uses one
+// connection per request, which is closed by the application at the end of
+// the response; the caller must close the returned connection once the
+// response body has been read. The application must take the request body
+// and then send the response headers within timeout, unless it is 0.
+func (s *Spawner) roundTripSCGI(child *childProcess, params map[string]string, r *http.Request, timeout time.Duration) (*http.Response, net.Conn, error) {
+	// SCGI requires the length of the body up front.
+	body, contentLength, release, err := s.sizedBody(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+
+	conn, err := net.Dial("unix", child.socketPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	stop := context.AfterFunc(r.Context(), func() { conn.Close() })
+	resp, err := sendSCGI(conn, params, body, contentLength, timeout)
+	if !stop() {
+		// The client went away, closing the connection.
+		err = r.Context().Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return resp, conn, nil
+}
@@ -0,0 +1,138 @@
+package spawner
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// serveSCGI runs a minimal SCGI application on a unix socket, which echoes
+// the request method, a header and the body, and returns the socket path.
+func serveSCGI(t *testing.T) string {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "app.sock")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				length, _ := r.ReadString(':')
+				n, _ := strconv.Atoi(strings.TrimSuffix(length, ":"))
+				netstring := make([]byte, n+1)
+				if _, err := io.ReadFull(r, netstring); err != nil {
+					return
+				}
+				fields := strings.Split(string(netstring[:n]), "\x00")
+				headers := make(map[string]string)
+				for i := 0; i+1 < len(fields); i += 2 {
+					headers[fields[i]] = fields[i+1]
+				}
+				contentLength, _ := strconv.Atoi(headers["CONTENT_LENGTH"])
+				body := make([]byte, contentLength)
+				io.ReadFull(r, body)
+				fmt.Fprintf(conn, "Status: 201 Created\r\nContent-Type: text/plain\r\n\r\n%s %s %s first=%s", headers["REQUEST_METHOD"], headers["HTTP_X_TEST"], body, fields[0])
+			}()
+		}
+	}()
+	return socketPath
+}
+
+func TestEncodeSCGIHeaders(t *testing.T) {
+	got := string(encodeSCGIHeaders(map[string]string{"REQUEST_METHOD": "GET", "CONTENT_LENGTH": "-1"}, 0))
+	want := "43:CONTENT_LENGTH\x000\x00SCGI\x001\x00REQUEST_METHOD\x00GET\x00,"
+	if got != want {
+		t.Errorf("encodeSCGIHeaders() = %q, want %q", got, want)
+	}
+}
+
+func TestProxySCGI(t *testing.T) {
+	s := NewSpawner(&Config{})
+	child := &childProcess{
+		cmd:        &mockCmd{path: "/web/app.scgi"},
+		socketPath: serveSCGI(t),
+		binaryPath: "/web/app.scgi",
+		app:        AppConfig{Protocol: protocolSCGI},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.proxyRequest(w, r, child, "/app.scgi", "")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		body io.Reader
+	}{
+		{name: "known length", body: strings.NewReader("hello")},
+		// Without a length the body is chunked and buffered by the spawner.
+		{name: "unknown length", body: io.MultiReader(strings.NewReader("hel"), strings.NewReader("lo"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/app.scgi", tt.body)
+			req.Header.Set("X-Test", "scgi")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("POST error = %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusCreated {
+				t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusCreated)
+			}
+			if want := "POST scgi hello first=CONTENT_LENGTH"; string(body) != want {
+				t.Errorf("body = %q, want %q", body, want)
+			}
+		})
+	}
+}
+
+func TestRoundTripSCGIClientGone(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "app.sock")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	// An application that takes the request and never answers.
+	started := make(chan struct{})
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		close(started)
+		io.Copy(io.Discard, conn)
+	}()
+	s := NewSpawner(&Config{})
+	child := &childProcess{socketPath: socketPath, binaryPath: "/web/app.scgi", app: AppConfig{Protocol: protocolSCGI}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	r := httptest.NewRequestWithContext(ctx, http.MethodGet, "/app.scgi", nil)
+	_, _, err = s.roundTripSCGI(child, map[string]string{"REQUEST_METHOD": "GET"}, r, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("roundTripSCGI() error = %v, want %v", err, context.Canceled)
+	}
+}
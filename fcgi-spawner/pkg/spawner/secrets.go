@@ -0,0 +1,129 @@
+package spawner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// vaultPrefix marks a value of a .env file as a reference to a secret in
+// HashiCorp Vault, e.g. vault:secret/data/app#password.
+const vaultPrefix = "vault:"
+
+// readEnvFile returns the contents of the .env file at path. Files encrypted
+// with SOPS are decrypted with the sops command.
+func readEnvFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !isSOPSFile(data) {
+		return data, nil
+	}
+	cmd := exec.Command("sops", "--decrypt", "--input-type", "dotenv", "--output-type", "dotenv", path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	data, err = cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s with sops: %v: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	return data, nil
+}
+
+// isSOPSFile reports whether data is a dotenv file encrypted with SOPS, which
+// adds its metadata as sops_* variables.
+func isSOPSFile(data []byte) bool {
+	for line := range strings.SplitSeq(string(data), "\n") {
+		if strings.HasPrefix(line, "sops_version=") {
+			return true
+		}
+	}
+	return false
+}
+
+// vaultClient reads secrets from the Vault server at VAULT_ADDR with the
+// token in VAULT_TOKEN, both taken from the spawner's environment. Secrets
+// read once are remembered, so that several keys of a secret are read with a
+// single request.
+type vaultClient struct {
+	addr, token string
+	client      *http.Client
+	secrets     map[string]map[string]any
+}
+
+func newVaultClient() *vaultClient {
+	return &vaultClient{
+		addr:    strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/"),
+		token:   os.Getenv("VAULT_TOKEN"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+		secrets: make(map[string]map[string]any),
+	}
+}
+
+// resolve returns the secret a reference like vault:secret/data/app#password
+// points to: the key after # of the secret at the path before it. Both KV
+// version 1 and 2 secrets engines are supported.
+func (v *vaultClient) resolve(ref string) (string, error) {
+	path, key, ok := strings.Cut(strings.TrimPrefix(ref, vaultPrefix), "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("invalid secret reference %q, expected vault:<path>#<key>", ref)
+	}
+	secret, err := v.read(path)
+	if err != nil {
+		return "", err
+	}
+	value, ok := secret[key]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no key %q", path, key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// read returns the data of the secret at path.
+func (v *vaultClient) read(path string) (map[string]any, error) {
+	if secret, ok := v.secrets[path]; ok {
+		return secret, nil
+	}
+	if v.addr == "" || v.token == "" {
+		return nil, errors.New("VAULT_ADDR and VAULT_TOKEN must be set to read secrets from vault")
+	}
+	req, err := http.NewRequest(http.MethodGet, v.addr+"/v1/"+(&url.URL{Path: strings.TrimPrefix(path, "/")}).EscapedPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reading vault secret %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("reading vault secret %s: %s", path, resp.Status)
+	}
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("reading vault secret %s: %v", path, err)
+	}
+	secret := body.Data
+	// KV version 2 nests the secret and adds metadata.
+	if data, ok := secret["data"].(map[string]any); ok {
+		if _, ok := secret["metadata"]; ok {
+			secret = data
+		}
+	}
+	v.secrets[path] = secret
+	return secret, nil
+}
@@ -0,0 +1,90 @@
+package spawner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestAppEnvVaultSecrets(t *testing.T) {
+	requests := 0
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		requests++
+		switch r.URL.Path {
+		case "/v1/secret/data/app":
+			w.Write([]byte(`{"data": {"data": {"password": "hunter2", "port": 5432}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/legacy":
+			w.Write([]byte(`{"data": {"token": "abc"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "s.token")
+
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "app.fcgi")
+	envFile := "DB_PASS=vault:secret/data/app#password\nDB_PORT=vault:secret/data/app#port\nAPI_TOKEN=vault:kv/legacy#token\nPLAIN=value\n"
+	if err := os.WriteFile(filepath.Join(webRoot, "app.env"), []byte(envFile), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot})
+
+	env, err := s.appEnv(appPath, AppConfig{})
+	if err != nil {
+		t.Fatalf("appEnv() error = %v", err)
+	}
+	for _, want := range []string{"DB_PASS=hunter2", "DB_PORT=5432", "API_TOKEN=abc", "PLAIN=value"} {
+		if !slices.Contains(env, want) {
+			t.Errorf("appEnv() = %v, missing %s", env, want)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("%d requests to vault, want 2", requests)
+	}
+
+	for _, ref := range []string{"vault:secret/data/app#missing", "vault:secret/data/other#key", "vault:secret/data/app"} {
+		if err := os.WriteFile(filepath.Join(webRoot, "app.env"), []byte("SECRET="+ref+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write env file: %v", err)
+		}
+		if _, err := s.appEnv(appPath, AppConfig{}); err == nil {
+			t.Errorf("appEnv() with %s succeeded, want an error", ref)
+		}
+	}
+}
+
+func TestReadEnvFileSOPS(t *testing.T) {
+	// A stand-in for sops printing the decrypted file.
+	bin := t.TempDir()
+	sops := "#!/bin/sh\necho \"decrypted $@\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "sops"), []byte(sops), 0755); err != nil {
+		t.Fatalf("Failed to write sops: %v", err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain.env")
+	if err := os.WriteFile(plain, []byte("KEY=value\n"), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	encrypted := filepath.Join(dir, "encrypted.env")
+	if err := os.WriteFile(encrypted, []byte("KEY=ENC[AES256_GCM,data:...]\nsops_version=3.8.1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+
+	if data, err := readEnvFile(plain); err != nil || string(data) != "KEY=value\n" {
+		t.Errorf("readEnvFile(plain) = %q, %v", data, err)
+	}
+	want := "decrypted --decrypt --input-type dotenv --output-type dotenv " + encrypted + "\n"
+	if data, err := readEnvFile(encrypted); err != nil || string(data) != want {
+		t.Errorf("readEnvFile(encrypted) = %q, %v, want %q", data, err, want)
+	}
+}
@@ -0,0 +1,84 @@
+package spawner
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// childStopTimeout is how long children get to exit after SIGTERM during
+// shutdown before they are killed.
+const childStopTimeout = 5 * time.Second
+
+// shutdownServer stops srv from accepting connections and waits for in-flight
+// requests until ctx is done, after which the remaining connections are
+// closed.
+func shutdownServer(ctx context.Context, srv *http.Server) {
+	if err := srv.Shutdown(ctx); err != nil {
+		mainLog.Warn("Requests still running after the shutdown timeout, closing connections", "addr", srv.Addr, "error", err)
+		srv.Close()
+	}
+}
+
+// stopAllChildren sends SIGTERM to all child processes, kills the ones that
+// haven't exited within timeout, reaps them and removes their sockets.
+func (s *Spawner) stopAllChildren(timeout time.Duration) {
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	s.stopped = true
+
+	// Processes draining after an upgrade are stopped as well.
+	children := slices.Concat(slices.Collect(maps.Values(s.childProcesses)), s.draining)
+	s.draining = nil
+
+	var wg sync.WaitGroup
+	for _, child := range children {
+		key := instanceKey(child.binaryPath, child.instance)
+		if child.cmd.Process() == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			process := child.cmd.Process()
+			if err := process.Signal(syscall.SIGTERM); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				spawnLog.Error("Error sending SIGTERM to child process", "pid", process.Pid(), "error", err)
+			}
+			exited := make(chan struct{})
+			go func() {
+				process.Wait()
+				close(exited)
+			}()
+			select {
+			case <-exited:
+			case <-time.After(timeout):
+				spawnLog.Warn("Child process didn't exit in time, killing it", "app", key, "pid", process.Pid(), "timeout", timeout)
+				process.Kill()
+				<-exited
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, child := range children {
+		child.closeConns()
+		if child.listener != nil {
+			child.listener.Close()
+		} else if err := os.Remove(child.socketPath); err != nil && !os.IsNotExist(err) {
+			spawnLog.Error("Error removing socket file", "socket", child.socketPath, "error", err)
+		}
+	}
+	clear(s.childProcesses)
+	s.saveState()
+	for appPath, f := range s.singletons {
+		f.Close()
+		delete(s.singletons, appPath)
+	}
+	spawnLog.Info("All child processes stopped")
+}
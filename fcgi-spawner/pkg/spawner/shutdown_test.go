@@ -0,0 +1,93 @@
+package spawner
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStopAllChildren(t *testing.T) {
+	webRoot := t.TempDir()
+	// The second app ignores SIGTERM and has to be killed.
+	apps := map[string]string{
+		"polite.fcgi":   "#!/bin/sh\nexec sleep 30\n",
+		"stubborn.fcgi": "#!/bin/sh\ntrap '' TERM\nwhile :; do sleep 0.1; done\n",
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot})
+	for name, script := range apps {
+		appPath := filepath.Join(webRoot, name)
+		if err := os.WriteFile(appPath, []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to write app: %v", err)
+		}
+		if err := s.startApp(appPath); err != nil {
+			t.Fatalf("startApp(%s) error = %v", name, err)
+		}
+	}
+	var pids []int
+	for _, child := range s.children() {
+		pids = append(pids, child.PID)
+	}
+	// Give the shells time to install their traps.
+	time.Sleep(200 * time.Millisecond)
+
+	start := time.Now()
+	s.stopAllChildren(500 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("stopAllChildren() took %s", elapsed)
+	}
+	if len(s.childProcesses) != 0 {
+		t.Errorf("stopAllChildren() left %d children", len(s.childProcesses))
+	}
+	for _, pid := range pids {
+		// The children have been reaped, so their PIDs no longer exist.
+		if err := syscall.Kill(pid, 0); err == nil {
+			t.Errorf("child process %d is still running", pid)
+		}
+	}
+}
+
+func TestTerminateChildGracePeriod(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "lingering.fcgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\ntrap '' TERM\nwhile :; do sleep 0.1; done\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	if err := os.WriteFile(appPath+".yaml", []byte("stopTimeout: 500ms\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot})
+	if err := s.startApp(appPath); err != nil {
+		t.Fatalf("startApp() error = %v", err)
+	}
+	pid := s.children()[0].PID
+	time.Sleep(200 * time.Millisecond)
+
+	// Stopping doesn't block other requests for the grace period.
+	start := time.Now()
+	s.stopApp(appPath)
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("stopApp() took %s", elapsed)
+	}
+	s.childProcessesMu.Lock()
+	running, stopping := len(s.childProcesses), len(s.draining)
+	s.childProcessesMu.Unlock()
+	if running != 0 || stopping != 1 {
+		t.Errorf("after stopApp(): %d running, %d stopping, want 0 and 1", running, stopping)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if err := syscall.Kill(pid, 0); err != nil {
+		t.Errorf("child process %d was killed before its grace period: %v", pid, err)
+	}
+	time.Sleep(time.Second)
+	if err := syscall.Kill(pid, 0); err == nil {
+		t.Errorf("child process %d is still running after its grace period", pid)
+	}
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	if len(s.draining) != 0 {
+		t.Errorf("%d processes still stopping", len(s.draining))
+	}
+}
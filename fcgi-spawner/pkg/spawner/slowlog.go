@@ -0,0 +1,30 @@
+package spawner
+
+import (
+	"net/http"
+	"time"
+)
+
+// requestTiming records where the time of a request to an application went.
+type requestTiming struct {
+	start   time.Time
+	spawn   time.Duration // Until a process was available, including starting one
+	spawned bool          // A process was started for the request
+}
+
+// logSlowRequest logs the request r to the application at appPath, answered
+// with status, if it took longer than Config.SlowRequestThreshold. The time
+// spent waiting for a process to start tells a cold start from a slow
+// application. CGI scripts have no spawn time, as they run per request.
+func (s *Spawner) logSlowRequest(r *http.Request, appPath string, status int, timing *requestTiming) {
+	threshold := s.Config.SlowRequestThreshold
+	if threshold <= 0 {
+		return
+	}
+	elapsed := time.Since(timing.start)
+	if elapsed < threshold {
+		return
+	}
+	proxyLog.Warn("Slow request", "app", s.relApp(appPath), "method", r.Method, "path", r.URL.Path, "status", status, "duration", elapsed.Round(time.Millisecond),
+		"spawnTime", timing.spawn.Round(time.Millisecond), "proxyTime", (elapsed - timing.spawn).Round(time.Millisecond), "spawned", timing.spawned)
+}
@@ -0,0 +1,49 @@
+package spawner
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogSlowRequest(t *testing.T) {
+	var buf bytes.Buffer
+	saved := proxyLog
+	proxyLog = slog.New(slog.NewTextHandler(&buf, nil))
+	t.Cleanup(func() { proxyLog = saved })
+
+	// The application never answers, so requests end with the upstream
+	// timeout.
+	webRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(webRoot, "slow.fcgi"), []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	upstreamTimeout := 200 * time.Millisecond
+	s := NewSpawner(&Config{WebRoot: webRoot, SlowRequestThreshold: 100 * time.Millisecond, Apps: map[string]AppConfig{
+		"slow.fcgi": {UpstreamTimeout: &upstreamTimeout},
+	}})
+	defer s.stopAllChildren(time.Second)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow.fcgi/report", nil))
+	line := buf.String()
+	for _, want := range []string{`msg="Slow request"`, "app=slow.fcgi", "path=/slow.fcgi/report", "status=504", "spawnTime=", "proxyTime=", "spawned=true"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log = %q, missing %s", line, want)
+		}
+	}
+
+	// Requests below the threshold aren't logged.
+	buf.Reset()
+	s.Config.SlowRequestThreshold = time.Minute
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow.fcgi/report", nil))
+	if strings.Contains(buf.String(), "Slow request") {
+		t.Errorf("log = %q, want no slow request", buf.String())
+	}
+}
@@ -0,0 +1,86 @@
+package spawner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// validateSocketPermissions checks the modes and owners set on the sockets
+// of applications and on SocketDir.
+func (c *Config) validateSocketPermissions() error {
+	for _, setting := range []struct{ name, mode, owner string }{
+		{"socketMode", c.SocketMode, c.SocketOwner},
+		{"socketDirMode", c.SocketDirMode, c.SocketDirOwner},
+	} {
+		if setting.mode != "" {
+			if _, err := parseFileMode(setting.mode); err != nil {
+				return fmt.Errorf("%s: %v", setting.name, err)
+			}
+		}
+		if setting.owner != "" {
+			userName, groupName, _ := strings.Cut(setting.owner, ":")
+			if _, err := lookupCredential(userName, groupName); err != nil {
+				return fmt.Errorf("owner %q: %v", setting.owner, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setPermissions sets mode, unless empty, and owner on path.
+func setPermissions(path, mode, owner string) error {
+	if mode != "" {
+		m, err := parseFileMode(mode)
+		if err != nil {
+			return err
+		}
+		if err := os.Chmod(path, m); err != nil {
+			return err
+		}
+	}
+	return chownTo(path, owner)
+}
+
+// makeSocketDir creates dir, SocketDir or the directory of the sockets of
+// applications in a subdirectory below it, with Config.SocketDirMode and
+// Config.SocketDirOwner. They are also set on the directories between
+// SocketDir and dir.
+func (s *Spawner) makeSocketDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	cfg := s.Config
+	if cfg.SocketDirMode == "" && cfg.SocketDirOwner == "" {
+		return nil
+	}
+	root := filepath.Clean(cfg.SocketDir)
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		if err := setPermissions(d, cfg.SocketDirMode, cfg.SocketDirOwner); err != nil {
+			return fmt.Errorf("failed to set the permissions of %s: %v", d, err)
+		}
+		if d == root || !isBelow(d, root) {
+			return nil
+		}
+	}
+}
+
+// setSocketPermissions sets the mode and owner configured for the sockets of
+// the application on the socket of child, which the application created.
+func (s *Spawner) setSocketPermissions(child *childProcess) error {
+	mode, owner := s.Config.SocketMode, s.Config.SocketOwner
+	if child.app.SocketMode != "" {
+		mode = child.app.SocketMode
+	}
+	if child.app.SocketOwner != "" {
+		owner = child.app.SocketOwner
+	}
+	if mode == "" && owner == "" {
+		return nil
+	}
+	if err := setPermissions(child.socketPath, mode, owner); err != nil {
+		return fmt.Errorf("failed to set the permissions of socket %s: %v", child.socketPath, err)
+	}
+	return nil
+}
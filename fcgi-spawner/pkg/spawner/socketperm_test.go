@@ -0,0 +1,68 @@
+package spawner
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestMakeSocketDir(t *testing.T) {
+	socketDir := filepath.Join(t.TempDir(), "sockets")
+	s := NewSpawner(&Config{SocketDir: socketDir, SocketDirMode: "0750", SocketDirOwner: strconv.Itoa(os.Getuid())})
+
+	if err := s.makeSocketDir(filepath.Join(socketDir, "api", "v1")); err != nil {
+		t.Fatalf("makeSocketDir() error = %v", err)
+	}
+	for _, dir := range []string{socketDir, filepath.Join(socketDir, "api"), filepath.Join(socketDir, "api", "v1")} {
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", dir, err)
+		}
+		if info.Mode().Perm() != 0750 {
+			t.Errorf("%s mode = %v, want 0750", dir, info.Mode().Perm())
+		}
+	}
+	// The parent of SocketDir is left alone.
+	if info, err := os.Stat(filepath.Dir(socketDir)); err != nil || info.Mode().Perm() == 0750 {
+		t.Errorf("Parent of socketDir = %v, %v, want it unchanged", info.Mode(), err)
+	}
+}
+
+func TestSetSocketPermissions(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "app.fcgi.sock")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	s := NewSpawner(&Config{SocketMode: "0660"})
+	tests := []struct {
+		name     string
+		app      AppConfig
+		wantMode os.FileMode
+	}{
+		{"default", AppConfig{}, 0660},
+		{"per app", AppConfig{SocketMode: "0600", SocketOwner: ":" + strconv.Itoa(os.Getgid())}, 0600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.setSocketPermissions(&childProcess{socketPath: socketPath, app: tt.app}); err != nil {
+				t.Fatalf("setSocketPermissions() error = %v", err)
+			}
+			info, err := os.Stat(socketPath)
+			if err != nil {
+				t.Fatalf("Failed to stat socket: %v", err)
+			}
+			if info.Mode().Perm() != tt.wantMode {
+				t.Errorf("socket mode = %v, want %v", info.Mode().Perm(), tt.wantMode)
+			}
+		})
+	}
+
+	if err := s.setSocketPermissions(&childProcess{socketPath: socketPath, app: AppConfig{SocketOwner: "no-such-user-fcgi"}}); err == nil {
+		t.Error("setSocketPermissions() with an unknown owner succeeded")
+	}
+}
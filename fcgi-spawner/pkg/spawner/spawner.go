@@ -0,0 +1,1353 @@
+// Package spawner starts FastCGI, SCGI, HTTP and CGI applications on demand
+// and proxies requests to them. A Spawner is an http.Handler that can be
+// embedded in other programs; the spawner command serves one with
+// ListenAndServe.
+package spawner
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Spawner manages FastCGI applications and serves static files.
+type Spawner struct {
+	Config           *Config
+	staticFileServer http.Handler
+	handler          http.Handler            // Serves requests, see ServeHTTP
+	hooks            hooks                   // Added with AddHook
+	adminRoutes      map[string]http.Handler // Added to the admin API with HandleAdmin
+	childProcessesMu sync.Mutex
+	childProcesses   map[string]*childProcess // Keyed by instanceKey
+	appLocks         map[string]*appMutex     // Serialize starting and stopping each app, by path
+	stopped          bool                     // Set once all children were stopped for shutdown
+	starting         int                      // Children being started by spawnChild, see makeRoom
+	cleanupPending   map[*childProcess]bool   // Children for the cleanup loop to look at
+	cleanupWake      chan struct{}            // Wakes the cleanup loop, see notifyCleanup
+	nextInstance     map[string]int           // Round-robin position per app
+	breakers         map[string]*breaker      // Apps failing to start, by path
+	restarts         map[string]*restartStats // Starts and exits, by app path
+	metrics          requestMetrics
+	events           eventBus                // Lifecycle events of the children
+	chat             chatNotifier            // Crashes and messages for Config.ChatWebhook
+	draining         []*childProcess         // Replaced processes finishing their requests, and stopping ones
+	upgrades         map[string]*time.Timer  // Pending upgrades, by app path
+	vhosts           map[string]*virtualHost // Virtual hosts, by host name
+	startedAt        time.Time
+	prewarming       atomic.Bool // Set while the apps to prewarm are started, failing readiness
+	stoppingMu       sync.Mutex
+	stoppingSince    time.Time // When the spawner was told to stop, see beginStopping
+	slot             int       // Slot taken in Config.CoordinationDir, see claimSlot
+	slotLock         *os.File
+	singletons       map[string]*os.File // Locks of singleton apps held, by path
+	audit            *auditLog           // Config.AuditLog, opened by Start
+	geoip            []*geoipDatabase    // Config.GeoIPDatabases
+}
+
+// NewSpawner creates and initializes a new Spawner instance for cfg, which
+// must have been checked with Config.Validate. Its child processes are
+// cleaned up and its applications upgraded once it is started with Start or
+// ListenAndServe.
+func NewSpawner(cfg *Config) *Spawner {
+	s := &Spawner{
+		Config:         cfg,
+		childProcesses: make(map[string]*childProcess),
+		cleanupWake:    make(chan struct{}, 1),
+		startedAt:      time.Now(),
+		geoip:          newGeoIPDatabases(cfg),
+	}
+
+	s.staticFileServer = s.newStaticFileServer(cfg.StaticRoot, cfg.SPAFallback)
+	for host, vhost := range cfg.VirtualHosts {
+		if s.vhosts == nil {
+			s.vhosts = make(map[string]*virtualHost)
+		}
+		s.vhosts[host] = &virtualHost{
+			host:             host,
+			webRoot:          vhost.WebRoot,
+			staticFileServer: s.newStaticFileServer(vhost.StaticRoot, vhost.SPAFallback),
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.spawnerHandler)
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	if cfg.PreStopDelay > 0 {
+		mux.HandleFunc(preStopPath, s.handlePreStop)
+	}
+	s.handler = mux
+	if cfg.Compress {
+		s.handler = newCompressor(cfg.CompressMinSize, cfg.CompressTypes).middleware(mux)
+	}
+	if len(cfg.Deny) > 0 {
+		s.handler = s.denyMiddleware(s.handler)
+	}
+	return s
+}
+
+type processInterface interface {
+	Signal(os.Signal) error
+	Wait() (*os.ProcessState, error)
+	Kill() error
+	Pid() int // Add Pid() for logging
+}
+
+type cmdInterface interface {
+	Start() error
+	Process() processInterface
+	ProcessState() *os.ProcessState
+	Path() string // Add Path() for SCRIPT_FILENAME
+}
+
+type childProcess struct {
+	cmd           cmdInterface
+	socketPath    string
+	lastUsed      time.Time
+	started       time.Time
+	binaryPath    string
+	instance      int       // Index of the process in the app's pool
+	active        int       // Requests being served, guarded by childProcessesMu
+	app           AppConfig // Settings the process was started with
+	binaryModTime time.Time
+	envFiles      []string     // The .env files the process was started with, see envFiles
+	envModTime    time.Time    // The latest modification time of envFiles, zero without any
+	listener      net.Listener // Add listener for stdio apps
+	container     string       // Name of the container the app runs in, see containerCommand
+	tmpDir        string       // Private TMPDIR of the process, see makePrivateTmp
+	idleTimer     *time.Timer  // Wakes the cleanup loop once the process may be idle, guarded by childProcessesMu
+	usage         procUsage    // Last sample of the watchdog, guarded by childProcessesMu
+	sampledAt     time.Time
+	overLimit     bool // Reported by the watchdog as exceeding its limits
+	// Active health checks, see checkHealth, guarded by childProcessesMu.
+	healthChecking  bool
+	healthCheckedAt time.Time
+	healthFailures  int // Failed health checks in a row
+
+	connsMu     sync.Mutex
+	idleConns   []*fcgiConn // Kept-alive FastCGI connections, see getConn
+	muxConns    []*fcgiMux  // Multiplexed FastCGI connections, see openMuxRequest
+	values      *fcgiValues // Capabilities of a FastCGI application, once known, see negotiate
+	connsClosed bool
+	transport   *http.Transport // Connections to apps speaking HTTP, see proxyHTTP
+}
+
+// execCmdWrapper implements cmdInterface for *exec.Cmd. Once started, the
+// process is reaped as soon as it exits, so that exited children are noticed
+// and don't linger as zombies.
+type execCmdWrapper struct {
+	cmd     *exec.Cmd
+	process *osProcessWrapper
+}
+
+func (w *execCmdWrapper) Start() error {
+	if err := w.cmd.Start(); err != nil {
+		return err
+	}
+	w.process = newOSProcessWrapper(w.cmd.Process)
+	return nil
+}
+
+func (w *execCmdWrapper) Process() processInterface {
+	if w.process == nil {
+		return nil
+	}
+	return w.process
+}
+
+// ProcessState returns the state of the exited process, or nil while it is running.
+func (w *execCmdWrapper) ProcessState() *os.ProcessState {
+	if w.process == nil {
+		return nil
+	}
+	select {
+	case <-w.process.done:
+		return w.process.state
+	default:
+		return nil
+	}
+}
+
+func (w *execCmdWrapper) Path() string {
+	return w.cmd.Path
+}
+
+// osProcessWrapper implements processInterface for *os.Process
+type osProcessWrapper struct {
+	process *os.Process
+	done    chan struct{} // Closed once the process has been reaped
+	state   *os.ProcessState
+	err     error
+}
+
+// newOSProcessWrapper wraps process and reaps it in the background.
+func newOSProcessWrapper(process *os.Process) *osProcessWrapper {
+	w := &osProcessWrapper{process: process, done: make(chan struct{})}
+	go func() {
+		w.state, w.err = process.Wait()
+		close(w.done)
+	}()
+	return w
+}
+
+func (w *osProcessWrapper) Signal(sig os.Signal) error {
+	return w.process.Signal(sig)
+}
+
+// Wait waits for the process to exit. Unlike os.Process.Wait, it can be
+// called any number of times.
+func (w *osProcessWrapper) Wait() (*os.ProcessState, error) {
+	<-w.done
+	return w.state, w.err
+}
+
+func (w *osProcessWrapper) Kill() error {
+	return w.process.Kill()
+}
+
+func (w *osProcessWrapper) Pid() int {
+	return w.process.Pid
+}
+
+// setEnv sets key to value in env, replacing an existing definition.
+func setEnv(env []string, key, value string) []string {
+	for i, existingVar := range env {
+		if strings.HasPrefix(existingVar, key+"=") {
+			env[i] = key + "=" + value
+			return env
+		}
+	}
+	return append(env, key+"="+value)
+}
+
+// logStream reads from a stream (stdout/stderr) and logs each line with a prefix.
+func logStream(stream io.ReadCloser, appPath string, pid int, streamName string) {
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		appLog.Info(scanner.Text(), "app", filepath.Base(appPath), "pid", pid, "stream", streamName)
+		appLogTail.add(appPath, pid, streamName, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		appLog.Error("Error reading from stream", "app", appPath, "pid", pid, "stream", streamName, "error", err)
+	}
+}
+
+// ServeHTTP serves requests for applications and static files, and the
+// health checks on /healthz and /readyz. Responses are compressed if
+// Config.Compress is set.
+func (s *Spawner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Start starts the background work of the spawner, which runs until ctx is
+// done: removing child processes that have exited or are idle, and upgrading
+// applications whose binaries or settings change. The applications to
+// prewarm are started in the background.
+func (s *Spawner) Start(ctx context.Context) error {
+	if s.Config.CoordinationDir != "" {
+		if err := s.claimSlot(); err != nil {
+			return fmt.Errorf("failed to claim a slot in coordinationDir: %v", err)
+		}
+	}
+	if s.Config.SocketDir != "" {
+		if err := s.makeSocketDir(s.Config.SocketDir); err != nil {
+			return fmt.Errorf("failed to create socket directory: %v", err)
+		}
+		s.recoverOrphans()
+	}
+	if s.Config.AuditLog != "" {
+		audit, err := openAuditLog(s.Config.AuditLog)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log: %v", err)
+		}
+		s.audit = audit
+	}
+	if err := s.watchFcgiBinaries(ctx); err != nil {
+		return err
+	}
+	go s.cleanupChildProcesses(ctx)
+	go s.watchdog(ctx)
+	go s.healthChecks(ctx)
+	go s.sendEvents(ctx)
+	go s.runWarmUps(ctx)
+	if s.Config.Registry != "" {
+		events, unsubscribe := s.events.subscribe()
+		go func() {
+			defer unsubscribe()
+			s.runRegistry(ctx, events)
+		}()
+	}
+	s.prewarming.Store(true)
+	go s.prewarm()
+	return nil
+}
+
+// Stop stops all child processes. They get childStopTimeout to exit after
+// SIGTERM before they are killed.
+func (s *Spawner) Stop() {
+	s.stopAllChildren(childStopTimeout)
+	s.releaseSlot()
+	s.audit.close()
+}
+
+// ListenAndServe starts the spawner and serves it on Config.ListenAddr, over
+// HTTPS if configured, along with the plain HTTP redirect and the admin API,
+// until ctx is done or a server fails. In-flight requests then get
+// Config.ShutdownTimeout to finish before the child processes are stopped.
+func (s *Spawner) ListenAndServe(ctx context.Context) error {
+	cfg := s.Config
+	var handler http.Handler = s
+	if cfg.AccessLog != "" {
+		accessLog, err := newAccessLog(cfg.AccessLog, cfg.AccessLogFormat)
+		if err != nil {
+			return fmt.Errorf("failed to open access log: %v", err)
+		}
+		handler = accessLog.middleware(handler)
+	}
+
+	server, err := newServer(cfg, handler)
+	if err != nil {
+		return err
+	}
+	var redirectServer *http.Server
+	if cfg.useTLS() {
+		redirect, err := configureTLS(cfg, server)
+		if err != nil {
+			return err
+		}
+		if cfg.RedirectAddr != "" {
+			redirectServer = &http.Server{
+				Addr:    cfg.RedirectAddr,
+				Handler: redirect,
+			}
+		}
+	}
+	var adminServer *http.Server
+	if cfg.AdminAddr != "" {
+		if cfg.AdminToken == "" && len(cfg.AdminTokens) == 0 {
+			return errors.New("the admin API requires a token, set SPAWNER_ADMIN_TOKEN, or adminToken or adminTokens in the config file")
+		}
+		adminServer = &http.Server{
+			Addr:    cfg.AdminAddr,
+			Handler: s.AdminHandler(),
+		}
+	}
+
+	ln, err := cfg.listen()
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", cfg.ListenAddr, err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := s.Start(ctx); err != nil {
+		ln.Close()
+		return err
+	}
+
+	// The first server to fail stops the spawner.
+	errc := make(chan error, 3)
+	if redirectServer != nil {
+		go func() {
+			mainLog.Info("Redirecting plain HTTP to HTTPS", "addr", cfg.RedirectAddr)
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errc <- fmt.Errorf("HTTP redirect server failed: %v", err)
+			}
+		}()
+	}
+	if adminServer != nil {
+		go func() {
+			adminLog.Info("Admin API listening", "addr", cfg.AdminAddr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errc <- fmt.Errorf("admin API server failed: %v", err)
+			}
+		}()
+	}
+	go func() {
+		var err error
+		if cfg.useTLS() {
+			mainLog.Info("Spawner listening", "addr", cfg.ListenAddr, "tls", true)
+			// With autocert the certificate comes from server.TLSConfig.
+			err = server.ServeTLS(ln, cfg.TLSCert, cfg.TLSKey)
+		} else {
+			mainLog.Info("Spawner listening", "addr", cfg.ListenAddr)
+			err = server.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			errc <- fmt.Errorf("server failed: %v", err)
+		}
+	}()
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+	case serveErr = <-errc:
+		mainLog.Error("Stopping the spawner", "error", serveErr)
+	}
+	if serveErr == nil {
+		s.waitPreStop()
+	}
+	shutdownTimeout := s.shutdownTimeout()
+	mainLog.Info("Shutting down, waiting for in-flight requests", "timeout", shutdownTimeout)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if adminServer != nil {
+		go shutdownServer(shutdownCtx, adminServer)
+	}
+	if redirectServer != nil {
+		go shutdownServer(shutdownCtx, redirectServer)
+	}
+	shutdownServer(shutdownCtx, server)
+	s.Stop()
+	return serveErr
+}
+
+// newServer creates the spawner's HTTP server. Unless disabled, plain HTTP
+// connections may use HTTP/2 without TLS (h2c), so that reverse proxies can
+// multiplex requests. Over TLS, HTTP/2 is negotiated with ALPN instead.
+func newServer(cfg *Config, handler http.Handler) (*http.Server, error) {
+	server := &http.Server{
+		Addr:    cfg.ListenAddr,
+		Handler: handler,
+	}
+	if cfg.H2C && !cfg.useTLS() {
+		h2s := &http2.Server{}
+		server.Handler = h2c.NewHandler(handler, h2s)
+		// h2c connections are hijacked from the server; registering the
+		// HTTP/2 server lets Shutdown send them a GOAWAY.
+		if err := http2.ConfigureServer(server, h2s); err != nil {
+			return nil, fmt.Errorf("failed to configure HTTP/2: %v", err)
+		}
+	}
+	return server, nil
+}
+
+// watchFcgiBinaries watches the web roots for changes to applications, their
+// settings and .env files in the background until ctx is done, and upgrades
+// the applications affected.
+func (s *Spawner) watchFcgiBinaries(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %v", err)
+	}
+
+	// Apps may live in subdirectories, so the whole tree is watched.
+	for _, webRoot := range s.webRoots() {
+		if err := watchTree(watcher, webRoot); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch webRoot %s: %v", webRoot, err)
+		}
+		watcherLog.Info("Watching directory for changes to FCGI binaries", "path", webRoot)
+	}
+	go s.handleWatchEvents(ctx, watcher)
+	return nil
+}
+
+// handleWatchEvents upgrades the applications changed according to the
+// events of watcher until ctx is done, and closes watcher then.
+func (s *Spawner) handleWatchEvents(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+					watcherLog.Debug("Watching new directory", "path", event.Name)
+					if err := watchTree(watcher, event.Name); err != nil {
+						watcherLog.Error("Failed to watch new directory", "path", event.Name, "error", err)
+					}
+				}
+			}
+			// New versions are written in place or, as running binaries can't
+			// be written to, renamed into place. Applications may also be
+			// removed, renamed away or made non-executable. Bursts of events,
+			// like those of a copy in progress, are handled once they settle.
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename|fsnotify.Chmod) != 0 {
+				if filepath.Ext(event.Name) == ".env" {
+					watcherLog.Debug("Environment file changed", "path", event.Name, "op", event.Op)
+					for _, appPath := range s.appsUsingEnvFile(event.Name) {
+						s.scheduleUpgrade(appPath)
+					}
+				} else if s.isAppName(event.Name) || s.isSidecarFile(event.Name) {
+					appPath := event.Name
+					if s.isSidecarFile(appPath) {
+						appPath = strings.TrimSuffix(appPath, filepath.Ext(appPath))
+						watcherLog.Debug("App config changed", "path", event.Name, "op", event.Op)
+					} else {
+						watcherLog.Debug("Application changed", "app", appPath, "op", event.Op)
+					}
+					s.scheduleUpgrade(appPath)
+				}
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			watcherLog.Error("Watcher error", "error", err)
+		}
+	}
+}
+
+// noHiddenFS is a file system that hides dot files.
+type noHiddenFS struct {
+	fs http.FileSystem
+}
+
+// Open implements the http.FileSystem interface.
+func (nhfs noHiddenFS) Open(name string) (http.File, error) {
+	// Disallow browsing of hidden files/directories
+	if strings.Contains(name, "/.") {
+		return nil, os.ErrNotExist
+	}
+
+	file, err := nhfs.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return noHiddenFile{file}, nil
+}
+
+// noHiddenFile is a file that filters out hidden files from directory listings.
+type noHiddenFile struct {
+	http.File
+}
+
+// Readdir implements the http.File interface and filters out hidden files.
+func (nhf noHiddenFile) Readdir(count int) ([]os.FileInfo, error) {
+	files, err := nhf.File.Readdir(count)
+	if err != nil {
+		return nil, err
+	}
+
+	var visibleFiles []os.FileInfo
+	for _, f := range files {
+		if !strings.HasPrefix(f.Name(), ".") {
+			visibleFiles = append(visibleFiles, f)
+		}
+	}
+	return visibleFiles, nil
+}
+
+func (s *Spawner) spawnerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "" {
+		http.Error(w, "Internal Server Error: script path is empty", http.StatusInternalServerError)
+		proxyLog.Error("Script path is empty in request")
+		return
+	}
+
+	// Hooks see the request as it came in and every response.
+	var appPath string
+	if len(s.hooks.postResponse) > 0 {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		w = rec
+		defer func() { s.postResponse(r, rec, appPath, start) }()
+	}
+	if r = s.preRoute(w, r); r == nil {
+		return
+	}
+	// Everything after the rewrite rules sees the rewritten request.
+	w, r = s.rewrite(w, r)
+	scriptPath := r.URL.Path
+
+	// CORS preflight requests carry no credentials, so they are answered
+	// before protected paths are checked.
+	w, ok := s.applyCORS(w, r)
+	if !ok {
+		return
+	}
+	// Protected paths are checked before anything is served.
+	if r = s.authorize(w, r); r == nil {
+		return
+	}
+
+	// The site is chosen by the Host header.
+	vhost := s.virtualHostFor(r.Host)
+
+	// Find the FCGI application the path leads to, if any
+	targetPath, err := s.findApp(vhost.webRoot, scriptPath)
+	if err != nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		proxyLog.Warn("Forbidden: attempted directory traversal", "path", scriptPath)
+		return
+	}
+
+	var scriptName, pathInfo string
+	if targetPath != "" {
+		scriptName, pathInfo = s.splitScriptPath(scriptPath, targetPath)
+	} else {
+		targetPath, scriptName, pathInfo = s.matchRoute(vhost.webRoot, scriptPath, r.Header)
+	}
+	appPath = targetPath
+
+	// Requests to applications are counted in the metrics of the app, and
+	// logged if they are slow.
+	var timing requestTiming
+	if targetPath != "" {
+		done := s.metrics.begin(targetPath)
+		rec := &statusRecorder{ResponseWriter: w}
+		timing.start = time.Now()
+		defer func() {
+			status := cmp.Or(rec.status, http.StatusOK)
+			done(status)
+			s.logSlowRequest(r, targetPath, status, &timing)
+		}()
+		w = rec
+	}
+
+	if targetPath != "" && isCGI(targetPath) {
+		if entry := accessEntryFrom(r.Context()); entry != nil {
+			entry.App = s.relApp(targetPath)
+			entry.Spawned = true
+		}
+		s.serveCGI(w, r, targetPath, scriptName, pathInfo)
+		return
+	}
+
+	if targetPath != "" {
+		child, spawned, err := s.getOrCreateChild(r.Context(), targetPath, r)
+		timing.spawn, timing.spawned = time.Since(timing.start), spawned
+		if entry := accessEntryFrom(r.Context()); entry != nil {
+			entry.App = s.relApp(targetPath)
+			entry.Spawned = spawned
+		}
+		var circuitOpen *circuitOpenError
+		if errors.As(err, &circuitOpen) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(circuitOpen.retryAfter.Seconds()))))
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			spawnLog.Debug("Not starting failing application", "app", targetPath, "retryAfter", circuitOpen.retryAfter)
+			return
+		}
+		var denied *spawnDeniedError
+		if errors.As(err, &denied) {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			spawnLog.Warn("Application not started", "app", targetPath, "reason", denied.reason)
+			return
+		}
+		var tooMany *tooManyChildrenError
+		if errors.As(err, &tooMany) {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			spawnLog.Warn("Application not started", "app", targetPath, "reason", tooMany)
+			return
+		}
+		var queued *spawnQueueError
+		if errors.As(err, &queued) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(queued.retryAfter.Seconds()))))
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			spawnLog.Warn("Not waiting for application", "app", targetPath, "reason", queued.reason)
+			return
+		}
+		var overloaded *overloadedError
+		if errors.As(err, &overloaded) {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			spawnLog.Warn("Application is overloaded", "app", targetPath, "reason", overloaded.reason)
+			return
+		}
+		if r.Context().Err() != nil {
+			// The client gave up waiting.
+			return
+		}
+		var notReady *notReadyError
+		if errors.As(err, &notReady) {
+			http.Error(w, "Service Unavailable: application did not become ready: "+notReady.reason.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		var singleton *singletonError
+		if errors.As(err, &singleton) {
+			http.Error(w, "Service Unavailable: application runs on another spawner", http.StatusServiceUnavailable)
+			spawnLog.Debug("Not starting singleton application", "app", targetPath)
+			return
+		}
+		var notRestarted *notRestartedError
+		if errors.As(err, &notRestarted) {
+			http.Error(w, "Service Unavailable: application is not restarted: "+notRestarted.reason.Error(), http.StatusServiceUnavailable)
+			spawnLog.Debug("Not restarting application", "app", targetPath, "reason", notRestarted.reason)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			spawnLog.Error("Error getting or creating child process", "app", targetPath, "error", err)
+			return
+		}
+		defer s.releaseChild(child)
+		setStickyCookie(w, r, child, scriptName)
+		s.proxyRequest(w, r, child, scriptName, pathInfo)
+		return
+	}
+
+	// If not an FCGI app, try serving as a static file
+	if vhost.staticFileServer != nil {
+		vhost.staticFileServer.ServeHTTP(s.cacheStatic(w, r), r)
+		return
+	}
+
+	// If we reach here, it's a 404
+	http.Error(w, "404 Not Found", http.StatusNotFound)
+	proxyLog.Debug("Requested path is not a valid FCGI application and static file serving is disabled", "path", r.URL.Path)
+}
+
+// getOrCreateChild returns an instance of the application at appPath to serve
+// the request r, starting instances as needed, and whether the instance was
+// started for this request. r is only used to pick the instance and may be
+// nil. The instance counts as busy until it is handed back with releaseChild.
+// When every instance serves as many requests as the app allows, the request
+// waits for one to finish, see waitForSlot.
+func (s *Spawner) getOrCreateChild(ctx context.Context, appPath string, r *http.Request) (*childProcess, bool, error) {
+	for {
+		child, spawned, freed, err := s.acquireChild(ctx, appPath, r)
+		if freed == nil {
+			return child, spawned, err
+		}
+		if err := s.waitForSlot(ctx, appPath, freed); err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+// acquireChild is getOrCreateChild without waiting: if every instance is at
+// the concurrency limit of the app, it queues the request and returns the
+// channel closed once one of them has finished a request instead.
+func (s *Spawner) acquireChild(ctx context.Context, appPath string, r *http.Request) (*childProcess, bool, <-chan struct{}, error) {
+	appLock, err := s.lockQueued(ctx, appPath)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	defer appLock.Unlock()
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+
+	begin := time.Now()
+	pool, app, err := s.ensurePool(appPath)
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	child, sticky := s.pick(appPath, pool, app.Balance, r)
+	if child.active >= app.scaleThreshold() && len(pool) < app.maxInstances() {
+		// Even the least busy instance is at the scale threshold, so add one
+		// rather than queueing behind slow requests.
+		if started, err := s.spawnChild(appPath, freeInstance(pool), app); err != nil {
+			spawnLog.Warn("Could not start another instance, using a busy one", "app", appPath, "error", err)
+		} else {
+			spawnLog.Info("Scaled up application", "app", appPath, "instances", len(pool)+1, "active", child.active)
+			if !sticky {
+				// Clients sticking to the busy instance stay with it.
+				child = started
+			}
+		}
+	}
+	if limit := s.maxConcurrentFor(app); limit > 0 && child.active >= limit {
+		// Even sticky clients go elsewhere rather than wait.
+		child = leastBusy(s.pool(appPath))
+		if child.active >= limit {
+			freed, err := s.queueRequest(appPath, appLock, app)
+			return nil, false, freed, err
+		}
+	}
+	child.active++
+	child.lastUsed = time.Now()
+	return child, !child.started.Before(begin), nil, nil
+}
+
+// ensurePool replaces the instances of the application at appPath that have
+// exited or run an outdated binary and starts instances until the app's
+// minimum is running. It returns the running instances and the app's
+// settings. The caller must hold the app's lock and childProcessesMu, which is
+// released while instances start.
+func (s *Spawner) ensurePool(appPath string) ([]*childProcess, AppConfig, error) {
+	app, err := s.appConfig(appPath)
+	if err != nil {
+		return nil, AppConfig{}, err
+	}
+	binary, err := s.appBinary(appPath, app)
+	if err != nil {
+		return nil, AppConfig{}, fmt.Errorf("command of %s not found: %v", appPath, err)
+	}
+	fileInfo, err := os.Stat(binary)
+	if os.IsNotExist(err) {
+		return nil, AppConfig{}, fmt.Errorf("application not found: %s", appPath)
+	}
+	if err != nil {
+		return nil, AppConfig{}, fmt.Errorf("failed to get file info for %s: %v", binary, err)
+	}
+	currentModTime := fileInfo.ModTime()
+	envFiles := s.envFiles(appPath)
+	envModTime := latestModTime(envFiles)
+
+	var pool, replaced []*childProcess
+	for _, child := range s.pool(appPath) {
+		if child.cmd.ProcessState() != nil {
+			// Process has exited, so we'll clean it up and create a new one.
+			s.recordExit(child)
+			if state := child.cmd.ProcessState(); time.Since(child.started) < crashWindow {
+				s.recordFailure(appPath, app, fmt.Errorf("exited %s after start: %v", time.Since(child.started).Round(time.Millisecond), state))
+			}
+			spawnLog.Info("Child process has exited, restarting", "app", appPath, "pid", child.cmd.Process().Pid())
+			s.terminateChild(child)
+			continue
+		}
+		if !currentModTime.Equal(child.binaryModTime) || !envModTime.Equal(child.envModTime) || !slices.Equal(envFiles, child.envFiles) || !reflect.DeepEqual(child.app, app) {
+			// The binary, the .env files or the settings have changed. The old process is
+			// taken out of service, and drained once the new one is ready.
+			replaced = append(replaced, child)
+			delete(s.childProcesses, instanceKey(child.binaryPath, child.instance))
+			s.draining = append(s.draining, child)
+			continue
+		}
+		pool = append(pool, child)
+	}
+
+	kept := len(pool)
+	for len(pool) < app.minInstances() {
+		child, err := s.spawnChild(appPath, freeInstance(pool), app)
+		if err != nil {
+			if len(replaced) == 0 {
+				return nil, AppConfig{}, err
+			}
+			// Keep serving with the old processes rather than failing. They
+			// count as up to date until the application changes again.
+			spawnLog.Error("Failed to start new version of application, keeping the old processes", "app", appPath, "error", err)
+			for _, child := range pool[kept:] {
+				delete(s.childProcesses, instanceKey(child.binaryPath, child.instance))
+				s.drainChild(child)
+			}
+			for _, old := range replaced {
+				old.binaryModTime, old.envFiles, old.envModTime, old.app = currentModTime, envFiles, envModTime, app
+				s.draining = slices.DeleteFunc(s.draining, func(c *childProcess) bool { return c == old })
+				s.childProcesses[instanceKey(old.binaryPath, old.instance)] = old
+			}
+			return append(pool[:kept], replaced...), app, nil
+		}
+		pool = append(pool, child)
+	}
+	for _, child := range replaced {
+		spawnLog.Info("Application changed, draining old child process", "app", appPath, "pid", child.cmd.Process().Pid())
+		s.drainChild(child)
+	}
+	return pool, app, nil
+}
+
+// terminateChild removes child from the running processes and stops it in
+// the background. Until it has exited, it is kept with the draining processes,
+// so that its socket isn't reused and shutdown still waits for it. The caller
+// must hold childProcessesMu.
+func (s *Spawner) terminateChild(child *childProcess) {
+	delete(s.childProcesses, instanceKey(child.binaryPath, child.instance))
+	child.closeConns()
+	s.draining = append(s.draining, child)
+	go func() {
+		s.stopChild(child)
+		s.childProcessesMu.Lock()
+		defer s.childProcessesMu.Unlock()
+		s.draining = slices.DeleteFunc(s.draining, func(c *childProcess) bool { return c == child })
+		s.releaseSingleton(child.binaryPath)
+	}()
+}
+
+// stopChild stops child, killing it if it doesn't exit within its grace
+// period, see stopTimeoutFor, and removes its socket.
+func (s *Spawner) stopChild(child *childProcess) {
+	if process := child.cmd.Process(); process != nil {
+		// Attempt graceful shutdown first
+		if err := process.Signal(syscall.SIGTERM); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			spawnLog.Error("Error sending SIGTERM to child process", "pid", process.Pid(), "error", err)
+		}
+		exited := make(chan struct{})
+		go func() {
+			// Wait for the process to ensure it's reaped and doesn't become a zombie
+			if _, err := process.Wait(); err != nil {
+				spawnLog.Error("Error waiting for child process", "pid", process.Pid(), "error", err)
+			}
+			close(exited)
+		}()
+		gracePeriod := s.stopTimeoutFor(child.app)
+		select {
+		case <-exited:
+		case <-time.After(gracePeriod):
+			spawnLog.Warn("Child process didn't exit in time, killing it", "app", child.binaryPath, "pid", process.Pid(), "timeout", gracePeriod)
+			if err := process.Kill(); err != nil {
+				spawnLog.Error("Error sending SIGKILL to child process", "pid", process.Pid(), "error", err)
+			}
+			<-exited
+		}
+	}
+	child.closeConns()
+	if child.listener != nil {
+		child.listener.Close()
+	} else {
+		if err := os.Remove(child.socketPath); err != nil && !os.IsNotExist(err) {
+			spawnLog.Error("Error removing socket file", "socket", child.socketPath, "error", err)
+		}
+	}
+	s.removeContainer(child)
+	removePrivateTmp(child)
+}
+
+// envFilePath returns the path of the .env file of the application at
+// appPath, e.g. hello.env for hello.fcgi.
+func envFilePath(appPath string) string {
+	return strings.TrimSuffix(appPath, filepath.Ext(appPath)) + ".env"
+}
+
+// appEnv returns the environment of the application at appPath: a default
+// PATH, the variables from its .env files and those from its settings.
+func (s *Spawner) appEnv(appPath string, app AppConfig) ([]string, error) {
+	return s.loadAppEnv(appPath, app, true)
+}
+
+// loadAppEnv returns the environment of the application at appPath like
+// appEnv, with the secrets of its .env files resolved, or left as they are
+// unless resolveSecrets.
+func (s *Spawner) loadAppEnv(appPath string, app AppConfig, resolveSecrets bool) ([]string, error) {
+	// Hardcode PATH as a base. It can be overridden by .env file.
+	childEnv := []string{"PATH=/usr/local/bin:/usr/bin:/bin"}
+
+	// Later files override earlier ones, and expand their variables.
+	defined := make(map[string]string)
+	lookup := func(key string) (string, bool) {
+		if value, ok := defined[key]; ok {
+			return value, true
+		}
+		return os.LookupEnv(key)
+	}
+	var vault *vaultClient
+	for _, envPath := range s.envFiles(appPath) {
+		spawnLog.Debug("Loading environment file", "path", envPath)
+		data, err := readEnvFile(envPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read env file %s: %v", envPath, err)
+		}
+
+		vars, err := parseEnvFile(string(data), lookup)
+		if err != nil {
+			return nil, fmt.Errorf("env file %s: %v", envPath, err)
+		}
+		for _, v := range vars {
+			defined[v.key] = v.value
+			// Secrets are resolved when the application starts,
+			// so that they aren't stored in the web root.
+			if resolveSecrets && strings.HasPrefix(v.value, vaultPrefix) {
+				if vault == nil {
+					vault = newVaultClient()
+				}
+				if v.value, err = vault.resolve(v.value); err != nil {
+					return nil, fmt.Errorf("env file %s: %s: %v", envPath, v.key, err)
+				}
+			}
+			childEnv = setEnv(childEnv, v.key, v.value)
+		}
+	}
+	// Variables from the app config take precedence over the .env files.
+	for _, key := range slices.Sorted(maps.Keys(app.Env)) {
+		childEnv = setEnv(childEnv, key, app.Env[key])
+	}
+	return childEnv, nil
+}
+
+// startChild starts the given instance of the application at appPath and
+// waits until it accepts connections. It is called without childProcessesMu,
+// so that requests for other apps aren't held up, but with the app's lock.
+func (s *Spawner) startChild(appPath string, instance int, app AppConfig) (*childProcess, error) {
+	binary, err := s.appBinary(appPath, app)
+	if err != nil {
+		return nil, fmt.Errorf("command of %s not found: %v", appPath, err)
+	}
+	fileInfo, err := os.Stat(binary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info for %s: %v", binary, err)
+	}
+
+	envFiles := s.envFiles(appPath)
+	envModTime := latestModTime(envFiles)
+	childEnv, err := s.appEnv(appPath, app)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apps in containers always use socket mode, as the listener can't be
+	// passed into the container.
+	useSocketMode := s.Config.SocketDir != "" || app.Container != nil
+	var socketPath, container string
+	if app.Container != nil {
+		if socketPath, err = s.containerSocketPath(appPath, instance); err != nil {
+			return nil, err
+		}
+		container = containerName(socketPath)
+	} else if useSocketMode {
+		s.childProcessesMu.Lock()
+		socketPath = s.unusedSocketPath(filepath.Join(s.Config.SocketDir, s.appSocketName(appPath, instance)))
+		s.childProcessesMu.Unlock()
+		if err := s.makeSocketDir(filepath.Dir(socketPath)); err != nil {
+			return nil, fmt.Errorf("failed to create socket directory: %v", err)
+		}
+		// Clean up old socket file if it exists
+		_ = os.Remove(socketPath)
+	} else {
+		// Use an abstract socket for stdio mode
+		socketPath = filepath.Join("/tmp/fcgi-spawner-sockets", s.appSocketName(appPath, instance))
+		s.childProcessesMu.Lock()
+		socketPath = s.unusedSocketPath("\x00" + socketPath)
+		s.childProcessesMu.Unlock()
+	}
+
+	var cmd *exec.Cmd
+	var ln net.Listener
+
+	if app.Container != nil {
+		if cmd, err = s.containerCommand(appPath, socketPath, app, childEnv); err != nil {
+			os.RemoveAll(filepath.Dir(socketPath))
+			return nil, err
+		}
+	} else if useSocketMode {
+		cmd = s.appCommand(appPath, app, append([]string{socketPath}, app.Args...))
+	} else {
+		cmd = s.appCommand(appPath, app, app.Args)
+		var err error
+		ln, err = net.Listen("unix", socketPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create listener for stdio app: %v", err)
+		}
+
+		unixListener, ok := ln.(*net.UnixListener)
+		if !ok {
+			ln.Close()
+			return nil, fmt.Errorf("listener was not a UnixListener")
+		}
+
+		listenerFile, err := unixListener.File()
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("failed to get listener file for child: %v", err)
+		}
+		defer listenerFile.Close() // We can close the file descriptor copy after start
+		cmd.Stdin = listenerFile
+	}
+
+	// Always set cmd.Env to the explicitly defined childEnv (which might be empty)
+	if app.Container == nil {
+		cmd.Env = childEnv
+	}
+
+	cred, err := s.credentialFor(app)
+	if err != nil {
+		if ln != nil {
+			ln.Close()
+		}
+		return nil, err
+	}
+	// The container runtime runs as the spawner and starts the container
+	// as the user, see containerCommand.
+	if cred != nil && app.Container == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+	}
+	if app.Container == nil {
+		cmd.Dir = appWorkDir(appPath, app, "")
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		if ln != nil {
+			ln.Close()
+		}
+		return nil, fmt.Errorf("failed to create stderr pipe for %s: %v", appPath, err)
+	}
+
+	var stdoutToLog io.ReadCloser
+	if useSocketMode { // Only capture stdout for socket mode
+		var err error
+		stdoutToLog, err = cmd.StdoutPipe()
+		if err != nil {
+			if ln != nil {
+				ln.Close()
+			}
+			return nil, fmt.Errorf("failed to create stdout pipe for %s: %v", appPath, err)
+		}
+	}
+
+	var tmpDir string
+	if app.PrivateTmp {
+		if tmpDir, err = makePrivateTmp(appPath, cred); err != nil {
+			if ln != nil {
+				ln.Close()
+			}
+			return nil, fmt.Errorf("failed to create private temporary directory for %s: %v", appPath, err)
+		}
+		cmd.Env = setEnv(cmd.Env, "TMPDIR", tmpDir)
+	}
+	if app.Container == nil {
+		var writable []string
+		if useSocketMode {
+			writable = append(writable, filepath.Dir(socketPath))
+		}
+		if tmpDir != "" {
+			writable = append(writable, tmpDir)
+		}
+		s.confine(cmd, appPath, app, writable...)
+	}
+
+	wrapper := &execCmdWrapper{cmd: cmd}
+	if err := wrapper.Start(); err != nil {
+		if ln != nil {
+			ln.Close()
+		}
+		if container != "" {
+			os.RemoveAll(filepath.Dir(socketPath))
+		}
+		if tmpDir != "" {
+			os.RemoveAll(tmpDir)
+		}
+		return nil, fmt.Errorf("failed to start application %s: %v", appPath, err)
+	}
+
+	go logStream(stderr, appPath, cmd.Process.Pid, "stderr")
+	if stdoutToLog != nil {
+		go logStream(stdoutToLog, appPath, cmd.Process.Pid, "stdout")
+	}
+
+	child := &childProcess{
+		cmd:           wrapper,
+		socketPath:    socketPath,
+		binaryPath:    appPath,
+		instance:      instance,
+		app:           app,
+		binaryModTime: fileInfo.ModTime(),
+		envFiles:      envFiles,
+		envModTime:    envModTime,
+		listener:      ln, // Store the listener
+		container:     container,
+		tmpDir:        tmpDir,
+	}
+	s.publishEvent(EventSpawned, child, "")
+	if err := s.waitReady(child); err != nil {
+		spawnLog.Error("Child process did not become ready", "app", appPath, "socket", socketPath, "error", err)
+		// Attempt to kill the process we just started, as it's not responding
+		if cmd.Process != nil {
+			cmd.Process.Kill()
+		}
+		child.closeConns()
+		if ln != nil {
+			ln.Close()
+		}
+		s.removeContainer(child)
+		removePrivateTmp(child)
+		return nil, &notReadyError{app: appPath, reason: err}
+	}
+	if useSocketMode && container == "" {
+		if err := s.setSocketPermissions(child); err != nil {
+			// The app works, but may not be reachable as intended.
+			spawnLog.Error("Failed to set socket permissions", "app", appPath, "error", err)
+		}
+	}
+	child.started = time.Now()
+	child.lastUsed = child.started
+	key := instanceKey(appPath, instance)
+
+	if container != "" {
+		spawnLog.Info("Started new container child process", "app", key, "pid", child.cmd.Process().Pid(), "container", container, "image", app.Container.Image)
+	} else if useSocketMode {
+		spawnLog.Info("Started new socket child process", "app", key, "pid", child.cmd.Process().Pid(), "socket", child.socketPath)
+	} else {
+		spawnLog.Info("Started new stdio child process", "app", key, "pid", child.cmd.Process().Pid())
+	}
+	if app.Protocol == "" || app.Protocol == protocolFastCGI {
+		// Requests don't wait for the answer.
+		go s.negotiate(child)
+	}
+
+	return child, nil
+}
+
+// proxyRequest forwards r to child, which serves it as scriptName with
+// pathInfo following it, over FastCGI or, if the app speaks them, SCGI or
+// HTTP.
+func (s *Spawner) proxyRequest(w http.ResponseWriter, r *http.Request, child *childProcess, scriptName, pathInfo string) {
+	s.childProcessesMu.Lock()
+	child.lastUsed = time.Now()
+	s.childProcessesMu.Unlock()
+
+	if child.app.Protocol == protocolHTTP {
+		if s.preProxy(w, r, child.binaryPath, nil) {
+			s.proxyHTTP(w, r, child, scriptName)
+		}
+		return
+	}
+
+	env := s.requestParams(r, child.binaryPath, scriptName, pathInfo)
+	s.addAppParams(env, r, child.binaryPath, child.app)
+	if !s.preProxy(w, r, child.binaryPath, env) {
+		return
+	}
+
+	// A hung application would block the request forever, so the request
+	// fails if the response headers don't arrive in time. Streaming
+	// responses aren't limited once they have started.
+	timeout := s.upstreamTimeoutFor(child.app)
+	var resp *http.Response
+	var fcgi *fcgiConn
+	var conn io.Closer
+	var err error
+	if child.app.Protocol == protocolSCGI {
+		resp, conn, err = s.roundTripSCGI(child, env, r, timeout)
+	} else if child.multiplexed() {
+		resp, conn, err = s.roundTripMux(child, env, r, timeout)
+	} else {
+		resp, fcgi, err = s.roundTrip(child, env, r, timeout)
+		conn = fcgi
+	}
+	var bodyErr *requestBodyError
+	if errors.As(err, &bodyErr) {
+		failRequestBody(w, child.binaryPath, err)
+		return
+	}
+	if err != nil && r.Context().Err() != nil {
+		proxyLog.Debug("Client went away while sending the request", "app", child.binaryPath, "error", err)
+		return
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+		proxyLog.Warn("Request to application timed out", "app", child.binaryPath, "timeout", timeout)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		proxyLog.Error("Request to application failed", "app", child.binaryPath, "socket", child.socketPath, "error", err)
+		return
+	}
+	// Streaming responses can go on for a long time, so the application is
+	// disconnected as soon as the client goes away.
+	stop := context.AfterFunc(r.Context(), func() { conn.Close() })
+	defer func() {
+		if fcgi == nil {
+			// SCGI connections serve a single request, and closing a
+			// multiplexed request ends it.
+			stop()
+			conn.Close()
+			return
+		}
+		if !stop() {
+			fcgi.done = false // closed, don't reuse
+		}
+		s.putConn(child, fcgi)
+	}()
+	s.recordSuccess(child.binaryPath)
+	s.writeResponse(w, r, child.binaryPath, resp)
+}
+
+// requestParams returns the CGI variables describing r for the application at
+// appPath, which serves it as scriptName with pathInfo following it.
+func (s *Spawner) requestParams(r *http.Request, appPath, scriptName, pathInfo string) map[string]string {
+	env := make(map[string]string)
+	env["REQUEST_METHOD"] = r.Method
+	env["SERVER_PROTOCOL"] = r.Proto
+	env["QUERY_STRING"] = r.URL.RawQuery
+	env["CONTENT_TYPE"] = r.Header.Get("Content-Type")
+	env["CONTENT_LENGTH"] = fmt.Sprintf("%d", r.ContentLength)
+	env["SCRIPT_FILENAME"] = appPath
+	env["SCRIPT_NAME"] = scriptName
+	env["PATH_INFO"] = pathInfo
+	webRoot := s.siteOf(appPath).webRoot
+	if pathInfo != "" {
+		env["PATH_TRANSLATED"] = filepath.Join(webRoot, filepath.FromSlash(pathInfo))
+	}
+	env["REQUEST_URI"] = r.URL.RequestURI()
+	env["DOCUMENT_URI"] = r.URL.Path
+	env["DOCUMENT_ROOT"] = webRoot
+	env["SERVER_SOFTWARE"] = "go-fcgi-spawner"
+	env["REDIRECT_STATUS"] = "200" // required by php-cgi
+	// Behind a trusted proxy, these describe the client of the proxy.
+	client := s.clientInfo(r)
+	env["REMOTE_ADDR"] = client.addr
+	if client.port != "" {
+		env["REMOTE_PORT"] = client.port
+	}
+	env["SERVER_PORT"] = client.serverPort
+	if client.https {
+		env["HTTPS"] = "on"
+	}
+	s.geoipParams(env, client.addr)
+	env["HTTP_HOST"] = r.Host
+	if user := authUserFrom(r.Context()); user != "" {
+		env["AUTH_TYPE"] = "Basic"
+		env["REMOTE_USER"] = user
+	}
+
+	s.clientCertParams(r, env)
+
+	for name, headers := range r.Header {
+		if s.Config.TLSClientCertHeader != "" && http.CanonicalHeaderKey(s.Config.TLSClientCertHeader) == name {
+			// Passed on as SSL_CLIENT_CERT if it comes from a trusted proxy.
+			continue
+		}
+		for _, h := range headers {
+			env["HTTP_"+strings.ToUpper(strings.Replace(name, "-", "_", -1))] = h
+		}
+	}
+	return env
+}
+
+// writeResponse sends resp from the application at appPath to the client,
+// flushing the body as it arrives so that streaming responses work.
+func (s *Spawner) writeResponse(w http.ResponseWriter, r *http.Request, appPath string, resp *http.Response) {
+	for k, vv := range resp.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	// Explicitly flush headers
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	// Read the response body and write it to the client, flushing incrementally
+	buf := make([]byte, 4096) // 4KB buffer
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				proxyLog.Debug("Failed to write response chunk to client", "error", writeErr)
+				return // Client likely disconnected
+			}
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if r.Context().Err() != nil {
+				proxyLog.Debug("Client disconnected during response", "app", appPath)
+				return
+			}
+			proxyLog.Error("Failed to read response body from application", "app", appPath, "error", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package spawner
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// statusReport is what the status page shows: a summary of the spawner for
+// debugging, see handleAdminStatus.
+type statusReport struct {
+	StartedAt    time.Time     `json:"startedAt"`
+	Uptime       string        `json:"uptime"`
+	PID          int           `json:"pid"`
+	GoVersion    string        `json:"goVersion"`
+	Goroutines   int           `json:"goroutines"`
+	Ready        bool          `json:"ready"`
+	NotReady     []string      `json:"notReady,omitempty"` // See readinessErrors
+	Config       statusConfig  `json:"config"`
+	Children     []childStatus `json:"children"`
+	Failing      []failingApp  `json:"failing,omitempty"`
+	RecentErrors []errorEntry  `json:"recentErrors,omitempty"`
+}
+
+// statusConfig is the part of the configuration shown on the status page.
+// It leaves out anything secret.
+type statusConfig struct {
+	ListenAddr    string   `json:"listenAddr"`
+	TLS           bool     `json:"tls"`
+	WebRoot       string   `json:"webRoot"`
+	StaticRoot    string   `json:"staticRoot,omitempty"`
+	SocketDir     string   `json:"socketDir,omitempty"` // Stdio mode without
+	VirtualHosts  []string `json:"virtualHosts,omitempty"`
+	Apps          []string `json:"apps,omitempty"` // With settings in Config.Apps
+	Manifest      bool     `json:"manifest"`
+	IdleTimeout   string   `json:"idleTimeout"`
+	MaxChildren   int      `json:"maxChildren"`
+	MaxConcurrent int      `json:"maxConcurrent"`
+}
+
+// status returns the status report of the spawner.
+func (s *Spawner) status() statusReport {
+	cfg := s.Config
+	notReady := s.readinessErrors()
+	report := statusReport{
+		StartedAt:  s.startedAt,
+		Uptime:     time.Since(s.startedAt).Round(time.Second).String(),
+		PID:        os.Getpid(),
+		GoVersion:  runtime.Version(),
+		Goroutines: runtime.NumGoroutine(),
+		Ready:      len(notReady) == 0,
+		NotReady:   notReady,
+		Config: statusConfig{
+			ListenAddr:    cfg.ListenAddr,
+			TLS:           cfg.useTLS(),
+			WebRoot:       cfg.WebRoot,
+			StaticRoot:    cfg.StaticRoot,
+			SocketDir:     cfg.SocketDir,
+			Manifest:      cfg.Manifest,
+			IdleTimeout:   cfg.DefaultIdleTimeout.String(),
+			MaxChildren:   cfg.MaxChildren,
+			MaxConcurrent: cfg.MaxConcurrent,
+		},
+		Children:     s.children(),
+		Failing:      s.failingApps(),
+		RecentErrors: recentErrors.snapshot(),
+	}
+	for host := range cfg.VirtualHosts {
+		report.Config.VirtualHosts = append(report.Config.VirtualHosts, host)
+	}
+	sort.Strings(report.Config.VirtualHosts)
+	for app := range cfg.Apps {
+		report.Config.Apps = append(report.Config.Apps, app)
+	}
+	sort.Strings(report.Config.Apps)
+	return report
+}
+
+// handleAdminStatus serves the status report as plain text, to read with
+// curl, or as JSON if the request asks for it with ?format=json or its
+// Accept header.
+func (s *Spawner) handleAdminStatus(w http.ResponseWriter, r *http.Request) {
+	report := s.status()
+	w.Header().Set("Cache-Control", "no-store")
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	s.writeStatusText(w, report)
+}
+
+// writeStatusText writes report to w as aligned plain text.
+func (s *Spawner) writeStatusText(w io.Writer, report statusReport) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	line := func(format string, args ...any) {
+		fmt.Fprintf(tw, format+"\n", args...)
+	}
+	name := func(appPath string) string {
+		if rel := s.adminName(appPath); rel != "" {
+			return rel
+		}
+		return appPath
+	}
+	ready := "yes"
+	if !report.Ready {
+		ready = "no: " + strings.Join(report.NotReady, ", ")
+	}
+	line("Started:\t%s (up %s)", report.StartedAt.Format(time.RFC3339), report.Uptime)
+	line("Process:\tpid %d, %s, %d goroutines", report.PID, report.GoVersion, report.Goroutines)
+	line("Ready:\t%s", ready)
+
+	cfg := report.Config
+	mode := "stdio"
+	if cfg.SocketDir != "" {
+		mode = "socket, in " + cfg.SocketDir
+	}
+	line("\nConfiguration:")
+	line("  listenAddr\t%s (TLS: %t)", cfg.ListenAddr, cfg.TLS)
+	line("  webRoot\t%s", cfg.WebRoot)
+	line("  staticRoot\t%s", cmp.Or(cfg.StaticRoot, "-"))
+	line("  mode\t%s", mode)
+	line("  virtualHosts\t%s", cmp.Or(strings.Join(cfg.VirtualHosts, ", "), "-"))
+	line("  apps\t%s", cmp.Or(strings.Join(cfg.Apps, ", "), "-"))
+	line("  manifest\t%t", cfg.Manifest)
+	line("  idleTimeout\t%s", cfg.IdleTimeout)
+	line("  maxChildren\t%d", cfg.MaxChildren)
+	line("  maxConcurrent\t%d", cfg.MaxConcurrent)
+
+	line("\nChildren (%d):", len(report.Children))
+	for _, child := range report.Children {
+		line("  %s #%d\tpid %d\t%d active\tidle %s", name(child.App), child.Instance, child.PID, child.Active, time.Since(child.LastUsed).Round(time.Second))
+	}
+
+	if len(report.Failing) > 0 {
+		line("\nFailing applications (%d):", len(report.Failing))
+		for _, app := range report.Failing {
+			line("  %s\t%d failures\tretry in %s\t%s", name(app.App), app.Failures, max(time.Until(app.RetryAt), 0).Round(time.Second), app.LastError)
+		}
+	}
+
+	if len(report.RecentErrors) > 0 {
+		line("\nRecent errors (%d):", len(report.RecentErrors))
+		// Newest first.
+		for _, entry := range slices.Backward(report.RecentErrors) {
+			var attrs []string
+			for key, value := range entry.Attrs {
+				attrs = append(attrs, key+"="+value)
+			}
+			sort.Strings(attrs)
+			line("  %s\t%s\t%s %s", entry.Time.Format(time.RFC3339), entry.Subsystem, entry.Message, strings.Join(attrs, " "))
+		}
+	}
+}
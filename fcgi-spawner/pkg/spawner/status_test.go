@@ -0,0 +1,85 @@
+package spawner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAdminStatus(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "app.fcgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	s := NewSpawner(&Config{
+		WebRoot:    webRoot,
+		ListenAddr: ":8080",
+		AdminToken: "secret",
+		Apps:       map[string]AppConfig{"app.fcgi": {Env: map[string]string{"DB_PASSWORD": "hunter2"}}},
+	})
+	if err := s.startApp(appPath); err != nil {
+		t.Fatalf("startApp() error = %v", err)
+	}
+	t.Cleanup(func() { s.stopApp(appPath) })
+	spawnLog.Error("Status test failure", "app", appPath)
+
+	handler := s.AdminHandler()
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d, want 200", path, rec.Code)
+		}
+		return rec
+	}
+
+	text := get("/status", "").Body.String()
+	for _, want := range []string{"Ready:", "listenAddr", ":8080", "Children (1):", "app.fcgi #0", "Recent errors", "spawn", "Status test failure app=" + appPath} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text status doesn't contain %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "hunter2") || strings.Contains(text, "secret") {
+		t.Errorf("text status shows secrets:\n%s", text)
+	}
+
+	for _, rec := range []*httptest.ResponseRecorder{get("/status?format=json", ""), get("/status", "application/json")} {
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		var report statusReport
+		if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+			t.Fatalf("Failed to decode JSON status: %v", err)
+		}
+		if len(report.Children) != 1 || report.Children[0].App != appPath {
+			t.Errorf("children = %+v, want the app", report.Children)
+		}
+		if report.Config.WebRoot != webRoot || len(report.Config.Apps) != 1 {
+			t.Errorf("config = %+v, want the web root and the app", report.Config)
+		}
+		if n := len(report.RecentErrors); n == 0 || report.RecentErrors[n-1].Message != "Status test failure" || report.RecentErrors[n-1].Subsystem != "spawn" {
+			t.Errorf("recent errors = %+v, want the error logged last", report.RecentErrors)
+		}
+	}
+}
+
+func TestRecentErrors(t *testing.T) {
+	var l errorLog
+	for i := range recentErrorCount + 5 {
+		l.add(errorEntry{Message: string(rune('a' + i))})
+	}
+	entries := l.snapshot()
+	if len(entries) != recentErrorCount || entries[0].Message != "f" {
+		t.Errorf("snapshot() has %d entries starting with %q, want %d starting with f", len(entries), entries[0].Message, recentErrorCount)
+	}
+}
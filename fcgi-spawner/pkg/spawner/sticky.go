@@ -0,0 +1,73 @@
+package spawner
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+)
+
+// Balance strategies keeping the requests of a client on one instance, for
+// applications keeping sessions in memory.
+const (
+	balanceCookie = "cookie"
+	balanceIPHash = "ip-hash"
+)
+
+// stickyCookieName returns the name of the cookie holding the instance of
+// the application at appPath a client sticks to. Applications get cookies of
+// their own, so that they don't mix on a site.
+func stickyCookieName(appPath string) string {
+	h := fnv.New32a()
+	h.Write([]byte(appPath))
+	return fmt.Sprintf("spawner_%08x", h.Sum32())
+}
+
+// stickyChild returns the instance of pool the client of r sticks to with
+// the given balance: the one named by its cookie, or the one chosen by the
+// hash of its address. It returns nil for other balances, without a request
+// and for clients that don't stick to a running instance yet.
+func (s *Spawner) stickyChild(appPath string, pool []*childProcess, balance string, r *http.Request) *childProcess {
+	if r == nil {
+		return nil
+	}
+	switch balance {
+	case balanceCookie:
+		cookie, err := r.Cookie(stickyCookieName(appPath))
+		if err != nil {
+			return nil
+		}
+		instance, err := strconv.Atoi(cookie.Value)
+		if err != nil {
+			return nil
+		}
+		for _, child := range pool {
+			if child.instance == instance {
+				return child
+			}
+		}
+	case balanceIPHash:
+		h := fnv.New32a()
+		h.Write([]byte(s.clientInfo(r).addr))
+		return pool[h.Sum32()%uint32(len(pool))]
+	}
+	return nil
+}
+
+// setStickyCookie makes the client of r stick to child with the cookie
+// balance, unless its cookie names child already. The cookie is scoped to
+// scriptName, the path the application is served on.
+func setStickyCookie(w http.ResponseWriter, r *http.Request, child *childProcess, scriptName string) {
+	if child.app.Balance != balanceCookie {
+		return
+	}
+	name, value := stickyCookieName(child.binaryPath), strconv.Itoa(child.instance)
+	if cookie, err := r.Cookie(name); err == nil && cookie.Value == value {
+		return
+	}
+	path := scriptName
+	if path == "" {
+		path = "/"
+	}
+	http.SetCookie(w, &http.Cookie{Name: name, Value: value, Path: path, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+}
@@ -0,0 +1,93 @@
+package spawner
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStickyChild(t *testing.T) {
+	const appPath = "/web/app.fcgi"
+	pool := []*childProcess{
+		{instance: 0, active: 0},
+		{instance: 1, active: 5},
+		{instance: 3, active: 5},
+	}
+	s := NewSpawner(&Config{})
+	request := func(remoteAddr, cookie string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/app.fcgi", nil)
+		r.RemoteAddr = remoteAddr
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: stickyCookieName(appPath), Value: cookie})
+		}
+		return r
+	}
+
+	tests := []struct {
+		name       string
+		balance    string
+		r          *http.Request
+		want       int // Instance, -1 for none
+		wantSticky bool
+	}{
+		{"cookie", balanceCookie, request("192.0.2.1:1234", "3"), 3, true},
+		{"cookie of a stopped instance", balanceCookie, request("192.0.2.1:1234", "2"), 0, false},
+		{"invalid cookie", balanceCookie, request("192.0.2.1:1234", "x"), 0, false},
+		{"no cookie", balanceCookie, request("192.0.2.1:1234", ""), 0, false},
+		{"no request", balanceCookie, nil, 0, false},
+		{"cookie without cookie balance", balanceLeastConnections, request("192.0.2.1:1234", "3"), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			child, sticky := s.pick(appPath, pool, tt.balance, tt.r)
+			if child.instance != tt.want || sticky != tt.wantSticky {
+				t.Errorf("pick() = instance %d, sticky %v, want %d, %v", child.instance, sticky, tt.want, tt.wantSticky)
+			}
+		})
+	}
+
+	// Clients keep their instance, whatever their port, and spread over the pool.
+	seen := map[int]bool{}
+	for _, addr := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "198.51.100.7", "203.0.113.9", "2001:db8::1", "2001:db8::2"} {
+		first, sticky := s.pick(appPath, pool, balanceIPHash, request(net.JoinHostPort(addr, "1000"), ""))
+		if !sticky {
+			t.Errorf("pick() with ip-hash isn't sticky for %s", addr)
+		}
+		if again, _ := s.pick(appPath, pool, balanceIPHash, request(net.JoinHostPort(addr, "2000"), "")); again != first {
+			t.Errorf("pick() with ip-hash = instance %d, then %d for %s", first.instance, again.instance, addr)
+		}
+		seen[first.instance] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("pick() with ip-hash used instances %v only", seen)
+	}
+}
+
+func TestSetStickyCookie(t *testing.T) {
+	child := &childProcess{binaryPath: "/web/app.fcgi", instance: 2, app: AppConfig{Balance: balanceCookie}}
+	name := stickyCookieName(child.binaryPath)
+
+	rec := httptest.NewRecorder()
+	setStickyCookie(rec, httptest.NewRequest(http.MethodGet, "/app.fcgi", nil), child, "/app.fcgi")
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != name || cookies[0].Value != "2" || cookies[0].Path != "/app.fcgi" || !cookies[0].HttpOnly {
+		t.Errorf("setStickyCookie() set %v, want %s=2 for /app.fcgi", cookies, name)
+	}
+
+	// Clients sticking to the instance already don't get the cookie again.
+	r := httptest.NewRequest(http.MethodGet, "/app.fcgi", nil)
+	r.AddCookie(&http.Cookie{Name: name, Value: "2"})
+	rec = httptest.NewRecorder()
+	setStickyCookie(rec, r, child, "/app.fcgi")
+	if cookies := rec.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("setStickyCookie() set %v for a client sticking to the instance", cookies)
+	}
+
+	child.app.Balance = balanceRoundRobin
+	rec = httptest.NewRecorder()
+	setStickyCookie(rec, httptest.NewRequest(http.MethodGet, "/app.fcgi", nil), child, "/app.fcgi")
+	if cookies := rec.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("setStickyCookie() set %v without the cookie balance", cookies)
+	}
+}
@@ -0,0 +1,80 @@
+package spawner
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// useTLS reports whether the spawner serves HTTPS.
+func (c *Config) useTLS() bool {
+	return c.TLSCert != "" || c.AutocertDomains != ""
+}
+
+// validateTLS checks that the TLS settings are consistent.
+func (c *Config) validateTLS() error {
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("tlsCert and tlsKey must be given together")
+	}
+	if c.TLSCert != "" && c.AutocertDomains != "" {
+		return errors.New("tlsCert/tlsKey and autocertDomains are mutually exclusive")
+	}
+	if c.RedirectAddr != "" && !c.useTLS() {
+		return errors.New("redirectAddr requires tlsCert/tlsKey or autocertDomains")
+	}
+	if c.TLSClientCA != "" && !c.useTLS() {
+		return errors.New("tlsClientCA requires tlsCert/tlsKey or autocertDomains")
+	}
+	switch c.TLSClientAuth {
+	case "", clientAuthOptional, clientAuthRequire:
+	default:
+		return fmt.Errorf("unknown tlsClientAuth %q, expected %s or %s", c.TLSClientAuth, clientAuthOptional, clientAuthRequire)
+	}
+	return nil
+}
+
+// configureTLS sets up server for HTTPS according to cfg and returns the
+// handler for plain HTTP requests on RedirectAddr. In autocert mode that
+// handler also answers ACME HTTP-01 challenges.
+func configureTLS(cfg *Config, server *http.Server) (http.Handler, error) {
+	if cfg.AutocertDomains == "" {
+		if cfg.TLSClientCA != "" {
+			server.TLSConfig = &tls.Config{}
+			if err := configureClientAuth(cfg, server.TLSConfig); err != nil {
+				return nil, fmt.Errorf("failed to load tlsClientCA: %v", err)
+			}
+		}
+		return redirectToHTTPS(cfg.ListenAddr), nil
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(strings.Split(cfg.AutocertDomains, ",")...),
+		Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+	}
+	server.TLSConfig = m.TLSConfig()
+	if err := configureClientAuth(cfg, server.TLSConfig); err != nil {
+		return nil, fmt.Errorf("failed to load tlsClientCA: %v", err)
+	}
+	return m.HTTPHandler(nil), nil
+}
+
+// redirectToHTTPS returns a handler sending clients to the same URL on the
+// HTTPS server listening on httpsAddr.
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,49 @@
+package spawner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"plain HTTP", Config{}, false},
+		{"certificate", Config{TLSCert: "cert.pem", TLSKey: "key.pem", RedirectAddr: ":80"}, false},
+		{"autocert", Config{AutocertDomains: "example.com", RedirectAddr: ":80"}, false},
+		{"certificate without key", Config{TLSCert: "cert.pem"}, true},
+		{"certificate and autocert", Config{TLSCert: "cert.pem", TLSKey: "key.pem", AutocertDomains: "example.com"}, true},
+		{"redirect without TLS", Config{RedirectAddr: ":80"}, true},
+		{"client CA", Config{TLSCert: "cert.pem", TLSKey: "key.pem", TLSClientCA: "ca.pem", TLSClientAuth: "require"}, false},
+		{"client CA without TLS", Config{TLSClientCA: "ca.pem"}, true},
+		{"unknown client auth", Config{TLSCert: "cert.pem", TLSKey: "key.pem", TLSClientCA: "ca.pem", TLSClientAuth: "always"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.validateTLS(); (err != nil) != tt.wantErr {
+				t.Errorf("validateTLS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		httpsAddr string
+		want      string
+	}{
+		{":443", "https://example.com/app.fcgi?a=1"},
+		{":8443", "https://example.com:8443/app.fcgi?a=1"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		redirectToHTTPS(tt.httpsAddr).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com:80/app.fcgi?a=1", nil))
+		if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != tt.want {
+			t.Errorf("redirectToHTTPS(%q) = %d %q, want 301 %q", tt.httpsAddr, rec.Code, rec.Header().Get("Location"), tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package spawner
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"time"
+)
+
+// upgradeDelay is how long the watcher waits for writes to an application to
+// settle before replacing its processes, so that a binary still being copied
+// isn't started.
+const upgradeDelay = 500 * time.Millisecond
+
+// scheduleUpgrade replaces the processes of the application at appPath once
+// it hasn't changed for upgradeDelay.
+func (s *Spawner) scheduleUpgrade(appPath string) {
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	if s.upgrades == nil {
+		s.upgrades = make(map[string]*time.Timer)
+	}
+	if timer, ok := s.upgrades[appPath]; ok {
+		timer.Reset(upgradeDelay)
+		return
+	}
+	s.upgrades[appPath] = time.AfterFunc(upgradeDelay, func() { s.upgradeApp(appPath) })
+}
+
+// upgradeApp starts new processes for the application at appPath after its
+// binary or settings have changed. New requests go to the new processes while
+// the old ones finish their requests. Applications that aren't running are
+// left alone; they start with the new version on their next request. The
+// processes of an application that was removed are drained and stopped.
+func (s *Spawner) upgradeApp(appPath string) {
+	appLock := s.appLock(appPath)
+	appLock.Lock()
+	defer appLock.Unlock()
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	delete(s.upgrades, appPath)
+	// A new binary or config may fix a failing app, so retry it right away.
+	delete(s.breakers, appPath)
+	s.resetRestarts(appPath)
+	pool := s.pool(appPath)
+	if len(pool) == 0 {
+		return
+	}
+	if _, err := os.Stat(appPath); errors.Is(err, fs.ErrNotExist) {
+		// Removed or renamed away.
+		watcherLog.Info("Application removed, stopping its child processes", "app", appPath)
+		s.audit.record(auditEntry{Actor: auditActorWatcher, Action: "stop", App: s.relApp(appPath), Detail: "application removed"})
+		for _, child := range pool {
+			delete(s.childProcesses, instanceKey(child.binaryPath, child.instance))
+			s.drainChild(child)
+		}
+		return
+	}
+	watcherLog.Info("Application changed, starting new child processes", "app", appPath)
+	entry := auditEntry{Actor: auditActorWatcher, Action: "reload", App: s.relApp(appPath), Detail: "binary, settings or environment changed"}
+	if _, _, err := s.ensurePool(appPath); err != nil {
+		watcherLog.Error("Failed to start new version of application", "app", appPath, "error", err)
+		entry.Error = err.Error()
+	}
+	s.audit.record(entry)
+}
+
+// appsUsingEnvFile returns the running applications using the .env file at
+// path, see envFiles.
+func (s *Spawner) appsUsingEnvFile(path string) []string {
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	var apps []string
+	for _, child := range s.childProcesses {
+		if s.usesEnvFile(child.binaryPath, path) && !slices.Contains(apps, child.binaryPath) {
+			apps = append(apps, child.binaryPath)
+		}
+	}
+	return apps
+}
+
+// drainChild takes child out of service. It keeps running until its active
+// requests have finished or Config.DrainTimeout has passed, and is stopped
+// then. The caller must hold childProcessesMu and have removed child from the
+// running processes.
+func (s *Spawner) drainChild(child *childProcess) {
+	child.closeConns()
+	if !slices.Contains(s.draining, child) {
+		s.draining = append(s.draining, child)
+	}
+	go s.finishDrain(child)
+}
+
+// finishDrain waits for the draining child to become idle and stops it.
+func (s *Spawner) finishDrain(child *childProcess) {
+	deadline := time.Now().Add(s.Config.DrainTimeout)
+	for {
+		s.childProcessesMu.Lock()
+		if !slices.Contains(s.draining, child) {
+			// Already stopped during shutdown.
+			s.childProcessesMu.Unlock()
+			return
+		}
+		active := child.active
+		if active == 0 || child.cmd.ProcessState() != nil || time.Now().After(deadline) {
+			s.draining = slices.DeleteFunc(s.draining, func(c *childProcess) bool { return c == child })
+			s.childProcessesMu.Unlock()
+			if active > 0 {
+				spawnLog.Warn("Drain timeout expired, stopping old child process with requests in flight", "app", child.binaryPath, "pid", child.cmd.Process().Pid(), "active", active)
+			}
+			break
+		}
+		s.childProcessesMu.Unlock()
+		time.Sleep(100 * time.Millisecond)
+	}
+	spawnLog.Info("Stopping old child process", "app", child.binaryPath, "pid", child.cmd.Process().Pid())
+	s.stopChild(child)
+	s.childProcessesMu.Lock()
+	s.releaseSingleton(child.binaryPath)
+	s.childProcessesMu.Unlock()
+}
+
+// unusedSocketPath returns socketPath, or, while a draining process still
+// listens on it, socketPath with a numeric suffix, e.g. hello.fcgi.sock.1.
+// The caller must hold childProcessesMu.
+func (s *Spawner) unusedSocketPath(socketPath string) string {
+	inUse := func(path string) bool {
+		return slices.ContainsFunc(s.draining, func(c *childProcess) bool { return c.socketPath == path })
+	}
+	candidate := socketPath
+	for n := 1; inUse(candidate); n++ {
+		candidate = fmt.Sprintf("%s.%d", socketPath, n)
+	}
+	return candidate
+}
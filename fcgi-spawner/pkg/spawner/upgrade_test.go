@@ -0,0 +1,200 @@
+package spawner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestUpgradeDrainsOldChild(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "drain.fcgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot, DrainTimeout: 10 * time.Second})
+	defer s.stopAllChildren(time.Second)
+
+	old, _, err := s.getOrCreateChild(context.Background(), appPath, nil)
+	if err != nil {
+		t.Fatalf("getOrCreateChild() error = %v", err)
+	}
+	// old is serving a request while the binary is replaced.
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(appPath, later, later); err != nil {
+		t.Fatalf("Failed to touch app: %v", err)
+	}
+	s.upgradeApp(appPath)
+
+	s.childProcessesMu.Lock()
+	current := s.childProcesses[instanceKey(appPath, 0)]
+	s.childProcessesMu.Unlock()
+	if current == nil || current == old {
+		t.Fatalf("upgradeApp() didn't start a new child process")
+	}
+	if current.socketPath == old.socketPath {
+		t.Errorf("new child process uses the socket of the draining one: %q", current.socketPath)
+	}
+	if old.cmd.ProcessState() != nil {
+		t.Fatalf("old child process was stopped with a request in flight")
+	}
+
+	s.releaseChild(old)
+	deadline := time.Now().Add(3 * time.Second)
+	for old.cmd.ProcessState() == nil && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if old.cmd.ProcessState() == nil {
+		t.Errorf("old child process still running after its request finished")
+	}
+	if err := syscall.Kill(current.cmd.Process().Pid(), 0); err != nil {
+		t.Errorf("new child process is not running: %v", err)
+	}
+}
+
+func TestUpgradeKeepsOldChildOnFailure(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "broken.fcgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot, DrainTimeout: 10 * time.Second})
+	defer s.stopAllChildren(time.Second)
+
+	if err := s.startApp(appPath); err != nil {
+		t.Fatalf("startApp() error = %v", err)
+	}
+	s.childProcessesMu.Lock()
+	old := s.childProcesses[instanceKey(appPath, 0)]
+	s.childProcessesMu.Unlock()
+
+	// The new version can't be started.
+	if err := os.Chmod(appPath, 0644); err != nil {
+		t.Fatalf("Failed to chmod app: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(appPath, later, later); err != nil {
+		t.Fatalf("Failed to touch app: %v", err)
+	}
+	s.upgradeApp(appPath)
+
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	if current := s.childProcesses[instanceKey(appPath, 0)]; current != old {
+		t.Errorf("upgradeApp() replaced the old child process although the new one failed")
+	}
+	if old.cmd.ProcessState() != nil {
+		t.Errorf("old child process was stopped")
+	}
+	if len(s.draining) != 0 {
+		t.Errorf("%d child processes draining, want 0", len(s.draining))
+	}
+}
+
+func TestUnusedSocketPath(t *testing.T) {
+	s := NewSpawner(&Config{})
+	s.draining = []*childProcess{{socketPath: "/run/app.fcgi.sock"}, {socketPath: "/run/app.fcgi.sock.1"}}
+	if got := s.unusedSocketPath("/run/app.fcgi.sock"); got != "/run/app.fcgi.sock.2" {
+		t.Errorf("unusedSocketPath() = %q, want /run/app.fcgi.sock.2", got)
+	}
+	if got := s.unusedSocketPath("/run/other.fcgi.sock"); got != "/run/other.fcgi.sock" {
+		t.Errorf("unusedSocketPath() = %q, want /run/other.fcgi.sock", got)
+	}
+}
+
+func TestUpgradeStopsRemovedApp(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "removed.fcgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot, DrainTimeout: 10 * time.Second})
+	defer s.stopAllChildren(time.Second)
+
+	if err := s.startApp(appPath); err != nil {
+		t.Fatalf("startApp() error = %v", err)
+	}
+	s.childProcessesMu.Lock()
+	old := s.childProcesses[instanceKey(appPath, 0)]
+	s.childProcessesMu.Unlock()
+
+	// Deployments move the old binary out of the way.
+	if err := os.Rename(appPath, appPath+".old"); err != nil {
+		t.Fatalf("Failed to rename app: %v", err)
+	}
+	s.upgradeApp(appPath)
+
+	s.childProcessesMu.Lock()
+	running := len(s.pool(appPath))
+	s.childProcessesMu.Unlock()
+	if running != 0 {
+		t.Errorf("%d child processes still serving the removed app, want 0", running)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for old.cmd.ProcessState() == nil && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if old.cmd.ProcessState() == nil {
+		t.Errorf("child process of the removed app is still running")
+	}
+}
+
+func TestScheduleUpgradeDebounces(t *testing.T) {
+	s := NewSpawner(&Config{})
+	for range 5 {
+		s.scheduleUpgrade("/web/app.fcgi")
+	}
+	s.childProcessesMu.Lock()
+	pending := len(s.upgrades)
+	s.childProcessesMu.Unlock()
+	if pending != 1 {
+		t.Errorf("%d upgrades pending after a burst of events, want 1", pending)
+	}
+	time.Sleep(upgradeDelay + 200*time.Millisecond)
+	s.childProcessesMu.Lock()
+	pending = len(s.upgrades)
+	s.childProcessesMu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d upgrades pending after the events settled, want 0", pending)
+	}
+}
+
+func TestUpgradeOnEnvFileChange(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "envchange.fcgi")
+	if err := os.WriteFile(appPath, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	s := NewSpawner(&Config{WebRoot: webRoot, DrainTimeout: time.Second})
+	defer s.stopAllChildren(time.Second)
+
+	if err := s.startApp(appPath); err != nil {
+		t.Fatalf("startApp() error = %v", err)
+	}
+	s.childProcessesMu.Lock()
+	old := s.childProcesses[instanceKey(appPath, 0)]
+	s.childProcessesMu.Unlock()
+
+	envPath := filepath.Join(webRoot, "envchange.env")
+	if err := os.WriteFile(envPath, []byte("GREETING=hi\n"), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	apps := s.appsUsingEnvFile(envPath)
+	if len(apps) != 1 || apps[0] != appPath {
+		t.Fatalf("appsUsingEnvFile() = %v, want [%s]", apps, appPath)
+	}
+	s.upgradeApp(appPath)
+
+	s.childProcessesMu.Lock()
+	current := s.childProcesses[instanceKey(appPath, 0)]
+	s.childProcessesMu.Unlock()
+	if current == nil || current == old {
+		t.Fatalf("upgradeApp() didn't restart the app after its .env file changed")
+	}
+	if current.envModTime.IsZero() {
+		t.Errorf("new child process doesn't record the .env file it was started with")
+	}
+}
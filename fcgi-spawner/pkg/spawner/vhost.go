@@ -0,0 +1,179 @@
+package spawner
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// VirtualHost is a site served for requests to a host name, with its own
+// applications and static files.
+type VirtualHost struct {
+	WebRoot     string `yaml:"webRoot"`
+	StaticRoot  string `yaml:"staticRoot"`
+	SPAFallback bool   `yaml:"spaFallback"`
+}
+
+// virtualHost is a site the spawner serves: a VirtualHost, or the default
+// site made of WebRoot and StaticRoot for requests to any other host.
+type virtualHost struct {
+	host             string // Empty for the default site
+	webRoot          string
+	staticFileServer http.Handler
+}
+
+// validateVirtualHosts checks the virtual hosts, which are keyed by host
+// name, optionally with a leading wildcard like *.example.com.
+func (c *Config) validateVirtualHosts() error {
+	for host, vhost := range c.VirtualHosts {
+		if host == "" || host != strings.ToLower(host) || strings.ContainsAny(host, ":/") || strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return fmt.Errorf("virtual host %q must be a lower-case host name like example.com or *.example.com", host)
+		}
+		if vhost.WebRoot == "" {
+			return fmt.Errorf("virtual host %s: webRoot is missing", host)
+		}
+	}
+	return nil
+}
+
+// validateStaticRoots checks that StaticRoot and the static roots of the
+// virtual hosts are directories.
+func (c *Config) validateStaticRoots() error {
+	roots := []string{c.StaticRoot}
+	for _, vhost := range c.VirtualHosts {
+		roots = append(roots, vhost.StaticRoot)
+	}
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		info, err := os.Stat(root)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", root)
+		}
+	}
+	return nil
+}
+
+// newStaticFileServer serves the files in staticRoot, or returns nil if
+// staticRoot is empty. With spa, unknown paths are answered with its
+// index.html, see spaFallback. Directories are served as configured by
+// IndexFiles and DirListing, see staticFiles.
+func (s *Spawner) newStaticFileServer(staticRoot string, spa bool) http.Handler {
+	if staticRoot == "" {
+		return nil
+	}
+	mainLog.Info("Enabling static file serving", "path", staticRoot, "spaFallback", spa)
+	fsys := noHiddenFS{http.Dir(staticRoot)}
+	if spa {
+		return spaFallback{fsys: fsys, files: s.newStaticFiles(fsys)}
+	}
+	return s.newStaticFiles(fsys)
+}
+
+// spaFallback serves files, and index.html for GET and HEAD requests to
+// paths that don't exist, so that single-page apps using the history API
+// can be reloaded on any of their routes. Paths with a file extension, like
+// a missing script or image, are still answered with 404.
+type spaFallback struct {
+	fsys  http.FileSystem
+	files http.Handler
+}
+
+func (h spaFallback) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if (r.Method != http.MethodGet && r.Method != http.MethodHead) || path.Ext(r.URL.Path) != "" {
+		h.files.ServeHTTP(w, r)
+		return
+	}
+	f, err := h.fsys.Open(path.Clean("/" + r.URL.Path))
+	if err == nil {
+		f.Close()
+		h.files.ServeHTTP(w, r)
+		return
+	}
+	index, err := h.fsys.Open("/index.html")
+	if err != nil {
+		h.files.ServeHTTP(w, r)
+		return
+	}
+	defer index.Close()
+	info, err := index.Stat()
+	if err != nil || info.IsDir() {
+		h.files.ServeHTTP(w, r)
+		return
+	}
+	http.ServeContent(w, r, "index.html", info.ModTime(), index)
+}
+
+// virtualHostFor returns the site serving requests for host: the virtual host
+// named host, else the one with the closest wildcard, else the default site.
+func (s *Spawner) virtualHostFor(host string) *virtualHost {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if vhost, ok := s.vhosts[host]; ok {
+		return vhost
+	}
+	for rest := host; ; {
+		_, parent, found := strings.Cut(rest, ".")
+		if !found {
+			break
+		}
+		if vhost, ok := s.vhosts["*."+parent]; ok {
+			return vhost
+		}
+		rest = parent
+	}
+	return &virtualHost{webRoot: s.Config.WebRoot, staticFileServer: s.staticFileServer}
+}
+
+// webRoots returns the web roots of all sites, the default one first.
+func (s *Spawner) webRoots() []string {
+	roots := []string{s.Config.WebRoot}
+	for _, vhost := range s.vhosts {
+		roots = append(roots, vhost.webRoot)
+	}
+	return roots
+}
+
+// siteOf returns the site the application at appPath belongs to.
+func (s *Spawner) siteOf(appPath string) *virtualHost {
+	site := &virtualHost{webRoot: s.Config.WebRoot, staticFileServer: s.staticFileServer}
+	longest := -1
+	if isBelow(appPath, s.Config.WebRoot) {
+		longest = len(s.Config.WebRoot)
+	}
+	// Web roots may be nested, so the innermost one wins.
+	for _, vhost := range s.vhosts {
+		if isBelow(appPath, vhost.webRoot) && len(vhost.webRoot) > longest {
+			site, longest = vhost, len(vhost.webRoot)
+		}
+	}
+	return site
+}
+
+// isBelow reports whether path is inside the directory dir.
+func isBelow(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// appSocketName returns the name of the socket of the application at
+// appPath, relative to the socket directory. Sockets of virtual hosts are
+// kept in a directory named after the host, and those of a spawner in a
+// slot other than 0 in a directory for the slot, see claimSlot.
+func (s *Spawner) appSocketName(appPath string, instance int) string {
+	name := instanceSocketName(s.relApp(appPath), instance)
+	if site := s.siteOf(appPath); site.host != "" {
+		name = filepath.Join(site.host, name)
+	}
+	return filepath.Join(s.slotDir(), name)
+}
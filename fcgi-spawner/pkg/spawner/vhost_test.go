@@ -0,0 +1,132 @@
+package spawner
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateVirtualHosts(t *testing.T) {
+	tests := []struct {
+		host    string
+		vhost   VirtualHost
+		wantErr bool
+	}{
+		{host: "api.example.com", vhost: VirtualHost{WebRoot: "/srv/api"}},
+		{host: "*.example.com", vhost: VirtualHost{WebRoot: "/srv/www"}},
+		{host: "api.example.com", wantErr: true},
+		{host: "API.example.com", vhost: VirtualHost{WebRoot: "/srv/api"}, wantErr: true},
+		{host: "example.com:8080", vhost: VirtualHost{WebRoot: "/srv/api"}, wantErr: true},
+		{host: "www.*.com", vhost: VirtualHost{WebRoot: "/srv/api"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		cfg := Config{VirtualHosts: map[string]VirtualHost{tt.host: tt.vhost}}
+		if err := cfg.validateVirtualHosts(); (err != nil) != tt.wantErr {
+			t.Errorf("validateVirtualHosts(%q: %+v) error = %v, wantErr %v", tt.host, tt.vhost, err, tt.wantErr)
+		}
+	}
+}
+
+func TestVirtualHosts(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"www", "api", "default"} {
+		if err := os.MkdirAll(filepath.Join(root, dir, "static"), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(root, dir, "static", "page.txt"), []byte(dir), 0644); err != nil {
+			t.Fatalf("Failed to write page: %v", err)
+		}
+	}
+	site := func(dir string) VirtualHost {
+		return VirtualHost{WebRoot: filepath.Join(root, dir, "web"), StaticRoot: filepath.Join(root, dir, "static")}
+	}
+	s := NewSpawner(&Config{
+		WebRoot:    filepath.Join(root, "default", "web"),
+		StaticRoot: filepath.Join(root, "default", "static"),
+		VirtualHosts: map[string]VirtualHost{
+			"api.example.com": site("api"),
+			"*.example.com":   site("www"),
+		},
+	})
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "api.example.com", want: "api"},
+		{host: "API.Example.com:8080", want: "api"},
+		{host: "www.example.com", want: "www"},
+		{host: "a.b.example.com", want: "www"},
+		{host: "example.com", want: "default"},
+		{host: "other.org", want: "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/page.txt", nil)
+			r.Host = tt.host
+			w := httptest.NewRecorder()
+			s.spawnerHandler(w, r)
+			if body, _ := io.ReadAll(w.Body); string(body) != tt.want {
+				t.Errorf("served %q, want the page of %s", body, tt.want)
+			}
+		})
+	}
+
+	appPath := filepath.Join(root, "api", "web", "v1", "users.fcgi")
+	if got := s.relApp(appPath); got != "v1/users.fcgi" {
+		t.Errorf("relApp() = %q, want v1/users.fcgi", got)
+	}
+	if got := s.appSocketName(appPath, 0); got != "api.example.com/v1/users.fcgi.sock" {
+		t.Errorf("appSocketName() = %q, want api.example.com/v1/users.fcgi.sock", got)
+	}
+	defaultApp := filepath.Join(root, "default", "web", "users.fcgi")
+	if got := s.appSocketName(defaultApp, 0); got != "users.fcgi.sock" {
+		t.Errorf("appSocketName() = %q, want users.fcgi.sock", got)
+	}
+}
+
+func TestSPAFallback(t *testing.T) {
+	staticRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(staticRoot, "index.html"), []byte("app"), 0644); err != nil {
+		t.Fatalf("Failed to write index.html: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(staticRoot, "page.txt"), []byte("page"), 0644); err != nil {
+		t.Fatalf("Failed to write page: %v", err)
+	}
+	h := NewSpawner(&Config{}).newStaticFileServer(staticRoot, true)
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{method: http.MethodGet, path: "/", wantStatus: http.StatusOK, wantBody: "app"},
+		{method: http.MethodGet, path: "/page.txt", wantStatus: http.StatusOK, wantBody: "page"},
+		{method: http.MethodGet, path: "/users/42", wantStatus: http.StatusOK, wantBody: "app"},
+		{method: http.MethodHead, path: "/users", wantStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/.git/config", wantStatus: http.StatusOK, wantBody: "app"},
+		{method: http.MethodGet, path: "/missing.js", wantStatus: http.StatusNotFound},
+		{method: http.MethodPost, path: "/users", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, w.Code, tt.wantStatus)
+		}
+		if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+			t.Errorf("%s %s: body = %q, want %q", tt.method, tt.path, w.Body.String(), tt.wantBody)
+		}
+	}
+
+	// Without the option, unknown paths are not found.
+	w := httptest.NewRecorder()
+	NewSpawner(&Config{}).newStaticFileServer(staticRoot, false).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/42", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /users/42 without fallback: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
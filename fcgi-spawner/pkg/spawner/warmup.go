@@ -0,0 +1,114 @@
+package spawner
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// WarmUpWindow is a time window, starting at the times of a cron schedule,
+// during which an application is started and not stopped when idle, so
+// that predictable traffic doesn't wait for it to start.
+type WarmUpWindow struct {
+	// Schedule is a cron expression in local time, e.g. "55 8 * * 1-5" for
+	// 08:55 on weekdays, see parseCron.
+	Schedule string `yaml:"schedule"`
+	// Duration is how long the window lasts. The idle timeout applies again
+	// afterwards. Windows last at least a minute.
+	Duration time.Duration `yaml:"duration"`
+}
+
+// warmUpEnd returns the end of the warm-up window of c that t is in, the
+// latest if several are, or the zero time if it's in none.
+func (c AppConfig) warmUpEnd(t time.Time) time.Time {
+	var end time.Time
+	for _, window := range c.WarmUp {
+		schedule, err := parseCron(window.Schedule)
+		if err != nil {
+			// Rejected by validate.
+			continue
+		}
+		d := max(window.Duration, time.Minute)
+		// Look for the latest start of the window that t can be in.
+		for start := t.Truncate(time.Minute); t.Sub(start) < d; start = start.Add(-time.Minute) {
+			if schedule.matches(start) {
+				if start.Add(d).After(end) {
+					end = start.Add(d)
+				}
+				break
+			}
+		}
+	}
+	return end
+}
+
+// validateWarmUp checks the warm-up windows of c.
+func (c AppConfig) validateWarmUp() error {
+	for _, window := range c.WarmUp {
+		if _, err := parseCron(window.Schedule); err != nil {
+			return err
+		}
+		if window.Duration < 0 {
+			return fmt.Errorf("warm-up duration %s must not be negative", window.Duration)
+		}
+	}
+	return nil
+}
+
+// runWarmUps starts the applications in Config.Apps that are in one of
+// their warm-up windows, when the spawner starts and then at the start of
+// every minute, until ctx is done.
+func (s *Spawner) runWarmUps(ctx context.Context) {
+	if !slices.ContainsFunc(slices.Collect(maps.Values(s.Config.Apps)), func(app AppConfig) bool { return len(app.WarmUp) > 0 }) {
+		return
+	}
+	for {
+		s.warmUp(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(time.Now().Truncate(time.Minute).Add(time.Minute))):
+		}
+	}
+}
+
+// warmUp starts the applications in Config.Apps that are in one of their
+// warm-up windows at now and aren't running, in every web root they are in.
+func (s *Spawner) warmUp(now time.Time) {
+	for _, rel := range slices.Sorted(maps.Keys(s.Config.Apps)) {
+		if len(s.Config.Apps[rel].WarmUp) == 0 {
+			continue
+		}
+		for _, webRoot := range s.webRoots() {
+			appPath := filepath.Join(webRoot, filepath.FromSlash(rel))
+			if !s.isApp(appPath) {
+				continue
+			}
+			if app, err := s.appConfig(appPath); err != nil || app.warmUpEnd(now).IsZero() {
+				continue
+			}
+			s.warmUpApp(appPath)
+		}
+	}
+}
+
+// warmUpApp starts the application at appPath unless it's running. Unlike
+// startApp, it leaves an application kept from restarting alone.
+func (s *Spawner) warmUpApp(appPath string) {
+	appLock := s.appLock(appPath)
+	appLock.Lock()
+	defer appLock.Unlock()
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	if len(s.pool(appPath)) > 0 {
+		return
+	}
+	if _, _, err := s.ensurePool(appPath); err != nil {
+		spawnLog.Warn("Failed to warm up application", "app", appPath, "error", err)
+		return
+	}
+	spawnLog.Info("Warmed up application", "app", appPath)
+}
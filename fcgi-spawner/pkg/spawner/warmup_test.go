@@ -0,0 +1,84 @@
+package spawner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWarmUpEnd(t *testing.T) {
+	app := AppConfig{WarmUp: []WarmUpWindow{
+		{Schedule: "55 8 * * 1-5", Duration: 10 * time.Hour},
+		{Schedule: "0 20 * * *"},
+	}}
+	// 2026-03-02 is a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.March, day, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		t, want time.Time
+	}{
+		{at(2, 8, 54), time.Time{}},
+		{at(2, 8, 55), at(2, 18, 55)},
+		{at(2, 12, 0), at(2, 18, 55)},
+		{at(2, 18, 55), time.Time{}},
+		{at(7, 12, 0), time.Time{}}, // Saturday
+		{at(7, 20, 0).Add(30 * time.Second), at(7, 20, 1)},
+	}
+	for _, tt := range tests {
+		if got := app.warmUpEnd(tt.t); !got.Equal(tt.want) {
+			t.Errorf("warmUpEnd(%s) = %s, want %s", tt.t.Format("Mon 15:04:05"), got, tt.want)
+		}
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	webRoot := t.TempDir()
+	for _, name := range []string{"reports.fcgi", "other.fcgi"} {
+		if err := os.WriteFile(filepath.Join(webRoot, name), []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+			t.Fatalf("Failed to write app: %v", err)
+		}
+	}
+	idle := 50 * time.Millisecond
+	s := NewSpawner(&Config{WebRoot: webRoot, DefaultIdleTimeout: idle, Apps: map[string]AppConfig{
+		"reports.fcgi": {WarmUp: []WarmUpWindow{{Schedule: "* * * * *", Duration: time.Hour}}},
+		"other.fcgi":   {WarmUp: []WarmUpWindow{{Schedule: "0 0 1 1 *"}}},
+	}})
+	defer s.stopAllChildren(time.Second)
+	go s.cleanupChildProcesses(t.Context())
+
+	s.warmUp(time.Now())
+	s.childProcessesMu.Lock()
+	reports, other := s.childProcesses[instanceKey(filepath.Join(webRoot, "reports.fcgi"), 0)], s.childProcesses[instanceKey(filepath.Join(webRoot, "other.fcgi"), 0)]
+	s.childProcessesMu.Unlock()
+	if reports == nil || other != nil {
+		t.Fatalf("warmUp() started reports: %v, other: %v, want only reports", reports != nil, other != nil)
+	}
+
+	// It isn't stopped when idle during its window.
+	s.notifyCleanup(reports)
+	time.Sleep(4 * idle)
+	s.childProcessesMu.Lock()
+	running := s.childProcesses[instanceKey(reports.binaryPath, 0)] == reports
+	s.childProcessesMu.Unlock()
+	if !running || reports.cmd.ProcessState() != nil {
+		t.Errorf("warmed up app was stopped within its warm-up window")
+	}
+}
+
+func TestValidateWarmUp(t *testing.T) {
+	tests := []struct {
+		window  WarmUpWindow
+		wantErr bool
+	}{
+		{WarmUpWindow{Schedule: "55 8 * * 1-5", Duration: 10 * time.Hour}, false},
+		{WarmUpWindow{Schedule: "55 8 * *"}, true},
+		{WarmUpWindow{Schedule: "* * * * *", Duration: -time.Minute}, true},
+	}
+	for _, tt := range tests {
+		if err := (AppConfig{WarmUp: []WarmUpWindow{tt.window}}).validate(); (err != nil) != tt.wantErr {
+			t.Errorf("validate() of %+v error = %v, wantErr %v", tt.window, err, tt.wantErr)
+		}
+	}
+}
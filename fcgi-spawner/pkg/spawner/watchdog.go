@@ -0,0 +1,232 @@
+package spawner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions for processes exceeding their memory or CPU limit.
+const (
+	onLimitRestart = "restart"
+	onLimitAlert   = "alert"
+)
+
+// clockTicks is the unit of the CPU times in /proc/<pid>/stat, USER_HZ,
+// which is 100 on every common Linux platform.
+const clockTicks = 100
+
+// byteUnits are the suffixes accepted by parseByteSize.
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"T", 1 << 40},
+}
+
+// parseByteSize parses a size in bytes, optionally with a binary unit, e.g.
+// "1048576", "512M", "512MiB" or "2G".
+func parseByteSize(s string) (int64, error) {
+	number, unit := s, int64(1)
+	trimmed := strings.TrimSuffix(strings.TrimSuffix(s, "B"), "i")
+	for _, u := range byteUnits {
+		if strings.HasSuffix(trimmed, u.suffix) {
+			number, unit = strings.TrimSuffix(trimmed, u.suffix), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * unit, nil
+}
+
+// validateLimits checks MaxMemory, MaxCPU and OnLimit.
+func (c AppConfig) validateLimits() error {
+	if c.MaxMemory != "" {
+		if _, err := parseByteSize(c.MaxMemory); err != nil {
+			return fmt.Errorf("invalid maxMemory: %v", err)
+		}
+	}
+	if c.MaxCPU < 0 {
+		return fmt.Errorf("maxCPU %g must not be negative", c.MaxCPU)
+	}
+	switch c.OnLimit {
+	case "", onLimitRestart, onLimitAlert:
+		return nil
+	default:
+		return fmt.Errorf("unknown onLimit action %q", c.OnLimit)
+	}
+}
+
+// hasLimits reports whether the processes of the app are checked by the
+// watchdog.
+func (c AppConfig) hasLimits() bool {
+	return c.MaxMemory != "" || c.MaxCPU > 0
+}
+
+// procUsage is the resource use of a process read from /proc.
+type procUsage struct {
+	rss int64         // Resident memory in bytes
+	cpu time.Duration // User and system CPU time used since the process started
+}
+
+// readProcStat reads /proc/<pid>/stat of the process with the given PID and
+// returns a function returning its numeric field n, counted from 1 as in
+// proc(5).
+func readProcStat(pid int) (func(n int) (int64, error), error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	// The command name in parentheses may contain spaces, so the fields are
+	// counted from the closing parenthesis, which ends field 2.
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return nil, errors.New("malformed /proc stat file")
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	return func(n int) (int64, error) {
+		if n-3 >= len(fields) {
+			return 0, errors.New("short /proc stat file")
+		}
+		return strconv.ParseInt(fields[n-3], 10, 64)
+	}, nil
+}
+
+// readProcUsage returns the resource use of the process with the given PID.
+func readProcUsage(pid int) (procUsage, error) {
+	field, err := readProcStat(pid)
+	if err != nil {
+		return procUsage{}, err
+	}
+	utime, err := field(14)
+	if err != nil {
+		return procUsage{}, err
+	}
+	stime, err := field(15)
+	if err != nil {
+		return procUsage{}, err
+	}
+	pages, err := field(24)
+	if err != nil {
+		return procUsage{}, err
+	}
+	return procUsage{
+		rss: pages * int64(os.Getpagesize()),
+		cpu: time.Duration(utime+stime) * time.Second / clockTicks,
+	}, nil
+}
+
+// watchdog checks the resource use of the child processes every
+// Config.WatchdogInterval until ctx is done.
+func (s *Spawner) watchdog(ctx context.Context) {
+	if s.Config.WatchdogInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.Config.WatchdogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkResources()
+		}
+	}
+}
+
+// checkResources samples the memory and CPU use of the child processes of
+// applications with limits. Processes exceeding them are replaced by a new
+// process, or reported once with OnLimit "alert". Processes in containers
+// aren't checked, as the spawner only sees the container runtime's client.
+func (s *Spawner) checkResources() {
+	var restart []*childProcess
+	s.childProcessesMu.Lock()
+	for _, child := range s.childProcesses {
+		process := child.cmd.Process()
+		if !child.app.hasLimits() || child.container != "" || process == nil {
+			continue
+		}
+		usage, err := readProcUsage(process.Pid())
+		if err != nil {
+			// Exited, which the cleanup loop takes care of.
+			continue
+		}
+		reason := s.exceededLimit(child, usage)
+		switch {
+		case reason == "":
+			if child.overLimit {
+				spawnLog.Info("Child process is within its limits again", "app", child.binaryPath, "pid", process.Pid())
+			}
+			child.overLimit = false
+		case child.app.OnLimit == onLimitAlert:
+			if !child.overLimit {
+				spawnLog.Warn("Child process exceeds its limits", "app", child.binaryPath, "pid", process.Pid(), "reason", reason)
+			}
+			child.overLimit = true
+		default:
+			spawnLog.Warn("Child process exceeds its limits, restarting it", "app", child.binaryPath, "pid", process.Pid(), "reason", reason)
+			child.overLimit = true
+			restart = append(restart, child)
+		}
+	}
+	s.childProcessesMu.Unlock()
+
+	for _, child := range restart {
+		s.replaceChild(child, "exceeding its limits")
+	}
+}
+
+// exceededLimit records usage as the latest sample of child and describes
+// the limit it exceeds, if any. CPU use is averaged since the previous
+// sample. The caller must hold childProcessesMu.
+func (s *Spawner) exceededLimit(child *childProcess, usage procUsage) string {
+	now := time.Now()
+	previous, previousAt := child.usage, child.sampledAt
+	child.usage, child.sampledAt = usage, now
+
+	if child.app.MaxMemory != "" {
+		// Validated with the app's settings.
+		if limit, _ := parseByteSize(child.app.MaxMemory); usage.rss > limit {
+			return fmt.Sprintf("uses %d MiB of memory, more than maxMemory %s", usage.rss>>20, child.app.MaxMemory)
+		}
+	}
+	if child.app.MaxCPU > 0 && !previousAt.IsZero() {
+		percent := 100 * float64(usage.cpu-previous.cpu) / float64(now.Sub(previousAt))
+		if percent > child.app.MaxCPU {
+			return fmt.Sprintf("used %.0f%% CPU, more than maxCPU %g%%", percent, child.app.MaxCPU)
+		}
+	}
+	return ""
+}
+
+// replaceChild starts a new process for the application of child, if its
+// pool needs one, and drains child, unless it was stopped or replaced in the
+// meantime. why tells why child is replaced, e.g. "exceeding its limits".
+func (s *Spawner) replaceChild(child *childProcess, why string) {
+	appLock := s.appLock(child.binaryPath)
+	appLock.Lock()
+	defer appLock.Unlock()
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	key := instanceKey(child.binaryPath, child.instance)
+	if s.childProcesses[key] != child {
+		return
+	}
+	delete(s.childProcesses, key)
+	s.draining = append(s.draining, child)
+	if _, _, err := s.ensurePool(child.binaryPath); err != nil {
+		spawnLog.Error("Failed to start a new process to replace one "+why, "app", child.binaryPath, "error", err)
+	}
+	s.drainChild(child)
+}
@@ -0,0 +1,99 @@
+package spawner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1048576", want: 1 << 20},
+		{in: "512K", want: 512 << 10},
+		{in: "512M", want: 512 << 20},
+		{in: "512MiB", want: 512 << 20},
+		{in: "2G", want: 2 << 30},
+		{in: "2GB", want: 2 << 30},
+		{in: "", wantErr: true},
+		{in: "M", wantErr: true},
+		{in: "-1M", wantErr: true},
+		{in: "1.5G", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, %v, want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestReadProcUsage(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("No /proc file system")
+	}
+	usage, err := readProcUsage(os.Getpid())
+	if err != nil {
+		t.Fatalf("readProcUsage() error = %v", err)
+	}
+	if usage.rss <= 0 {
+		t.Errorf("readProcUsage() rss = %d, want the memory of the test", usage.rss)
+	}
+	if _, err := readProcUsage(-1); err == nil {
+		t.Error("readProcUsage(-1) succeeded")
+	}
+}
+
+func TestCheckResources(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("No /proc file system")
+	}
+	webRoot := t.TempDir()
+	for _, name := range []string{"leaky.fcgi", "watched.fcgi", "unlimited.fcgi"} {
+		if err := os.WriteFile(filepath.Join(webRoot, name), []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+			t.Fatalf("Failed to write app: %v", err)
+		}
+	}
+	// Every process uses more than 1K of memory.
+	s := NewSpawner(&Config{
+		WebRoot: webRoot,
+		Apps: map[string]AppConfig{
+			"leaky.fcgi":   {MaxMemory: "1K"},
+			"watched.fcgi": {MaxMemory: "1K", OnLimit: onLimitAlert},
+		},
+	})
+	defer s.stopAllChildren(time.Second)
+
+	pids := map[string]int{}
+	for _, name := range []string{"leaky.fcgi", "watched.fcgi", "unlimited.fcgi"} {
+		child, _, err := s.getOrCreateChild(context.Background(), filepath.Join(webRoot, name), nil)
+		if err != nil {
+			t.Fatalf("getOrCreateChild(%s) error = %v", name, err)
+		}
+		s.releaseChild(child)
+		pids[name] = child.cmd.Process().Pid()
+	}
+
+	s.checkResources()
+
+	s.childProcessesMu.Lock()
+	defer s.childProcessesMu.Unlock()
+	for name, wantReplaced := range map[string]bool{"leaky.fcgi": true, "watched.fcgi": false, "unlimited.fcgi": false} {
+		child := s.childProcesses[filepath.Join(webRoot, name)]
+		if child == nil {
+			t.Errorf("%s isn't running", name)
+			continue
+		}
+		if replaced := child.cmd.Process().Pid() != pids[name]; replaced != wantReplaced {
+			t.Errorf("%s replaced = %v, want %v", name, replaced, wantReplaced)
+		}
+	}
+	if child := s.childProcesses[filepath.Join(webRoot, "watched.fcgi")]; child != nil && !child.overLimit {
+		t.Error("watched.fcgi isn't reported as exceeding its limits")
+	}
+}
@@ -0,0 +1,64 @@
+package spawner
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// appWorkDir returns the working directory of the application at appPath:
+// its WorkDir, relative to the directory the application is in, or def if
+// it has none.
+func appWorkDir(appPath string, app AppConfig, def string) string {
+	if app.WorkDir == "" {
+		return def
+	}
+	if filepath.IsAbs(app.WorkDir) {
+		return app.WorkDir
+	}
+	return filepath.Join(filepath.Dir(appPath), app.WorkDir)
+}
+
+// withUmask makes cmd run with the file mode creation mask umask, which is
+// validated by AppConfig.validate. Go can only change the umask of the whole
+// spawner, so a shell sets it and then replaces itself with the command,
+// keeping its PID and file descriptors.
+func withUmask(cmd *exec.Cmd, umask string) {
+	if cmd.Err != nil {
+		// Start reports it.
+		return
+	}
+	cmd.Args = append([]string{"/bin/sh", "-c", "umask " + umask + ` && exec "$0" "$@"`, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+}
+
+// makePrivateTmp creates a temporary directory for a process of the
+// application at appPath, which only the user of cred can access, the
+// spawner's if nil, and returns its path.
+func makePrivateTmp(appPath string, cred *syscall.Credential) (string, error) {
+	name := strings.TrimSuffix(filepath.Base(appPath), filepath.Ext(appPath))
+	dir, err := os.MkdirTemp("", "fcgi-spawner-tmp-"+name+".")
+	if err != nil {
+		return "", err
+	}
+	if cred != nil {
+		if err := os.Chown(dir, int(cred.Uid), int(cred.Gid)); err != nil {
+			os.Remove(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// removePrivateTmp removes the private temporary directory of child, if it
+// has one, along with what the process left in it.
+func removePrivateTmp(child *childProcess) {
+	if child.tmpDir == "" {
+		return
+	}
+	if err := os.RemoveAll(child.tmpDir); err != nil {
+		spawnLog.Error("Error removing private temporary directory", "app", child.binaryPath, "path", child.tmpDir, "error", err)
+	}
+}
@@ -0,0 +1,91 @@
+package spawner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkDirUmaskPrivateTmp(t *testing.T) {
+	webRoot := t.TempDir()
+	appPath := filepath.Join(webRoot, "app.fcgi")
+	os.Mkdir(filepath.Join(webRoot, "data"), 0755)
+	script := "#!/bin/sh\necho \"$(pwd) $(umask) $TMPDIR\" > \"$OUT\"\nexec sleep 30\n"
+	if err := os.WriteFile(appPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write app: %v", err)
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	s := NewSpawner(&Config{WebRoot: webRoot, Apps: map[string]AppConfig{
+		"app.fcgi": {WorkDir: "data", Umask: "027", PrivateTmp: true, Env: map[string]string{"OUT": out}},
+	}})
+	defer s.stopAllChildren(time.Second)
+	if err := s.startApp(appPath); err != nil {
+		t.Fatalf("startApp() error = %v", err)
+	}
+
+	var fields []string
+	for deadline := time.Now().Add(2 * time.Second); len(fields) < 3; time.Sleep(20 * time.Millisecond) {
+		data, _ := os.ReadFile(out)
+		fields = strings.Fields(string(data))
+		if time.Now().After(deadline) {
+			t.Fatalf("app wrote %q, want its working directory, umask and TMPDIR", data)
+		}
+	}
+	if fields[0] != filepath.Join(webRoot, "data") {
+		t.Errorf("working directory = %s, want %s", fields[0], filepath.Join(webRoot, "data"))
+	}
+	if fields[1] != "0027" {
+		t.Errorf("umask = %s, want 0027", fields[1])
+	}
+	tmpDir := fields[2]
+	if info, err := os.Stat(tmpDir); err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("TMPDIR %s = %v, %v, want a private directory", tmpDir, info, err)
+	}
+
+	s.stopApp(appPath)
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		if _, err := os.Stat(tmpDir); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("TMPDIR %s still exists after the app stopped", tmpDir)
+		}
+	}
+}
+
+func TestAppWorkDir(t *testing.T) {
+	tests := []struct {
+		workDir, want string
+	}{
+		{"", "/default"},
+		{".", "/web/api"},
+		{"../data", "/web/data"},
+		{"/var/lib/app", "/var/lib/app"},
+	}
+	for _, tt := range tests {
+		if got := appWorkDir("/web/api/app.fcgi", AppConfig{WorkDir: tt.workDir}, "/default"); got != tt.want {
+			t.Errorf("appWorkDir(%q) = %s, want %s", tt.workDir, got, tt.want)
+		}
+	}
+}
+
+func TestValidateUmask(t *testing.T) {
+	tests := []struct {
+		app     AppConfig
+		wantErr bool
+	}{
+		{AppConfig{Umask: "027"}, false},
+		{AppConfig{Umask: "0077"}, false},
+		{AppConfig{Umask: "u=rwx"}, true},
+		{AppConfig{Umask: "1777"}, true},
+		{AppConfig{Umask: "022", Container: &ContainerConfig{Image: "alpine"}}, true},
+		{AppConfig{PrivateTmp: true, Container: &ContainerConfig{Image: "alpine"}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.app.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("validate() of %+v error = %v, wantErr %v", tt.app, err, tt.wantErr)
+		}
+	}
+}
@@ -4,38 +4,205 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github-notifications-oauth/internal/config"
+	"github-notifications-oauth/internal/digest"
 	"github-notifications-oauth/internal/handlers"
+	"github-notifications-oauth/internal/logging"
+	"github-notifications-oauth/internal/notify"
+	"github-notifications-oauth/internal/poller"
+	"github-notifications-oauth/internal/ratelimit"
 	"github-notifications-oauth/internal/services"
+	"github-notifications-oauth/internal/session"
+	"github-notifications-oauth/internal/store"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 func main() {
-	var err error
-	config.OauthConf, config.OauthStateString, err = config.LoadConfig()
+	listenAddr := flag.String("listenAddr", ":8080", "HTTP listen address")
+	tlsCert := flag.String("tlsCert", "", "TLS certificate file. Together with -tlsKey the server is served over HTTPS.")
+	tlsKey := flag.String("tlsKey", "", "TLS private key file")
+	autocertDomains := flag.String("autocertDomains", "", "Comma-separated domains to obtain certificates for from Let's Encrypt. Enables HTTPS with automatic certificates.")
+	autocertCacheDir := flag.String("autocertCacheDir", "autocert-cache", "Directory storing certificates obtained with -autocertDomains")
+	redirectAddr := flag.String("redirectAddr", "", "Optional plain HTTP listen address (e.g. :80) redirecting to HTTPS. In autocert mode it also answers ACME HTTP-01 challenges.")
+	logLevel := flag.String("logLevel", "info", "Log level (debug, info, warn, error)")
+	dataFile := flag.String("dataFile", "data.json", "JSON file persisting per-user settings such as triage rules. If empty, settings are kept in memory only.")
+	cacheTTL := flag.Duration("cacheTTL", 30*time.Second, "How long GitHub responses are cached per token (0 disables caching)")
+	smtpAddr := flag.String("smtpAddr", "", "SMTP server (host:port) used to send email digests. If empty, digests are disabled.")
+	smtpFrom := flag.String("smtpFrom", "", "Sender address of email digests")
+	smtpUsername := flag.String("smtpUsername", "", "SMTP username; the password is read from the SMTP_PASSWORD environment variable")
+	webhookHosts := flag.String("webhookHosts", "", "Comma-separated Mattermost/Slack hosts that forward rules may post to (e.g. hooks.slack.com). If empty, forwarding is disabled.")
+	apiRate := flag.Float64("apiRate", 5, "Sustained number of /api/* requests per second allowed per session (0 disables rate limiting)")
+	apiBurst := flag.Int("apiBurst", 20, "Number of /api/* requests a session may send in a burst")
+	sessionTTL := flag.Duration("sessionTTL", 30*24*time.Hour, "How long a session lasts without API requests; the poller stops applying rules for expired sessions (0 keeps sessions until logout)")
+	pollInterval := flag.Duration("pollInterval", time.Minute, "Interval at which the inbox of signed-in users is polled to apply triage rules (0 disables polling)")
+	flag.Parse()
+
+	level, err := logging.ParseLevel(*logLevel)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fmt.Fprintf(os.Stderr, "Invalid -logLevel %q: %v\n", *logLevel, err)
+		os.Exit(2)
+	}
+	if *smtpAddr != "" && *smtpFrom == "" {
+		fmt.Fprintln(os.Stderr, "-smtpAddr requires -smtpFrom")
+		os.Exit(2)
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fmt.Fprintln(os.Stderr, "-tlsCert and -tlsKey must be given together")
+		os.Exit(2)
+	}
+	if *tlsCert != "" && *autocertDomains != "" {
+		fmt.Fprintln(os.Stderr, "-tlsCert/-tlsKey and -autocertDomains are mutually exclusive")
+		os.Exit(2)
+	}
+	useTLS := *tlsCert != "" || *autocertDomains != ""
+	if *redirectAddr != "" && !useTLS {
+		fmt.Fprintln(os.Stderr, "-redirectAddr requires -tlsCert/-tlsKey or -autocertDomains")
+		os.Exit(2)
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		os.Exit(1)
+	}
+	dataStore, err := store.Open(*dataFile)
+	if err != nil {
+		slog.Error("Failed to open datastore", "error", err)
+		os.Exit(1)
+	}
+	sessions := session.NewStore(*sessionTTL)
+
+	// All GitHub services share one circuit breaker so that an outage detected
+	// by one request fails fast for everyone until GitHub recovers.
+	breaker := services.NewCircuitBreaker(5, 30*time.Second)
+	var cache *services.Cache
+	if *cacheTTL > 0 {
+		cache = services.NewCache(*cacheTTL)
+	}
+	newService := func(ctx context.Context, token string) services.GitHubService {
+		svc := services.WithRetry(services.NewGitHubService(ctx, token), services.DefaultRetryPolicy, breaker)
+		return services.WithCache(svc, cache, token)
 	}
 	// Create a new handler instance with the GitHub service factory
-	h := handlers.NewHandler(services.NewGitHubService)
+	h := handlers.NewHandler(cfg, newService, sessions, dataStore)
+	h.Cache = cache
+
+	var mailer *digest.Mailer
+	if *smtpAddr != "" {
+		mailer = &digest.Mailer{
+			Addr:     *smtpAddr,
+			From:     *smtpFrom,
+			Username: *smtpUsername,
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+		h.Mailer = mailer
+	}
+	var notifier *notify.Webhook
+	if *webhookHosts != "" {
+		notifier = notify.NewWebhook(strings.Split(strings.ToLower(*webhookHosts), ","))
+		h.Notifier = notifier
+	}
+
+	if *pollInterval > 0 {
+		p := &poller.Poller{
+			Sessions:   sessions,
+			Store:      dataStore,
+			NewService: newService,
+			Interval:   *pollInterval,
+			Mailer:     mailer,
+			Notifier:   notifier,
+		}
+		h.Poller = p
+		go p.Run(context.Background())
+	}
 
 	http.HandleFunc("/", handlers.HandleMain)
-	http.HandleFunc("/login", handlers.HandleGitHubLogin)
-	http.HandleFunc("/github/callback", func(w http.ResponseWriter, r *http.Request) {
-		handlers.HandleGitHubCallback(w, r, context.Background())
-	})
+	http.HandleFunc("/login", h.HandleGitHubLogin)
+	http.HandleFunc("/github/callback", h.HandleGitHubCallback)
+	http.HandleFunc("/logout", h.HandleLogout)
+	http.HandleFunc("/healthz", h.HandleHealth)
+	http.HandleFunc("/api/openapi.json", handlers.OpenAPIHandler)
 	http.HandleFunc("/api/notifications", h.APINotificationsHandler)
+	http.HandleFunc("/api/notifications/pinned", h.APIPinnedNotificationsHandler)
+	http.HandleFunc("/api/notifications/search", h.APISearchNotificationsHandler)
+	http.HandleFunc("/api/notifications/export", h.APIExportNotificationsHandler)
 	http.HandleFunc("/api/mark-as-read", h.APIMarkAsReadHandler)
+	http.HandleFunc("/api/mark-as-read/batch", h.APIBatchMarkAsReadHandler)
+	http.HandleFunc("/api/rules", h.APIRulesHandler)
+	http.HandleFunc("/api/preferences", h.APIPreferencesHandler)
 
-	listenAddr := flag.String("listenAddr", ":8080", "HTTP listen address")
-	flag.Parse()
+	// Every request is logged with its request ID; requests to documented API
+	// endpoints are validated against the OpenAPI specification
+	handler := handlers.ValidateRequests(http.DefaultServeMux)
+	if *apiRate > 0 {
+		handler = h.RateLimit(ratelimit.New(*apiRate, max(*apiBurst, 1)), handler)
+	}
+	server := &http.Server{
+		Addr:    *listenAddr,
+		Handler: logging.Middleware(handler),
+	}
 
-	fmt.Printf("Server started at http://localhost%s\n", *listenAddr)
+	// redirect answers plain HTTP requests on -redirectAddr. In autocert mode
+	// it is replaced by the ACME handler, which redirects all other requests.
+	redirect := redirectToHTTPS(*listenAddr)
+	if *autocertDomains != "" {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(strings.Split(*autocertDomains, ",")...),
+			Cache:      autocert.DirCache(*autocertCacheDir),
+		}
+		server.TLSConfig = m.TLSConfig()
+		redirect = m.HTTPHandler(nil)
+	}
+	if *redirectAddr != "" {
+		go func() {
+			slog.Info("Redirecting plain HTTP to HTTPS", "addr", *redirectAddr)
+			if err := http.ListenAndServe(*redirectAddr, redirect); err != nil {
+				slog.Error("HTTP redirect server failed", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	fmt.Printf("Server started at %s://localhost%s\n", scheme, *listenAddr)
 	fmt.Println("Use Ctrl+C to stop the server")
 
-	if err := http.ListenAndServe(*listenAddr, nil); err != nil {
-		log.Fatal(err)
+	if useTLS {
+		// With autocert the certificate comes from server.TLSConfig.
+		err = server.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil {
+		slog.Error("Server failed", "error", err)
+		os.Exit(1)
 	}
 }
+
+// redirectToHTTPS returns a handler sending clients to the same URL on the
+// HTTPS server listening on httpsAddr.
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
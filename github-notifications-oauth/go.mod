@@ -4,7 +4,12 @@ go 1.25.1
 
 require (
 	github.com/google/go-github/v62 v62.0.0
+	golang.org/x/crypto v0.40.0
 	golang.org/x/oauth2 v0.31.0
 )
 
-require github.com/google/go-querystring v1.1.0 // indirect
+require (
+	github.com/google/go-querystring v1.1.0 // indirect
+	golang.org/x/net v0.41.0 // indirect
+	golang.org/x/text v0.27.0 // indirect
+)
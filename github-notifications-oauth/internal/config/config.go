@@ -8,29 +8,27 @@ import (
 	"golang.org/x/oauth2/github"
 )
 
-var (
-	OauthConf        *oauth2.Config
-	OauthStateString string
-)
+// Config holds the application configuration.
+type Config struct {
+	// OAuth is the configuration of the GitHub OAuth App.
+	OAuth *oauth2.Config
+}
 
-func LoadConfig() (*oauth2.Config, string, error) {
+// LoadConfig reads the configuration from the environment.
+func LoadConfig() (*Config, error) {
 	clientID := os.Getenv("GITHUB_CLIENT_ID")
 	clientSecret := os.Getenv("GITHUB_CLIENT_SECRET")
-	oauthStateString := os.Getenv("OAUTH_STATE_STRING")
 
 	if clientID == "" || clientSecret == "" {
-		return nil, "", fmt.Errorf("GITHUB_CLIENT_ID and GITHUB_CLIENT_SECRET environment variables must be set.")
-	}
-	if oauthStateString == "" {
-		return nil, "", fmt.Errorf("OAUTH_STATE_STRING environment variable must be set.")
+		return nil, fmt.Errorf("GITHUB_CLIENT_ID and GITHUB_CLIENT_SECRET environment variables must be set.")
 	}
 
-	OauthConf := &oauth2.Config{
+	oauthConf := &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		Scopes:       []string{"notifications"},
 		Endpoint:     github.Endpoint,
 	}
 
-	return OauthConf, oauthStateString, nil
+	return &Config{OAuth: oauthConf}, nil
 }
@@ -0,0 +1,73 @@
+package digest
+
+import (
+	"fmt"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+
+	"github-notifications-oauth/internal/services"
+	"github.com/google/go-github/v62/github"
+)
+
+// Mailer sends emails through an SMTP server.
+type Mailer struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	// From is the sender address.
+	From string
+	// Username and Password authenticate with PLAIN auth if Username is set.
+	Username string
+	Password string
+}
+
+// Send delivers a plain text email to a single recipient.
+func (m *Mailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := strings.Cut(m.Addr, ":")
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s",
+		m.From, to, subject, time.Now().Format(time.RFC1123Z), strings.ReplaceAll(body, "\n", "\r\n"))
+	if err := smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("could not send email to %s: %v", to, err)
+	}
+	return nil
+}
+
+// Compose builds the subject and body of a digest of unread notifications,
+// grouped by repository.
+func Compose(login string, notifications []*github.Notification) (subject, body string) {
+	byRepo := make(map[string][]*github.Notification)
+	for _, n := range notifications {
+		repo := n.GetRepository().GetFullName()
+		byRepo[repo] = append(byRepo[repo], n)
+	}
+	repos := make([]string, 0, len(byRepo))
+	for repo := range byRepo {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+
+	if len(notifications) == 1 {
+		subject = "1 unread GitHub notification"
+	} else {
+		subject = fmt.Sprintf("%d unread GitHub notifications", len(notifications))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hi %s,\n\nyou have %s:\n", login, subject)
+	for _, repo := range repos {
+		fmt.Fprintf(&b, "\n%s\n", repo)
+		for _, n := range byRepo[repo] {
+			fmt.Fprintf(&b, "  - %s (%s)\n", n.GetSubject().GetTitle(), strings.ReplaceAll(n.GetReason(), "_", " "))
+			if link := services.WebURL(n); link != "" {
+				fmt.Fprintf(&b, "    %s\n", link)
+			}
+		}
+	}
+	b.WriteString("\nYou receive this digest because you enabled it in your preferences.\n")
+	return subject, b.String()
+}
@@ -0,0 +1,57 @@
+package digest
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v62/github"
+)
+
+func notification(repo, title, reason, url string) *github.Notification {
+	return &github.Notification{
+		Repository: &github.Repository{FullName: github.String(repo), HTMLURL: github.String("https://github.com/" + repo)},
+		Subject:    &github.NotificationSubject{Title: github.String(title), URL: github.String(url)},
+		Reason:     github.String(reason),
+	}
+}
+
+func TestCompose(t *testing.T) {
+	tests := []struct {
+		name          string
+		notifications []*github.Notification
+		wantSubject   string
+		wantBody      string
+	}{
+		{
+			name:          "one",
+			notifications: []*github.Notification{notification("octo-org/octo-repo", "Fix the build", "ci_activity", "https://api.github.com/repos/octo-org/octo-repo/pulls/7")},
+			wantSubject:   "1 unread GitHub notification",
+			wantBody: "Hi octocat,\n\nyou have 1 unread GitHub notification:\n" +
+				"\nocto-org/octo-repo\n  - Fix the build (ci activity)\n    https://github.com/octo-org/octo-repo/pull/7\n" +
+				"\nYou receive this digest because you enabled it in your preferences.\n",
+		},
+		{
+			name: "grouped by repository",
+			notifications: []*github.Notification{
+				notification("octo-org/zeta", "Release", "subscribed", ""),
+				notification("octo-org/alpha", "Question", "mention", "https://api.github.com/repos/octo-org/alpha/issues/1"),
+				notification("octo-org/zeta", "Crash", "assign", "https://api.github.com/repos/octo-org/zeta/issues/2"),
+			},
+			wantSubject: "3 unread GitHub notifications",
+			wantBody: "Hi octocat,\n\nyou have 3 unread GitHub notifications:\n" +
+				"\nocto-org/alpha\n  - Question (mention)\n    https://github.com/octo-org/alpha/issues/1\n" +
+				"\nocto-org/zeta\n  - Release (subscribed)\n    https://github.com/octo-org/zeta\n  - Crash (assign)\n    https://github.com/octo-org/zeta/issues/2\n" +
+				"\nYou receive this digest because you enabled it in your preferences.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, body := Compose("octocat", tt.notifications)
+			if subject != tt.wantSubject {
+				t.Errorf("Compose() subject = %q, want %q", subject, tt.wantSubject)
+			}
+			if body != tt.wantBody {
+				t.Errorf("Compose() body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
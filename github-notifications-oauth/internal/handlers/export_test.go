@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v62/github"
+)
+
+func TestWriteNotificationsCSV(t *testing.T) {
+	updated := github.Timestamp{Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	tests := []struct {
+		name      string
+		title     string
+		wantTitle string
+	}{
+		{name: "plain", title: "Fix the build", wantTitle: "Fix the build"},
+		{name: "formula", title: `=HYPERLINK("http://evil.example","click")`, wantTitle: `'=HYPERLINK("http://evil.example","click")`},
+		{name: "plus", title: "+1 for this", wantTitle: "'+1 for this"},
+		{name: "minus", title: "-2+3", wantTitle: "'-2+3"},
+		{name: "at", title: "@SUM(A1:A2)", wantTitle: "'@SUM(A1:A2)"},
+		{name: "tab", title: "\t=1", wantTitle: "'\t=1"},
+		{name: "inner equals", title: "a = b", wantTitle: "a = b"},
+		{name: "empty", title: "", wantTitle: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &github.Notification{
+				ID:         github.String("1"),
+				Repository: &github.Repository{FullName: github.String("octo-org/octo-repo")},
+				Subject:    &github.NotificationSubject{Title: github.String(tt.title), Type: github.String("Issue")},
+				Reason:     github.String("mention"),
+				Unread:     github.Bool(true),
+				UpdatedAt:  &updated,
+			}
+			w := httptest.NewRecorder()
+			if err := writeNotificationsCSV(w, []*github.Notification{n}); err != nil {
+				t.Fatalf("writeNotificationsCSV() error = %v", err)
+			}
+			records, err := csv.NewReader(w.Body).ReadAll()
+			if err != nil {
+				t.Fatalf("Reading CSV: %v", err)
+			}
+			if len(records) != 2 {
+				t.Fatalf("got %d records, want a header and one row", len(records))
+			}
+			want := []string{"1", "octo-org/octo-repo", "octo-org", tt.wantTitle, "Issue", "mention", "true", "2024-05-01T12:00:00Z", ""}
+			for i, cell := range records[1] {
+				if cell != want[i] {
+					t.Errorf("%s = %q, want %q", exportColumns[i], cell, want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteNotificationsCSVFlushes(t *testing.T) {
+	tests := []struct {
+		name        string
+		rows        int
+		wantFlushed bool
+	}{
+		{name: "few rows", rows: exportFlushRows - 1},
+		{name: "many rows", rows: exportFlushRows, wantFlushed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifications := make([]*github.Notification, tt.rows)
+			for i := range notifications {
+				notifications[i] = &github.Notification{ID: github.String(strconv.Itoa(i))}
+			}
+			w := httptest.NewRecorder()
+			if err := writeNotificationsCSV(w, notifications); err != nil {
+				t.Fatalf("writeNotificationsCSV() error = %v", err)
+			}
+			if w.Flushed != tt.wantFlushed {
+				t.Errorf("flushed = %t, want %t", w.Flushed, tt.wantFlushed)
+			}
+			records, err := csv.NewReader(w.Body).ReadAll()
+			if err != nil {
+				t.Fatalf("Reading CSV: %v", err)
+			}
+			if len(records) != tt.rows+1 {
+				t.Errorf("got %d records, want a header and %d rows", len(records), tt.rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github-notifications-oauth/internal/buildinfo"
+	"github-notifications-oauth/internal/logging"
+	"github-notifications-oauth/internal/services"
+)
+
+// githubCheckTTL is how long the result of a GitHub connectivity check is
+// reused, so that frequent health checks don't turn into GitHub traffic.
+const githubCheckTTL = 30 * time.Second
+
+// githubCheck caches the outcome of the last GitHub connectivity check.
+type githubCheck struct {
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+type healthResponse struct {
+	Status string         `json:"status"`
+	Uptime string         `json:"uptime"`
+	Build  buildinfo.Info `json:"build"`
+	GitHub healthCheck    `json:"github"`
+	Poller *pollerHealth  `json:"poller,omitempty"`
+}
+
+type healthCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type pollerHealth struct {
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// checkGitHub returns the result of a GitHub connectivity check, reusing a
+// recent result if there is one.
+func (h *Handler) checkGitHub(ctx context.Context) error {
+	h.github.mu.Lock()
+	defer h.github.mu.Unlock()
+	if time.Since(h.github.checked) < githubCheckTTL {
+		return h.github.err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	h.github.err = services.CheckGitHub(ctx)
+	h.github.checked = time.Now()
+	return h.github.err
+}
+
+// HandleHealth reports the health of the server: build metadata, whether
+// GitHub is reachable and the outcome of the last polling round. It responds
+// with 503 if GitHub can't be reached.
+func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := healthResponse{
+		Status: "ok",
+		Uptime: time.Since(h.startedAt).Round(time.Second).String(),
+		Build:  buildinfo.Get(),
+		GitHub: healthCheck{OK: true},
+	}
+	if err := h.checkGitHub(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Warn("GitHub connectivity check failed", "error", err)
+		resp.Status = "degraded"
+		resp.GitHub = healthCheck{OK: false, Error: err.Error()}
+	}
+	if h.Poller != nil {
+		status := h.Poller.Status()
+		resp.Poller = &pollerHealth{}
+		if !status.LastRun.IsZero() {
+			resp.Poller.LastRun = &status.LastRun
+		}
+		if status.LastError != nil {
+			resp.Poller.LastError = status.LastError.Error()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if resp.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
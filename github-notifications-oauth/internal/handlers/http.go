@@ -2,31 +2,83 @@ package handlers
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
-	"log"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github-notifications-oauth/internal/config"
+	"github-notifications-oauth/internal/digest"
+	"github-notifications-oauth/internal/logging"
+	"github-notifications-oauth/internal/notify"
+	"github-notifications-oauth/internal/poller"
 	"github-notifications-oauth/internal/services"
+	"github-notifications-oauth/internal/session"
+	"github-notifications-oauth/internal/store"
+	"github.com/google/go-github/v62/github"
 	"golang.org/x/oauth2"
 )
 
 // GitHubServiceFactory defines a function type for creating GitHubService instances.
 type GitHubServiceFactory func(ctx context.Context, token string) services.GitHubService
 
+// oauthStateCookie holds the random state of a login in progress.
+const oauthStateCookie = "oauth_state"
+
 // Handler struct holds dependencies for HTTP handlers.
 type Handler struct {
+	Config               *config.Config
 	GitHubServiceFactory GitHubServiceFactory
+	Sessions             *session.Store
+	Store                *store.Store
+	// Cache holds GitHub responses per token; it may be nil.
+	Cache *services.Cache
+	// Mailer sends email digests; it is nil if digests are not configured.
+	Mailer *digest.Mailer
+	// Notifier forwards notifications to chat; it is nil if forwarding is not configured.
+	Notifier *notify.Webhook
+	// Poller is reported on by the health endpoint; it is nil if polling is disabled.
+	Poller *poller.Poller
+
+	startedAt time.Time
+	github    githubCheck
 }
 
-// NewHandler creates a new Handler instance.
-func NewHandler(factory GitHubServiceFactory) *Handler {
+// NewHandler creates a new Handler instance. Optional dependencies such as
+// Cache are set on the returned Handler.
+func NewHandler(cfg *config.Config, factory GitHubServiceFactory, sessions *session.Store, dataStore *store.Store) *Handler {
 	return &Handler{
+		Config:               cfg,
 		GitHubServiceFactory: factory,
+		Sessions:             sessions,
+		Store:                dataStore,
+		startedAt:            time.Now(),
+	}
+}
+
+// currentUser returns the GitHub login of the caller. Tokens without a session,
+// e.g. issued before the server restarted, get one once GitHub confirms them.
+func (h *Handler) currentUser(ctx context.Context, token string) (string, error) {
+	if sess, ok := h.Sessions.Get(token); ok && sess.Login != "" {
+		logging.SetUser(ctx, sess.Login)
+		return sess.Login, nil
 	}
+	user, _, err := h.GitHubServiceFactory(ctx, token).GetAuthenticatedUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	h.Sessions.Create(token, user.GetLogin())
+	logging.SetUser(ctx, user.GetLogin())
+	return user.GetLogin(), nil
 }
 
 // extractToken extracts the Bearer token from the Authorization header.
@@ -42,47 +94,184 @@ func extractToken(r *http.Request) string {
 	return parts[1]
 }
 
+// apiError is the structured error body returned by the JSON API.
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"`
+}
+
+// writeJSONError writes a structured JSON error response.
+func writeJSONError(w http.ResponseWriter, status int, code, message string, details ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Error: apiErrorDetail{Code: code, Message: message, Details: details}})
+}
+
+// writeGitHubError reports a failed GitHub API call. Rate limiting and an open
+// circuit breaker are reported as retryable conditions instead of internal errors.
+func writeGitHubError(w http.ResponseWriter, err error, message string) {
+	var circuitErr *services.CircuitOpenError
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	var respErr *github.ErrorResponse
+	var netErr net.Error
+	switch {
+	case errors.As(err, &circuitErr):
+		w.Header().Set("Retry-After", retryAfterSeconds(circuitErr.RetryAfter))
+		http.Error(w, message, http.StatusServiceUnavailable)
+	case errors.As(err, &rateErr):
+		w.Header().Set("Retry-After", retryAfterSeconds(time.Until(rateErr.Rate.Reset.Time)))
+		http.Error(w, message, http.StatusTooManyRequests)
+	case errors.As(err, &abuseErr):
+		if abuseErr.RetryAfter != nil {
+			w.Header().Set("Retry-After", retryAfterSeconds(*abuseErr.RetryAfter))
+		}
+		http.Error(w, message, http.StatusTooManyRequests)
+	case errors.As(err, &respErr) && respErr.Response != nil && respErr.Response.StatusCode >= http.StatusInternalServerError,
+		errors.As(err, &netErr):
+		http.Error(w, message, http.StatusBadGateway)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+// gitHubErrorMessage describes a failed GitHub API call to a client, in the
+// categories of writeGitHubError, without the details of err.
+func gitHubErrorMessage(err error) string {
+	var circuitErr *services.CircuitOpenError
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	var respErr *github.ErrorResponse
+	var netErr net.Error
+	switch {
+	case errors.As(err, &circuitErr):
+		return "GitHub unavailable"
+	case errors.As(err, &rateErr), errors.As(err, &abuseErr):
+		return "rate limited"
+	case errors.As(err, &respErr) && respErr.Response != nil && respErr.Response.StatusCode == http.StatusNotFound:
+		return "not found"
+	case errors.As(err, &respErr) && respErr.Response != nil && respErr.Response.StatusCode >= http.StatusInternalServerError,
+		errors.As(err, &netErr):
+		return "upstream error"
+	default:
+		return "internal error"
+	}
+}
+
+func retryAfterSeconds(d time.Duration) string {
+	seconds := int(d.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
+
 // HandleMain serves the main index.html page.
 func HandleMain(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "web/index.html")
 }
 
 // HandleGitHubLogin redirects the user to the GitHub authorization page.
-func HandleGitHubLogin(w http.ResponseWriter, r *http.Request) {
-	url := config.OauthConf.AuthCodeURL(config.OauthStateString, oauth2.AccessTypeOnline)
+// Every login gets a random state value, remembered in a short-lived cookie
+// and checked by the callback to prevent cross-site request forgery.
+func (h *Handler) HandleGitHubLogin(w http.ResponseWriter, r *http.Request) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		logging.FromContext(r.Context()).Error("Could not generate oauth state", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	state := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/github/callback",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	url := h.Config.OAuth.AuthCodeURL(state, oauth2.AccessTypeOnline)
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
 // HandleGitHubCallback handles the request from the GitHub callback.
-func HandleGitHubCallback(w http.ResponseWriter, r *http.Request, ctx context.Context) {
-	if r.FormValue("state") != config.OauthStateString {
-		log.Println("Invalid oauth state")
+func (h *Handler) HandleGitHubCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+	cookie, err := r.Cookie(oauthStateCookie)
+	// The state is single-use, so the cookie is dropped whatever the outcome.
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: "/github/callback", MaxAge: -1})
+	state := r.FormValue("state")
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookie.Value)) != 1 {
+		logger.Warn("Invalid oauth state")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
 	code := r.FormValue("code")
-	token, err := config.OauthConf.Exchange(ctx, code)
+	token, err := h.Config.OAuth.Exchange(ctx, code)
 	if err != nil {
-		log.Printf("oauthConf.Exchange() failed: %v\n", err)
+		logger.Error("OAuth code exchange failed", "error", err)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
+	if _, err := h.currentUser(ctx, token.AccessToken); err != nil {
+		logger.Warn("Could not resolve GitHub user at login", "error", err)
+		h.Sessions.Create(token.AccessToken, "")
+	}
 
 	tmpl, err := template.ParseFiles("web/callback.html")
 	if err != nil {
-		log.Printf("Could not parse callback.html template: %v", err)
+		logger.Error("Could not parse callback.html template", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	err = tmpl.Execute(w, token.AccessToken)
 	if err != nil {
-		log.Printf("Could not execute callback.html template: %v", err)
+		logger.Error("Could not execute callback.html template", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
 
+// HandleLogout destroys the server session of the caller and revokes the
+// caller's access token with GitHub, so that signing out invalidates it.
+func (h *Handler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+	if !h.Sessions.Delete(token) {
+		logger.Info("Logout without a server session")
+	}
+	h.Cache.Invalidate(token)
+
+	if err := services.RevokeToken(ctx, h.Config.OAuth.ClientID, h.Config.OAuth.ClientSecret, token); err != nil {
+		logger.Error("Could not revoke access token", "error", err)
+		writeGitHubError(w, err, "Signed out, but the access token could not be revoked")
+		return
+	}
+
+	logger.Info("User logged out and access token revoked")
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"message": "Successfully logged out"}`)
+}
+
 // APINotificationsHandler handles API requests to get notifications and returns them as JSON.
 func (h *Handler) APINotificationsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -96,19 +285,20 @@ func (h *Handler) APINotificationsHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	ctx := context.Background()
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
 	// Create a GitHubService instance with the extracted token for this request
 	gitHubService := h.GitHubServiceFactory(ctx, token)
 	notifications, _, err := gitHubService.ListNotifications(ctx, nil)
 	if err != nil {
-		log.Printf("Could not get notifications: %v", err)
-		http.Error(w, "Could not retrieve notifications from GitHub API", http.StatusInternalServerError)
+		logger.Error("Could not get notifications", "error", err)
+		writeGitHubError(w, err, "Could not retrieve notifications from GitHub API")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(notifications); err != nil {
-		log.Printf("Could not encode notifications to JSON: %v", err)
+	if err := json.NewEncoder(w).Encode(h.pinnedFirst(ctx, gitHubService, token, notifications, true)); err != nil {
+		logger.Error("Could not encode notifications to JSON", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
@@ -143,17 +333,91 @@ func (h *Handler) APIMarkAsReadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
 	// Create a GitHubService instance with the extracted token for this request
 	gitHubService := h.GitHubServiceFactory(ctx, token)
 	_, err := gitHubService.MarkThreadRead(ctx, reqBody.ThreadID)
 	if err != nil {
-		log.Printf("Could not mark notification as read (ID: %d): %v", reqBody.ThreadID, err)
-		http.Error(w, "Could not mark notification as read", http.StatusInternalServerError)
+		logger.Error("Could not mark notification as read", "thread_id", reqBody.ThreadID, "error", err)
+		writeGitHubError(w, err, "Could not mark notification as read")
 		return
 	}
 
-	log.Printf("Notification %d marked as read", reqBody.ThreadID)
+	logger.Info("Notification marked as read", "thread_id", reqBody.ThreadID)
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `{"message": "Notification successfully marked as read"}`)
 }
+
+// maxBatchConcurrency bounds the number of concurrent GitHub calls made for one batch request.
+const maxBatchConcurrency = 8
+
+// BatchMarkReadRequest is used to parse the JSON request body of a batch mark-as-read request.
+type BatchMarkReadRequest struct {
+	ThreadIDs []int64 `json:"thread_ids"`
+}
+
+// MarkReadResult reports the outcome of marking a single thread as read.
+type MarkReadResult struct {
+	ThreadID int64  `json:"thread_id"`
+	OK       bool   `json:"ok"`
+	Error    string `json:"error,omitempty"`
+}
+
+// APIBatchMarkAsReadHandler handles API requests to mark several notifications as read at once.
+// Threads are marked concurrently and the outcome is reported for every ID.
+func (h *Handler) APIBatchMarkAsReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+		return
+	}
+
+	var reqBody BatchMarkReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if len(reqBody.ThreadIDs) == 0 {
+		http.Error(w, "Missing thread_ids", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+	gitHubService := h.GitHubServiceFactory(ctx, token)
+
+	results := make([]MarkReadResult, len(reqBody.ThreadIDs))
+	sem := make(chan struct{}, maxBatchConcurrency)
+	var wg sync.WaitGroup
+	for i, id := range reqBody.ThreadIDs {
+		results[i].ThreadID = id
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if _, err := gitHubService.MarkThreadRead(ctx, id); err != nil {
+				logger.Error("Could not mark notification as read", "thread_id", id, "error", err)
+				results[i].Error = gitHubErrorMessage(err)
+				return
+			}
+			results[i].OK = true
+		}()
+	}
+	wg.Wait()
+
+	logger.Info("Batch mark-as-read processed", "count", len(results))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string][]MarkReadResult{"results": results}); err != nil {
+		logger.Error("Could not encode batch results to JSON", "error", err)
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github-notifications-oauth/internal/services"
+	"github.com/google/go-github/v62/github"
+)
+
+// markService fails MarkThreadRead with the error given for the thread ID.
+type markService struct {
+	services.GitHubService
+	errs map[int64]error
+}
+
+func (s *markService) MarkThreadRead(ctx context.Context, id int64) (*github.Response, error) {
+	return nil, s.errs[id]
+}
+
+func errorResponse(status int) error {
+	return &github.ErrorResponse{
+		Response: &http.Response{StatusCode: status, Request: &http.Request{Method: http.MethodPatch}},
+		Message:  "secret details from " + http.StatusText(status),
+	}
+}
+
+func TestBatchMarkAsReadErrors(t *testing.T) {
+	svc := &markService{errs: map[int64]error{
+		2: errorResponse(http.StatusNotFound),
+		3: &github.AbuseRateLimitError{Message: "secret details"},
+		4: errorResponse(http.StatusBadGateway),
+		5: &net.OpError{Op: "dial", Err: errors.New("secret details")},
+		6: &services.CircuitOpenError{},
+		7: errors.New("secret details"),
+	}}
+	factory := func(ctx context.Context, token string) services.GitHubService { return svc }
+	h := NewHandler(nil, factory, nil, nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/mark-as-read/batch", strings.NewReader(`{"thread_ids": [1, 2, 3, 4, 5, 6, 7]}`))
+	r.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	h.APIBatchMarkAsReadHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (%s)", w.Code, http.StatusOK, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("response leaks error details: %s", w.Body)
+	}
+
+	var body struct {
+		Results []MarkReadResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := []MarkReadResult{
+		{ThreadID: 1, OK: true},
+		{ThreadID: 2, Error: "not found"},
+		{ThreadID: 3, Error: "rate limited"},
+		{ThreadID: 4, Error: "upstream error"},
+		{ThreadID: 5, Error: "upstream error"},
+		{ThreadID: 6, Error: "GitHub unavailable"},
+		{ThreadID: 7, Error: "internal error"},
+	}
+	if len(body.Results) != len(want) {
+		t.Fatalf("results = %+v, want %+v", body.Results, want)
+	}
+	for i := range want {
+		if body.Results[i] != want[i] {
+			t.Errorf("result %d = %+v, want %+v", i, body.Results[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// maxRequestBodySize limits the size of JSON request bodies accepted by the API.
+const maxRequestBodySize = 1 << 20
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// apiSpec is the parsed form of openAPISpec used for request validation.
+var apiSpec = mustParseSpec(openAPISpec)
+
+// openAPIDocument is the subset of an OpenAPI 3 document needed to validate requests.
+type openAPIDocument struct {
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+	Security []map[string][]string `json:"security"`
+}
+
+type operation struct {
+	Parameters  []parameter            `json:"parameters"`
+	RequestBody *requestBody           `json:"requestBody"`
+	Security    *[]map[string][]string `json:"security"`
+}
+
+type parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool `json:"required"`
+	Content  map[string]struct {
+		Schema *schema `json:"schema"`
+	} `json:"content"`
+}
+
+// schema is the subset of JSON Schema supported by the validator.
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Required   []string           `json:"required"`
+	Properties map[string]*schema `json:"properties"`
+	Items      *schema            `json:"items"`
+	Enum       []string           `json:"enum"`
+	Minimum    *float64           `json:"minimum"`
+	MinItems   *int               `json:"minItems"`
+	MaxItems   *int               `json:"maxItems"`
+	MinLength  *int               `json:"minLength"`
+}
+
+func mustParseSpec(data []byte) *openAPIDocument {
+	var doc openAPIDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		panic(fmt.Sprintf("invalid embedded OpenAPI specification: %v", err))
+	}
+	return &doc
+}
+
+// OpenAPIHandler serves the OpenAPI specification of the JSON API.
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// ValidateRequests rejects requests to documented API paths that do not match
+// the OpenAPI specification. Undocumented paths are passed through untouched.
+func ValidateRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		item, ok := apiSpec.Paths[r.URL.Path]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		op, ok := item[strings.ToLower(r.Method)]
+		if !ok {
+			w.Header().Set("Allow", allowedMethods(item))
+			writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", fmt.Sprintf("Method %s is not allowed for %s", r.Method, r.URL.Path))
+			return
+		}
+		if apiSpec.requiresAuth(op) && extractToken(r) == "" {
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Authorization header missing or malformed")
+			return
+		}
+
+		problems := apiSpec.validateQuery(op, r)
+		if op.RequestBody != nil {
+			status, code, bodyProblems := apiSpec.validateBody(op.RequestBody, r)
+			if status != http.StatusOK {
+				writeJSONError(w, status, code, "Request body does not match the API specification", bodyProblems...)
+				return
+			}
+			problems = append(problems, bodyProblems...)
+		}
+		if len(problems) > 0 {
+			writeJSONError(w, http.StatusBadRequest, "invalid_request", "Request does not match the API specification", problems...)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func allowedMethods(item map[string]*operation) string {
+	var methods []string
+	for method := range item {
+		methods = append(methods, strings.ToUpper(method))
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+func (d *openAPIDocument) requiresAuth(op *operation) bool {
+	if op.Security != nil {
+		return len(*op.Security) > 0
+	}
+	return len(d.Security) > 0
+}
+
+func (d *openAPIDocument) validateQuery(op *operation, r *http.Request) []string {
+	var problems []string
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		if p.In != "query" {
+			continue
+		}
+		value := query.Get(p.Name)
+		if value == "" {
+			if p.Required {
+				problems = append(problems, fmt.Sprintf("query parameter %s is required", p.Name))
+			}
+			continue
+		}
+		if p.Schema == nil {
+			continue
+		}
+		var v any = value
+		if s := d.resolve(p.Schema); s.Type == "integer" || s.Type == "number" {
+			v = json.Number(value)
+		} else if s.Type == "boolean" {
+			v = value == "true"
+			if value != "true" && value != "false" {
+				problems = append(problems, fmt.Sprintf("query parameter %s must be true or false", p.Name))
+				continue
+			}
+		}
+		problems = append(problems, d.validate(p.Schema, p.Name, v)...)
+	}
+	return problems
+}
+
+// validateBody checks the JSON request body and restores it for the next handler.
+// A status other than 200 means the body could not be examined at all.
+func (d *openAPIDocument) validateBody(body *requestBody, r *http.Request) (int, string, []string) {
+	media, ok := body.Content["application/json"]
+	if !ok {
+		return http.StatusOK, "", nil
+	}
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != "application/json" {
+		return http.StatusUnsupportedMediaType, "unsupported_media_type", []string{"Content-Type must be application/json"}
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		return http.StatusBadRequest, "invalid_body", []string{"request body could not be read"}
+	}
+	if len(raw) > maxRequestBodySize {
+		return http.StatusRequestEntityTooLarge, "body_too_large", []string{fmt.Sprintf("request body exceeds %d bytes", maxRequestBodySize)}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(raw))
+
+	if len(bytes.TrimSpace(raw)) == 0 {
+		if body.Required {
+			return http.StatusBadRequest, "invalid_body", []string{"request body is required"}
+		}
+		return http.StatusOK, "", nil
+	}
+
+	var value any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil || dec.More() {
+		return http.StatusBadRequest, "invalid_body", []string{"request body is not valid JSON"}
+	}
+	return http.StatusOK, "", d.validate(media.Schema, "", value)
+}
+
+func (d *openAPIDocument) resolve(s *schema) *schema {
+	for s != nil && s.Ref != "" {
+		s = d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	if s == nil {
+		return &schema{}
+	}
+	return s
+}
+
+// validate checks value against s and returns a description of every mismatch.
+func (d *openAPIDocument) validate(s *schema, field string, value any) []string {
+	s = d.resolve(s)
+	name := field
+	if name == "" {
+		name = "body"
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return []string{name + " must be an object"}
+		}
+		var problems []string
+		for _, req := range s.Required {
+			if _, ok := obj[req]; !ok {
+				problems = append(problems, joinField(field, req)+" is required")
+			}
+		}
+		props := make([]string, 0, len(s.Properties))
+		for prop := range s.Properties {
+			props = append(props, prop)
+		}
+		sort.Strings(props)
+		for _, prop := range props {
+			if v, ok := obj[prop]; ok {
+				problems = append(problems, d.validate(s.Properties[prop], joinField(field, prop), v)...)
+			}
+		}
+		return problems
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			return []string{name + " must be an array"}
+		}
+		var problems []string
+		if s.MinItems != nil && len(arr) < *s.MinItems {
+			problems = append(problems, fmt.Sprintf("%s must contain at least %d items", name, *s.MinItems))
+		}
+		if s.MaxItems != nil && len(arr) > *s.MaxItems {
+			problems = append(problems, fmt.Sprintf("%s must contain at most %d items", name, *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, v := range arr {
+				problems = append(problems, d.validate(s.Items, fmt.Sprintf("%s[%d]", name, i), v)...)
+			}
+		}
+		return problems
+	case "integer", "number":
+		num, ok := value.(json.Number)
+		if !ok {
+			return []string{fmt.Sprintf("%s must be %s", name, withArticle(s.Type))}
+		}
+		f, err := num.Float64()
+		if err == nil && s.Type == "integer" {
+			_, err = num.Int64()
+		}
+		if err != nil {
+			return []string{fmt.Sprintf("%s must be %s", name, withArticle(s.Type))}
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return []string{fmt.Sprintf("%s must be at least %v", name, *s.Minimum)}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return []string{name + " must be a string"}
+		}
+		if s.MinLength != nil && len(str) < *s.MinLength {
+			return []string{fmt.Sprintf("%s must be at least %d characters long", name, *s.MinLength)}
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, str) {
+			return []string{fmt.Sprintf("%s must be one of %s", name, strings.Join(s.Enum, ", "))}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{name + " must be a boolean"}
+		}
+	}
+	return nil
+}
+
+func withArticle(typ string) string {
+	if strings.IndexByte("aeiou", typ[0]) >= 0 {
+		return "an " + typ
+	}
+	return "a " + typ
+}
+
+func joinField(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	return parent + "." + child
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateRequests(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tooManyIDs := `{"thread_ids":[` + strings.Repeat("1,", 100) + `1]}`
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		token       string
+		contentType string
+		body        string
+		wantStatus  int
+		wantAllow   string
+	}{
+		{name: "health", method: http.MethodGet, target: "/healthz", wantStatus: http.StatusOK},
+		{name: "health without body", method: http.MethodHead, target: "/healthz", wantStatus: http.StatusOK},
+		{name: "health method", method: http.MethodPost, target: "/healthz", wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, HEAD"},
+		{name: "undocumented path", method: http.MethodDelete, target: "/api/unknown", wantStatus: http.StatusOK},
+		{name: "missing token", method: http.MethodGet, target: "/api/notifications", wantStatus: http.StatusUnauthorized},
+		{name: "token", method: http.MethodGet, target: "/api/notifications", token: "t", wantStatus: http.StatusOK},
+		{name: "public spec", method: http.MethodGet, target: "/api/openapi.json", wantStatus: http.StatusOK},
+		{name: "required query parameter", method: http.MethodGet, target: "/api/notifications/search", token: "t", wantStatus: http.StatusBadRequest},
+		{name: "query parameter", method: http.MethodGet, target: "/api/notifications/search?q=repo:octo", token: "t", wantStatus: http.StatusOK},
+		{name: "enum query parameter", method: http.MethodGet, target: "/api/notifications/export?format=xml", token: "t", wantStatus: http.StatusBadRequest},
+		{name: "boolean query parameter", method: http.MethodGet, target: "/api/notifications/export?all=yes", token: "t", wantStatus: http.StatusBadRequest},
+		{name: "export", method: http.MethodGet, target: "/api/notifications/export?format=csv&all=true", token: "t", wantStatus: http.StatusOK},
+		{name: "body", method: http.MethodPost, target: "/api/mark-as-read", token: "t", contentType: "application/json", body: `{"thread_id":42}`, wantStatus: http.StatusOK},
+		{name: "body minimum", method: http.MethodPost, target: "/api/mark-as-read", token: "t", contentType: "application/json", body: `{"thread_id":0}`, wantStatus: http.StatusBadRequest},
+		{name: "body type", method: http.MethodPost, target: "/api/mark-as-read", token: "t", contentType: "application/json", body: `{"thread_id":"42"}`, wantStatus: http.StatusBadRequest},
+		{name: "body required field", method: http.MethodPost, target: "/api/mark-as-read", token: "t", contentType: "application/json", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "body required", method: http.MethodPost, target: "/api/mark-as-read", token: "t", contentType: "application/json", wantStatus: http.StatusBadRequest},
+		{name: "invalid JSON", method: http.MethodPost, target: "/api/mark-as-read", token: "t", contentType: "application/json", body: `{"thread_id":`, wantStatus: http.StatusBadRequest},
+		{name: "content type", method: http.MethodPost, target: "/api/mark-as-read", token: "t", contentType: "text/plain", body: `{"thread_id":42}`, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "max items", method: http.MethodPost, target: "/api/mark-as-read/batch", token: "t", contentType: "application/json", body: tooManyIDs, wantStatus: http.StatusBadRequest},
+		{name: "enum in body", method: http.MethodPost, target: "/api/rules", token: "t", contentType: "application/json", body: `{"reason":"ci_activity","action":"delete"}`, wantStatus: http.StatusBadRequest},
+		{name: "rule", method: http.MethodPost, target: "/api/rules", token: "t", contentType: "application/json", body: `{"reason":"ci_activity","action":"read"}`, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			ValidateRequests(next).ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", allow, tt.wantAllow)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github-notifications-oauth/internal/logging"
+	"github-notifications-oauth/internal/services"
+	"github-notifications-oauth/internal/store"
+	"github.com/google/go-github/v62/github"
+)
+
+// maxPins bounds the number of threads a user can pin, as each pinned thread
+// missing from a list is fetched from GitHub.
+const maxPins = 50
+
+// maxPinFetches bounds the number of concurrent GitHub calls made to fetch pinned threads.
+const maxPinFetches = 4
+
+var (
+	// errNotPinned is returned by the datastore update when a thread isn't pinned.
+	errNotPinned = errors.New("thread not pinned")
+	// errTooManyPins is returned by the datastore update when maxPins is reached.
+	errTooManyPins = errors.New("too many pinned threads")
+)
+
+// listedNotification is a notification as returned by the list endpoints.
+type listedNotification struct {
+	*github.Notification
+	Pinned bool `json:"pinned,omitempty"`
+}
+
+// PinRequest is used to parse the JSON request body of a pin request.
+type PinRequest struct {
+	ThreadID int64 `json:"thread_id"`
+}
+
+// pinnedFirst flags the caller's pinned threads in notifications and moves
+// them to the top, keeping the order otherwise. With fetchMissing, pinned
+// threads that aren't in notifications, e.g. because they were read, are
+// fetched and added as well. If the caller can't be identified, the list is
+// returned without pins.
+func (h *Handler) pinnedFirst(ctx context.Context, svc services.GitHubService, token string, notifications []*github.Notification, fetchMissing bool) []listedNotification {
+	var pins []int64
+	login, err := h.currentUser(ctx, token)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Could not identify user, ignoring pins", "error", err)
+	} else {
+		pins = h.Store.User(login).Pins
+	}
+
+	listed := make([]listedNotification, 0, len(notifications)+len(pins))
+	seen := make(map[int64]bool)
+	for _, n := range notifications {
+		id, _ := strconv.ParseInt(n.GetID(), 10, 64)
+		seen[id] = true
+		listed = append(listed, listedNotification{Notification: n, Pinned: slices.Contains(pins, id)})
+	}
+	if fetchMissing {
+		var missing []int64
+		for _, id := range pins {
+			if !seen[id] {
+				missing = append(missing, id)
+			}
+		}
+		for _, n := range h.fetchPinned(ctx, svc, login, missing) {
+			listed = append(listed, listedNotification{Notification: n, Pinned: true})
+		}
+	}
+	slices.SortStableFunc(listed, func(a, b listedNotification) int {
+		switch {
+		case a.Pinned == b.Pinned:
+			return 0
+		case a.Pinned:
+			return -1
+		default:
+			return 1
+		}
+	})
+	return listed
+}
+
+// fetchPinned fetches the threads ids pinned by login concurrently, keeping
+// their order. Threads that can't be fetched are logged and skipped; those
+// that no longer exist are unpinned.
+func (h *Handler) fetchPinned(ctx context.Context, svc services.GitHubService, login string, ids []int64) []*github.Notification {
+	logger := logging.FromContext(ctx)
+	threads := make([]*github.Notification, len(ids))
+	gone := make([]bool, len(ids))
+	sem := make(chan struct{}, maxPinFetches)
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			n, resp, err := svc.GetThread(ctx, id)
+			switch {
+			case err != nil && resp != nil && resp.StatusCode == http.StatusNotFound:
+				gone[i] = true
+			case err != nil:
+				logger.Warn("Could not get pinned thread", "thread_id", id, "error", err)
+			default:
+				threads[i] = n
+			}
+		}()
+	}
+	wg.Wait()
+
+	var fetched []*github.Notification
+	var stale []int64
+	for i, n := range threads {
+		if gone[i] {
+			stale = append(stale, ids[i])
+		} else if n != nil {
+			fetched = append(fetched, n)
+		}
+	}
+	if len(stale) > 0 {
+		err := h.Store.Update(login, func(u *store.UserData) error {
+			u.Pins = slices.DeleteFunc(u.Pins, func(id int64) bool { return slices.Contains(stale, id) })
+			return nil
+		})
+		if err != nil {
+			logger.Error("Could not unpin threads that no longer exist", "thread_ids", stale, "error", err)
+		} else {
+			logger.Info("Unpinned threads that no longer exist", "thread_ids", stale)
+		}
+	}
+	return fetched
+}
+
+// APIPinnedNotificationsHandler lists the caller's pinned threads (GET), pins a
+// thread (POST) or unpins one given by ?thread_id= (DELETE).
+func (h *Handler) APIPinnedNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+	login, err := h.currentUser(ctx, token)
+	if err != nil {
+		logger.Error("Could not identify user", "error", err)
+		writeGitHubError(w, err, "Could not identify the GitHub user")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		gitHubService := h.GitHubServiceFactory(ctx, token)
+		pinned := []listedNotification{}
+		for _, n := range h.fetchPinned(ctx, gitHubService, login, h.Store.User(login).Pins) {
+			pinned = append(pinned, listedNotification{Notification: n, Pinned: true})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(pinned); err != nil {
+			logger.Error("Could not encode pinned notifications to JSON", "error", err)
+		}
+
+	case http.MethodPost:
+		var reqBody PinRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+		if reqBody.ThreadID == 0 {
+			http.Error(w, "Missing thread_id", http.StatusBadRequest)
+			return
+		}
+		_, resp, err := h.GitHubServiceFactory(ctx, token).GetThread(ctx, reqBody.ThreadID)
+		if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound {
+			http.Error(w, "Notification not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("Could not get thread to pin", "thread_id", reqBody.ThreadID, "error", err)
+			writeGitHubError(w, err, "Could not retrieve notification from GitHub API")
+			return
+		}
+		err = h.Store.Update(login, func(u *store.UserData) error {
+			if slices.Contains(u.Pins, reqBody.ThreadID) {
+				return nil
+			}
+			if len(u.Pins) >= maxPins {
+				return errTooManyPins
+			}
+			u.Pins = append(u.Pins, reqBody.ThreadID)
+			return nil
+		})
+		if errors.Is(err, errTooManyPins) {
+			http.Error(w, fmt.Sprintf("At most %d notifications can be pinned", maxPins), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			logger.Error("Could not save pin", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Thread pinned", "thread_id", reqBody.ThreadID)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"message": "Notification %d pinned"}`, reqBody.ThreadID)
+
+	case http.MethodDelete:
+		threadID, err := strconv.ParseInt(r.URL.Query().Get("thread_id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid thread_id", http.StatusBadRequest)
+			return
+		}
+		err = h.Store.Update(login, func(u *store.UserData) error {
+			i := slices.Index(u.Pins, threadID)
+			if i < 0 {
+				return errNotPinned
+			}
+			u.Pins = slices.Delete(u.Pins, i, i+1)
+			return nil
+		})
+		if errors.Is(err, errNotPinned) {
+			http.Error(w, "Notification is not pinned", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("Could not delete pin", "thread_id", threadID, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Thread unpinned", "thread_id", threadID)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"message": "Notification %d unpinned"}`, threadID)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
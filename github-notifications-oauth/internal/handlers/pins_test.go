@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github-notifications-oauth/internal/services"
+	"github-notifications-oauth/internal/session"
+	"github-notifications-oauth/internal/store"
+	"github.com/google/go-github/v62/github"
+)
+
+// threadService answers GetThread with threads, failing for the IDs in broken
+// and answering 404 for the others.
+type threadService struct {
+	services.GitHubService
+	threads map[int64]*github.Notification
+	broken  map[int64]bool
+}
+
+func (s *threadService) GetThread(ctx context.Context, id int64) (*github.Notification, *github.Response, error) {
+	if n, ok := s.threads[id]; ok {
+		return n, &github.Response{Response: &http.Response{StatusCode: http.StatusOK}}, nil
+	}
+	status := http.StatusNotFound
+	if s.broken[id] {
+		status = http.StatusBadGateway
+	}
+	resp := &github.Response{Response: &http.Response{StatusCode: status}}
+	return nil, resp, &github.ErrorResponse{Response: resp.Response, Message: http.StatusText(status)}
+}
+
+func newPinsHandler(t *testing.T, pins []int64) *Handler {
+	t.Helper()
+	svc := &threadService{
+		threads: map[int64]*github.Notification{1: {ID: github.String("1")}, 4: {ID: github.String("4")}},
+		broken:  map[int64]bool{3: true},
+	}
+	sessions := session.NewStore(0)
+	sessions.Create("alice-token", "alice")
+	dataStore, err := store.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dataStore.Update("alice", func(u *store.UserData) error { u.Pins = pins; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	factory := func(ctx context.Context, token string) services.GitHubService { return svc }
+	return NewHandler(nil, factory, sessions, dataStore)
+}
+
+func TestPinThread(t *testing.T) {
+	full := make([]int64, maxPins)
+	for i := range full {
+		full[i] = int64(100 + i)
+	}
+	tests := []struct {
+		name       string
+		pins       []int64
+		threadID   int64
+		wantStatus int
+		wantPins   []int64
+	}{
+		{name: "existing thread", pins: []int64{1}, threadID: 4, wantStatus: http.StatusOK, wantPins: []int64{1, 4}},
+		{name: "already pinned", pins: []int64{4}, threadID: 4, wantStatus: http.StatusOK, wantPins: []int64{4}},
+		{name: "unknown thread", pins: []int64{1}, threadID: 2, wantStatus: http.StatusNotFound, wantPins: []int64{1}},
+		{name: "GitHub failing", threadID: 3, wantStatus: http.StatusBadGateway},
+		{name: "too many pins", pins: full, threadID: 4, wantStatus: http.StatusConflict, wantPins: full},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newPinsHandler(t, tt.pins)
+			body := `{"thread_id": ` + strconv.FormatInt(tt.threadID, 10) + `}`
+			r := httptest.NewRequest(http.MethodPost, "/api/notifications/pinned", strings.NewReader(body))
+			r.Header.Set("Authorization", "Bearer alice-token")
+			w := httptest.NewRecorder()
+			h.APIPinnedNotificationsHandler(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if pins := h.Store.User("alice").Pins; !slices.Equal(pins, tt.wantPins) {
+				t.Errorf("pins = %v, want %v", pins, tt.wantPins)
+			}
+		})
+	}
+}
+
+func TestListPinned(t *testing.T) {
+	h := newPinsHandler(t, []int64{4, 2, 3, 1})
+	r := httptest.NewRequest(http.MethodGet, "/api/notifications/pinned", nil)
+	r.Header.Set("Authorization", "Bearer alice-token")
+	w := httptest.NewRecorder()
+	h.APIPinnedNotificationsHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (%s)", w.Code, http.StatusOK, w.Body)
+	}
+
+	var listed []listedNotification
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, n := range listed {
+		ids = append(ids, n.GetID())
+	}
+	// Thread 3 fails and is skipped; thread 2 no longer exists and is unpinned.
+	if want := []string{"4", "1"}; !slices.Equal(ids, want) {
+		t.Errorf("listed threads = %v, want %v", ids, want)
+	}
+	if pins, want := h.Store.User("alice").Pins, []int64{4, 3, 1}; !slices.Equal(pins, want) {
+		t.Errorf("pins = %v, want %v", pins, want)
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/mail"
+
+	"github-notifications-oauth/internal/logging"
+	"github-notifications-oauth/internal/store"
+)
+
+// APIPreferencesHandler reads (GET) or replaces (PUT) the caller's preferences.
+func (h *Handler) APIPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+	login, err := h.currentUser(ctx, token)
+	if err != nil {
+		logger.Error("Could not identify user", "error", err)
+		writeGitHubError(w, err, "Could not identify the GitHub user")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writePreferences(w, h.Store.User(login).Preferences)
+
+	case http.MethodPut:
+		var prefs store.Preferences
+		if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+		if msg := h.validatePreferences(prefs); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		err := h.Store.Update(login, func(u *store.UserData) error {
+			u.Preferences = prefs
+			return nil
+		})
+		if err != nil {
+			logger.Error("Could not save preferences", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Preferences updated", "digest", prefs.Digest.Enabled)
+		writePreferences(w, prefs)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validatePreferences returns a message describing what is wrong with prefs,
+// or an empty string if they are valid.
+func (h *Handler) validatePreferences(prefs store.Preferences) string {
+	d := prefs.Digest
+	if d.Email != "" {
+		// Only bare addresses are accepted, which also keeps them safe to use in mail headers.
+		if addr, err := mail.ParseAddress(d.Email); err != nil || addr.Address != d.Email {
+			return "Invalid digest email address"
+		}
+	}
+	if d.IntervalHours < 0 {
+		return "Digest interval must be positive"
+	}
+	if d.Enabled {
+		if h.Mailer == nil {
+			return "Email digests are not configured on this server"
+		}
+		if d.Email == "" {
+			return "An email address is required to enable the digest"
+		}
+	}
+	return ""
+}
+
+func writePreferences(w http.ResponseWriter, prefs store.Preferences) {
+	if prefs.Digest.IntervalHours == 0 {
+		prefs.Digest.IntervalHours = store.DefaultDigestIntervalHours
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github-notifications-oauth/internal/logging"
+	"github-notifications-oauth/internal/ratelimit"
+)
+
+// RateLimit limits requests to /api/* per session, or per client address for
+// requests without a token of a known session, so that made-up tokens neither
+// escape the limit nor each get a bucket. Requests over the limit are rejected
+// with 429 and a Retry-After header.
+func (h *Handler) RateLimit(limiter *ratelimit.Limiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var key string
+		if token := extractToken(r); token != "" {
+			if _, ok := h.Sessions.Get(token); ok {
+				key = "session:" + token
+			}
+		}
+		if key == "" {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			key = "addr:" + host
+		}
+		if wait, ok := limiter.Allow(key); !ok {
+			logging.FromContext(r.Context()).Warn("Rate limit exceeded", "retry_after", wait)
+			w.Header().Set("Retry-After", retryAfterSeconds(wait))
+			writeJSONError(w, http.StatusTooManyRequests, "rate_limited", "Too many requests, slow down")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github-notifications-oauth/internal/ratelimit"
+	"github-notifications-oauth/internal/session"
+)
+
+func TestRateLimit(t *testing.T) {
+	sessions := session.NewStore(0)
+	sessions.Create("alice-token", "alice")
+	sessions.Create("bob-token", "bob")
+	h := NewHandler(nil, nil, sessions, nil)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name string
+		// first and second are the Authorization headers of two requests
+		// from the same address.
+		first, second string
+		wantSecond    int
+	}{
+		{name: "same session", first: "Bearer alice-token", second: "Bearer alice-token", wantSecond: http.StatusTooManyRequests},
+		{name: "other session", first: "Bearer alice-token", second: "Bearer bob-token", wantSecond: http.StatusOK},
+		{name: "no token", first: "", second: "", wantSecond: http.StatusTooManyRequests},
+		{name: "unknown tokens", first: "Bearer made-up-1", second: "Bearer made-up-2", wantSecond: http.StatusTooManyRequests},
+		{name: "unknown token after none", first: "", second: "Bearer made-up", wantSecond: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := h.RateLimit(ratelimit.New(0.001, 1), ok)
+			var codes []int
+			for _, auth := range []string{tt.first, tt.second} {
+				r := httptest.NewRequest(http.MethodGet, "/api/notifications", nil)
+				r.RemoteAddr = "192.0.2.1:1234"
+				if auth != "" {
+					r.Header.Set("Authorization", auth)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				codes = append(codes, w.Code)
+			}
+			if codes[0] != http.StatusOK || codes[1] != tt.wantSecond {
+				t.Errorf("status = %v, want [%d %d]", codes, http.StatusOK, tt.wantSecond)
+			}
+		})
+	}
+}
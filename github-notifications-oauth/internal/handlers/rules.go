@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github-notifications-oauth/internal/logging"
+	"github-notifications-oauth/internal/rules"
+	"github-notifications-oauth/internal/store"
+)
+
+// errRuleNotFound is returned by the datastore update when a rule ID is unknown.
+var errRuleNotFound = errors.New("rule not found")
+
+// APIRulesHandler manages the caller's auto-triage rules:
+// GET lists them, POST creates one and DELETE (with ?id=) removes one.
+func (h *Handler) APIRulesHandler(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+	login, err := h.currentUser(ctx, token)
+	if err != nil {
+		logger.Error("Could not identify user", "error", err)
+		writeGitHubError(w, err, "Could not identify the GitHub user")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		userRules := h.Store.User(login).Rules
+		if userRules == nil {
+			userRules = []rules.Rule{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(userRules); err != nil {
+			logger.Error("Could not encode rules to JSON", "error", err)
+		}
+
+	case http.MethodPost:
+		var rule rules.Rule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+		if err := rule.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if rule.Action == rules.ActionForward {
+			if h.Notifier == nil {
+				http.Error(w, "Forwarding is not configured on this server", http.StatusBadRequest)
+				return
+			}
+			if err := h.Notifier.Check(rule.WebhookURL); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		rule.ID = rules.NewID()
+		err := h.Store.Update(login, func(u *store.UserData) error {
+			u.Rules = append(u.Rules, rule)
+			return nil
+		})
+		if err != nil {
+			logger.Error("Could not save rule", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Rule created", "rule", rule.ID, "action", rule.Action)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rule)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "Missing id", http.StatusBadRequest)
+			return
+		}
+		err := h.Store.Update(login, func(u *store.UserData) error {
+			for i, rule := range u.Rules {
+				if rule.ID == id {
+					u.Rules = append(u.Rules[:i], u.Rules[i+1:]...)
+					return nil
+				}
+			}
+			return errRuleNotFound
+		})
+		if errors.Is(err, errRuleNotFound) {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("Could not delete rule", "rule", id, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Rule deleted", "rule", id)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
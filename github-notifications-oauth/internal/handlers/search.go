@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github-notifications-oauth/internal/logging"
+	"github-notifications-oauth/internal/services"
+	"github.com/google/go-github/v62/github"
+)
+
+// searchQuery is a parsed notification search.
+//
+// A query is a list of whitespace separated terms that must all match.
+// Terms may be qualified with title:, repo:, reason: or org: to match a single
+// field; unqualified terms match the title, repository or reason.
+// Matching is case-insensitive and, except for org: and reason:, by substring.
+type searchQuery struct {
+	terms []searchTerm
+}
+
+type searchTerm struct {
+	field string
+	value string
+}
+
+func parseSearchQuery(q string) searchQuery {
+	var query searchQuery
+	for _, word := range strings.Fields(strings.ToLower(q)) {
+		term := searchTerm{value: word}
+		if field, value, ok := strings.Cut(word, ":"); ok && value != "" {
+			switch field {
+			case "title", "repo", "reason", "org":
+				term = searchTerm{field: field, value: value}
+			}
+		}
+		query.terms = append(query.terms, term)
+	}
+	return query
+}
+
+// matches reports whether n satisfies every term of the query.
+func (q searchQuery) matches(n *github.Notification) bool {
+	title := strings.ToLower(n.GetSubject().GetTitle())
+	repo := strings.ToLower(n.GetRepository().GetFullName())
+	reason := strings.ToLower(n.GetReason())
+	org := strings.ToLower(n.GetRepository().GetOwner().GetLogin())
+	if org == "" {
+		org, _, _ = strings.Cut(repo, "/")
+	}
+
+	for _, t := range q.terms {
+		var ok bool
+		switch t.field {
+		case "title":
+			ok = strings.Contains(title, t.value)
+		case "repo":
+			ok = strings.Contains(repo, t.value)
+		case "reason":
+			ok = reason == t.value
+		case "org":
+			ok = org == t.value
+		default:
+			ok = strings.Contains(title, t.value) || strings.Contains(repo, t.value) || strings.Contains(reason, t.value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// filterNotifications returns the notifications matching the query.
+func filterNotifications(notifications []*github.Notification, q searchQuery) []*github.Notification {
+	matched := []*github.Notification{}
+	for _, n := range notifications {
+		if q.matches(n) {
+			matched = append(matched, n)
+		}
+	}
+	return matched
+}
+
+// APISearchNotificationsHandler handles API requests to search the user's notifications.
+func (h *Handler) APISearchNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "Missing search query", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+	gitHubService := h.GitHubServiceFactory(ctx, token)
+	inbox, err := services.ListInbox(ctx, gitHubService, r.URL.Query().Get("all") == "true")
+	if err != nil {
+		logger.Error("Could not get notifications for search", "error", err)
+		writeGitHubError(w, err, "Could not retrieve notifications from GitHub API")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	results := h.pinnedFirst(ctx, gitHubService, token, filterNotifications(inbox, parseSearchQuery(q)), false)
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		logger.Error("Could not encode search results to JSON", "error", err)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v62/github"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want []searchTerm
+	}{
+		{q: "", want: nil},
+		{q: "flaky", want: []searchTerm{{value: "flaky"}}},
+		{q: "  Repo:Octo-Org/Octo-Repo   reason:mention ", want: []searchTerm{{field: "repo", value: "octo-org/octo-repo"}, {field: "reason", value: "mention"}}},
+		{q: "title:build org:octo-org", want: []searchTerm{{field: "title", value: "build"}, {field: "org", value: "octo-org"}}},
+		// Unknown fields and empty values are searched for as plain words.
+		{q: "author:octocat", want: []searchTerm{{value: "author:octocat"}}},
+		{q: "repo:", want: []searchTerm{{value: "repo:"}}},
+		{q: "http://example.com", want: []searchTerm{{value: "http://example.com"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			if got := parseSearchQuery(tt.q).terms; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSearchQuery(%q) = %+v, want %+v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchQueryMatches(t *testing.T) {
+	n := &github.Notification{
+		Repository: &github.Repository{FullName: github.String("octo-org/octo-repo")},
+		Subject:    &github.NotificationSubject{Title: github.String("Fix the flaky build")},
+		Reason:     github.String("ci_activity"),
+	}
+	tests := []struct {
+		q    string
+		want bool
+	}{
+		{q: "", want: true},
+		{q: "FLAKY", want: true},
+		{q: "octo-repo", want: true},
+		{q: "ci_act", want: true},
+		{q: "title:build", want: true},
+		{q: "title:octo", want: false},
+		{q: "repo:octo-org/", want: true},
+		{q: "reason:ci_activity", want: true},
+		{q: "reason:ci", want: false},
+		{q: "org:octo-org", want: true},
+		{q: "org:octo", want: false},
+		{q: "flaky reason:mention", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			if got := parseSearchQuery(tt.q).matches(n); got != tt.want {
+				t.Errorf("parseSearchQuery(%q).matches() = %t, want %t", tt.q, got, tt.want)
+			}
+		})
+	}
+}
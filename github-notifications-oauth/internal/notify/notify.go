@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github-notifications-oauth/internal/services"
+	"github.com/google/go-github/v62/github"
+)
+
+// Webhook posts messages to Mattermost or Slack incoming webhooks. Both accept
+// the same {"text": ...} payload as the mattermost notifier of the webhook
+// service in this repository.
+type Webhook struct {
+	// AllowedHosts lists the hosts webhook URLs may point to, so that users
+	// can't make the server send requests to arbitrary (internal) addresses.
+	AllowedHosts []string
+	Client       *http.Client
+}
+
+// NewWebhook creates a notifier posting to webhooks on the given hosts.
+func NewWebhook(allowedHosts []string) *Webhook {
+	return &Webhook{
+		AllowedHosts: allowedHosts,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Check returns an error if rawURL is not an HTTPS URL on an allowed host.
+func (w *Webhook) Check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("webhook URL must be an https:// URL")
+	}
+	if !slices.Contains(w.AllowedHosts, strings.ToLower(u.Hostname())) {
+		return fmt.Errorf("webhook host %s is not allowed on this server", u.Hostname())
+	}
+	return nil
+}
+
+// Send posts text to the webhook at rawURL.
+func (w *Webhook) Send(ctx context.Context, rawURL, text string) error {
+	if err := w.Check(rawURL); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not post to webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// Message formats a notification for a chat channel.
+func Message(n *github.Notification) string {
+	text := fmt.Sprintf("[%s] %s (%s)", n.GetRepository().GetFullName(), n.GetSubject().GetTitle(), strings.ReplaceAll(n.GetReason(), "_", " "))
+	if link := services.WebURL(n); link != "" {
+		text += "\n" + link
+	}
+	return text
+}
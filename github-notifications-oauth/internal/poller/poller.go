@@ -0,0 +1,212 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github-notifications-oauth/internal/digest"
+	"github-notifications-oauth/internal/notify"
+	"github-notifications-oauth/internal/rules"
+	"github-notifications-oauth/internal/services"
+	"github-notifications-oauth/internal/session"
+	"github-notifications-oauth/internal/store"
+	"github.com/google/go-github/v62/github"
+)
+
+// Poller periodically walks the inbox of every signed-in user, applies the
+// user's auto-triage rules to unread notifications and sends email digests
+// to users who asked for them.
+type Poller struct {
+	Sessions   *session.Store
+	Store      *store.Store
+	NewService func(ctx context.Context, token string) services.GitHubService
+	Interval   time.Duration
+	// Mailer sends email digests; digests are disabled if it is nil.
+	Mailer *digest.Mailer
+	// Notifier forwards notifications to chat; forward rules are skipped if it is nil.
+	Notifier *notify.Webhook
+
+	mu      sync.Mutex
+	lastRun time.Time
+	lastErr error
+}
+
+// Status describes the outcome of the most recent polling round.
+type Status struct {
+	LastRun   time.Time
+	LastError error
+}
+
+// Status returns the outcome of the most recent polling round.
+func (p *Poller) Status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Status{LastRun: p.lastRun, LastError: p.lastErr}
+}
+
+// Run polls every Interval until ctx is cancelled.
+func (p *Poller) Run(ctx context.Context) {
+	slog.Info("Notification poller started", "interval", p.Interval)
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.PollOnce(ctx)
+		}
+	}
+}
+
+// PollOnce runs a single polling round over all sessions.
+func (p *Poller) PollOnce(ctx context.Context) {
+	var lastErr error
+	for _, sess := range p.Sessions.All() {
+		if sess.Login == "" {
+			continue
+		}
+		if err := p.pollUser(ctx, sess); err != nil {
+			slog.Error("Polling notifications failed", "user", sess.Login, "error", err)
+			lastErr = err
+		}
+	}
+	p.mu.Lock()
+	p.lastRun = time.Now()
+	p.lastErr = lastErr
+	p.mu.Unlock()
+}
+
+func (p *Poller) pollUser(ctx context.Context, sess session.Session) error {
+	user := p.Store.User(sess.Login)
+	userRules := user.Rules
+	digestDue := p.digestDue(user)
+	if len(userRules) == 0 && !digestDue {
+		return nil
+	}
+
+	logger := slog.With("user", sess.Login)
+	svc := p.NewService(ctx, sess.Token)
+	inbox, err := services.ListInbox(ctx, svc, false)
+	if unauthorized(err) {
+		// The token was revoked or has expired; the user has to sign in again.
+		p.Sessions.Delete(sess.Token)
+		logger.Info("Deleted session of a token GitHub no longer accepts")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Notifications handled by a rule are left out of the digest, except
+	// forwarded ones, which stay unread.
+	var untriaged []*github.Notification
+	forwarded := make(map[string]time.Time)
+	for _, n := range inbox {
+		rule, ok := rules.FirstMatch(userRules, n)
+		if !ok || rule.Action == rules.ActionForward {
+			untriaged = append(untriaged, n)
+		}
+		if !ok {
+			continue
+		}
+		if rule.Action == rules.ActionForward {
+			if sent, ok := p.forward(ctx, logger, user, rule, n); ok {
+				forwarded[n.GetID()] = sent
+			}
+			continue
+		}
+		id, err := strconv.ParseInt(n.GetID(), 10, 64)
+		if err != nil {
+			logger.Warn("Skipping notification with unexpected ID", "id", n.GetID())
+			continue
+		}
+		switch rule.Action {
+		case rules.ActionRead:
+			_, err = svc.MarkThreadRead(ctx, id)
+		case rules.ActionDone:
+			_, err = svc.MarkThreadDone(ctx, id)
+		}
+		if err != nil {
+			logger.Error("Could not apply rule", "rule", rule.ID, "action", rule.Action, "thread_id", id, "error", err)
+			continue
+		}
+		logger.Info("Applied rule", "rule", rule.ID, "action", rule.Action, "thread_id", id, "title", n.GetSubject().GetTitle())
+	}
+
+	if !maps.Equal(forwarded, user.Forwarded) && (len(forwarded) > 0 || len(user.Forwarded) > 0) {
+		// Threads that left the inbox are dropped, so they are forwarded
+		// again if they come back unread.
+		err := p.Store.Update(sess.Login, func(u *store.UserData) error {
+			u.Forwarded = forwarded
+			return nil
+		})
+		if err != nil {
+			logger.Error("Could not record forwarded notifications", "error", err)
+		}
+	}
+
+	if digestDue {
+		return p.sendDigest(sess.Login, user.Preferences.Digest, untriaged)
+	}
+	return nil
+}
+
+// unauthorized reports whether err is GitHub rejecting the access token.
+func unauthorized(err error) bool {
+	var respErr *github.ErrorResponse
+	return errors.As(err, &respErr) && respErr.Response != nil && respErr.Response.StatusCode == http.StatusUnauthorized
+}
+
+// forward posts n to the webhook of rule unless it was already forwarded
+// since its last update. It returns the update time to remember and whether
+// the notification counts as forwarded.
+func (p *Poller) forward(ctx context.Context, logger *slog.Logger, user store.UserData, rule rules.Rule, n *github.Notification) (time.Time, bool) {
+	updated := n.GetUpdatedAt().Time
+	if sent, ok := user.Forwarded[n.GetID()]; ok && !updated.After(sent) {
+		return sent, true
+	}
+	if p.Notifier == nil {
+		return time.Time{}, false
+	}
+	if err := p.Notifier.Send(ctx, rule.WebhookURL, notify.Message(n)); err != nil {
+		logger.Error("Could not forward notification", "rule", rule.ID, "thread_id", n.GetID(), "error", err)
+		return time.Time{}, false
+	}
+	logger.Info("Forwarded notification", "rule", rule.ID, "thread_id", n.GetID(), "title", n.GetSubject().GetTitle())
+	return updated, true
+}
+
+// digestDue reports whether the user's next email digest should be sent.
+func (p *Poller) digestDue(user store.UserData) bool {
+	prefs := user.Preferences.Digest
+	if p.Mailer == nil || !prefs.Enabled || prefs.Email == "" {
+		return false
+	}
+	return time.Since(user.DigestSentAt) >= prefs.Interval()
+}
+
+// sendDigest emails the unread notifications to the user. Nothing is sent
+// for an empty inbox, but the schedule moves on as if a digest was sent.
+func (p *Poller) sendDigest(login string, prefs store.DigestPreferences, unread []*github.Notification) error {
+	logger := slog.With("user", login)
+	if len(unread) > 0 {
+		subject, body := digest.Compose(login, unread)
+		if err := p.Mailer.Send(prefs.Email, subject, body); err != nil {
+			return err
+		}
+		logger.Info("Sent email digest", "notifications", len(unread))
+	} else {
+		logger.Debug("Skipped email digest of empty inbox")
+	}
+	return p.Store.Update(login, func(u *store.UserData) error {
+		u.DigestSentAt = time.Now()
+		return nil
+	})
+}
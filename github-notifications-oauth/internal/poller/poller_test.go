@@ -0,0 +1,69 @@
+package poller
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github-notifications-oauth/internal/rules"
+	"github-notifications-oauth/internal/services"
+	"github-notifications-oauth/internal/session"
+	"github-notifications-oauth/internal/store"
+	"github.com/google/go-github/v62/github"
+)
+
+// failingService answers the notification list with a GitHub error of status.
+type failingService struct {
+	services.GitHubService
+	status int
+}
+
+func (f failingService) ListNotifications(ctx context.Context, opts *github.NotificationListOptions) ([]*github.Notification, *github.Response, error) {
+	resp := &http.Response{StatusCode: f.status, Request: &http.Request{Method: http.MethodGet}}
+	return nil, &github.Response{Response: resp}, &github.ErrorResponse{Response: resp, Message: http.StatusText(f.status)}
+}
+
+func TestPollOnceGitHubErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		wantSession bool
+		wantErr     bool
+	}{
+		{name: "revoked token", status: http.StatusUnauthorized},
+		{name: "server error", status: http.StatusInternalServerError, wantSession: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := session.NewStore(0)
+			sessions.Create("token", "octocat")
+			dataStore, err := store.Open("")
+			if err != nil {
+				t.Fatalf("store.Open() error = %v", err)
+			}
+			err = dataStore.Update("octocat", func(u *store.UserData) error {
+				u.Rules = []rules.Rule{{ID: "ci", Reason: "ci_activity", Action: rules.ActionRead}}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+			p := &Poller{
+				Sessions: sessions,
+				Store:    dataStore,
+				NewService: func(ctx context.Context, token string) services.GitHubService {
+					return failingService{status: tt.status}
+				},
+			}
+
+			p.PollOnce(context.Background())
+
+			if _, ok := sessions.Get("token"); ok != tt.wantSession {
+				t.Errorf("session kept = %t, want %t", ok, tt.wantSession)
+			}
+			if err := p.Status().LastError; (err != nil) != tt.wantErr {
+				t.Errorf("Status().LastError = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		// sleep is the pause before the last request.
+		sleep     time.Duration
+		requests  int
+		wantAllow []bool
+	}{
+		{name: "burst", rate: 1, burst: 3, requests: 4, wantAllow: []bool{true, true, true, false}},
+		{name: "no burst", rate: 1, burst: 1, requests: 2, wantAllow: []bool{true, false}},
+		{name: "refill", rate: 50, burst: 1, sleep: 40 * time.Millisecond, requests: 2, wantAllow: []bool{true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(tt.rate, tt.burst)
+			for i := range tt.requests {
+				if i == tt.requests-1 {
+					time.Sleep(tt.sleep)
+				}
+				wait, ok := l.Allow("key")
+				if ok != tt.wantAllow[i] {
+					t.Errorf("request %d allowed = %t, want %t", i, ok, tt.wantAllow[i])
+				}
+				if !ok && (wait <= 0 || wait > time.Duration(float64(time.Second)/tt.rate)) {
+					t.Errorf("request %d wait = %s, want up to the time of one token", i, wait)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterKeys(t *testing.T) {
+	l := New(1, 1)
+	if _, ok := l.Allow("a"); !ok {
+		t.Fatal("first request of a rejected")
+	}
+	if _, ok := l.Allow("b"); !ok {
+		t.Error("bucket of b drained by a")
+	}
+	if _, ok := l.Allow("a"); ok {
+		t.Error("second request of a allowed")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l := New(10, 1)
+	l.Allow("idle")
+	l.Allow("busy")
+	// idle has refilled by the time of the next sweep, busy was just used.
+	now := time.Now().Add(time.Minute)
+	l.buckets["busy"].last = now
+	l.sweep(now)
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("sweep() kept the refilled bucket")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("sweep() dropped a bucket in use")
+	}
+}
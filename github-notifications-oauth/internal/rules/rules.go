@@ -0,0 +1,92 @@
+package rules
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v62/github"
+)
+
+// Actions a rule can apply to a matching notification.
+const (
+	ActionRead = "read"
+	ActionDone = "done"
+	// ActionForward posts the notification to a chat webhook and leaves it unread.
+	ActionForward = "forward"
+)
+
+// Rule automatically triages notifications. All non-empty conditions must
+// match; a rule without conditions is rejected so it can't swallow the inbox.
+type Rule struct {
+	ID string `json:"id"`
+	// Reason matches the notification reason exactly, e.g. "ci_activity".
+	Reason string `json:"reason,omitempty"`
+	// Repo matches the repository full name exactly, e.g. "octo-org/octo-repo".
+	Repo string `json:"repo,omitempty"`
+	// Org matches the repository owner exactly.
+	Org string `json:"org,omitempty"`
+	// Title matches a substring of the subject title.
+	Title string `json:"title,omitempty"`
+	// Action is what to do with matching notifications.
+	Action string `json:"action"`
+	// WebhookURL is the Mattermost or Slack incoming webhook used by ActionForward.
+	WebhookURL string `json:"webhook_url,omitempty"`
+}
+
+// NewID returns a random rule identifier.
+func NewID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Validate checks that the rule has at least one condition and a known action.
+func (r Rule) Validate() error {
+	if r.Reason == "" && r.Repo == "" && r.Org == "" && r.Title == "" {
+		return errors.New("rule needs at least one of reason, repo, org or title")
+	}
+	switch r.Action {
+	case ActionRead, ActionDone:
+		return nil
+	case ActionForward:
+		if r.WebhookURL == "" {
+			return errors.New("forward rules need a webhook_url")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown action %q", r.Action)
+	}
+}
+
+// Matches reports whether the notification satisfies all conditions of the rule.
+// Comparisons are case-insensitive.
+func (r Rule) Matches(n *github.Notification) bool {
+	repo := n.GetRepository().GetFullName()
+	org, _, _ := strings.Cut(repo, "/")
+	if r.Reason != "" && !strings.EqualFold(r.Reason, n.GetReason()) {
+		return false
+	}
+	if r.Repo != "" && !strings.EqualFold(r.Repo, repo) {
+		return false
+	}
+	if r.Org != "" && !strings.EqualFold(r.Org, org) {
+		return false
+	}
+	if r.Title != "" && !strings.Contains(strings.ToLower(n.GetSubject().GetTitle()), strings.ToLower(r.Title)) {
+		return false
+	}
+	return true
+}
+
+// FirstMatch returns the first rule matching the notification.
+func FirstMatch(rules []Rule, n *github.Notification) (Rule, bool) {
+	for _, r := range rules {
+		if r.Matches(n) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
@@ -0,0 +1,76 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v62/github"
+)
+
+func TestMatches(t *testing.T) {
+	n := &github.Notification{
+		Repository: &github.Repository{FullName: github.String("octo-org/octo-repo")},
+		Subject:    &github.NotificationSubject{Title: github.String("Bump lodash from 4.17.20 to 4.17.21")},
+		Reason:     github.String("ci_activity"),
+	}
+	tests := []struct {
+		name string
+		rule Rule
+		want bool
+	}{
+		{name: "reason", rule: Rule{Reason: "ci_activity"}, want: true},
+		{name: "reason case", rule: Rule{Reason: "CI_Activity"}, want: true},
+		{name: "other reason", rule: Rule{Reason: "mention"}},
+		{name: "repo", rule: Rule{Repo: "Octo-Org/Octo-Repo"}, want: true},
+		{name: "repo prefix", rule: Rule{Repo: "octo-org/octo"}},
+		{name: "org", rule: Rule{Org: "octo-org"}, want: true},
+		{name: "other org", rule: Rule{Org: "octo"}},
+		{name: "title substring", rule: Rule{Title: "bump LODASH"}, want: true},
+		{name: "other title", rule: Rule{Title: "security"}},
+		{name: "all conditions", rule: Rule{Reason: "ci_activity", Org: "octo-org", Title: "bump"}, want: true},
+		{name: "one condition fails", rule: Rule{Reason: "ci_activity", Org: "other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Matches(n); got != tt.want {
+				t.Errorf("Matches() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirstMatch(t *testing.T) {
+	n := &github.Notification{Reason: github.String("mention")}
+	rules := []Rule{
+		{ID: "ci", Reason: "ci_activity", Action: ActionRead},
+		{ID: "first", Reason: "mention", Action: ActionDone},
+		{ID: "second", Reason: "mention", Action: ActionRead},
+	}
+	if r, ok := FirstMatch(rules, n); !ok || r.ID != "first" {
+		t.Errorf("FirstMatch() = %q, %t, want first", r.ID, ok)
+	}
+	if _, ok := FirstMatch(rules[:1], n); ok {
+		t.Error("FirstMatch() matched a rule of another reason")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{name: "read", rule: Rule{Reason: "ci_activity", Action: ActionRead}},
+		{name: "done", rule: Rule{Repo: "octo-org/octo-repo", Action: ActionDone}},
+		{name: "forward", rule: Rule{Org: "octo-org", Action: ActionForward, WebhookURL: "https://hooks.slack.com/services/x"}},
+		{name: "forward without webhook", rule: Rule{Org: "octo-org", Action: ActionForward}, wantErr: true},
+		{name: "no condition", rule: Rule{Action: ActionRead}, wantErr: true},
+		{name: "unknown action", rule: Rule{Title: "x", Action: "delete"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github-notifications-oauth/internal/logging"
+	"github.com/google/go-github/v62/github"
+)
+
+// Cache keeps recent GitHub responses in memory, separately for every access
+// token, so that several UI components asking for the same data within the TTL
+// cost a single GitHub call. It is safe for concurrent use and meant to be
+// shared by all service instances.
+type Cache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	tokens    map[string]*tokenCache
+	lastSweep time.Time
+}
+
+// tokenCache holds the cached responses of one access token.
+type tokenCache struct {
+	notifications map[string]cachedNotifications
+	user          *cachedUser
+}
+
+type cachedNotifications struct {
+	notifications []*github.Notification
+	resp          *github.Response
+	expires       time.Time
+}
+
+type cachedUser struct {
+	user    *github.User
+	resp    *github.Response
+	expires time.Time
+}
+
+// NewCache creates a cache whose entries expire after ttl.
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{ttl: ttl, tokens: make(map[string]*tokenCache)}
+}
+
+// Invalidate drops everything cached for token. It is a no-op on a nil cache.
+func (c *Cache) Invalidate(token string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.tokens, token)
+	c.mu.Unlock()
+}
+
+// invalidateNotifications drops the cached notification lists of token, which
+// are stale once a thread changes state. The authenticated user is kept.
+func (c *Cache) invalidateNotifications(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if tc, ok := c.tokens[token]; ok {
+		tc.notifications = nil
+	}
+}
+
+// entry returns the cache of token, creating it if needed. The caller must hold c.mu.
+func (c *Cache) entry(token string) *tokenCache {
+	c.sweep()
+	tc, ok := c.tokens[token]
+	if !ok {
+		tc = &tokenCache{}
+		c.tokens[token] = tc
+	}
+	return tc
+}
+
+// sweep removes expired entries, at most once per TTL so that tokens which are
+// no longer used don't pile up. The caller must hold c.mu.
+func (c *Cache) sweep() {
+	now := time.Now()
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+	for token, tc := range c.tokens {
+		for key, n := range tc.notifications {
+			if now.After(n.expires) {
+				delete(tc.notifications, key)
+			}
+		}
+		if tc.user != nil && now.After(tc.user.expires) {
+			tc.user = nil
+		}
+		if len(tc.notifications) == 0 && tc.user == nil {
+			delete(c.tokens, token)
+		}
+	}
+}
+
+// cachingService decorates a GitHubService with a Cache.
+type cachingService struct {
+	next  GitHubService
+	cache *Cache
+	token string
+}
+
+// WithCache wraps svc, which must act on behalf of token, so that
+// ListNotifications and GetAuthenticatedUser are served from cache while fresh.
+// Marking a thread as read or done invalidates the cached notifications.
+// If cache is nil, svc is returned unchanged.
+func WithCache(svc GitHubService, cache *Cache, token string) GitHubService {
+	if cache == nil {
+		return svc
+	}
+	return &cachingService{next: svc, cache: cache, token: token}
+}
+
+// notificationsKey identifies a ListNotifications call by its options.
+func notificationsKey(opts *github.NotificationListOptions) string {
+	if opts == nil {
+		opts = &github.NotificationListOptions{}
+	}
+	return fmt.Sprintf("all=%t participating=%t since=%d before=%d page=%d per_page=%d",
+		opts.All, opts.Participating, opts.Since.Unix(), opts.Before.Unix(), opts.Page, opts.PerPage)
+}
+
+func (s *cachingService) ListNotifications(ctx context.Context, opts *github.NotificationListOptions) ([]*github.Notification, *github.Response, error) {
+	key := notificationsKey(opts)
+	s.cache.mu.Lock()
+	cached, ok := s.cache.entry(s.token).notifications[key]
+	s.cache.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		logging.FromContext(ctx).Debug("GitHub cache hit", "call", "ListNotifications")
+		return append([]*github.Notification(nil), cached.notifications...), cached.resp, nil
+	}
+
+	notifications, resp, err := s.next.ListNotifications(ctx, opts)
+	if err != nil {
+		return notifications, resp, err
+	}
+	s.cache.mu.Lock()
+	tc := s.cache.entry(s.token)
+	if tc.notifications == nil {
+		tc.notifications = make(map[string]cachedNotifications)
+	}
+	tc.notifications[key] = cachedNotifications{
+		notifications: append([]*github.Notification(nil), notifications...),
+		resp:          resp,
+		expires:       time.Now().Add(s.cache.ttl),
+	}
+	s.cache.mu.Unlock()
+	return notifications, resp, nil
+}
+
+func (s *cachingService) MarkThreadRead(ctx context.Context, id int64) (*github.Response, error) {
+	resp, err := s.next.MarkThreadRead(ctx, id)
+	if err == nil {
+		s.cache.invalidateNotifications(s.token)
+	}
+	return resp, err
+}
+
+func (s *cachingService) MarkThreadDone(ctx context.Context, id int64) (*github.Response, error) {
+	resp, err := s.next.MarkThreadDone(ctx, id)
+	if err == nil {
+		s.cache.invalidateNotifications(s.token)
+	}
+	return resp, err
+}
+
+// GetThread is not cached; it is only used for the few pinned threads.
+func (s *cachingService) GetThread(ctx context.Context, id int64) (*github.Notification, *github.Response, error) {
+	return s.next.GetThread(ctx, id)
+}
+
+func (s *cachingService) GetAuthenticatedUser(ctx context.Context) (*github.User, *github.Response, error) {
+	s.cache.mu.Lock()
+	cached := s.cache.entry(s.token).user
+	s.cache.mu.Unlock()
+	if cached != nil && time.Now().Before(cached.expires) {
+		logging.FromContext(ctx).Debug("GitHub cache hit", "call", "GetAuthenticatedUser")
+		return cached.user, cached.resp, nil
+	}
+
+	user, resp, err := s.next.GetAuthenticatedUser(ctx)
+	if err != nil {
+		return user, resp, err
+	}
+	s.cache.mu.Lock()
+	s.cache.entry(s.token).user = &cachedUser{user: user, resp: resp, expires: time.Now().Add(s.cache.ttl)}
+	s.cache.mu.Unlock()
+	return user, resp, nil
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		// between runs between the two ListNotifications calls of alice.
+		between   func(alice, bob GitHubService, cache *Cache)
+		ttl       time.Duration
+		wantCalls int
+	}{
+		{name: "cached", ttl: time.Minute, between: func(alice, bob GitHubService, cache *Cache) {}, wantCalls: 1},
+		{name: "other token", ttl: time.Minute, between: func(alice, bob GitHubService, cache *Cache) {
+			bob.MarkThreadRead(ctx, 1)
+		}, wantCalls: 1},
+		{name: "marked read", ttl: time.Minute, between: func(alice, bob GitHubService, cache *Cache) {
+			alice.MarkThreadRead(ctx, 1)
+		}, wantCalls: 2},
+		{name: "marked done", ttl: time.Minute, between: func(alice, bob GitHubService, cache *Cache) {
+			alice.MarkThreadDone(ctx, 1)
+		}, wantCalls: 2},
+		{name: "invalidated", ttl: time.Minute, between: func(alice, bob GitHubService, cache *Cache) {
+			cache.Invalidate("alice")
+		}, wantCalls: 2},
+		{name: "expired", ttl: 10 * time.Millisecond, between: func(alice, bob GitHubService, cache *Cache) {
+			time.Sleep(20 * time.Millisecond)
+		}, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewCache(tt.ttl)
+			backend := &fakeService{}
+			alice := WithCache(backend, cache, "alice")
+			bob := WithCache(&fakeService{}, cache, "bob")
+
+			alice.ListNotifications(ctx, nil)
+			tt.between(alice, bob, cache)
+			alice.ListNotifications(ctx, nil)
+
+			// Marking threads calls the backend as well.
+			calls := backend.calls - backend.marks
+			if calls != tt.wantCalls {
+				t.Errorf("%d ListNotifications calls reached GitHub, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCacheUser(t *testing.T) {
+	backend := &fakeService{}
+	svc := WithCache(backend, NewCache(time.Minute), "alice")
+	for range 3 {
+		svc.GetAuthenticatedUser(context.Background())
+	}
+	// Marking a thread leaves the user cached.
+	svc.MarkThreadRead(context.Background(), 1)
+	svc.GetAuthenticatedUser(context.Background())
+	if calls := backend.calls - backend.marks; calls != 1 {
+		t.Errorf("%d GetAuthenticatedUser calls reached GitHub, want 1", calls)
+	}
+}
+
+func TestWithCacheNil(t *testing.T) {
+	backend := &fakeService{}
+	if svc := WithCache(backend, nil, "alice"); svc != GitHubService(backend) {
+		t.Errorf("WithCache() with a nil cache = %T, want the service itself", svc)
+	}
+	var cache *Cache
+	cache.Invalidate("alice")
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github-notifications-oauth/internal/logging"
 	"github.com/google/go-github/v62/github"
 	"golang.org/x/oauth2"
 )
@@ -13,6 +17,9 @@ import (
 type GitHubService interface {
 	ListNotifications(ctx context.Context, opts *github.NotificationListOptions) ([]*github.Notification, *github.Response, error)
 	MarkThreadRead(ctx context.Context, id int64) (*github.Response, error)
+	MarkThreadDone(ctx context.Context, id int64) (*github.Response, error)
+	GetThread(ctx context.Context, id int64) (*github.Notification, *github.Response, error)
+	GetAuthenticatedUser(ctx context.Context) (*github.User, *github.Response, error)
 }
 
 // githubClient implements GitHubService using the official github.Client.
@@ -28,16 +35,126 @@ func (g *githubClient) MarkThreadRead(ctx context.Context, id int64) (*github.Re
 	return g.client.Activity.MarkThreadRead(ctx, fmt.Sprintf("%d", id))
 }
 
+// MarkThreadDone marks a thread as done, which removes it from the inbox.
+// go-github does not wrap this endpoint yet, so the request is built by hand.
+func (g *githubClient) MarkThreadDone(ctx context.Context, id int64) (*github.Response, error) {
+	req, err := g.client.NewRequest(http.MethodDelete, fmt.Sprintf("notifications/threads/%d", id), nil)
+	if err != nil {
+		return nil, err
+	}
+	return g.client.Do(ctx, req, nil)
+}
+
+func (g *githubClient) GetThread(ctx context.Context, id int64) (*github.Notification, *github.Response, error) {
+	return g.client.Activity.GetThread(ctx, strconv.FormatInt(id, 10))
+}
+
+func (g *githubClient) GetAuthenticatedUser(ctx context.Context) (*github.User, *github.Response, error) {
+	return g.client.Users.Get(ctx, "")
+}
+
+const (
+	// inboxPageSize is the page size used when walking the whole inbox.
+	inboxPageSize = 50
+	// maxInboxPages bounds the number of GitHub calls made to collect the inbox.
+	maxInboxPages = 10
+)
+
+// ListInbox collects notifications across pages, up to maxInboxPages.
+// If all is true, notifications that were already read are included.
+func ListInbox(ctx context.Context, svc GitHubService, all bool) ([]*github.Notification, error) {
+	opts := &github.NotificationListOptions{
+		All:         all,
+		ListOptions: github.ListOptions{PerPage: inboxPageSize},
+	}
+	var inbox []*github.Notification
+	for page := 0; page < maxInboxPages; page++ {
+		notifications, resp, err := svc.ListNotifications(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		inbox = append(inbox, notifications...)
+		if resp == nil || resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return inbox, nil
+}
+
+// WebURL turns the API URL of the notification subject into the URL of the
+// corresponding page on github.com, falling back to the repository page.
+func WebURL(n *github.Notification) string {
+	api := n.GetSubject().GetURL()
+	if !strings.HasPrefix(api, "https://api.github.com/repos/") {
+		return n.GetRepository().GetHTMLURL()
+	}
+	link := "https://github.com/" + strings.TrimPrefix(api, "https://api.github.com/repos/")
+	return strings.Replace(link, "/pulls/", "/pull/", 1)
+}
+
+// loggingTransport logs every GitHub API call together with the request ID
+// carried by the request context, so calls can be traced back to the API
+// request that triggered them.
+type loggingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	logger := logging.FromContext(req.Context())
+	if err != nil {
+		logger.Debug("GitHub API call failed", "method", req.Method, "path", req.URL.Path, "duration", time.Since(start), "error", err)
+		return resp, err
+	}
+	logger.Debug("GitHub API call",
+		"method", req.Method,
+		"path", req.URL.Path,
+		"status", resp.StatusCode,
+		"duration", time.Since(start),
+		"rate_limit_remaining", resp.Header.Get("X-RateLimit-Remaining"))
+	return resp, nil
+}
+
+// RevokeToken revokes an OAuth access token issued to the application
+// identified by clientID, so it can no longer be used against the GitHub API.
+func RevokeToken(ctx context.Context, clientID, clientSecret, token string) error {
+	tp := &github.BasicAuthTransport{
+		Username:  clientID,
+		Password:  clientSecret,
+		Transport: &loggingTransport{next: http.DefaultTransport},
+	}
+	resp, err := github.NewClient(tp.Client()).Authorizations.Revoke(ctx, clientID, token)
+	if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound {
+		// The token is unknown to GitHub, i.e. it has already been revoked.
+		return nil
+	}
+	return err
+}
+
+// CheckGitHub verifies that the GitHub API is reachable. It queries the rate
+// limit endpoint, which doesn't count against the rate limit.
+func CheckGitHub(ctx context.Context) error {
+	client := github.NewClient(&http.Client{Transport: &loggingTransport{next: http.DefaultTransport}})
+	_, _, err := client.RateLimit.Get(ctx)
+	return err
+}
+
 // NewGitHubService creates a new GitHubService.
 // If a token is provided, it creates an authenticated client.
 // Otherwise, it creates an unauthenticated client.
 func NewGitHubService(ctx context.Context, token string) GitHubService {
-	var tc *http.Client
+	tc := &http.Client{}
 	if token != "" {
 		ts := oauth2.StaticTokenSource(
 			&oauth2.Token{AccessToken: token},
 		)
 		tc = oauth2.NewClient(ctx, ts)
 	}
+	if tc.Transport == nil {
+		tc.Transport = http.DefaultTransport
+	}
+	tc.Transport = &loggingTransport{next: tc.Transport}
 	return &githubClient{client: github.NewClient(tc)}
 }
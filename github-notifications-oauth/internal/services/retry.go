@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github-notifications-oauth/internal/logging"
+	"github.com/google/go-github/v62/github"
+)
+
+// RetryPolicy controls how failed GitHub API calls are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// BaseDelay is the backoff before the second attempt; it doubles with every retry.
+	BaseDelay time.Duration
+	// MaxDelay caps a single wait. Calls asking for a longer wait are not retried.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is a policy suitable for interactive requests.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// CircuitOpenError is returned without contacting GitHub while the circuit breaker is open.
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("github: circuit breaker open, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+// CircuitBreaker stops sending requests to GitHub after a run of consecutive
+// transient failures. Once the cooldown expires it is half-open: a single trial
+// request is let through while the others wait for it, proceeding if it
+// succeeds and failing fast if it opens the circuit again.
+// It is safe for concurrent use and meant to be shared by all service instances.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	// trial is closed when the trial request of the half-open breaker ends; it
+	// is nil unless one is in flight.
+	trial chan struct{}
+}
+
+// NewCircuitBreaker creates a breaker that opens after threshold consecutive
+// failures and stays open for cooldown.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow returns a *CircuitOpenError if no request may be sent, waiting first
+// for the trial request in flight, if any. trial reports whether the caller
+// sends the trial request; it must pass it on to success, failure or release.
+func (b *CircuitBreaker) allow(ctx context.Context) (trial bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	for {
+		if wait := time.Until(b.openUntil); wait > 0 {
+			b.mu.Unlock()
+			return false, &CircuitOpenError{RetryAfter: wait}
+		}
+		if b.failures < b.threshold {
+			b.mu.Unlock()
+			return false, nil
+		}
+		if b.trial == nil {
+			b.trial = make(chan struct{})
+			b.mu.Unlock()
+			return true, nil
+		}
+		done := b.trial
+		b.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-done:
+		}
+		b.mu.Lock()
+	}
+}
+
+// success records that GitHub answered, closing the circuit.
+func (b *CircuitBreaker) success(trial bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.endTrial(trial)
+}
+
+// failure records an outage. Once the threshold is reached every further
+// failure, including a failed trial request, opens the circuit again.
+func (b *CircuitBreaker) failure(trial bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		if time.Now().After(b.openUntil) {
+			slog.Warn("GitHub circuit breaker opened", "failures", b.failures, "cooldown", b.cooldown)
+		}
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+	b.endTrial(trial)
+}
+
+// release ends a call that tells nothing about GitHub, such as one canceled
+// by the caller, letting another waiting request make the trial.
+func (b *CircuitBreaker) release(trial bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.endTrial(trial)
+}
+
+func (b *CircuitBreaker) endTrial(trial bool) {
+	if trial && b.trial != nil {
+		close(b.trial)
+		b.trial = nil
+	}
+}
+
+// retryingService decorates a GitHubService with retries and a circuit breaker.
+type retryingService struct {
+	next    GitHubService
+	policy  RetryPolicy
+	breaker *CircuitBreaker
+}
+
+// WithRetry wraps svc so that transient failures (5xx responses, rate limiting,
+// network errors) are retried with jittered exponential backoff, honoring
+// Retry-After and rate limit reset times sent by GitHub. Only failures of
+// GitHub as a whole count toward breaker, which may be nil: one user running
+// out of their own rate limit doesn't fail fast for everyone.
+func WithRetry(svc GitHubService, policy RetryPolicy, breaker *CircuitBreaker) GitHubService {
+	return &retryingService{next: svc, policy: policy, breaker: breaker}
+}
+
+func (s *retryingService) ListNotifications(ctx context.Context, opts *github.NotificationListOptions) ([]*github.Notification, *github.Response, error) {
+	var notifications []*github.Notification
+	var resp *github.Response
+	err := s.do(ctx, "ListNotifications", func() (*github.Response, error) {
+		var err error
+		notifications, resp, err = s.next.ListNotifications(ctx, opts)
+		return resp, err
+	})
+	return notifications, resp, err
+}
+
+func (s *retryingService) MarkThreadRead(ctx context.Context, id int64) (*github.Response, error) {
+	var resp *github.Response
+	err := s.do(ctx, "MarkThreadRead", func() (*github.Response, error) {
+		var err error
+		resp, err = s.next.MarkThreadRead(ctx, id)
+		return resp, err
+	})
+	return resp, err
+}
+
+func (s *retryingService) MarkThreadDone(ctx context.Context, id int64) (*github.Response, error) {
+	var resp *github.Response
+	err := s.do(ctx, "MarkThreadDone", func() (*github.Response, error) {
+		var err error
+		resp, err = s.next.MarkThreadDone(ctx, id)
+		return resp, err
+	})
+	return resp, err
+}
+
+func (s *retryingService) GetThread(ctx context.Context, id int64) (*github.Notification, *github.Response, error) {
+	var notification *github.Notification
+	var resp *github.Response
+	err := s.do(ctx, "GetThread", func() (*github.Response, error) {
+		var err error
+		notification, resp, err = s.next.GetThread(ctx, id)
+		return resp, err
+	})
+	return notification, resp, err
+}
+
+func (s *retryingService) GetAuthenticatedUser(ctx context.Context) (*github.User, *github.Response, error) {
+	var user *github.User
+	var resp *github.Response
+	err := s.do(ctx, "GetAuthenticatedUser", func() (*github.Response, error) {
+		var err error
+		user, resp, err = s.next.GetAuthenticatedUser(ctx)
+		return resp, err
+	})
+	return user, resp, err
+}
+
+// do runs call until it succeeds, fails permanently or the policy is exhausted.
+func (s *retryingService) do(ctx context.Context, name string, call func() (*github.Response, error)) error {
+	for attempt := 1; ; attempt++ {
+		trial, err := s.breaker.allow(ctx)
+		if err != nil {
+			return err
+		}
+
+		resp, err := call()
+		switch {
+		case err == nil:
+			s.breaker.success(trial)
+			return nil
+		case ctx.Err() != nil:
+			s.breaker.release(trial)
+		case outage(resp, err):
+			s.breaker.failure(trial)
+		default:
+			s.breaker.success(trial)
+		}
+
+		delay, retryable := s.retryDelay(ctx, resp, err, attempt)
+		if !retryable {
+			return err
+		}
+		if attempt >= s.policy.MaxAttempts || delay > s.policy.MaxDelay {
+			return err
+		}
+
+		logging.FromContext(ctx).Warn("GitHub call failed, retrying",
+			"call", name,
+			"attempt", attempt,
+			"max_attempts", s.policy.MaxAttempts,
+			"delay", delay.Round(time.Millisecond),
+			"error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay decides whether err is transient and how long to wait before the next attempt.
+func (s *retryingService) retryDelay(ctx context.Context, resp *github.Response, err error, attempt int) (time.Duration, bool) {
+	if ctx.Err() != nil {
+		return 0, false
+	}
+
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil {
+			return *abuseErr.RetryAfter, true
+		}
+		return s.backoff(attempt), true
+	}
+
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		return time.Until(rateErr.Rate.Reset.Time), true
+	}
+
+	if resp != nil && resp.Response != nil {
+		status := resp.StatusCode
+		if status != http.StatusTooManyRequests && status < http.StatusInternalServerError {
+			return 0, false
+		}
+		if after := parseRetryAfter(resp.Header.Get("Retry-After")); after > 0 {
+			return after, true
+		}
+		return s.backoff(attempt), true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return s.backoff(attempt), true
+	}
+	return 0, false
+}
+
+// outage reports whether err is a failure of GitHub as a whole: a 5xx response
+// or a network error. Primary and secondary rate limits apply to the token of
+// the caller alone.
+func outage(resp *github.Response, err error) bool {
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &rateErr) || errors.As(err, &abuseErr) {
+		return false
+	}
+	if resp != nil && resp.Response != nil {
+		return resp.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// backoff returns an exponentially growing delay with jitter in [d/2, d].
+func (s *retryingService) backoff(attempt int) time.Duration {
+	d := s.policy.BaseDelay << (attempt - 1)
+	if d <= 0 || d > s.policy.MaxDelay {
+		d = s.policy.MaxDelay
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v62/github"
+)
+
+// fakeService answers every call with resp and err.
+type fakeService struct {
+	resp  *github.Response
+	err   error
+	calls int
+	// marks counts the calls marking a thread.
+	marks int
+}
+
+func (f *fakeService) ListNotifications(ctx context.Context, opts *github.NotificationListOptions) ([]*github.Notification, *github.Response, error) {
+	f.calls++
+	return nil, f.resp, f.err
+}
+
+func (f *fakeService) MarkThreadRead(ctx context.Context, id int64) (*github.Response, error) {
+	f.calls++
+	f.marks++
+	return f.resp, f.err
+}
+
+func (f *fakeService) MarkThreadDone(ctx context.Context, id int64) (*github.Response, error) {
+	f.calls++
+	f.marks++
+	return f.resp, f.err
+}
+
+func (f *fakeService) GetThread(ctx context.Context, id int64) (*github.Notification, *github.Response, error) {
+	f.calls++
+	return nil, f.resp, f.err
+}
+
+func (f *fakeService) GetAuthenticatedUser(ctx context.Context) (*github.User, *github.Response, error) {
+	f.calls++
+	return nil, f.resp, f.err
+}
+
+func response(status int) *github.Response {
+	return &github.Response{Response: &http.Response{StatusCode: status, Header: http.Header{}}}
+}
+
+func TestBreakerCountsOnlyOutages(t *testing.T) {
+	reset := github.Timestamp{Time: time.Now().Add(time.Hour)}
+	tests := []struct {
+		name     string
+		resp     *github.Response
+		err      error
+		wantOpen bool
+	}{
+		{name: "server error", resp: response(http.StatusBadGateway), err: errors.New("bad gateway"), wantOpen: true},
+		{name: "network error", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, wantOpen: true},
+		{name: "secondary rate limit", resp: response(http.StatusForbidden), err: &github.AbuseRateLimitError{}},
+		{name: "primary rate limit", resp: response(http.StatusForbidden), err: &github.RateLimitError{Rate: github.Rate{Reset: reset}}},
+		{name: "not found", resp: response(http.StatusNotFound), err: errors.New("not found")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := NewCircuitBreaker(2, time.Minute)
+			svc := WithRetry(&fakeService{resp: tt.resp, err: tt.err}, RetryPolicy{MaxAttempts: 1, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, breaker)
+			for range 2 {
+				svc.MarkThreadRead(context.Background(), 1)
+			}
+			_, err := svc.MarkThreadRead(context.Background(), 1)
+			var openErr *CircuitOpenError
+			if open := errors.As(err, &openErr); open != tt.wantOpen {
+				t.Errorf("circuit open = %t, want %t (error %v)", open, tt.wantOpen, err)
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name      string
+		end       func(b *CircuitBreaker)
+		wantTrial bool
+		wantOpen  bool
+	}{
+		{name: "trial succeeds", end: func(b *CircuitBreaker) { b.success(true) }},
+		{name: "trial fails", end: func(b *CircuitBreaker) { b.failure(true) }, wantOpen: true},
+		{name: "trial released", end: func(b *CircuitBreaker) { b.release(true) }, wantTrial: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			breaker := NewCircuitBreaker(1, 10*time.Millisecond)
+			breaker.failure(false)
+			var openErr *CircuitOpenError
+			if _, err := breaker.allow(ctx); !errors.As(err, &openErr) {
+				t.Fatalf("allow() during cooldown = %v, want CircuitOpenError", err)
+			}
+			time.Sleep(20 * time.Millisecond)
+			if trial, err := breaker.allow(ctx); !trial || err != nil {
+				t.Fatalf("allow() after cooldown = %t, %v, want trial", trial, err)
+			}
+
+			type result struct {
+				trial bool
+				err   error
+			}
+			waiter := make(chan result, 1)
+			go func() {
+				trial, err := breaker.allow(ctx)
+				waiter <- result{trial, err}
+			}()
+			select {
+			case r := <-waiter:
+				t.Fatalf("allow() during trial = %t, %v, want to wait", r.trial, r.err)
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			tt.end(breaker)
+			r := <-waiter
+			if open := errors.As(r.err, &openErr); open != tt.wantOpen {
+				t.Errorf("circuit open = %t, want %t (error %v)", open, tt.wantOpen, r.err)
+			}
+			if r.trial != tt.wantTrial {
+				t.Errorf("waiter trial = %t, want %t", r.trial, tt.wantTrial)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	s := &retryingService{policy: RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second, MaxDelay: time.Minute}}
+	retryAfter := 7 * time.Second
+	withRetryAfter := response(http.StatusServiceUnavailable)
+	withRetryAfter.Header.Set("Retry-After", "3")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		resp      *github.Response
+		err       error
+		wantRetry bool
+		wantMin   time.Duration
+		wantMax   time.Duration
+	}{
+		{name: "server error", resp: response(http.StatusBadGateway), err: errors.New("bad gateway"), wantRetry: true, wantMin: 500 * time.Millisecond, wantMax: time.Second},
+		{name: "retry after", resp: withRetryAfter, err: errors.New("unavailable"), wantRetry: true, wantMin: 3 * time.Second, wantMax: 3 * time.Second},
+		{name: "too many requests", resp: response(http.StatusTooManyRequests), err: errors.New("slow down"), wantRetry: true, wantMin: 500 * time.Millisecond, wantMax: time.Second},
+		{name: "secondary rate limit", err: &github.AbuseRateLimitError{RetryAfter: &retryAfter}, wantRetry: true, wantMin: retryAfter, wantMax: retryAfter},
+		{name: "primary rate limit", err: &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: time.Now().Add(10 * time.Second)}}}, wantRetry: true, wantMin: 9 * time.Second, wantMax: 10 * time.Second},
+		{name: "network error", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, wantRetry: true, wantMin: 500 * time.Millisecond, wantMax: time.Second},
+		{name: "not found", resp: response(http.StatusNotFound), err: errors.New("not found")},
+		{name: "other error", err: errors.New("bad request")},
+		{name: "canceled", ctx: canceled, resp: response(http.StatusBadGateway), err: errors.New("bad gateway")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			delay, retry := s.retryDelay(ctx, tt.resp, tt.err, 1)
+			if retry != tt.wantRetry {
+				t.Fatalf("retryDelay() retry = %t, want %t", retry, tt.wantRetry)
+			}
+			if retry && (delay < tt.wantMin || delay > tt.wantMax) {
+				t.Errorf("retryDelay() delay = %s, want between %s and %s", delay, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	s := &retryingService{policy: RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 100 * time.Millisecond},
+		{attempt: 2, want: 200 * time.Millisecond},
+		{attempt: 4, want: 800 * time.Millisecond},
+		{attempt: 5, want: time.Second},
+		{attempt: 80, want: time.Second},
+	}
+	for _, tt := range tests {
+		for range 10 {
+			if d := s.backoff(tt.attempt); d < tt.want/2 || d > tt.want {
+				t.Errorf("backoff(%d) = %s, want between %s and %s", tt.attempt, d, tt.want/2, tt.want)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{value: ""},
+		{value: "garbage"},
+		{value: "120", wantMin: 2 * time.Minute, wantMax: 2 * time.Minute},
+		{value: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), wantMin: 58 * time.Second, wantMax: time.Minute},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got < tt.wantMin || got > tt.wantMax {
+			t.Errorf("parseRetryAfter(%q) = %s, want between %s and %s", tt.value, got, tt.wantMin, tt.wantMax)
+		}
+	}
+}
+
+func TestRetryingServiceAttempts(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	tests := []struct {
+		name      string
+		resp      *github.Response
+		err       error
+		wantCalls int
+	}{
+		{name: "success", wantCalls: 1},
+		{name: "transient", resp: response(http.StatusBadGateway), err: errors.New("bad gateway"), wantCalls: 3},
+		{name: "permanent", resp: response(http.StatusNotFound), err: errors.New("not found"), wantCalls: 1},
+		{name: "wait too long", err: &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: time.Now().Add(time.Hour)}}}, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &fakeService{resp: tt.resp, err: tt.err}
+			_, err := WithRetry(backend, policy, nil).MarkThreadRead(context.Background(), 1)
+			if err != tt.err {
+				t.Errorf("MarkThreadRead() error = %v, want %v", err, tt.err)
+			}
+			if backend.calls != tt.wantCalls {
+				t.Errorf("%d calls, want %d", backend.calls, tt.wantCalls)
+			}
+		})
+	}
+}
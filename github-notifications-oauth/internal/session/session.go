@@ -0,0 +1,88 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// Session is the server-side state kept for a signed-in user.
+type Session struct {
+	Token string
+	// Login is the GitHub login of the user, empty if it couldn't be resolved yet.
+	Login     string
+	CreatedAt time.Time
+	LastSeen  time.Time
+}
+
+// Store keeps sessions in memory, keyed by GitHub access token.
+// It is safe for concurrent use.
+type Store struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*Session
+}
+
+// NewStore creates an empty session store. Sessions not seen for ttl expire;
+// with a ttl of 0 they last until they are deleted.
+func NewStore(ttl time.Duration) *Store {
+	return &Store{ttl: ttl, sessions: make(map[string]*Session)}
+}
+
+// expired reports whether sess has not been seen for the lifetime of sessions.
+func (s *Store) expired(sess *Session, now time.Time) bool {
+	return s.ttl > 0 && now.Sub(sess.LastSeen) >= s.ttl
+}
+
+// Create starts a session for token, replacing any existing one.
+func (s *Store) Create(token, login string) Session {
+	now := time.Now()
+	sess := &Session{Token: token, Login: login, CreatedAt: now, LastSeen: now}
+	s.mu.Lock()
+	s.sessions[token] = sess
+	s.mu.Unlock()
+	return *sess
+}
+
+// Get returns a copy of the session for token and marks it as seen.
+// An expired session is deleted and not returned.
+func (s *Store) Get(token string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	sess, ok := s.sessions[token]
+	if !ok {
+		return Session{}, false
+	}
+	if s.expired(sess, now) {
+		delete(s.sessions, token)
+		return Session{}, false
+	}
+	sess.LastSeen = now
+	return *sess, true
+}
+
+// All returns a copy of every session, deleting the expired ones, without
+// marking them as seen.
+func (s *Store) All() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	all := make([]Session, 0, len(s.sessions))
+	for token, sess := range s.sessions {
+		if s.expired(sess, now) {
+			delete(s.sessions, token)
+			continue
+		}
+		all = append(all, *sess)
+	}
+	return all
+}
+
+// Delete destroys the session for token and reports whether one existed.
+func (s *Store) Delete(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.sessions[token]
+	delete(s.sessions, token)
+	return ok
+}
@@ -0,0 +1,57 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreExpiry(t *testing.T) {
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		idle     time.Duration
+		wantKept bool
+	}{
+		{name: "recently seen", ttl: time.Hour, idle: time.Minute, wantKept: true},
+		{name: "idle too long", ttl: time.Hour, idle: 2 * time.Hour},
+		{name: "no expiry", ttl: 0, idle: 365 * 24 * time.Hour, wantKept: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, lookup := range []string{"Get", "All"} {
+				s := NewStore(tt.ttl)
+				s.Create("token", "octocat")
+				s.sessions["token"].LastSeen = time.Now().Add(-tt.idle)
+
+				var found bool
+				switch lookup {
+				case "Get":
+					_, found = s.Get("token")
+				case "All":
+					found = len(s.All()) == 1
+				}
+				if found != tt.wantKept {
+					t.Errorf("%s() found session = %t, want %t", lookup, found, tt.wantKept)
+				}
+				if _, ok := s.sessions["token"]; ok != tt.wantKept {
+					t.Errorf("after %s() session stored = %t, want %t", lookup, ok, tt.wantKept)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreGetMarksSeen(t *testing.T) {
+	s := NewStore(time.Hour)
+	s.Create("token", "octocat")
+	s.sessions["token"].LastSeen = time.Now().Add(-30 * time.Minute)
+	if _, ok := s.Get("token"); !ok {
+		t.Fatal("Get() found no session")
+	}
+	if idle := time.Since(s.sessions["token"].LastSeen); idle > time.Minute {
+		t.Errorf("session idle for %s after Get(), want it marked as seen", idle)
+	}
+	if !s.Delete("token") || s.Delete("token") {
+		t.Error("Delete() should report whether the session existed")
+	}
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github-notifications-oauth/internal/rules"
+)
+
+// UserData is everything persisted for a single GitHub user.
+type UserData struct {
+	Rules       []rules.Rule `json:"rules,omitempty"`
+	Preferences Preferences  `json:"preferences,omitzero"`
+	// DigestSentAt is when the last email digest was sent.
+	DigestSentAt time.Time `json:"digest_sent_at,omitzero"`
+	// Forwarded maps thread IDs to the update time of the thread when it was
+	// last forwarded, so a thread is only forwarded again after it changed.
+	Forwarded map[string]time.Time `json:"forwarded,omitempty"`
+	// Pins are the IDs of threads shown at the top of notification lists.
+	Pins []int64 `json:"pins,omitempty"`
+}
+
+// Preferences are the settings a user can change through the API.
+type Preferences struct {
+	Digest DigestPreferences `json:"digest"`
+}
+
+// DigestPreferences configure the email digest of unread notifications.
+type DigestPreferences struct {
+	Enabled bool   `json:"enabled"`
+	Email   string `json:"email,omitempty"`
+	// IntervalHours is the time between two digests.
+	IntervalHours int `json:"interval_hours,omitempty"`
+}
+
+// DefaultDigestIntervalHours is used when no digest interval is set.
+const DefaultDigestIntervalHours = 24
+
+// Interval returns the time between two digests.
+func (d DigestPreferences) Interval() time.Duration {
+	if d.IntervalHours <= 0 {
+		return DefaultDigestIntervalHours * time.Hour
+	}
+	return time.Duration(d.IntervalHours) * time.Hour
+}
+
+// clone returns a deep copy so callers can't modify stored data by accident.
+func (u *UserData) clone() UserData {
+	c := *u
+	c.Rules = append([]rules.Rule(nil), u.Rules...)
+	c.Forwarded = maps.Clone(u.Forwarded)
+	c.Pins = slices.Clone(u.Pins)
+	return c
+}
+
+// Store persists per-user data, keyed by GitHub login, in a JSON file.
+// With an empty path the data is only kept in memory.
+// It is safe for concurrent use.
+type Store struct {
+	mu    sync.Mutex
+	path  string
+	users map[string]*UserData
+}
+
+// Open loads the datastore from path, starting empty if the file doesn't exist yet.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, users: make(map[string]*UserData)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read datastore %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, &s.users); err != nil {
+		return nil, fmt.Errorf("could not parse datastore %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// User returns a copy of the data stored for login.
+func (s *Store) User(login string) UserData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[login]; ok {
+		return u.clone()
+	}
+	return UserData{}
+}
+
+// Update applies fn to the data of login and persists the result.
+// If fn returns an error nothing is changed.
+func (s *Store) Update(login string, fn func(*UserData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := UserData{}
+	if existing, ok := s.users[login]; ok {
+		u = existing.clone()
+	}
+	if err := fn(&u); err != nil {
+		return err
+	}
+	previous, existed := s.users[login]
+	s.users[login] = &u
+	if err := s.save(); err != nil {
+		if existed {
+			s.users[login] = previous
+		} else {
+			delete(s.users, login)
+		}
+		return err
+	}
+	return nil
+}
+
+// save writes the datastore atomically. The caller must hold s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.users, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".datastore-*")
+	if err != nil {
+		return fmt.Errorf("could not write datastore: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write datastore: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write datastore: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("could not write datastore: %v", err)
+	}
+	return nil
+}